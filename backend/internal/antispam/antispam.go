@@ -0,0 +1,209 @@
+// Package antispam implements the checks protecting anonymous ballots:
+// proof-of-work challenges, device identifiers and voter name rules
+package antispam
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/bits"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/google/uuid"
+	"doodle-clone/internal/config"
+)
+
+// Difficulty bounds of proof-of-work challenges, in leading zero bits
+const (
+	MinDifficulty     = 8
+	MaxDifficulty     = 24
+	DefaultDifficulty = 18
+)
+
+var (
+	ErrInvalidChallenge = errors.New("invalid proof-of-work challenge")
+	ErrChallengeExpired = errors.New("proof-of-work challenge expired")
+	ErrInvalidSolution  = errors.New("invalid proof-of-work solution")
+)
+
+// Challenge is a signed proof-of-work puzzle bound to a poll.
+// The client must find a Solution such that SHA-256(Token + ":" + Solution)
+// starts with Difficulty zero bits.
+type Challenge struct {
+	Token      string    `json:"challenge"`
+	Difficulty int       `json:"difficulty"`
+	ExpiresAt  time.Time `json:"expires_at"`
+}
+
+var (
+	secretOnce sync.Once
+	secret     []byte
+)
+
+// Secret returns the key signing challenges and hashing device identifiers.
+// Without ANTISPAM_SECRET a random key is used, so challenges do not survive a restart
+// and are not shared between replicas.
+func Secret() []byte {
+	secretOnce.Do(func() {
+		if config.AppConfig != nil && config.AppConfig.AntiSpamSecret != "" {
+			secret = []byte(config.AppConfig.AntiSpamSecret)
+			return
+		}
+		secret = make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			panic("antispam: " + err.Error())
+		}
+	})
+	return secret
+}
+
+// NewChallenge creates a challenge for pollID, signed with secret
+func NewChallenge(secret []byte, pollID uuid.UUID, difficulty int, ttl time.Duration) (Challenge, error) {
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return Challenge{}, err
+	}
+
+	expiresAt := time.Now().Add(ttl).Truncate(time.Second)
+	payload := strings.Join([]string{
+		pollID.String(),
+		strconv.Itoa(difficulty),
+		strconv.FormatInt(expiresAt.Unix(), 10),
+		hex.EncodeToString(nonce),
+	}, "|")
+
+	token := base64.RawURLEncoding.EncodeToString([]byte(payload)) + "." + sign(secret, payload)
+	return Challenge{Token: token, Difficulty: difficulty, ExpiresAt: expiresAt}, nil
+}
+
+// Verify checks a solved challenge for pollID and returns its nonce,
+// which callers store to refuse a second ballot with the same challenge
+func Verify(secret []byte, pollID uuid.UUID, token, solution string, now time.Time) (string, error) {
+	encoded, signature, ok := strings.Cut(token, ".")
+	if !ok {
+		return "", ErrInvalidChallenge
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", ErrInvalidChallenge
+	}
+	payload := string(raw)
+	if !hmac.Equal([]byte(signature), []byte(sign(secret, payload))) {
+		return "", ErrInvalidChallenge
+	}
+
+	parts := strings.Split(payload, "|")
+	if len(parts) != 4 || parts[0] != pollID.String() {
+		return "", ErrInvalidChallenge
+	}
+	difficulty, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return "", ErrInvalidChallenge
+	}
+	expiresAt, err := strconv.ParseInt(parts[2], 10, 64)
+	if err != nil {
+		return "", ErrInvalidChallenge
+	}
+	if now.Unix() > expiresAt {
+		return "", ErrChallengeExpired
+	}
+
+	if solution == "" || len(solution) > 64 {
+		return "", ErrInvalidSolution
+	}
+	sum := sha256.Sum256([]byte(token + ":" + solution))
+	if LeadingZeroBits(sum[:]) < difficulty {
+		return "", ErrInvalidSolution
+	}
+
+	return parts[3], nil
+}
+
+// Solve finds a solution to a challenge by brute force. It mirrors what clients do
+// and is meant for tests and scripts.
+func Solve(c Challenge) string {
+	for i := 0; ; i++ {
+		solution := strconv.Itoa(i)
+		sum := sha256.Sum256([]byte(c.Token + ":" + solution))
+		if LeadingZeroBits(sum[:]) >= c.Difficulty {
+			return solution
+		}
+	}
+}
+
+// LeadingZeroBits counts the zero bits at the start of b
+func LeadingZeroBits(b []byte) int {
+	n := 0
+	for _, x := range b {
+		if x != 0 {
+			return n + bits.LeadingZeros8(x)
+		}
+		n += 8
+	}
+	return n
+}
+
+func sign(secret []byte, payload string) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// HashDevice hashes a device cookie or client fingerprint before it is stored
+func HashDevice(secret []byte, value string) string {
+	if value == "" {
+		return ""
+	}
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(value))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// NewDeviceID returns a random identifier for the device cookie
+func NewDeviceID() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// NormalizeName folds a voter name for comparisons: lower case, letters and digits only,
+// so that "Jean-Marc ", "jean marc" and "JEAN.MARC" are the same name
+func NormalizeName(name string) string {
+	var sb strings.Builder
+	for _, r := range strings.ToLower(name) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			sb.WriteRune(r)
+		}
+	}
+	return sb.String()
+}
+
+// BlockedName returns the blocklist entry matched by name, if any.
+// Entries match anywhere in the normalized name.
+func BlockedName(name string, blocklist []string) (string, bool) {
+	normalized := NormalizeName(name)
+	for _, entry := range blocklist {
+		if e := NormalizeName(entry); e != "" && strings.Contains(normalized, e) {
+			return entry, true
+		}
+	}
+	return "", false
+}
+
+// ValidateDifficulty checks that a difficulty is within bounds
+func ValidateDifficulty(difficulty int) error {
+	if difficulty < MinDifficulty || difficulty > MaxDifficulty {
+		return fmt.Errorf("difficulty must be between %d and %d", MinDifficulty, MaxDifficulty)
+	}
+	return nil
+}
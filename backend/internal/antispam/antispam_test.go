@@ -0,0 +1,93 @@
+package antispam
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testSecret = []byte("test-secret")
+
+func TestChallenge(t *testing.T) {
+	pollID := uuid.New()
+	c, err := NewChallenge(testSecret, pollID, 10, time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, 10, c.Difficulty)
+
+	solution := Solve(c)
+
+	t.Run("Valid solution", func(t *testing.T) {
+		nonce, err := Verify(testSecret, pollID, c.Token, solution, time.Now())
+		require.NoError(t, err)
+		assert.Len(t, nonce, 32)
+	})
+
+	t.Run("Wrong solution", func(t *testing.T) {
+		// Find a string that does not solve the challenge
+		wrong := "x"
+		for {
+			if _, err := Verify(testSecret, pollID, c.Token, wrong, time.Now()); err != nil {
+				assert.ErrorIs(t, err, ErrInvalidSolution)
+				break
+			}
+			wrong += "x"
+		}
+	})
+
+	t.Run("Other poll", func(t *testing.T) {
+		_, err := Verify(testSecret, uuid.New(), c.Token, solution, time.Now())
+		assert.ErrorIs(t, err, ErrInvalidChallenge)
+	})
+
+	t.Run("Expired", func(t *testing.T) {
+		_, err := Verify(testSecret, pollID, c.Token, solution, time.Now().Add(2*time.Minute))
+		assert.ErrorIs(t, err, ErrChallengeExpired)
+	})
+
+	t.Run("Other secret", func(t *testing.T) {
+		_, err := Verify([]byte("other"), pollID, c.Token, solution, time.Now())
+		assert.ErrorIs(t, err, ErrInvalidChallenge)
+	})
+
+	t.Run("Tampered payload", func(t *testing.T) {
+		encoded, sig, _ := strings.Cut(c.Token, ".")
+		tampered := strings.Replace(encoded, encoded[:4], "AAAA", 1) + "." + sig
+		_, err := Verify(testSecret, pollID, tampered, solution, time.Now())
+		assert.ErrorIs(t, err, ErrInvalidChallenge)
+	})
+}
+
+func TestLeadingZeroBits(t *testing.T) {
+	assert.Equal(t, 0, LeadingZeroBits([]byte{0x80}))
+	assert.Equal(t, 7, LeadingZeroBits([]byte{0x01}))
+	assert.Equal(t, 12, LeadingZeroBits([]byte{0x00, 0x08}))
+	assert.Equal(t, 16, LeadingZeroBits([]byte{0x00, 0x00}))
+}
+
+func TestNames(t *testing.T) {
+	assert.Equal(t, "jeanmarc", NormalizeName(" Jean-Marc "))
+	assert.Equal(t, NormalizeName("JEAN.MARC"), NormalizeName("jean marc"))
+	assert.Equal(t, "élodie", NormalizeName("Élodie!"))
+
+	blocklist := []string{"admin", "Bot ", ""}
+	entry, blocked := BlockedName("The A.D.M.I.N", blocklist)
+	assert.True(t, blocked)
+	assert.Equal(t, "admin", entry)
+
+	_, blocked = BlockedName("Robotnik", blocklist)
+	assert.True(t, blocked)
+
+	_, blocked = BlockedName("Alice", blocklist)
+	assert.False(t, blocked)
+}
+
+func TestHashDevice(t *testing.T) {
+	assert.Empty(t, HashDevice(testSecret, ""))
+	assert.Equal(t, HashDevice(testSecret, "abc"), HashDevice(testSecret, "abc"))
+	assert.NotEqual(t, HashDevice(testSecret, "abc"), HashDevice([]byte("other"), "abc"))
+	assert.Len(t, HashDevice(testSecret, "abc"), 64)
+}
@@ -0,0 +1,229 @@
+// Package audit writes the append-only history of mutations on polls, votes,
+// comments and accounts
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"net/netip"
+	"reflect"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// Actions recorded in audit_log, as "<target>.<verb>"
+const (
+	ActionRegister          = "auth.register"
+	ActionLogin             = "auth.login"
+	ActionLogout            = "auth.logout"
+	ActionProfileUpdate     = "auth.profile_update"
+	ActionPasswordChange    = "auth.password_change"
+	ActionSessionRevoke     = "auth.session_revoke"
+	ActionAccessTokenCreate = "auth.token_create"
+	ActionAccessTokenRevoke = "auth.token_revoke"
+	ActionFeedCreate        = "auth.feed_create"
+	ActionFeedRevoke        = "auth.feed_revoke"
+	ActionCalDAVConnect     = "auth.caldav_connect"
+	ActionCalDAVDisconnect  = "auth.caldav_disconnect"
+	ActionAccountDelete     = "auth.account_delete"
+
+	ActionPollCreate           = "poll.create"
+	ActionPollUpdate           = "poll.update"
+	ActionPollDelete           = "poll.delete"
+	ActionPollFinalDate        = "poll.final_date"
+	ActionPollDateAdd          = "poll.date_add"
+	ActionPollDateImport       = "poll.date_import"
+	ActionPollRevert           = "poll.revert"
+	ActionPollProtectionUpdate = "poll.protection_update"
+
+	ActionVoteCreate   = "vote.create"
+	ActionVoteUpdate   = "vote.update"
+	ActionVoteDelete   = "vote.delete"
+	ActionBallotFlag   = "ballot.flag"
+	ActionBallotDelete = "ballot.delete"
+
+	ActionCommentCreate = "comment.create"
+	ActionCommentUpdate = "comment.update"
+	ActionCommentDelete = "comment.delete"
+
+	ActionWebhookCreate = "webhook.create"
+	ActionWebhookUpdate = "webhook.update"
+	ActionWebhookDelete = "webhook.delete"
+)
+
+// Target types
+const (
+	TargetUser    = "user"
+	TargetPoll    = "poll"
+	TargetVote    = "vote"
+	TargetBallot  = "ballot"
+	TargetComment = "comment"
+	TargetSession = "session"
+	TargetToken   = "access_token"
+	TargetFeed    = "calendar_feed"
+	TargetCalDAV  = "caldav_account"
+	TargetWebhook = "webhook"
+)
+
+// Redacted replaces the value of a personal field in the log
+const Redacted = "[redacted]"
+
+// personalFields are never written with their values, at any depth of the changes:
+// entries cannot be erased, so they only record that such a field changed
+var personalFields = map[string]bool{
+	"name":      true,
+	"email":     true,
+	"user_name": true,
+	"username":  true,
+	"content":   true,
+}
+
+// Execer is implemented by both *pgxpool.Pool and pgx.Tx, so entries can be written
+// in the transaction of the mutation they describe
+type Execer interface {
+	Exec(ctx context.Context, sql string, arguments ...any) (pgconn.CommandTag, error)
+}
+
+// Change is the old and new value of a field
+type Change struct {
+	Old any `json:"old"`
+	New any `json:"new"`
+}
+
+// Entry is one line of the audit log
+type Entry struct {
+	ActorID    *uuid.UUID // nil for anonymous voters
+	Action     string
+	TargetType string
+	TargetID   string
+	PollID     *uuid.UUID // Poll the entry belongs to, for the activity feed
+	Changes    map[string]Change
+	IPAddress  string
+	RequestID  string
+}
+
+// Record appends e to the audit log, with personal fields redacted and the IP truncated
+func Record(ctx context.Context, db Execer, e Entry) error {
+	var changes []byte
+	if len(e.Changes) > 0 {
+		var err error
+		if changes, err = redact(e.Changes); err != nil {
+			return err
+		}
+	}
+
+	_, err := db.Exec(ctx, `
+		INSERT INTO audit_log (actor_id, action, target_type, target_id, poll_id, changes, ip_address, request_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	`, e.ActorID, e.Action, e.TargetType, e.TargetID, e.PollID, changes, MaskIP(e.IPAddress), e.RequestID)
+	return err
+}
+
+// MaskIP truncates an address to its network, /24 for IPv4 and /48 for IPv6:
+// enough to spot abuse from a network without identifying a subscriber
+func MaskIP(ip string) string {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return ""
+	}
+	bits := 48
+	if addr = addr.Unmap(); addr.Is4() {
+		bits = 24
+	}
+	prefix, err := addr.WithZone("").Prefix(bits)
+	if err != nil {
+		return ""
+	}
+	return prefix.Addr().String()
+}
+
+// redact marshals changes with the values of personal fields replaced by Redacted
+func redact(changes map[string]Change) ([]byte, error) {
+	data, err := json.Marshal(changes)
+	if err != nil {
+		return nil, err
+	}
+	var decoded map[string]Change
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return nil, err
+	}
+	for field, change := range decoded {
+		decoded[field] = Change{
+			Old: redactValue(change.Old, personalFields[field]),
+			New: redactValue(change.New, personalFields[field]),
+		}
+	}
+	return json.Marshal(decoded)
+}
+
+// redactValue redacts v if it is personal, or the personal fields nested in it.
+// A null stays null, so creations and deletions still read as such.
+func redactValue(v any, personal bool) any {
+	if v == nil {
+		return nil
+	}
+	if personal {
+		return Redacted
+	}
+	switch v := v.(type) {
+	case map[string]any:
+		for k, child := range v {
+			v[k] = redactValue(child, personalFields[k])
+		}
+	case []any:
+		for i, child := range v {
+			v[i] = redactValue(child, false)
+		}
+	}
+	return v
+}
+
+// Diff compares the JSON fields of two snapshots (structs or maps) and returns those
+// that differ. A nil before describes a creation, a nil after a deletion.
+func Diff(before, after any) map[string]Change {
+	old, err := fields(before)
+	if err != nil {
+		return nil
+	}
+	cur, err := fields(after)
+	if err != nil {
+		return nil
+	}
+
+	keys := make(map[string]bool)
+	for k := range old {
+		keys[k] = true
+	}
+	for k := range cur {
+		keys[k] = true
+	}
+
+	changes := make(map[string]Change)
+	for k := range keys {
+		if !reflect.DeepEqual(old[k], cur[k]) {
+			changes[k] = Change{Old: old[k], New: cur[k]}
+		}
+	}
+	return changes
+}
+
+// fields flattens a snapshot into its JSON fields
+func fields(v any) (map[string]any, error) {
+	if v == nil {
+		return map[string]any{}, nil
+	}
+	if rv := reflect.ValueOf(v); (rv.Kind() == reflect.Pointer || rv.Kind() == reflect.Map) && rv.IsNil() {
+		return map[string]any{}, nil
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	m := map[string]any{}
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
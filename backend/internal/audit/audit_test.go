@@ -0,0 +1,75 @@
+package audit
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type pollSnapshot struct {
+	Title    string  `json:"title"`
+	Location string  `json:"location"`
+	Expires  *string `json:"expires_at"`
+}
+
+func TestDiff(t *testing.T) {
+	expires := "2026-03-01T10:00:00Z"
+	before := pollSnapshot{Title: "Réunion", Location: "Bureau A"}
+	after := pollSnapshot{Title: "Réunion d'équipe", Location: "Bureau A", Expires: &expires}
+
+	changes := Diff(before, after)
+	assert.Len(t, changes, 2)
+	assert.Equal(t, Change{Old: "Réunion", New: "Réunion d'équipe"}, changes["title"])
+	assert.Equal(t, Change{Old: nil, New: expires}, changes["expires_at"])
+
+	t.Run("Creation", func(t *testing.T) {
+		changes := Diff(nil, map[string]any{"response": "yes"})
+		assert.Equal(t, Change{Old: nil, New: "yes"}, changes["response"])
+
+		var none map[string]any
+		assert.Equal(t, changes, Diff(none, map[string]any{"response": "yes"}))
+	})
+
+	t.Run("Deletion", func(t *testing.T) {
+		var none *pollSnapshot
+		changes := Diff(&before, none)
+		assert.Len(t, changes, 2) // expires_at was already null
+		assert.Equal(t, Change{Old: "Bureau A", New: nil}, changes["location"])
+	})
+
+	t.Run("No change", func(t *testing.T) {
+		assert.Empty(t, Diff(before, before))
+	})
+}
+
+func TestRedact(t *testing.T) {
+	data, err := redact(map[string]Change{
+		"name":     {Old: "Alice", New: "Alicia"},
+		"email":    {Old: nil, New: "alice@example.com"},
+		"response": {Old: "no", New: "yes"},
+		"votes": {Old: []map[string]any{
+			{"user_name": "Bob", "user_id": "42", "response": "yes"},
+		}},
+	})
+	assert.NoError(t, err)
+
+	var changes map[string]Change
+	assert.NoError(t, json.Unmarshal(data, &changes))
+	assert.Equal(t, Change{Old: Redacted, New: Redacted}, changes["name"])
+	assert.Equal(t, Change{Old: nil, New: Redacted}, changes["email"], "a creation stays a creation")
+	assert.Equal(t, Change{Old: "no", New: "yes"}, changes["response"])
+	assert.Equal(t, []any{
+		map[string]any{"user_name": Redacted, "user_id": "42", "response": "yes"},
+	}, changes["votes"].Old)
+	assert.NotContains(t, string(data), "Alice")
+	assert.NotContains(t, string(data), "Bob")
+}
+
+func TestMaskIP(t *testing.T) {
+	assert.Equal(t, "203.0.113.0", MaskIP("203.0.113.42"))
+	assert.Equal(t, "203.0.113.0", MaskIP("::ffff:203.0.113.42"))
+	assert.Equal(t, "2001:db8:85a3::", MaskIP("2001:db8:85a3:8d3:1319:8a2e:370:7348"))
+	assert.Equal(t, "", MaskIP("not an ip"))
+	assert.Equal(t, "", MaskIP(""))
+}
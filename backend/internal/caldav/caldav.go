@@ -0,0 +1,238 @@
+// Package caldav reads the busy times of a calendar on a CalDAV server (RFC 4791)
+package caldav
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"doodle-clone/internal/ical"
+)
+
+// ErrUnauthorized is returned when the server rejects the credentials
+var ErrUnauthorized = errors.New("the CalDAV server rejected the credentials")
+
+// ErrNotCalendar is returned when the URL is not a calendar collection
+var ErrNotCalendar = errors.New("the URL is not a CalDAV calendar")
+
+const (
+	// Only the start of an error answer is kept
+	maxErrorBody = 512
+	// Answers are read up to this size
+	maxResponseBody = 10 << 20
+	// Occurrences of the events of one calendar-query answer
+	maxOccurrences = 10000
+)
+
+// Account is the calendar collection of a user and their credentials
+type Account struct {
+	URL      string
+	Username string
+	Password string
+}
+
+// Client queries CalDAV servers
+type Client struct {
+	http *http.Client
+}
+
+// NewClient returns a client sending its requests with httpClient
+func NewClient(httpClient *http.Client) *Client {
+	return &Client{http: httpClient}
+}
+
+// ValidateURL checks that a calendar URL is an absolute http(s) URL without credentials
+func ValidateURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return err
+	}
+	if u.Scheme != "https" && u.Scheme != "http" {
+		return errors.New("calendar URL must use http or https")
+	}
+	if u.Hostname() == "" {
+		return errors.New("calendar URL must have a host")
+	}
+	if u.User != nil {
+		return errors.New("calendar URL must not contain credentials")
+	}
+	return nil
+}
+
+// multistatus is a WebDAV multi-status answer. Elements are matched on their local
+// name, servers using various prefixes.
+type multistatus struct {
+	Responses []struct {
+		Href     string `xml:"href"`
+		Propstat []struct {
+			Status string `xml:"status"`
+			Prop   struct {
+				ResourceType struct {
+					Calendar *struct{} `xml:"calendar"`
+				} `xml:"resourcetype"`
+				CalendarData string `xml:"calendar-data"`
+			} `xml:"prop"`
+		} `xml:"propstat"`
+	} `xml:"response"`
+}
+
+// Verify checks that the account is a calendar collection the credentials give access to
+func (c *Client) Verify(ctx context.Context, a Account) error {
+	body := `<?xml version="1.0" encoding="utf-8"?>
+<d:propfind xmlns:d="DAV:"><d:prop><d:resourcetype/></d:prop></d:propfind>`
+	resp, err := c.do(ctx, a, "PROPFIND", "0", body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusMultiStatus {
+		return statusError(resp)
+	}
+
+	var ms multistatus
+	if err := xml.NewDecoder(io.LimitReader(resp.Body, maxResponseBody)).Decode(&ms); err != nil {
+		return fmt.Errorf("invalid PROPFIND answer: %w", err)
+	}
+	for _, r := range ms.Responses {
+		for _, ps := range r.Propstat {
+			if ps.Prop.ResourceType.Calendar != nil {
+				return nil
+			}
+		}
+	}
+	return ErrNotCalendar
+}
+
+// FreeBusy returns the busy times of the calendar between from and to. It asks for the
+// free-busy report, which tells nothing of the events; servers that do not implement it
+// are asked for the events of the period instead.
+func (c *Client) FreeBusy(ctx context.Context, a Account, from, to time.Time) ([]ical.Period, error) {
+	body := fmt.Sprintf(`<?xml version="1.0" encoding="utf-8"?>
+<c:free-busy-query xmlns:c="urn:ietf:params:xml:ns:caldav"><c:time-range start="%s" end="%s"/></c:free-busy-query>`,
+		ical.FormatTime(from), ical.FormatTime(to))
+	resp, err := c.do(ctx, a, "REPORT", "1", body)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusUnauthorized:
+		return nil, ErrUnauthorized
+	case resp.StatusCode == http.StatusOK && strings.HasPrefix(resp.Header.Get("Content-Type"), "text/calendar"):
+		periods, err := ical.ParseFreeBusy(io.LimitReader(resp.Body, maxResponseBody))
+		if err != nil {
+			return nil, fmt.Errorf("invalid free-busy answer: %w", err)
+		}
+		return clip(periods, from, to), nil
+	}
+	return c.eventBusyTimes(ctx, a, from, to)
+}
+
+// eventBusyTimes reads the busy times from the events of the period, expanding the
+// recurring ones. Transparent and cancelled events are left out.
+func (c *Client) eventBusyTimes(ctx context.Context, a Account, from, to time.Time) ([]ical.Period, error) {
+	body := fmt.Sprintf(`<?xml version="1.0" encoding="utf-8"?>
+<c:calendar-query xmlns:d="DAV:" xmlns:c="urn:ietf:params:xml:ns:caldav">
+  <d:prop><c:calendar-data/></d:prop>
+  <c:filter>
+    <c:comp-filter name="VCALENDAR">
+      <c:comp-filter name="VEVENT"><c:time-range start="%s" end="%s"/></c:comp-filter>
+    </c:comp-filter>
+  </c:filter>
+</c:calendar-query>`, ical.FormatTime(from), ical.FormatTime(to))
+	resp, err := c.do(ctx, a, "REPORT", "1", body)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusMultiStatus {
+		return nil, statusError(resp)
+	}
+
+	var ms multistatus
+	if err := xml.NewDecoder(io.LimitReader(resp.Body, maxResponseBody)).Decode(&ms); err != nil {
+		return nil, fmt.Errorf("invalid calendar-query answer: %w", err)
+	}
+	var periods []ical.Period
+	for _, r := range ms.Responses {
+		for _, ps := range r.Propstat {
+			if strings.TrimSpace(ps.Prop.CalendarData) == "" {
+				continue
+			}
+			events, err := ical.Parse(strings.NewReader(ps.Prop.CalendarData), time.UTC)
+			if err != nil {
+				return nil, fmt.Errorf("invalid event %s: %w", r.Href, err)
+			}
+			for _, e := range events {
+				if e.Transparent || e.Status == ical.StatusCancelled {
+					continue
+				}
+				for _, o := range e.Occurrences(from, to, maxOccurrences-len(periods)) {
+					end := o.Start
+					if o.End != nil {
+						end = *o.End
+					}
+					periods = append(periods, ical.Period{Start: o.Start, End: end})
+				}
+				if len(periods) >= maxOccurrences {
+					return clip(periods, from, to), nil
+				}
+			}
+		}
+	}
+	return clip(periods, from, to), nil
+}
+
+// do sends a WebDAV request to the calendar of the account
+func (c *Client) do(ctx context.Context, a Account, method, depth, body string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, a.URL, bytes.NewBufferString(body))
+	if err != nil {
+		return nil, err
+	}
+	req.SetBasicAuth(a.Username, a.Password)
+	req.Header.Set("Content-Type", "application/xml; charset=utf-8")
+	req.Header.Set("Depth", depth)
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("CalDAV request failed: %w", err)
+	}
+	return resp, nil
+}
+
+// statusError describes an unexpected answer
+func statusError(resp *http.Response) error {
+	switch {
+	case resp.StatusCode == http.StatusUnauthorized:
+		return ErrUnauthorized
+	case resp.StatusCode >= 300 && resp.StatusCode < 400:
+		return fmt.Errorf("the CalDAV server redirected to %s, use that URL", resp.Header.Get("Location"))
+	}
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+	return fmt.Errorf("the CalDAV server answered %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+}
+
+// clip limits periods to [from, to), dropping those outside
+func clip(periods []ical.Period, from, to time.Time) []ical.Period {
+	out := periods[:0]
+	for _, p := range periods {
+		if !p.Start.Before(to) || p.End.Before(from) || (p.End.Equal(from) && !p.Start.Equal(from)) {
+			continue
+		}
+		if p.Start.Before(from) {
+			p.Start = from
+		}
+		if p.End.After(to) {
+			p.End = to
+		}
+		out = append(out, p)
+	}
+	return out
+}
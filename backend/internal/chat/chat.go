@@ -0,0 +1,213 @@
+// Package chat posts poll summaries to Slack or Mattermost incoming webhooks
+package chat
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"doodle-clone/internal/models"
+)
+
+// Kinds of poll messages
+const (
+	KindPollCreated   = "poll_created"
+	KindPollClosing   = "poll_closing"
+	KindPollFinalized = "poll_finalized"
+)
+
+// leaderboardSize is the number of date options listed in a message
+const leaderboardSize = 5
+
+const dateFormat = "02/01/2006 à 15:04"
+
+// Message is an incoming webhook payload, in the Slack format that Mattermost also accepts.
+// User content only goes in attachment titles, fields and fallbacks, which are not parsed
+// for mentions or links.
+type Message struct {
+	Text        string       `json:"text"`
+	Attachments []Attachment `json:"attachments,omitempty"`
+}
+
+// Attachment is a block of a message
+type Attachment struct {
+	Fallback  string  `json:"fallback"`
+	Color     string  `json:"color,omitempty"`
+	Title     string  `json:"title,omitempty"`
+	TitleLink string  `json:"title_link,omitempty"`
+	Text      string  `json:"text,omitempty"`
+	Fields    []Field `json:"fields,omitempty"`
+}
+
+// Field is a labelled value of an attachment
+type Field struct {
+	Title string `json:"title"`
+	Value string `json:"value"`
+	Short bool   `json:"short"`
+}
+
+// PollSummary is what a message tells about a poll
+type PollSummary struct {
+	Title       string
+	Description string
+	Location    string
+	Creator     string
+	URL         string
+	ExpiresAt   *time.Time
+	FinalDate   *uuid.UUID
+	Options     []models.DateOptionWithStats
+}
+
+// Leaderboard returns the date options from most to least popular: yes, then maybe
+// answers, the earliest date first on a tie
+func Leaderboard(options []models.DateOptionWithStats) []models.DateOptionWithStats {
+	ranked := append([]models.DateOptionWithStats(nil), options...)
+	sort.SliceStable(ranked, func(i, j int) bool {
+		a, b := ranked[i], ranked[j]
+		if a.YesCount != b.YesCount {
+			return a.YesCount > b.YesCount
+		}
+		if a.MaybeCount != b.MaybeCount {
+			return a.MaybeCount > b.MaybeCount
+		}
+		return a.StartTime.Before(b.StartTime)
+	})
+	return ranked
+}
+
+// PollMessage formats the message of a poll event
+func PollMessage(kind string, p PollSummary) Message {
+	var text, color string
+	switch kind {
+	case KindPollCreated:
+		text, color = "Nouveau sondage", "#4F46E5"
+	case KindPollClosing:
+		text, color = "Sondage bientôt clos", "#F59E0B"
+	case KindPollFinalized:
+		text, color = "Date retenue", "#10B981"
+	default:
+		text = "Sondage"
+	}
+
+	var fields []Field
+	if p.Creator != "" {
+		fields = append(fields, Field{Title: "Organisateur", Value: p.Creator, Short: true})
+	}
+	if p.Location != "" {
+		fields = append(fields, Field{Title: "Lieu", Value: p.Location, Short: true})
+	}
+	if p.ExpiresAt != nil && kind != KindPollFinalized {
+		fields = append(fields, Field{Title: "Clôture", Value: p.ExpiresAt.Format(dateFormat), Short: true})
+	}
+
+	ranked := Leaderboard(p.Options)
+	if p.FinalDate != nil {
+		for _, o := range ranked {
+			if o.ID == *p.FinalDate {
+				fields = append(fields, Field{Title: "Date retenue", Value: formatRange(o), Short: false})
+			}
+		}
+	}
+	if len(ranked) > 0 {
+		fields = append(fields, Field{Title: "Classement", Value: formatLeaderboard(ranked, p.FinalDate), Short: false})
+	}
+
+	return Message{
+		Text: text,
+		Attachments: []Attachment{{
+			Fallback:  fmt.Sprintf("%s : %s %s", text, p.Title, p.URL),
+			Color:     color,
+			Title:     p.Title,
+			TitleLink: p.URL,
+			Text:      p.Description,
+			Fields:    fields,
+		}},
+	}
+}
+
+// formatLeaderboard lists the top date options with their answers
+func formatLeaderboard(ranked []models.DateOptionWithStats, finalDate *uuid.UUID) string {
+	var b strings.Builder
+	for i, o := range ranked {
+		if i == leaderboardSize {
+			fmt.Fprintf(&b, "… et %d autres dates\n", len(ranked)-leaderboardSize)
+			break
+		}
+		fmt.Fprintf(&b, "%d. %s : %d oui, %d peut-être, %d non", i+1, formatRange(o), o.YesCount, o.MaybeCount, o.NoCount)
+		if finalDate != nil && o.ID == *finalDate {
+			b.WriteString(" (retenue)")
+		}
+		b.WriteString("\n")
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+func formatRange(o models.DateOptionWithStats) string {
+	s := o.StartTime.Format(dateFormat)
+	if o.EndTime != nil {
+		end := o.EndTime.Format("15:04")
+		if !sameDay(o.StartTime, *o.EndTime) {
+			end = o.EndTime.Format(dateFormat)
+		}
+		s += " – " + end
+	}
+	return s
+}
+
+func sameDay(a, b time.Time) bool {
+	ay, am, ad := a.Date()
+	by, bm, bd := b.Date()
+	return ay == by && am == bm && ad == bd
+}
+
+// Client posts messages to an incoming webhook
+type Client struct {
+	url  string
+	http *http.Client
+}
+
+// NewClient creates a client; it is disabled when url is empty
+func NewClient(url string, timeout time.Duration) *Client {
+	return &Client{url: url, http: &http.Client{Timeout: timeout}}
+}
+
+// Enabled tells whether an incoming webhook is configured
+func (c *Client) Enabled() bool {
+	return c != nil && c.url != ""
+}
+
+// Post sends a message. Any answer other than 2xx is an error.
+func (c *Client) Post(ctx context.Context, msg Message) error {
+	if !c.Enabled() {
+		return fmt.Errorf("chat webhook not configured")
+	}
+
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		answer, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("chat webhook answered %d: %s", resp.StatusCode, strings.TrimSpace(string(answer)))
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+package chat
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"doodle-clone/internal/models"
+)
+
+func option(day, yes, maybe, no int) models.DateOptionWithStats {
+	return models.DateOptionWithStats{
+		DateOption: models.DateOption{ID: uuid.New(), StartTime: time.Date(2026, 3, day, 14, 0, 0, 0, time.UTC)},
+		YesCount:   yes,
+		MaybeCount: maybe,
+		NoCount:    no,
+	}
+}
+
+func TestLeaderboard(t *testing.T) {
+	first := option(3, 4, 0, 1)
+	second := option(1, 2, 3, 0)
+	third := option(2, 2, 1, 2)
+	tied := option(4, 2, 1, 0)
+
+	ranked := Leaderboard([]models.DateOptionWithStats{tied, second, third, first})
+	assert.Equal(t, []uuid.UUID{first.ID, second.ID, third.ID, tied.ID},
+		[]uuid.UUID{ranked[0].ID, ranked[1].ID, ranked[2].ID, ranked[3].ID})
+}
+
+func TestPollMessage(t *testing.T) {
+	winner := option(3, 4, 0, 1)
+	other := option(1, 1, 0, 3)
+	msg := PollMessage(KindPollFinalized, PollSummary{
+		Title:     "Réunion <!channel>",
+		Creator:   "Alice",
+		URL:       "http://localhost:5173/poll/ABCD2345",
+		FinalDate: &winner.ID,
+		Options:   []models.DateOptionWithStats{other, winner},
+	})
+
+	assert.Equal(t, "Date retenue", msg.Text, "user content stays out of the parsed text")
+	require.Len(t, msg.Attachments, 1)
+	a := msg.Attachments[0]
+	assert.Equal(t, "Réunion <!channel>", a.Title)
+	assert.Equal(t, "http://localhost:5173/poll/ABCD2345", a.TitleLink)
+
+	fields := map[string]string{}
+	for _, f := range a.Fields {
+		fields[f.Title] = f.Value
+	}
+	assert.Equal(t, "03/03/2026 à 14:00", fields["Date retenue"])
+	assert.Equal(t, "1. 03/03/2026 à 14:00 : 4 oui, 0 peut-être, 1 non (retenue)\n2. 01/03/2026 à 14:00 : 1 oui, 0 peut-être, 3 non",
+		fields["Classement"])
+}
+
+func TestPost(t *testing.T) {
+	var received Message
+	status := http.StatusOK
+	stub := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&received))
+		w.WriteHeader(status)
+		w.Write([]byte("invalid_payload"))
+	}))
+	defer stub.Close()
+
+	client := NewClient(stub.URL, 5*time.Second)
+	require.True(t, client.Enabled())
+
+	msg := PollMessage(KindPollCreated, PollSummary{Title: "Apéro", Options: []models.DateOptionWithStats{option(1, 0, 0, 0)}})
+	require.NoError(t, client.Post(context.Background(), msg))
+	assert.Equal(t, "Nouveau sondage", received.Text)
+	assert.Equal(t, "Apéro", received.Attachments[0].Title)
+
+	status = http.StatusBadRequest
+	err := client.Post(context.Background(), msg)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid_payload")
+
+	assert.False(t, NewClient("", time.Second).Enabled())
+	assert.Error(t, NewClient("", time.Second).Post(context.Background(), msg))
+}
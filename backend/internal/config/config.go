@@ -1,7 +1,10 @@
 package config
 
 import (
+	"errors"
 	"os"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/joho/godotenv"
@@ -22,6 +25,90 @@ type Config struct {
 	JWTExpiry     time.Duration
 	RefreshExpiry time.Duration
 
+	// Asymmetric signing keys (one PEM file per kid) and the kid used to sign
+	JWTKeysDir   string
+	JWTActiveKID string
+	// Keep accepting HS256 tokens signed with JWTSecret until this time during the
+	// migration (zero: never)
+	JWTLegacyHS256Until time.Time
+
+	// Interval between purges of expired refresh tokens
+	TokenCleanupInterval time.Duration
+
+	// Login throttling: failed attempts within LoginFailureWindow before a lockout,
+	// per account and per IP, and how long login attempts are kept for auditing
+	LoginMaxFailures      int
+	LoginMaxFailuresPerIP int
+	LoginFailureWindow    time.Duration
+	LoginLockoutDuration  time.Duration
+	LoginAuditRetention   time.Duration
+
+	// Rate limiting: "memory" or "postgres" (shared between replicas),
+	// and "<limit>/<window>" policies per route group
+	RateLimitBackend string
+	RateLimitDefault string
+	RateLimitAuth    string
+	RateLimitVote    string
+
+	// Addresses or CIDRs of the reverse proxies whose X-Forwarded-For header gives
+	// the client IP. Without any, the IP of the connection is used.
+	TrustedProxies []string
+
+	// Key signing proof-of-work challenges and hashing device identifiers of anonymous voters
+	AntiSpamSecret string
+
+	// Password-protected polls: lifetime of poll access tokens, and wrong passwords
+	// allowed per poll within PollUnlockWindow before unlocking is refused
+	PollAccessExpiry      time.Duration
+	PollUnlockMaxFailures int
+	PollUnlockWindow      time.Duration
+
+	// Live poll events: interval of keep-alive comments, and lifetime of a stream
+	// after which clients reconnect and go through the access checks again
+	EventStreamHeartbeat time.Duration
+	EventStreamMaxAge    time.Duration
+
+	// Webhooks: dispatcher interval, attempts before a delivery fails, request timeout,
+	// whether private addresses may be called, and how long deliveries are logged
+	WebhookInterval          time.Duration
+	WebhookMaxAttempts       int
+	WebhookTimeout           time.Duration
+	WebhookAllowPrivate      bool
+	WebhookDeliveryRetention time.Duration
+
+	// Outbox relay: interval between checks when no event wakes it up, failures before
+	// an event is given up, and how long relayed events are kept
+	OutboxInterval    time.Duration
+	OutboxMaxAttempts int
+	OutboxRetention   time.Duration
+
+	// Chat: Slack or Mattermost incoming webhook receiving poll summaries (disabled when
+	// empty), and how long before a poll expires its closing notice is posted
+	ChatWebhookURL    string
+	ChatClosingNotice time.Duration
+
+	// Notification worker: interval between runs, and attempts before a notification
+	// is left failed for an admin to requeue
+	NotificationInterval    time.Duration
+	NotificationMaxAttempts int
+
+	// Notifications: default backend (auto, smtp, log, memory, webhook or none),
+	// "type=backend" overrides, the file of the log backend (stderr when empty),
+	// and the endpoint and signing secret of the webhook backend
+	NotifyBackend       string
+	NotifyRoutes        string
+	NotifyLogFile       string
+	NotifyWebhookURL    string
+	NotifyWebhookSecret string
+
+	// CalDAV accounts: passphrase encrypting their app passwords (the integration is
+	// disabled without it), interval between syncs of auto-filled votes, request timeout,
+	// and whether servers on private addresses may be reached
+	CalDAVEncryptionKey string
+	CalDAVSyncInterval  time.Duration
+	CalDAVTimeout       time.Duration
+	CalDAVAllowPrivate  bool
+
 	// OAuth
 	GoogleClientID     string
 	GoogleClientSecret string
@@ -39,6 +126,11 @@ type Config struct {
 	SMTPUser     string
 	SMTPPassword string
 	SMTPFrom     string
+
+	// Email templates: language of users without a preference, and a directory
+	// overriding the bundled templates
+	EmailLocale       string
+	EmailTemplatesDir string
 }
 
 var AppConfig *Config
@@ -62,6 +154,61 @@ func Load() error {
 		JWTExpiry:     getDuration("JWT_EXPIRY", 15*time.Minute),
 		RefreshExpiry: getDuration("REFRESH_EXPIRY", 7*24*time.Hour),
 
+		JWTKeysDir:          getEnv("JWT_KEYS_DIR", ""),
+		JWTActiveKID:        getEnv("JWT_ACTIVE_KID", ""),
+		JWTLegacyHS256Until: getTime("JWT_LEGACY_HS256_UNTIL"),
+
+		TokenCleanupInterval: getDuration("TOKEN_CLEANUP_INTERVAL", time.Hour),
+
+		LoginMaxFailures:      getInt("LOGIN_MAX_FAILURES", 5),
+		LoginMaxFailuresPerIP: getInt("LOGIN_MAX_FAILURES_PER_IP", 20),
+		LoginFailureWindow:    getDuration("LOGIN_FAILURE_WINDOW", 15*time.Minute),
+		LoginLockoutDuration:  getDuration("LOGIN_LOCKOUT_DURATION", 15*time.Minute),
+		LoginAuditRetention:   getDuration("LOGIN_AUDIT_RETENTION", 90*24*time.Hour),
+
+		RateLimitBackend: getEnv("RATE_LIMIT_BACKEND", "memory"),
+		RateLimitDefault: getEnv("RATE_LIMIT_DEFAULT", "100/1m"),
+		RateLimitAuth:    getEnv("RATE_LIMIT_AUTH", "20/1m"),
+		RateLimitVote:    getEnv("RATE_LIMIT_VOTE", "20/1m"),
+
+		TrustedProxies: getList("TRUSTED_PROXIES"),
+
+		AntiSpamSecret: getEnv("ANTISPAM_SECRET", ""),
+
+		PollAccessExpiry:      getDuration("POLL_ACCESS_EXPIRY", time.Hour),
+		PollUnlockMaxFailures: getInt("POLL_UNLOCK_MAX_FAILURES", 10),
+		PollUnlockWindow:      getDuration("POLL_UNLOCK_WINDOW", 15*time.Minute),
+
+		EventStreamHeartbeat: getDuration("EVENT_STREAM_HEARTBEAT", 25*time.Second),
+		EventStreamMaxAge:    getDuration("EVENT_STREAM_MAX_AGE", 30*time.Minute),
+
+		WebhookInterval:          getDuration("WEBHOOK_INTERVAL", 5*time.Second),
+		WebhookMaxAttempts:       getInt("WEBHOOK_MAX_ATTEMPTS", 8),
+		WebhookTimeout:           getDuration("WEBHOOK_TIMEOUT", 10*time.Second),
+		WebhookAllowPrivate:      getEnv("WEBHOOK_ALLOW_PRIVATE", "false") == "true",
+		WebhookDeliveryRetention: getDuration("WEBHOOK_DELIVERY_RETENTION", 30*24*time.Hour),
+
+		OutboxInterval:    getDuration("OUTBOX_INTERVAL", 5*time.Second),
+		OutboxMaxAttempts: getInt("OUTBOX_MAX_ATTEMPTS", 10),
+		OutboxRetention:   getDuration("OUTBOX_RETENTION", 7*24*time.Hour),
+
+		ChatWebhookURL:    getEnv("CHAT_WEBHOOK_URL", ""),
+		ChatClosingNotice: getDuration("CHAT_CLOSING_NOTICE", 24*time.Hour),
+
+		NotificationInterval:    getDuration("NOTIFICATION_INTERVAL", time.Minute),
+		NotificationMaxAttempts: getInt("NOTIFICATION_MAX_ATTEMPTS", 5),
+
+		NotifyBackend:       getEnv("NOTIFY_BACKEND", "auto"),
+		NotifyRoutes:        getEnv("NOTIFY_ROUTES", ""),
+		NotifyLogFile:       getEnv("NOTIFY_LOG_FILE", ""),
+		NotifyWebhookURL:    getEnv("NOTIFY_WEBHOOK_URL", ""),
+		NotifyWebhookSecret: getEnv("NOTIFY_WEBHOOK_SECRET", ""),
+
+		CalDAVEncryptionKey: getEnv("CALDAV_ENCRYPTION_KEY", ""),
+		CalDAVSyncInterval:  getDuration("CALDAV_SYNC_INTERVAL", time.Hour),
+		CalDAVTimeout:       getDuration("CALDAV_TIMEOUT", 15*time.Second),
+		CalDAVAllowPrivate:  getEnv("CALDAV_ALLOW_PRIVATE", "false") == "true",
+
 		// OAuth
 		GoogleClientID:     getEnv("GOOGLE_CLIENT_ID", ""),
 		GoogleClientSecret: getEnv("GOOGLE_CLIENT_SECRET", ""),
@@ -79,8 +226,43 @@ func Load() error {
 		SMTPUser:     getEnv("SMTP_USER", ""),
 		SMTPPassword: getEnv("SMTP_PASSWORD", ""),
 		SMTPFrom:     getEnv("SMTP_FROM", "noreply@doodle-clone.com"),
+
+		EmailLocale:       getEnv("EMAIL_LOCALE", "fr"),
+		EmailTemplatesDir: getEnv("EMAIL_TEMPLATES_DIR", ""),
+	}
+
+	return nil
+}
+
+// defaultSecrets are the placeholder secrets shipped in the code and in .env.example
+var defaultSecrets = []string{
+	"",
+	"change-me-in-production",
+	"change-me-in-production-too",
+	"change-this-to-a-random-string-in-production",
+	"change-this-to-another-random-string-in-production",
+}
+
+// Validate rejects configurations that are unsafe to run in production
+func Validate() error {
+	if !IsProduction() {
+		return nil
 	}
 
+	if AppConfig.JWTKeysDir == "" {
+		return errors.New("JWT_KEYS_DIR must be set in production")
+	}
+	if AppConfig.AntiSpamSecret == "" {
+		// A random per-process key breaks challenges across restarts and replicas
+		return errors.New("ANTISPAM_SECRET must be set in production")
+	}
+	if AppConfig.JWTLegacyHS256Until.After(time.Now()) {
+		for _, secret := range defaultSecrets {
+			if AppConfig.JWTSecret == secret {
+				return errors.New("JWT_SECRET is a default value: set a random secret or unset JWT_LEGACY_HS256_UNTIL")
+			}
+		}
+	}
 	return nil
 }
 
@@ -91,6 +273,15 @@ func getEnv(key, defaultValue string) string {
 	return defaultValue
 }
 
+func getInt(key string, defaultValue int) int {
+	if value := os.Getenv(key); value != "" {
+		if i, err := strconv.Atoi(value); err == nil {
+			return i
+		}
+	}
+	return defaultValue
+}
+
 func getDuration(key string, defaultValue time.Duration) time.Duration {
 	if value := os.Getenv(key); value != "" {
 		if duration, err := time.ParseDuration(value); err == nil {
@@ -100,6 +291,27 @@ func getDuration(key string, defaultValue time.Duration) time.Duration {
 	return defaultValue
 }
 
+// getList reads a comma-separated list, nil when unset
+func getList(key string) []string {
+	var list []string
+	for _, item := range strings.Split(os.Getenv(key), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// getTime reads an RFC 3339 time, the zero time when unset or invalid
+func getTime(key string) time.Time {
+	if value := os.Getenv(key); value != "" {
+		if t, err := time.Parse(time.RFC3339, value); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
 // IsProduction returns true if the app is running in production
 func IsProduction() bool {
 	return AppConfig.Environment == "production"
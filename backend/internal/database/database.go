@@ -61,6 +61,21 @@ func RunMigrations() error {
 		createRefreshTokensTable(),
 		createNotificationSettingsTable(),
 		createNotificationsTable(),
+		createPersonalAccessTokensTable(),
+		createLoginAttemptsTable(),
+		createRateLimitBucketsTable(),
+		createPollProtectionsTable(),
+		createPollUnlockFailuresTable(),
+		createAuditLogTable(),
+		createPollVersionsTable(),
+		createWebhooksTable(),
+		createWebhookDeliveriesTable(),
+		createOutboxTable(),
+		createUserNotificationsTable(),
+		createNotificationPreferencesTable(),
+		createCalendarInvitationsTable(),
+		createCalendarFeedsTable(),
+		createCalDAVAccountsTable(),
 	}
 
 	for _, migration := range migrations {
@@ -133,10 +148,209 @@ func RunMigrations() error {
 		}
 	}
 
+	migrateRefreshTokens(ctx)
+	migrateAccountDeletion(ctx)
+	migrateVoteProtection(ctx)
+	migratePollPasswords(ctx)
+	migratePollVersions(ctx)
+	migrateNotificationChannel(ctx)
+	migrateNotificationRetries(ctx)
+	migrateChatClosingNotices(ctx)
+	migrateUserLocale(ctx)
+	migratePollSequence(ctx)
+	migrateVoteSource(ctx)
+
 	log.Println("Database migrations completed successfully")
 	return nil
 }
 
+// migrateRefreshTokens replaces the plaintext token column of older databases
+// with a SHA-256 hash and adds the columns used for rotation and reuse detection
+func migrateRefreshTokens(ctx context.Context) {
+	var plaintextExists bool
+	err := Pool.QueryRow(ctx, `
+		SELECT EXISTS (
+			SELECT FROM information_schema.columns
+			WHERE table_schema = 'public'
+			AND table_name = 'refresh_tokens'
+			AND column_name = 'token'
+		)`).Scan(&plaintextExists)
+	if err == nil && plaintextExists {
+		log.Println("Hashing stored refresh tokens...")
+		_, err = Pool.Exec(ctx, `
+			ALTER TABLE refresh_tokens ADD COLUMN IF NOT EXISTS token_hash VARCHAR(64);
+			ALTER TABLE refresh_tokens ADD COLUMN IF NOT EXISTS family_id UUID;
+			ALTER TABLE refresh_tokens ADD COLUMN IF NOT EXISTS replaced_by UUID;
+			ALTER TABLE refresh_tokens ADD COLUMN IF NOT EXISTS revoked_at TIMESTAMP WITH TIME ZONE;
+
+			UPDATE refresh_tokens
+			SET token_hash = encode(sha256(convert_to(token, 'UTF8')), 'hex'),
+			    family_id = id
+			WHERE token_hash IS NULL;
+
+			ALTER TABLE refresh_tokens ALTER COLUMN token_hash SET NOT NULL;
+			ALTER TABLE refresh_tokens ALTER COLUMN family_id SET NOT NULL;
+			ALTER TABLE refresh_tokens ADD CONSTRAINT refresh_tokens_token_hash_key UNIQUE (token_hash);
+			DROP INDEX IF EXISTS idx_refresh_tokens_token;
+			ALTER TABLE refresh_tokens DROP COLUMN token;
+		`)
+		if err != nil {
+			log.Printf("Warning: failed to hash refresh tokens: %v", err)
+		}
+	}
+
+	_, err = Pool.Exec(ctx, `
+		ALTER TABLE refresh_tokens ADD COLUMN IF NOT EXISTS session_started_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP;
+		ALTER TABLE refresh_tokens ADD COLUMN IF NOT EXISTS user_agent VARCHAR(500);
+		ALTER TABLE refresh_tokens ADD COLUMN IF NOT EXISTS ip_address VARCHAR(64);
+		CREATE INDEX IF NOT EXISTS idx_refresh_tokens_family ON refresh_tokens(family_id);
+	`)
+	if err != nil {
+		log.Printf("Warning: failed to add refresh token session columns: %v", err)
+	}
+}
+
+// migrateAccountDeletion lets polls, votes and comments outlive their author:
+// the foreign keys to users switch from ON DELETE CASCADE to ON DELETE SET NULL
+func migrateAccountDeletion(ctx context.Context) {
+	_, err := Pool.Exec(ctx, `ALTER TABLE polls ADD COLUMN IF NOT EXISTS archived_at TIMESTAMP WITH TIME ZONE;`)
+	if err != nil {
+		log.Printf("Warning: failed to add archived_at column: %v", err)
+	}
+
+	foreignKeys := []struct{ table, column, constraint string }{
+		{"polls", "creator_id", "polls_creator_id_fkey"},
+		{"votes", "user_id", "votes_user_id_fkey"},
+		{"comments", "user_id", "comments_user_id_fkey"},
+	}
+	for _, fk := range foreignKeys {
+		var deleteRule string
+		err := Pool.QueryRow(ctx, `
+			SELECT delete_rule FROM information_schema.referential_constraints
+			WHERE constraint_schema = 'public' AND constraint_name = $1
+		`, fk.constraint).Scan(&deleteRule)
+		if err != nil || deleteRule == "SET NULL" {
+			continue
+		}
+
+		log.Printf("Switching %s.%s to ON DELETE SET NULL...", fk.table, fk.column)
+		_, err = Pool.Exec(ctx, fmt.Sprintf(`
+			ALTER TABLE %[1]s ALTER COLUMN %[2]s DROP NOT NULL;
+			ALTER TABLE %[1]s DROP CONSTRAINT %[3]s;
+			ALTER TABLE %[1]s ADD CONSTRAINT %[3]s FOREIGN KEY (%[2]s) REFERENCES users(id) ON DELETE SET NULL;
+		`, fk.table, fk.column, fk.constraint))
+		if err != nil {
+			log.Printf("Warning: failed to update %s: %v", fk.constraint, err)
+		}
+	}
+}
+
+// migrateVoteProtection adds the ballot, device and moderation columns to votes
+func migrateVoteProtection(ctx context.Context) {
+	_, err := Pool.Exec(ctx, `
+		ALTER TABLE votes ADD COLUMN IF NOT EXISTS ballot_id UUID;
+		ALTER TABLE votes ADD COLUMN IF NOT EXISTS device_hash VARCHAR(64);
+		ALTER TABLE votes ADD COLUMN IF NOT EXISTS fingerprint_hash VARCHAR(64);
+		ALTER TABLE votes ADD COLUMN IF NOT EXISTS pow_nonce VARCHAR(32);
+		ALTER TABLE votes ADD COLUMN IF NOT EXISTS flagged BOOLEAN NOT NULL DEFAULT false;
+		ALTER TABLE votes ADD COLUMN IF NOT EXISTS flag_reason VARCHAR(200);
+		CREATE INDEX IF NOT EXISTS idx_votes_ballot ON votes(poll_id, ballot_id);
+		CREATE INDEX IF NOT EXISTS idx_votes_device ON votes(poll_id, device_hash);
+		CREATE INDEX IF NOT EXISTS idx_votes_pow_nonce ON votes(pow_nonce);
+	`)
+	if err != nil {
+		log.Printf("Warning: failed to add vote protection columns: %v", err)
+	}
+}
+
+// migratePollPasswords adds the password column to polls
+func migratePollPasswords(ctx context.Context) {
+	_, err := Pool.Exec(ctx, `ALTER TABLE polls ADD COLUMN IF NOT EXISTS password_hash VARCHAR(255)`)
+	if err != nil {
+		log.Printf("Warning: failed to add poll password column: %v", err)
+	}
+}
+
+// migrateNotificationChannel adds the delivery channel to notifications
+func migrateNotificationChannel(ctx context.Context) {
+	_, err := Pool.Exec(ctx, `ALTER TABLE notifications ADD COLUMN IF NOT EXISTS channel VARCHAR(20) NOT NULL DEFAULT 'email'`)
+	if err != nil {
+		log.Printf("Warning: failed to add notification channel column: %v", err)
+	}
+}
+
+// migrateNotificationRetries adds the attempt count and retry time of notifications
+func migrateNotificationRetries(ctx context.Context) {
+	_, err := Pool.Exec(ctx, `
+		ALTER TABLE notifications ADD COLUMN IF NOT EXISTS attempts INTEGER NOT NULL DEFAULT 0;
+		ALTER TABLE notifications ADD COLUMN IF NOT EXISTS next_attempt_at TIMESTAMP WITH TIME ZONE;
+		CREATE INDEX IF NOT EXISTS idx_notifications_due ON notifications(COALESCE(next_attempt_at, scheduled_at))
+			WHERE status = 'pending';
+	`)
+	if err != nil {
+		log.Printf("Warning: failed to add notification retry columns: %v", err)
+	}
+}
+
+// migrateChatClosingNotices keeps a single chat closing notice per poll, so that
+// concurrent workers queueing them cannot post twice
+func migrateChatClosingNotices(ctx context.Context) {
+	_, err := Pool.Exec(ctx, `
+		DELETE FROM notifications n USING notifications o
+		WHERE n.poll_id = o.poll_id AND n.channel = 'chat' AND o.channel = 'chat'
+		AND n.type = 'poll_closing' AND o.type = 'poll_closing'
+		AND (n.created_at, n.id) > (o.created_at, o.id);
+		CREATE UNIQUE INDEX IF NOT EXISTS idx_notifications_chat_closing ON notifications(poll_id, type)
+			WHERE channel = 'chat' AND type = 'poll_closing';
+	`)
+	if err != nil {
+		log.Printf("Warning: failed to add chat closing notice index: %v", err)
+	}
+}
+
+// migrateUserLocale adds the email language of users
+func migrateUserLocale(ctx context.Context) {
+	_, err := Pool.Exec(ctx, `ALTER TABLE users ADD COLUMN IF NOT EXISTS locale VARCHAR(10)`)
+	if err != nil {
+		log.Printf("Warning: failed to add user locale column: %v", err)
+	}
+}
+
+// migratePollSequence adds the revision of the calendar event of finalized polls
+func migratePollSequence(ctx context.Context) {
+	_, err := Pool.Exec(ctx, `ALTER TABLE polls ADD COLUMN IF NOT EXISTS ics_sequence INTEGER NOT NULL DEFAULT 0`)
+	if err != nil {
+		log.Printf("Warning: failed to add poll sequence column: %v", err)
+	}
+}
+
+// migrateVoteSource adds the origin of votes filled in from a calendar
+func migrateVoteSource(ctx context.Context) {
+	_, err := Pool.Exec(ctx, `ALTER TABLE votes ADD COLUMN IF NOT EXISTS source VARCHAR(20)`)
+	if err != nil {
+		log.Printf("Warning: failed to add vote source column: %v", err)
+	}
+}
+
+// migratePollVersions records the current state of older polls as their first version
+func migratePollVersions(ctx context.Context) {
+	_, err := Pool.Exec(ctx, `
+		INSERT INTO poll_versions (poll_id, version, title, description, location, expires_at, date_options, reason, created_by)
+		SELECT p.id, 1, p.title, p.description, p.location, p.expires_at,
+		       COALESCE((
+		           SELECT jsonb_agg(jsonb_build_object('id', d.id, 'start_time', d.start_time, 'end_time', d.end_time)
+		                            ORDER BY d.start_time, d.id)
+		           FROM date_options d WHERE d.poll_id = p.id
+		       ), '[]'::jsonb),
+		       'create', p.creator_id
+		FROM polls p
+		WHERE NOT EXISTS (SELECT 1 FROM poll_versions v WHERE v.poll_id = p.id)
+	`)
+	if err != nil {
+		log.Printf("Warning: failed to record initial poll versions: %v", err)
+	}
+}
+
 // Helper function to check if table exists
 func TableExists(ctx context.Context, tableName string) bool {
 	var exists bool
@@ -154,6 +368,21 @@ func TableExists(ctx context.Context, tableName string) bool {
 func DropAllTables() error {
 	ctx := context.Background()
 	tables := []string{
+		"caldav_accounts",
+		"calendar_feeds",
+		"calendar_invitations",
+		"notification_preferences",
+		"user_notifications",
+		"outbox",
+		"webhook_deliveries",
+		"webhooks",
+		"poll_versions",
+		"audit_log",
+		"poll_unlock_failures",
+		"poll_protections",
+		"rate_limit_buckets",
+		"login_attempts",
+		"personal_access_tokens",
 		"refresh_tokens",
 		"comments",
 		"votes",
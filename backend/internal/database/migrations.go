@@ -9,6 +9,7 @@ func createUsersTable() string {
 		name VARCHAR(255) NOT NULL,
 		avatar VARCHAR(500),
 		provider VARCHAR(50) NOT NULL DEFAULT 'email',
+		locale VARCHAR(10), -- Language of emails, EMAIL_LOCALE when NULL
 		created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
 		updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
 	);
@@ -24,7 +25,7 @@ func createPollsTable() string {
 		title VARCHAR(200) NOT NULL,
 		description TEXT,
 		location VARCHAR(500),
-		creator_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		creator_id UUID REFERENCES users(id) ON DELETE SET NULL, -- NULL once the creator deleted their account
 		expires_at TIMESTAMP WITH TIME ZONE,
 		allow_multiple BOOLEAN DEFAULT false,
 		allow_maybe BOOLEAN DEFAULT true,
@@ -32,6 +33,8 @@ func createPollsTable() string {
 		limit_votes BOOLEAN DEFAULT false,
 		max_votes_per_user INTEGER DEFAULT 1,
 		final_date UUID REFERENCES date_options(id) ON DELETE SET NULL,
+		archived_at TIMESTAMP WITH TIME ZONE,
+		password_hash VARCHAR(255), -- bcrypt, NULL when the poll has no password
 		created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
 		updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
 	);
@@ -62,9 +65,15 @@ func createVotesTable() string {
 		id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
 		poll_id UUID NOT NULL REFERENCES polls(id) ON DELETE CASCADE,
 		date_option_id UUID NOT NULL REFERENCES date_options(id) ON DELETE CASCADE,
-		user_id UUID REFERENCES users(id) ON DELETE CASCADE,
+		user_id UUID REFERENCES users(id) ON DELETE SET NULL,
 		user_name VARCHAR(255) NOT NULL,
 		response VARCHAR(10) NOT NULL CHECK (response IN ('yes', 'no', 'maybe')),
+		ballot_id UUID, -- Votes submitted together by an anonymous voter
+		device_hash VARCHAR(64),
+		fingerprint_hash VARCHAR(64),
+		pow_nonce VARCHAR(32),
+		flagged BOOLEAN NOT NULL DEFAULT false,
+		flag_reason VARCHAR(200),
 		created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
 		UNIQUE(poll_id, date_option_id, user_id)
 	);
@@ -81,7 +90,7 @@ func createCommentsTable() string {
 	CREATE TABLE IF NOT EXISTS comments (
 		id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
 		poll_id UUID NOT NULL REFERENCES polls(id) ON DELETE CASCADE,
-		user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		user_id UUID REFERENCES users(id) ON DELETE SET NULL, -- NULL once the author deleted their account
 		content TEXT NOT NULL,
 		created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
 	);
@@ -96,13 +105,18 @@ func createRefreshTokensTable() string {
 	CREATE TABLE IF NOT EXISTS refresh_tokens (
 		id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
 		user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
-		token VARCHAR(500) UNIQUE NOT NULL,
+		token_hash VARCHAR(64) UNIQUE NOT NULL,
+		family_id UUID NOT NULL,
+		replaced_by UUID,
+		revoked_at TIMESTAMP WITH TIME ZONE,
+		session_started_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+		user_agent VARCHAR(500),
+		ip_address VARCHAR(64),
 		expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
 		created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
 	);
 
 	CREATE INDEX IF NOT EXISTS idx_refresh_tokens_user ON refresh_tokens(user_id);
-	CREATE INDEX IF NOT EXISTS idx_refresh_tokens_token ON refresh_tokens(token);
 	CREATE INDEX IF NOT EXISTS idx_refresh_tokens_expires ON refresh_tokens(expires_at);
 	`
 }
@@ -126,8 +140,11 @@ func createNotificationsTable() string {
 		poll_id UUID NOT NULL REFERENCES polls(id) ON DELETE CASCADE,
 		user_id UUID REFERENCES users(id) ON DELETE CASCADE,
 		type VARCHAR(50) NOT NULL,
+		channel VARCHAR(20) NOT NULL DEFAULT 'email',
 		status VARCHAR(20) NOT NULL DEFAULT 'pending',
 		scheduled_at TIMESTAMP WITH TIME ZONE NOT NULL,
+		attempts INTEGER NOT NULL DEFAULT 0,
+		next_attempt_at TIMESTAMP WITH TIME ZONE, -- Retry or claim, scheduled_at when NULL
 		sent_at TIMESTAMP WITH TIME ZONE,
 		error_message TEXT,
 		created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
@@ -139,3 +156,285 @@ func createNotificationsTable() string {
 	CREATE INDEX IF NOT EXISTS idx_notifications_scheduled ON notifications(scheduled_at);
 	`
 }
+
+func createPersonalAccessTokensTable() string {
+	return `
+	CREATE TABLE IF NOT EXISTS personal_access_tokens (
+		id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+		user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		name VARCHAR(100) NOT NULL,
+		token_hash VARCHAR(64) UNIQUE NOT NULL,
+		token_prefix VARCHAR(16) NOT NULL,
+		scopes TEXT[] NOT NULL DEFAULT '{}',
+		expires_at TIMESTAMP WITH TIME ZONE,
+		last_used_at TIMESTAMP WITH TIME ZONE,
+		revoked_at TIMESTAMP WITH TIME ZONE,
+		created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_personal_access_tokens_user ON personal_access_tokens(user_id);
+	`
+}
+
+func createLoginAttemptsTable() string {
+	return `
+	CREATE TABLE IF NOT EXISTS login_attempts (
+		id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+		email VARCHAR(255) NOT NULL,
+		user_id UUID REFERENCES users(id) ON DELETE SET NULL,
+		ip_address VARCHAR(64) NOT NULL,
+		user_agent VARCHAR(500),
+		success BOOLEAN NOT NULL,
+		reason VARCHAR(50), -- invalid_password, unknown_email, throttled...
+		created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_login_attempts_email ON login_attempts(email, created_at);
+	CREATE INDEX IF NOT EXISTS idx_login_attempts_ip ON login_attempts(ip_address, created_at);
+	CREATE INDEX IF NOT EXISTS idx_login_attempts_created ON login_attempts(created_at);
+	`
+}
+
+func createRateLimitBucketsTable() string {
+	return `
+	CREATE TABLE IF NOT EXISTS rate_limit_buckets (
+		key VARCHAR(255) PRIMARY KEY,
+		tokens DOUBLE PRECISION NOT NULL,
+		updated_at TIMESTAMP WITH TIME ZONE NOT NULL,
+		expires_at TIMESTAMP WITH TIME ZONE NOT NULL -- When the bucket is full again
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_rate_limit_buckets_expires ON rate_limit_buckets(expires_at);
+	`
+}
+
+func createPollProtectionsTable() string {
+	return `
+	CREATE TABLE IF NOT EXISTS poll_protections (
+		poll_id UUID PRIMARY KEY REFERENCES polls(id) ON DELETE CASCADE,
+		require_pow BOOLEAN NOT NULL DEFAULT false,
+		pow_difficulty INTEGER NOT NULL DEFAULT 18,
+		one_ballot_per_device BOOLEAN NOT NULL DEFAULT false,
+		block_duplicate_names BOOLEAN NOT NULL DEFAULT false,
+		name_blocklist TEXT[] NOT NULL DEFAULT '{}',
+		updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+	);
+	`
+}
+
+func createPollUnlockFailuresTable() string {
+	return `
+	CREATE TABLE IF NOT EXISTS poll_unlock_failures (
+		id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+		poll_id UUID NOT NULL REFERENCES polls(id) ON DELETE CASCADE,
+		ip_address VARCHAR(64) NOT NULL,
+		created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_poll_unlock_failures_poll ON poll_unlock_failures(poll_id, created_at);
+	`
+}
+
+func createPollVersionsTable() string {
+	return `
+	CREATE TABLE IF NOT EXISTS poll_versions (
+		id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+		poll_id UUID NOT NULL REFERENCES polls(id) ON DELETE CASCADE,
+		version INTEGER NOT NULL,
+		title VARCHAR(200) NOT NULL,
+		description TEXT,
+		location VARCHAR(500),
+		expires_at TIMESTAMP WITH TIME ZONE,
+		date_options JSONB NOT NULL DEFAULT '[]', -- [{"id", "start_time", "end_time"}]
+		reason VARCHAR(20) NOT NULL, -- create, update, date_add, revert
+		reverted_from INTEGER,
+		created_by UUID REFERENCES users(id) ON DELETE SET NULL,
+		created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+		UNIQUE(poll_id, version)
+	);
+	`
+}
+
+func createWebhooksTable() string {
+	return `
+	CREATE TABLE IF NOT EXISTS webhooks (
+		id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+		user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		poll_id UUID REFERENCES polls(id) ON DELETE CASCADE, -- NULL for every poll of the user
+		url TEXT NOT NULL,
+		secret VARCHAR(100) NOT NULL, -- Kept in clear to sign deliveries
+		events TEXT[] NOT NULL DEFAULT '{}', -- Empty for every event
+		description VARCHAR(200),
+		active BOOLEAN NOT NULL DEFAULT true,
+		created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_webhooks_user ON webhooks(user_id);
+	CREATE INDEX IF NOT EXISTS idx_webhooks_poll ON webhooks(poll_id);
+	`
+}
+
+func createWebhookDeliveriesTable() string {
+	return `
+	CREATE TABLE IF NOT EXISTS webhook_deliveries (
+		id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+		webhook_id UUID NOT NULL REFERENCES webhooks(id) ON DELETE CASCADE,
+		event_type VARCHAR(50) NOT NULL,
+		payload JSONB NOT NULL,
+		status VARCHAR(20) NOT NULL DEFAULT 'pending', -- pending, delivered, failed
+		attempts INTEGER NOT NULL DEFAULT 0,
+		next_attempt_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		last_status_code INTEGER,
+		last_error TEXT,
+		last_response TEXT,
+		redelivery_of UUID,
+		delivered_at TIMESTAMP WITH TIME ZONE,
+		created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_due ON webhook_deliveries(next_attempt_at) WHERE status = 'pending';
+	CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_webhook ON webhook_deliveries(webhook_id, created_at);
+	`
+}
+
+func createOutboxTable() string {
+	return `
+	CREATE TABLE IF NOT EXISTS outbox (
+		id BIGSERIAL PRIMARY KEY, -- Relay order
+		poll_id UUID NOT NULL, -- No foreign key: events of deleted polls are still relayed
+		event_type VARCHAR(50) NOT NULL,
+		payload JSONB NOT NULL,
+		attempts INTEGER NOT NULL DEFAULT 0,
+		last_error TEXT,
+		processed_at TIMESTAMP WITH TIME ZONE, -- Relayed, or given up when last_error is set
+		created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_outbox_pending ON outbox(id) WHERE processed_at IS NULL;
+	CREATE INDEX IF NOT EXISTS idx_outbox_processed ON outbox(processed_at);
+	`
+}
+
+func createAuditLogTable() string {
+	return `
+	CREATE TABLE IF NOT EXISTS audit_log (
+		id BIGSERIAL PRIMARY KEY,
+		actor_id UUID, -- No foreign key: entries outlive users and polls
+		action VARCHAR(64) NOT NULL,
+		target_type VARCHAR(32) NOT NULL,
+		target_id VARCHAR(64) NOT NULL,
+		poll_id UUID,
+		changes JSONB, -- {"field": {"old": ..., "new": ...}}
+		ip_address VARCHAR(64),
+		request_id VARCHAR(64),
+		created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_audit_log_created ON audit_log(created_at);
+	CREATE INDEX IF NOT EXISTS idx_audit_log_actor ON audit_log(actor_id, created_at);
+	CREATE INDEX IF NOT EXISTS idx_audit_log_poll ON audit_log(poll_id, created_at);
+	CREATE INDEX IF NOT EXISTS idx_audit_log_target ON audit_log(target_type, target_id);
+
+	-- Append-only: rows can be inserted, never changed or removed
+	CREATE OR REPLACE FUNCTION audit_log_append_only() RETURNS trigger AS $$
+	BEGIN
+		RAISE EXCEPTION 'audit_log is append-only';
+	END;
+	$$ LANGUAGE plpgsql;
+
+	DROP TRIGGER IF EXISTS audit_log_no_update ON audit_log;
+	CREATE TRIGGER audit_log_no_update BEFORE UPDATE OR DELETE ON audit_log
+		FOR EACH ROW EXECUTE FUNCTION audit_log_append_only();
+	DROP TRIGGER IF EXISTS audit_log_no_truncate ON audit_log;
+	CREATE TRIGGER audit_log_no_truncate BEFORE TRUNCATE ON audit_log
+		FOR EACH STATEMENT EXECUTE FUNCTION audit_log_append_only();
+	`
+}
+
+func createUserNotificationsTable() string {
+	return `
+	CREATE TABLE IF NOT EXISTS user_notifications (
+		id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+		user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		poll_id UUID NOT NULL REFERENCES polls(id) ON DELETE CASCADE,
+		type VARCHAR(50) NOT NULL, -- new_vote, new_comment, final_date, poll_changed
+		actors TEXT[] NOT NULL DEFAULT '{}', -- Latest distinct authors of the merged events
+		count INTEGER NOT NULL DEFAULT 1, -- Distinct authors merged while unread
+		read_at TIMESTAMP WITH TIME ZONE,
+		created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+	);
+
+	-- Events of a type on a poll are merged into the unread notification
+	CREATE UNIQUE INDEX IF NOT EXISTS idx_user_notifications_unread ON user_notifications(user_id, poll_id, type)
+		WHERE read_at IS NULL;
+	CREATE INDEX IF NOT EXISTS idx_user_notifications_user ON user_notifications(user_id, updated_at DESC);
+	`
+}
+
+func createNotificationPreferencesTable() string {
+	return `
+	CREATE TABLE IF NOT EXISTS notification_preferences (
+		user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		type VARCHAR(50) NOT NULL,
+		in_app BOOLEAN NOT NULL DEFAULT true,
+		email BOOLEAN NOT NULL DEFAULT true,
+		PRIMARY KEY (user_id, type)
+	);
+	`
+}
+
+func createCalendarInvitationsTable() string {
+	return `
+	CREATE TABLE IF NOT EXISTS calendar_invitations (
+		poll_id UUID NOT NULL, -- No foreign key: the event is cancelled after the poll is deleted
+		user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		organizer_id UUID REFERENCES users(id) ON DELETE SET NULL,
+		sequence INTEGER NOT NULL, -- SEQUENCE of the last invitation sent
+		summary TEXT NOT NULL,
+		start_time TIMESTAMP WITH TIME ZONE NOT NULL,
+		end_time TIMESTAMP WITH TIME ZONE,
+		cancel_at TIMESTAMP WITH TIME ZONE, -- Next attempt to send the cancellation, if due
+		attempts INTEGER NOT NULL DEFAULT 0,
+		error_message TEXT,
+		invited_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (poll_id, user_id)
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_calendar_invitations_cancel ON calendar_invitations(cancel_at)
+		WHERE cancel_at IS NOT NULL;
+	`
+}
+
+func createCalendarFeedsTable() string {
+	return `
+	CREATE TABLE IF NOT EXISTS calendar_feeds (
+		user_id UUID PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+		token_hash VARCHAR(64) UNIQUE NOT NULL,
+		token_prefix VARCHAR(20) NOT NULL,
+		etag VARCHAR(64), -- Hash of the last feed served, which changed at modified_at
+		modified_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+		last_used_at TIMESTAMP WITH TIME ZONE,
+		created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+	);
+	`
+}
+
+func createCalDAVAccountsTable() string {
+	return `
+	CREATE TABLE IF NOT EXISTS caldav_accounts (
+		user_id UUID PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+		url TEXT NOT NULL,
+		username VARCHAR(255) NOT NULL,
+		password_encrypted BYTEA NOT NULL, -- Sealed with CALDAV_ENCRYPTION_KEY and the user ID
+		auto_fill BOOLEAN NOT NULL DEFAULT false,
+		last_sync_at TIMESTAMP WITH TIME ZONE,
+		last_error TEXT,
+		created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_caldav_accounts_sync ON caldav_accounts(last_sync_at) WHERE auto_fill;
+	`
+}
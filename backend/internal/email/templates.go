@@ -0,0 +1,203 @@
+package email
+
+import (
+	"bytes"
+	"embed"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	texttemplate "text/template"
+	"time"
+)
+
+// bundled holds the default templates. Each locale has, per message, a <name>.html
+// template defining "title" and "content" (shown in layout.html) and a <name>.txt
+// template defining "subject", whose body is the plain-text part.
+//
+//go:embed templates
+var bundled embed.FS
+
+// Locales lists the languages emails are written in
+var Locales = []string{"fr", "en"}
+
+// dateTimeLayouts formats dates for each locale
+var dateTimeLayouts = map[string]string{
+	"fr": "02/01/2006 à 15:04 MST",
+	"en": "Jan 2, 2006 at 3:04 PM MST",
+}
+
+// Data is what the templates can show. Everything is escaped in the HTML part.
+type Data struct {
+	Locale        string
+	RecipientName string
+	PollTitle     string
+	URL           string     // Target of the main button: the poll, or the account
+	Date          *time.Time // Final date of the poll, if set
+	IPAddress     string
+	LockedUntil   time.Time
+}
+
+// Rendered is an email ready to send
+type Rendered struct {
+	Subject string
+	HTML    string
+	Text    string
+}
+
+// Templates renders the emails of every locale
+type Templates struct {
+	defaultLocale string
+	html          map[string]*htmltemplate.Template // By "<locale>/<name>"
+	text          map[string]*texttemplate.Template
+}
+
+// LoadTemplates parses the bundled templates, replacing those found in dir when it is not
+// empty: dir/layout.html, dir/fr/new_vote.txt... Files missing from dir keep the default.
+func LoadTemplates(dir, defaultLocale string) (*Templates, error) {
+	if !IsLocale(defaultLocale) {
+		return nil, fmt.Errorf("unknown email locale %q", defaultLocale)
+	}
+
+	defaults, err := fs.Sub(bundled, "templates")
+	if err != nil {
+		return nil, err
+	}
+	read := func(name string) (string, error) {
+		if dir != "" {
+			b, err := os.ReadFile(path.Join(dir, name))
+			if err == nil {
+				return string(b), nil
+			}
+			if !errors.Is(err, fs.ErrNotExist) {
+				return "", err
+			}
+		}
+		b, err := fs.ReadFile(defaults, name)
+		return string(b), err
+	}
+
+	layout, err := read("layout.html")
+	if err != nil {
+		return nil, err
+	}
+
+	t := &Templates{
+		defaultLocale: defaultLocale,
+		html:          map[string]*htmltemplate.Template{},
+		text:          map[string]*texttemplate.Template{},
+	}
+	for _, locale := range Locales {
+		funcs := map[string]any{"datetime": dateTimeFormatter(locale)}
+
+		common, err := read(path.Join(locale, "common.html"))
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range TemplateNames() {
+			key := locale + "/" + name
+
+			body, err := read(key + ".html")
+			if err != nil {
+				return nil, err
+			}
+			h := htmltemplate.New(name).Funcs(funcs)
+			for _, src := range []string{layout, common, body} {
+				if h, err = h.Parse(src); err != nil {
+					return nil, fmt.Errorf("invalid template %s.html: %w", key, err)
+				}
+			}
+
+			text, err := read(key + ".txt")
+			if err != nil {
+				return nil, err
+			}
+			tt, err := texttemplate.New(name).Funcs(funcs).Parse(text)
+			if err != nil {
+				return nil, fmt.Errorf("invalid template %s.txt: %w", key, err)
+			}
+			if tt.Lookup("subject") == nil {
+				return nil, fmt.Errorf("template %s.txt does not define a subject", key)
+			}
+
+			t.html[key], t.text[key] = h, tt
+		}
+	}
+	return t, nil
+}
+
+// TemplateNames lists the messages with a template, named after their notification type
+func TemplateNames() []string {
+	entries, _ := fs.ReadDir(bundled, "templates/"+Locales[0])
+	var names []string
+	for _, e := range entries {
+		if name, ok := strings.CutSuffix(e.Name(), ".txt"); ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// IsLocale checks if emails can be written in locale
+func IsLocale(locale string) bool {
+	for _, l := range Locales {
+		if l == locale {
+			return true
+		}
+	}
+	return false
+}
+
+// Locale returns the supported locale closest to a user preference ("en-GB" gives "en"),
+// or the default one
+func (t *Templates) Locale(preference string) string {
+	preference = strings.ToLower(strings.TrimSpace(preference))
+	if i := strings.IndexAny(preference, "-_"); i >= 0 {
+		preference = preference[:i]
+	}
+	if IsLocale(preference) {
+		return preference
+	}
+	return t.defaultLocale
+}
+
+// Render writes a message in the locale closest to data.Locale
+func (t *Templates) Render(name string, data Data) (*Rendered, error) {
+	data.Locale = t.Locale(data.Locale)
+	key := data.Locale + "/" + name
+	h, ok := t.html[key]
+	if !ok {
+		return nil, fmt.Errorf("unknown email template %q", name)
+	}
+
+	var subject, text, html bytes.Buffer
+	if err := t.text[key].ExecuteTemplate(&subject, "subject", data); err != nil {
+		return nil, fmt.Errorf("failed to render subject of %s: %w", key, err)
+	}
+	if err := t.text[key].Execute(&text, data); err != nil {
+		return nil, fmt.Errorf("failed to render text of %s: %w", key, err)
+	}
+	if err := h.ExecuteTemplate(&html, "layout", data); err != nil {
+		return nil, fmt.Errorf("failed to render HTML of %s: %w", key, err)
+	}
+
+	return &Rendered{
+		// A single line, whatever the poll title contains
+		Subject: strings.Join(strings.Fields(subject.String()), " "),
+		HTML:    html.String(),
+		Text:    strings.TrimSpace(text.String()) + "\n",
+	}, nil
+}
+
+// dateTimeFormatter returns the "datetime" template function of a locale
+func dateTimeFormatter(locale string) func(time.Time) string {
+	layout := dateTimeLayouts[locale]
+	return func(t time.Time) string {
+		return t.Format(layout)
+	}
+}
@@ -0,0 +1,93 @@
+package email
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRender(t *testing.T) {
+	templates, err := LoadTemplates("", "fr")
+	require.NoError(t, err)
+
+	date := time.Date(2026, 3, 14, 18, 30, 0, 0, time.UTC)
+	data := Data{
+		RecipientName: "Alice",
+		PollTitle:     "Apéro <script>alert(1)</script>\nBcc: eve@example.com",
+		URL:           "https://doodle.example.com/poll/ABCD2345",
+		Date:          &date,
+	}
+
+	msg, err := templates.Render("final_date", data)
+	require.NoError(t, err)
+	assert.Equal(t, "Date fixée pour : Apéro <script>alert(1)</script> Bcc: eve@example.com", msg.Subject)
+	assert.NotContains(t, msg.HTML, "<script>")
+	assert.Contains(t, msg.HTML, "&lt;script&gt;")
+	assert.Contains(t, msg.HTML, `<html lang="fr">`)
+	assert.Contains(t, msg.HTML, `href="https://doodle.example.com/poll/ABCD2345"`)
+	assert.Contains(t, msg.Text, "Date retenue : 14/03/2026 à 18:30 UTC\n")
+	assert.Contains(t, msg.Text, "Apéro <script>alert(1)</script>", "the text part is not escaped")
+
+	data.Locale = "en-GB"
+	msg, err = templates.Render("final_date", data)
+	require.NoError(t, err)
+	assert.Contains(t, msg.Subject, "Final date selected")
+	assert.Contains(t, msg.Text, "Selected date: Mar 14, 2026 at 6:30 PM UTC")
+
+	data.Locale, data.Date = "de", nil
+	msg, err = templates.Render("event_reminder", data)
+	require.NoError(t, err)
+	assert.Contains(t, msg.Subject, "Rappel", "unknown locales get the default one")
+	assert.NotContains(t, msg.Text, "Date et heure")
+
+	_, err = templates.Render("unknown", data)
+	assert.Error(t, err)
+}
+
+func TestTemplatesCoverEveryLocale(t *testing.T) {
+	names := TemplateNames()
+	assert.Contains(t, names, "account_locked")
+	assert.NotContains(t, names, "common")
+
+	templates, err := LoadTemplates("", "en")
+	require.NoError(t, err)
+	for _, locale := range Locales {
+		for _, name := range names {
+			msg, err := templates.Render(name, Data{Locale: locale, RecipientName: "Bob", URL: "https://example.com"})
+			require.NoError(t, err, "%s/%s", locale, name)
+			assert.NotEmpty(t, msg.Subject)
+			assert.Contains(t, msg.Text, "Bob")
+		}
+	}
+}
+
+func TestLoadTemplatesOverride(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "en"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "en", "new_vote.txt"),
+		[]byte(`{{define "subject"}}Vote: {{.PollTitle}}{{end}}{{.RecipientName}}, someone voted.`), 0o644))
+
+	templates, err := LoadTemplates(dir, "fr")
+	require.NoError(t, err)
+
+	msg, err := templates.Render("new_vote", Data{Locale: "en", RecipientName: "Carol", PollTitle: "Lunch"})
+	require.NoError(t, err)
+	assert.Equal(t, "Vote: Lunch", msg.Subject)
+	assert.Equal(t, "Carol, someone voted.\n", msg.Text)
+	assert.Contains(t, msg.HTML, "New vote received", "the bundled HTML part is kept")
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "en", "new_vote.txt"), []byte(`{{.RecipientName}}`), 0o644))
+	_, err = LoadTemplates(dir, "fr")
+	assert.Error(t, err, "no subject")
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "layout.html"), []byte(`{{define "layout"}}{{template "content" .}`), 0o644))
+	_, err = LoadTemplates(dir, "fr")
+	assert.Error(t, err)
+
+	_, err = LoadTemplates("", "de")
+	assert.Error(t, err)
+}
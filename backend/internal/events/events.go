@@ -0,0 +1,216 @@
+// Package events publishes live poll updates through PostgreSQL LISTEN/NOTIFY,
+// so that every replica can fan them out to its own event stream clients
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// Channel is the PostgreSQL notification channel carrying poll events
+const Channel = "poll_events"
+
+// maxPayload stays under the 8000 bytes PostgreSQL allows per notification
+const maxPayload = 7900
+
+// subscriptionBuffer is the number of events a subscriber may lag behind before being dropped
+const subscriptionBuffer = 32
+
+// Event types, sent as the SSE event name
+const (
+	TypeVoteCreated       = "vote-created"
+	TypeVoteUpdated       = "vote-updated"
+	TypeVoteDeleted       = "vote-deleted"
+	TypeCommentCreated    = "comment-created"
+	TypeCommentUpdated    = "comment-updated"
+	TypeCommentDeleted    = "comment-deleted"
+	TypeDateOptionCreated = "date-option-created"
+	TypeDateOptionDeleted = "date-option-deleted"
+	TypePollCreated       = "poll-created"
+	TypePollUpdated       = "poll-updated"
+	TypePollFinalized     = "poll-finalized"
+	TypePollDeleted       = "poll-deleted"
+
+	// Sent by the broker when events may have been missed; clients should reload the poll
+	TypeResync = "resync"
+)
+
+// PollEventTypes lists the events published on changes, which webhooks can filter on
+var PollEventTypes = []string{
+	TypeVoteCreated,
+	TypeVoteUpdated,
+	TypeVoteDeleted,
+	TypeCommentCreated,
+	TypeCommentUpdated,
+	TypeCommentDeleted,
+	TypeDateOptionCreated,
+	TypeDateOptionDeleted,
+	TypePollCreated,
+	TypePollUpdated,
+	TypePollFinalized,
+	TypePollDeleted,
+}
+
+// IsPollEventType checks if t is a published event type
+func IsPollEventType(t string) bool {
+	for _, pt := range PollEventTypes {
+		if pt == t {
+			return true
+		}
+	}
+	return false
+}
+
+// Voter identifies who cast a vote. It is kept apart from the event data so
+// streams can leave it out on polls that hide who voted.
+type Voter struct {
+	UserID *uuid.UUID `json:"user_id,omitempty"`
+	Name   string     `json:"user_name"`
+}
+
+// Event is a change on a poll
+type Event struct {
+	PollID uuid.UUID              `json:"poll_id"`
+	Type   string                 `json:"type"`
+	Data   map[string]interface{} `json:"data,omitempty"`
+	Voter  *Voter                 `json:"voter,omitempty"`
+}
+
+// Payload returns the data sent to stream clients, with the voter only if showVoter
+func (e Event) Payload(showVoter bool) map[string]interface{} {
+	payload := make(map[string]interface{}, len(e.Data)+2)
+	for k, v := range e.Data {
+		payload[k] = v
+	}
+	payload["poll_id"] = e.PollID
+	if showVoter && e.Voter != nil {
+		payload["voter"] = e.Voter
+	}
+	return payload
+}
+
+// ErrTooLarge is returned for events over the size of a PostgreSQL notification
+var ErrTooLarge = errors.New("event too large to publish")
+
+// Execer is implemented by both *pgxpool.Pool and pgx.Tx. Inside a transaction,
+// the event is only delivered if the transaction commits.
+type Execer interface {
+	Exec(ctx context.Context, sql string, arguments ...any) (pgconn.CommandTag, error)
+}
+
+// Publish sends an event to the listeners of every replica
+func Publish(ctx context.Context, db Execer, e Event) error {
+	payload, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	if len(payload) > maxPayload {
+		return fmt.Errorf("%w: %s is %d bytes", ErrTooLarge, e.Type, len(payload))
+	}
+	_, err = db.Exec(ctx, "SELECT pg_notify($1, $2)", Channel, string(payload))
+	return err
+}
+
+// Subscription receives the events of one poll
+type Subscription struct {
+	PollID uuid.UUID
+	C      <-chan Event
+
+	ch     chan Event
+	broker *Broker
+	closed bool
+}
+
+// Close stops the subscription; C is closed
+func (s *Subscription) Close() {
+	s.broker.mu.Lock()
+	defer s.broker.mu.Unlock()
+	s.broker.remove(s)
+}
+
+// Broker dispatches the events received by this replica to the subscriptions of each poll
+type Broker struct {
+	mu     sync.Mutex
+	subs   map[uuid.UUID]map[*Subscription]struct{}
+	buffer int
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// NewBroker creates a broker
+func NewBroker() *Broker {
+	return &Broker{
+		subs:   make(map[uuid.UUID]map[*Subscription]struct{}),
+		buffer: subscriptionBuffer,
+	}
+}
+
+// Subscribe starts receiving the events of a poll
+func (b *Broker) Subscribe(pollID uuid.UUID) *Subscription {
+	ch := make(chan Event, b.buffer)
+	s := &Subscription{PollID: pollID, C: ch, ch: ch, broker: b}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.subs[pollID] == nil {
+		b.subs[pollID] = make(map[*Subscription]struct{})
+	}
+	b.subs[pollID][s] = struct{}{}
+	return s
+}
+
+// Subscribers returns the number of open subscriptions on a poll
+func (b *Broker) Subscribers(pollID uuid.UUID) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.subs[pollID])
+}
+
+// remove closes a subscription; b.mu must be held
+func (b *Broker) remove(s *Subscription) {
+	if s.closed {
+		return
+	}
+	s.closed = true
+	close(s.ch)
+	delete(b.subs[s.PollID], s)
+	if len(b.subs[s.PollID]) == 0 {
+		delete(b.subs, s.PollID)
+	}
+}
+
+// Dispatch delivers an event to the subscriptions of its poll. A subscriber too slow
+// to keep up is dropped rather than blocking the others; its client reconnects.
+func (b *Broker) Dispatch(e Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for s := range b.subs[e.PollID] {
+		select {
+		case s.ch <- e:
+		default:
+			b.remove(s)
+		}
+	}
+}
+
+// broadcast delivers an event of the given type to every subscription
+func (b *Broker) broadcast(eventType string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for pollID, subs := range b.subs {
+		for s := range subs {
+			select {
+			case s.ch <- Event{PollID: pollID, Type: eventType}:
+			default:
+				b.remove(s)
+			}
+		}
+	}
+}
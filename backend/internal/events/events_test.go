@@ -0,0 +1,70 @@
+package events
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBrokerDispatch(t *testing.T) {
+	b := NewBroker()
+	b.buffer = 2
+	pollID := uuid.New()
+
+	a := b.Subscribe(pollID)
+	other := b.Subscribe(uuid.New())
+	assert.Equal(t, 1, b.Subscribers(pollID))
+
+	b.Dispatch(Event{PollID: pollID, Type: TypeVoteCreated})
+	assert.Equal(t, TypeVoteCreated, (<-a.C).Type)
+	assert.Empty(t, other.C, "events of other polls are not delivered")
+
+	a.Close()
+	a.Close()
+	_, open := <-a.C
+	assert.False(t, open)
+	assert.Equal(t, 0, b.Subscribers(pollID))
+
+	t.Run("Slow subscribers are dropped", func(t *testing.T) {
+		slow := b.Subscribe(pollID)
+		for i := 0; i < 3; i++ {
+			b.Dispatch(Event{PollID: pollID, Type: TypeCommentCreated})
+		}
+		assert.Equal(t, 0, b.Subscribers(pollID))
+
+		received := 0
+		for range slow.C {
+			received++
+		}
+		assert.Equal(t, 2, received)
+		slow.Close()
+	})
+
+	t.Run("Resync reaches every poll", func(t *testing.T) {
+		s := b.Subscribe(pollID)
+		defer s.Close()
+		b.broadcast(TypeResync)
+		assert.Equal(t, Event{PollID: pollID, Type: TypeResync}, <-s.C)
+		assert.Equal(t, TypeResync, (<-other.C).Type)
+	})
+}
+
+func TestEventPayload(t *testing.T) {
+	userID := uuid.New()
+	e := Event{
+		PollID: uuid.New(),
+		Type:   TypeVoteCreated,
+		Data:   map[string]interface{}{"response": "yes"},
+		Voter:  &Voter{UserID: &userID, Name: "Alice"},
+	}
+
+	shown := e.Payload(true)
+	assert.Equal(t, "yes", shown["response"])
+	assert.Equal(t, e.PollID, shown["poll_id"])
+	assert.Equal(t, e.Voter, shown["voter"])
+
+	hidden := e.Payload(false)
+	assert.NotContains(t, hidden, "voter")
+	assert.NotContains(t, e.Data, "poll_id", "the event data is not modified")
+}
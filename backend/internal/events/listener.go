@@ -0,0 +1,93 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// reconnectDelay is the pause before listening again after the connection was lost
+const reconnectDelay = 5 * time.Second
+
+// Start listens for the events published by every replica until Stop is called
+func (b *Broker) Start(pool *pgxpool.Pool) {
+	ctx, cancel := context.WithCancel(context.Background())
+	b.cancel = cancel
+	b.done = make(chan struct{})
+
+	go func() {
+		defer close(b.done)
+		for first := true; ; first = false {
+			if !first {
+				// Events published while reconnecting were lost
+				b.broadcast(TypeResync)
+			}
+			if err := b.listen(ctx, pool); err != nil && ctx.Err() == nil {
+				log.Printf("Poll event listener stopped: %v", err)
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(reconnectDelay):
+			}
+		}
+	}()
+	log.Println("Poll event listener started")
+}
+
+// Stop stops listening and closes every subscription
+func (b *Broker) Stop() {
+	if b.cancel == nil {
+		return
+	}
+	b.cancel()
+	<-b.done
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, subs := range b.subs {
+		for s := range subs {
+			b.remove(s)
+		}
+	}
+	log.Println("Poll event listener stopped")
+}
+
+// listen holds a connection on the notification channel until it fails or ctx ends
+func (b *Broker) listen(ctx context.Context, pool *pgxpool.Pool) error {
+	conn, err := pool.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		// Do not hand a listening connection back to the pool
+		unlistenCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if _, err := conn.Exec(unlistenCtx, "UNLISTEN *"); err != nil {
+			conn.Conn().Close(unlistenCtx)
+		}
+		conn.Release()
+	}()
+
+	if _, err := conn.Exec(ctx, "LISTEN "+Channel); err != nil {
+		return err
+	}
+
+	for {
+		notification, err := conn.Conn().WaitForNotification(ctx)
+		if err != nil {
+			return err
+		}
+
+		var e Event
+		if err := json.Unmarshal([]byte(notification.Payload), &e); err != nil {
+			log.Printf("Ignoring malformed poll event: %v", err)
+			continue
+		}
+		b.Dispatch(e)
+	}
+}
@@ -0,0 +1,201 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"doodle-clone/internal/audit"
+	"doodle-clone/internal/database"
+	"doodle-clone/internal/middleware"
+	"doodle-clone/internal/models"
+)
+
+// defaultAccessTokenLifetime applies when no expiry is requested
+const defaultAccessTokenLifetime = 30 * 24 * time.Hour
+
+// CreateAccessToken creates a personal access token for the current user
+// @Summary      Créer un jeton d'accès personnel
+// @Description  Crée un jeton nommé, limité à des scopes et expirant, pour les scripts et intégrations. Le jeton n'est affiché qu'une seule fois.
+// @Tags         auth
+// @Accept       json
+// @Produce      json
+// @Security     BearerAuth
+// @Param        request body models.CreateAccessTokenRequest true "Nom, scopes et durée de validité"
+// @Success      201  {object}  models.CreateAccessTokenResponse
+// @Failure      400  {object}  map[string]string
+// @Failure      401  {object}  map[string]string
+// @Failure      500  {object}  map[string]string
+// @Router       /user/tokens [post]
+func (h *AuthHandler) CreateAccessToken(c *gin.Context) {
+	userID := middleware.GetCurrentUser(c)
+	if userID == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Not authenticated"})
+		return
+	}
+
+	var req models.CreateAccessTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	for _, scope := range req.Scopes {
+		if !models.IsValidScope(scope) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":        "Unknown scope: " + scope,
+				"valid_scopes": models.AccessTokenScopes,
+			})
+			return
+		}
+	}
+
+	lifetime := defaultAccessTokenLifetime
+	if req.ExpiresInDays > 0 {
+		lifetime = time.Duration(req.ExpiresInDays) * 24 * time.Hour
+	}
+	expiresAt := time.Now().Add(lifetime)
+
+	secret, err := randomToken(32)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+	token := middleware.AccessTokenPrefix + secret
+
+	ctx, cancel := database.GetContext()
+	defer cancel()
+
+	pat := models.PersonalAccessToken{
+		ID:          uuid.New(),
+		UserID:      *userID,
+		Name:        req.Name,
+		TokenPrefix: token[:len(middleware.AccessTokenPrefix)+6],
+		Scopes:      req.Scopes,
+		ExpiresAt:   &expiresAt,
+	}
+	err = h.db.QueryRow(ctx, `
+		INSERT INTO personal_access_tokens (id, user_id, name, token_hash, token_prefix, scopes, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING created_at
+	`, pat.ID, pat.UserID, pat.Name, middleware.HashToken(token), pat.TokenPrefix, pat.Scopes, pat.ExpiresAt).Scan(&pat.CreatedAt)
+	if err != nil {
+		log.Printf("Failed to create access token: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create access token"})
+		return
+	}
+
+	entry := newAuditEntry(c, audit.ActionAccessTokenCreate, audit.TargetToken, pat.ID.String())
+	entry.Changes = audit.Diff(nil, map[string]interface{}{
+		"name":       pat.Name,
+		"prefix":     pat.TokenPrefix,
+		"scopes":     pat.Scopes,
+		"expires_at": pat.ExpiresAt,
+	})
+	recordAudit(ctx, h.db, entry)
+
+	c.JSON(http.StatusCreated, models.CreateAccessTokenResponse{
+		PersonalAccessToken: pat,
+		Token:               token,
+	})
+}
+
+// ListAccessTokens returns the active personal access tokens of the current user
+// @Summary      Lister les jetons d'accès personnels
+// @Description  Retourne les jetons d'accès actifs de l'utilisateur (sans leur valeur)
+// @Tags         auth
+// @Accept       json
+// @Produce      json
+// @Security     BearerAuth
+// @Success      200  {object}  map[string]interface{}  "tokens, count"
+// @Failure      401  {object}  map[string]string
+// @Failure      500  {object}  map[string]string
+// @Router       /user/tokens [get]
+func (h *AuthHandler) ListAccessTokens(c *gin.Context) {
+	userID := middleware.GetCurrentUser(c)
+	if userID == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Not authenticated"})
+		return
+	}
+
+	ctx, cancel := database.GetContext()
+	defer cancel()
+
+	rows, err := h.db.Query(ctx, `
+		SELECT id, user_id, name, token_prefix, scopes, expires_at, last_used_at, created_at
+		FROM personal_access_tokens
+		WHERE user_id = $1 AND revoked_at IS NULL
+		AND (expires_at IS NULL OR expires_at > CURRENT_TIMESTAMP)
+		ORDER BY created_at DESC
+	`, *userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch access tokens"})
+		return
+	}
+	defer rows.Close()
+
+	tokens := []models.PersonalAccessToken{}
+	for rows.Next() {
+		var t models.PersonalAccessToken
+		if err := rows.Scan(&t.ID, &t.UserID, &t.Name, &t.TokenPrefix, &t.Scopes, &t.ExpiresAt, &t.LastUsedAt, &t.CreatedAt); err != nil {
+			log.Printf("Error scanning access token: %v", err)
+			continue
+		}
+		tokens = append(tokens, t)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"tokens": tokens,
+		"count":  len(tokens),
+	})
+}
+
+// RevokeAccessToken revokes a personal access token of the current user
+// @Summary      Révoquer un jeton d'accès personnel
+// @Description  Révoque définitivement un jeton d'accès
+// @Tags         auth
+// @Accept       json
+// @Produce      json
+// @Security     BearerAuth
+// @Param        tokenId path      string  true  "ID du jeton"
+// @Success      200  {object}  map[string]string
+// @Failure      400  {object}  map[string]string
+// @Failure      401  {object}  map[string]string
+// @Failure      404  {object}  map[string]string
+// @Failure      500  {object}  map[string]string
+// @Router       /user/tokens/{tokenId} [delete]
+func (h *AuthHandler) RevokeAccessToken(c *gin.Context) {
+	userID := middleware.GetCurrentUser(c)
+	if userID == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Not authenticated"})
+		return
+	}
+
+	tokenID, err := uuid.Parse(c.Param("tokenId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid token ID"})
+		return
+	}
+
+	ctx, cancel := database.GetContext()
+	defer cancel()
+
+	tag, err := h.db.Exec(ctx, `
+		UPDATE personal_access_tokens SET revoked_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL
+	`, tokenID, *userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke access token"})
+		return
+	}
+	if tag.RowsAffected() == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Access token not found"})
+		return
+	}
+
+	recordAudit(ctx, h.db, newAuditEntry(c, audit.ActionAccessTokenRevoke, audit.TargetToken, tokenID.String()))
+
+	c.JSON(http.StatusOK, gin.H{"message": "Access token revoked successfully"})
+}
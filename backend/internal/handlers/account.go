@@ -0,0 +1,535 @@
+package handlers
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"golang.org/x/crypto/bcrypt"
+	"doodle-clone/internal/audit"
+	"doodle-clone/internal/database"
+	"doodle-clone/internal/middleware"
+	"doodle-clone/internal/models"
+)
+
+// deletedUserName replaces the name of a user on the votes they leave behind
+const deletedUserName = "Deleted user"
+
+// exportedPoll is a poll created by the user, with its date options
+type exportedPoll struct {
+	models.Poll
+	DateOptions []models.DateOption `json:"date_options"`
+}
+
+// ExportAccount returns a zip archive with all personal data of the current user
+// @Summary      Exporter mes données
+// @Description  Télécharge une archive ZIP (JSON) du profil, des sondages, votes, commentaires, notifications, webhooks, calendriers, jetons, sessions et du journal d'audit de l'utilisateur
+// @Tags         user
+// @Produce      application/zip
+// @Security     BearerAuth
+// @Success      200  {file}    binary
+// @Failure      401  {object}  map[string]string
+// @Failure      500  {object}  map[string]string
+// @Router       /user/export [get]
+func (h *AuthHandler) ExportAccount(c *gin.Context) {
+	userID := middleware.GetCurrentUser(c)
+	if userID == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Not authenticated"})
+		return
+	}
+
+	ctx, cancel := database.GetContext(30 * time.Second)
+	defer cancel()
+
+	profile, err := h.exportProfile(ctx, *userID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+		log.Printf("Error exporting profile: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export account"})
+		return
+	}
+
+	polls, err := h.exportPolls(ctx, *userID)
+	if err != nil {
+		log.Printf("Error exporting polls: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export account"})
+		return
+	}
+
+	votes, err := h.exportVotes(ctx, *userID)
+	if err != nil {
+		log.Printf("Error exporting votes: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export account"})
+		return
+	}
+
+	comments, err := h.exportComments(ctx, *userID)
+	if err != nil {
+		log.Printf("Error exporting comments: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export account"})
+		return
+	}
+
+	notifications, err := h.exportNotifications(ctx, *userID)
+	if err != nil {
+		log.Printf("Error exporting notifications: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export account"})
+		return
+	}
+
+	loginAttempts, err := h.exportLoginAttempts(ctx, *userID)
+	if err != nil {
+		log.Printf("Error exporting login attempts: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export account"})
+		return
+	}
+
+	files := []struct {
+		name string
+		data any
+	}{
+		{"profile.json", profile},
+		{"polls.json", polls},
+		{"votes.json", votes},
+		{"comments.json", comments},
+		{"notifications.json", notifications},
+		{"login_attempts.json", loginAttempts},
+	}
+	for _, s := range exportSections {
+		data, err := h.exportSection(ctx, s.query, *userID)
+		if err != nil {
+			log.Printf("Error exporting %s: %v", s.name, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export account"})
+			return
+		}
+		files = append(files, struct {
+			name string
+			data any
+		}{s.name, data})
+	}
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, f := range files {
+		w, err := zw.Create(f.name)
+		if err == nil {
+			enc := json.NewEncoder(w)
+			enc.SetIndent("", "  ")
+			err = enc.Encode(f.data)
+		}
+		if err != nil {
+			log.Printf("Error writing %s to export: %v", f.name, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export account"})
+			return
+		}
+	}
+	if err := zw.Close(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export account"})
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=doodle_export_%s.zip", time.Now().Format("20060102")))
+	c.Data(http.StatusOK, "application/zip", buf.Bytes())
+}
+
+func (h *AuthHandler) exportProfile(ctx context.Context, userID uuid.UUID) (*models.User, error) {
+	var user models.User
+	err := h.db.QueryRow(ctx, `
+		SELECT id, email, name, COALESCE(avatar, ''), provider, COALESCE(locale, ''), created_at, updated_at
+		FROM users WHERE id = $1
+	`, userID).Scan(&user.ID, &user.Email, &user.Name, &user.Avatar, &user.Provider, &user.Locale, &user.CreatedAt, &user.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (h *AuthHandler) exportPolls(ctx context.Context, userID uuid.UUID) ([]exportedPoll, error) {
+	rows, err := h.db.Query(ctx, `
+		SELECT id, title, COALESCE(description, ''), COALESCE(location, ''), creator_id, access_code, expires_at,
+		       allow_multiple, allow_maybe, anonymous, limit_votes, max_votes_per_user,
+		       final_date, created_at, updated_at
+		FROM polls WHERE creator_id = $1
+		ORDER BY created_at
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	polls := []exportedPoll{}
+	index := make(map[uuid.UUID]int)
+	for rows.Next() {
+		var p exportedPoll
+		err := rows.Scan(
+			&p.ID, &p.Title, &p.Description, &p.Location, &p.CreatorID, &p.AccessCode, &p.ExpiresAt,
+			&p.AllowMultiple, &p.AllowMaybe, &p.Anonymous, &p.LimitVotes, &p.MaxVotesPerUser,
+			&p.FinalDate, &p.CreatedAt, &p.UpdatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		p.DateOptions = []models.DateOption{}
+		index[p.ID] = len(polls)
+		polls = append(polls, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	dateRows, err := h.db.Query(ctx, `
+		SELECT d.id, d.poll_id, d.start_time, d.end_time, d.created_at
+		FROM date_options d
+		JOIN polls p ON p.id = d.poll_id
+		WHERE p.creator_id = $1
+		ORDER BY d.start_time
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer dateRows.Close()
+
+	for dateRows.Next() {
+		var d models.DateOption
+		if err := dateRows.Scan(&d.ID, &d.PollID, &d.StartTime, &d.EndTime, &d.CreatedAt); err != nil {
+			return nil, err
+		}
+		if i, ok := index[d.PollID]; ok {
+			polls[i].DateOptions = append(polls[i].DateOptions, d)
+		}
+	}
+
+	return polls, dateRows.Err()
+}
+
+func (h *AuthHandler) exportVotes(ctx context.Context, userID uuid.UUID) ([]models.Vote, error) {
+	rows, err := h.db.Query(ctx, `
+		SELECT id, poll_id, date_option_id, user_id, user_name, response, created_at
+		FROM votes WHERE user_id = $1
+		ORDER BY created_at
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	votes := []models.Vote{}
+	for rows.Next() {
+		var v models.Vote
+		if err := rows.Scan(&v.ID, &v.PollID, &v.DateOptionID, &v.UserID, &v.UserName, &v.Response, &v.CreatedAt); err != nil {
+			return nil, err
+		}
+		votes = append(votes, v)
+	}
+	return votes, rows.Err()
+}
+
+func (h *AuthHandler) exportComments(ctx context.Context, userID uuid.UUID) ([]models.Comment, error) {
+	rows, err := h.db.Query(ctx, `
+		SELECT id, poll_id, user_id, content, created_at
+		FROM comments WHERE user_id = $1
+		ORDER BY created_at
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	comments := []models.Comment{}
+	for rows.Next() {
+		var cm models.Comment
+		if err := rows.Scan(&cm.ID, &cm.PollID, &cm.UserID, &cm.Content, &cm.CreatedAt); err != nil {
+			return nil, err
+		}
+		comments = append(comments, cm)
+	}
+	return comments, rows.Err()
+}
+
+func (h *AuthHandler) exportNotifications(ctx context.Context, userID uuid.UUID) ([]models.Notification, error) {
+	rows, err := h.db.Query(ctx, `
+		SELECT id, poll_id, user_id, type, status, scheduled_at, sent_at, error_message, created_at
+		FROM notifications WHERE user_id = $1
+		ORDER BY scheduled_at
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	notifications := []models.Notification{}
+	for rows.Next() {
+		var n models.Notification
+		err := rows.Scan(&n.ID, &n.PollID, &n.UserID, &n.Type, &n.Status, &n.ScheduledAt, &n.SentAt, &n.ErrorMessage, &n.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		notifications = append(notifications, n)
+	}
+	return notifications, rows.Err()
+}
+
+// exportedLoginAttempt is an entry of the login audit
+type exportedLoginAttempt struct {
+	IPAddress string    `json:"ip_address"`
+	UserAgent string    `json:"user_agent"`
+	Success   bool      `json:"success"`
+	Reason    string    `json:"reason,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (h *AuthHandler) exportLoginAttempts(ctx context.Context, userID uuid.UUID) ([]exportedLoginAttempt, error) {
+	rows, err := h.db.Query(ctx, `
+		SELECT ip_address, COALESCE(user_agent, ''), success, COALESCE(reason, ''), created_at
+		FROM login_attempts WHERE user_id = $1
+		ORDER BY created_at
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	attempts := []exportedLoginAttempt{}
+	for rows.Next() {
+		var a exportedLoginAttempt
+		if err := rows.Scan(&a.IPAddress, &a.UserAgent, &a.Success, &a.Reason, &a.CreatedAt); err != nil {
+			return nil, err
+		}
+		attempts = append(attempts, a)
+	}
+	return attempts, rows.Err()
+}
+
+// exportSections are the remaining per-user tables, selected without secrets:
+// no token hashes, webhook signing secrets or sealed CalDAV passwords
+var exportSections = []struct {
+	name  string
+	query string
+}{
+	{"inbox.json", `
+		SELECT id, poll_id, type, actors, count, read_at, created_at, updated_at
+		FROM user_notifications WHERE user_id = $1
+		ORDER BY created_at`},
+	{"notification_preferences.json", `
+		SELECT type, in_app, email
+		FROM notification_preferences WHERE user_id = $1
+		ORDER BY type`},
+	{"webhooks.json", `
+		SELECT id, poll_id, url, events, description, active, created_at, updated_at
+		FROM webhooks WHERE user_id = $1
+		ORDER BY created_at`},
+	{"webhook_deliveries.json", `
+		SELECT d.id, d.webhook_id, d.event_type, d.payload, d.status, d.attempts,
+		       d.last_status_code, d.last_error, d.redelivery_of, d.delivered_at, d.created_at
+		FROM webhook_deliveries d
+		JOIN webhooks w ON w.id = d.webhook_id
+		WHERE w.user_id = $1
+		ORDER BY d.created_at`},
+	{"calendar_feed.json", `
+		SELECT token_prefix, modified_at, last_used_at, created_at
+		FROM calendar_feeds WHERE user_id = $1`},
+	{"caldav_account.json", `
+		SELECT url, username, auto_fill, last_sync_at, last_error, created_at, updated_at
+		FROM caldav_accounts WHERE user_id = $1`},
+	{"access_tokens.json", `
+		SELECT id, name, token_prefix, scopes, expires_at, last_used_at, revoked_at, created_at
+		FROM personal_access_tokens WHERE user_id = $1
+		ORDER BY created_at`},
+	{"sessions.json", `
+		SELECT family_id AS session_id, session_started_at, user_agent, ip_address, created_at, expires_at, revoked_at
+		FROM refresh_tokens WHERE user_id = $1
+		ORDER BY created_at`},
+	{"audit_log.json", `
+		SELECT id, actor_id, action, target_type, target_id, poll_id, changes, ip_address, request_id, created_at
+		FROM audit_log
+		WHERE actor_id = $1 OR (target_type = 'user' AND target_id = $1::text)
+		ORDER BY id`},
+}
+
+// exportSection returns the rows of a section query as a JSON array
+func (h *AuthHandler) exportSection(ctx context.Context, query string, userID uuid.UUID) (json.RawMessage, error) {
+	var data []byte
+	err := h.db.QueryRow(ctx, `SELECT COALESCE(json_agg(t), '[]') FROM (`+query+`) t`, userID).Scan(&data)
+	return data, err
+}
+
+// DeleteAccount deletes the current user.
+// Votes and comments are kept without their author, owned polls follow the chosen policy,
+// and every session and access token of the user is removed with the account.
+// @Summary      Supprimer mon compte
+// @Description  Supprime le compte : votes et commentaires anonymisés, sondages transférés, archivés ou supprimés selon poll_policy
+// @Tags         user
+// @Accept       json
+// @Produce      json
+// @Security     BearerAuth
+// @Param        request body models.DeleteAccountRequest true "Mot de passe et politique pour les sondages"
+// @Success      200  {object}  map[string]interface{}
+// @Failure      400  {object}  map[string]string
+// @Failure      401  {object}  map[string]string
+// @Failure      500  {object}  map[string]string
+// @Router       /user [delete]
+func (h *AuthHandler) DeleteAccount(c *gin.Context) {
+	userID := middleware.GetCurrentUser(c)
+	if userID == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Not authenticated"})
+		return
+	}
+
+	var req models.DeleteAccountRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx, cancel := database.GetContext(30 * time.Second)
+	defer cancel()
+
+	// Email accounts confirm with their password; Google accounts have none
+	var passwordHash *string
+	err := h.db.QueryRow(ctx, "SELECT password_hash FROM users WHERE id = $1", *userID).Scan(&passwordHash)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if passwordHash != nil && *passwordHash != "" {
+		if bcrypt.CompareHashAndPassword([]byte(*passwordHash), []byte(req.Password)) != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid password"})
+			return
+		}
+	}
+
+	var newOwnerID uuid.UUID
+	if req.PollPolicy == models.PollPolicyTransfer {
+		if req.TransferTo == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "transfer_to is required to transfer polls"})
+			return
+		}
+		err := h.db.QueryRow(ctx, "SELECT id FROM users WHERE email = $1", req.TransferTo).Scan(&newOwnerID)
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "No user with this email to transfer polls to"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+		if newOwnerID == *userID {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot transfer polls to yourself"})
+			return
+		}
+	}
+
+	tx, err := h.db.Begin(ctx)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	var pollsQuery string
+	var pollsArgs []any
+	switch req.PollPolicy {
+	case models.PollPolicyTransfer:
+		pollsQuery = `UPDATE polls SET creator_id = $2, updated_at = CURRENT_TIMESTAMP WHERE creator_id = $1`
+		pollsArgs = []any{*userID, newOwnerID}
+	case models.PollPolicyArchive:
+		// Archived polls have no creator and are closed to new votes
+		pollsQuery = `
+			UPDATE polls SET creator_id = NULL, archived_at = CURRENT_TIMESTAMP,
+			       expires_at = LEAST(COALESCE(expires_at, CURRENT_TIMESTAMP), CURRENT_TIMESTAMP),
+			       updated_at = CURRENT_TIMESTAMP
+			WHERE creator_id = $1`
+		pollsArgs = []any{*userID}
+	case models.PollPolicyDelete:
+		pollsQuery = `DELETE FROM polls WHERE creator_id = $1`
+		pollsArgs = []any{*userID}
+	}
+	tag, err := tx.Exec(ctx, pollsQuery, pollsArgs...)
+	if err != nil {
+		log.Printf("Error applying poll policy %s: %v", req.PollPolicy, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete account"})
+		return
+	}
+	pollCount := tag.RowsAffected()
+
+	// Events of deleted polls are removed from the calendars of their participants
+	_, err = tx.Exec(ctx, `
+		UPDATE calendar_invitations ci SET cancel_at = CURRENT_TIMESTAMP, attempts = 0
+		WHERE ci.organizer_id = $1 AND ci.cancel_at IS NULL
+		  AND NOT EXISTS (SELECT 1 FROM polls p WHERE p.id = ci.poll_id)
+	`, *userID)
+	if err != nil {
+		log.Printf("Error cancelling invitations: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete account"})
+		return
+	}
+
+	// Votes keep counting, but no longer point to the user
+	_, err = tx.Exec(ctx, `UPDATE votes SET user_id = NULL, user_name = $2 WHERE user_id = $1`, *userID, deletedUserName)
+	if err != nil {
+		log.Printf("Error anonymizing votes: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete account"})
+		return
+	}
+
+	_, err = tx.Exec(ctx, `UPDATE comments SET user_id = NULL WHERE user_id = $1`, *userID)
+	if err != nil {
+		log.Printf("Error anonymizing comments: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete account"})
+		return
+	}
+
+	// Refresh tokens, access tokens and notifications cascade with the user
+	if _, err := tx.Exec(ctx, `DELETE FROM login_attempts WHERE user_id = $1`, *userID); err != nil {
+		log.Printf("Error deleting login attempts: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete account"})
+		return
+	}
+
+	if _, err := tx.Exec(ctx, `DELETE FROM users WHERE id = $1`, *userID); err != nil {
+		log.Printf("Error deleting user: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete account"})
+		return
+	}
+
+	// Audit entries outlive the user with its ID only: audit.Record never stores
+	// names, emails or comment bodies, and truncates IPs
+	entry := newAuditEntry(c, audit.ActionAccountDelete, audit.TargetUser, userID.String())
+	entry.Changes = map[string]audit.Change{
+		"poll_policy": {New: req.PollPolicy},
+		"polls":       {New: pollCount},
+	}
+	if err := audit.Record(ctx, tx, entry); err != nil {
+		log.Printf("Error recording account deletion: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete account"})
+		return
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete account"})
+		return
+	}
+
+	clearRefreshCookie(c)
+	c.JSON(http.StatusOK, gin.H{
+		"message":     "Account deleted",
+		"poll_policy": req.PollPolicy,
+		"polls":       pollCount,
+	})
+}
@@ -0,0 +1,22 @@
+package handlers
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// adminEmails are the accounts allowed on admin endpoints
+var adminEmails = []string{
+	"steph.leminhnhut@gmail.com",
+	"stephane.le@gmail.com",
+	"stephane.consulting.ai@gmail.com",
+}
+
+// isAdmin reports whether userID belongs to an admin account
+func isAdmin(ctx context.Context, db *pgxpool.Pool, userID uuid.UUID) bool {
+	var admin bool
+	err := db.QueryRow(ctx, `SELECT email = ANY($1) FROM users WHERE id = $2`, adminEmails, userID).Scan(&admin)
+	return err == nil && admin
+}
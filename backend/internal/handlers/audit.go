@@ -0,0 +1,279 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"doodle-clone/internal/audit"
+	"doodle-clone/internal/database"
+	"doodle-clone/internal/middleware"
+	"doodle-clone/internal/models"
+)
+
+const (
+	defaultAuditLimit = 50
+	maxAuditLimit     = 200
+)
+
+// newAuditEntry starts an audit entry for a mutation made by the current request
+func newAuditEntry(c *gin.Context, action, targetType, targetID string) audit.Entry {
+	return audit.Entry{
+		ActorID:    middleware.GetCurrentUser(c),
+		Action:     action,
+		TargetType: targetType,
+		TargetID:   targetID,
+		IPAddress:  c.ClientIP(),
+		RequestID:  middleware.GetRequestID(c),
+	}
+}
+
+// recordAudit appends an entry for a mutation that is already done.
+// A failure is logged rather than reported, since the change cannot be undone anymore;
+// inside a transaction, call audit.Record and roll back on error instead.
+func recordAudit(ctx context.Context, db execer, e audit.Entry) {
+	if err := audit.Record(ctx, db, e); err != nil {
+		log.Printf("Failed to record audit entry %s %s/%s: %v", e.Action, e.TargetType, e.TargetID, err)
+	}
+}
+
+// AuditHandler serves the audit log
+type AuditHandler struct {
+	db *pgxpool.Pool
+}
+
+// NewAuditHandler creates a new audit handler
+func NewAuditHandler(db *pgxpool.Pool) *AuditHandler {
+	return &AuditHandler{db: db}
+}
+
+// auditPage reads the limit and offset query parameters
+func auditPage(c *gin.Context) (int, int) {
+	limit, err := strconv.Atoi(c.Query("limit"))
+	if err != nil || limit <= 0 {
+		limit = defaultAuditLimit
+	}
+	if limit > maxAuditLimit {
+		limit = maxAuditLimit
+	}
+	offset, err := strconv.Atoi(c.Query("offset"))
+	if err != nil || offset < 0 {
+		offset = 0
+	}
+	return limit, offset
+}
+
+// ListAuditLog returns audit entries matching the query filters
+// @Summary      Journal d'audit
+// @Description  Recherche dans le journal d'audit des modifications (admin uniquement)
+// @Tags         admin
+// @Produce      json
+// @Security     BearerAuth
+// @Param        actor_id     query  string  false  "UUID de l'auteur"
+// @Param        action       query  string  false  "Action exacte (poll.update) ou préfixe (poll.)"
+// @Param        target_type  query  string  false  "Type de cible (poll, vote, comment, user...)"
+// @Param        target_id    query  string  false  "ID de la cible"
+// @Param        poll_id      query  string  false  "UUID du sondage"
+// @Param        request_id   query  string  false  "ID de requête (X-Request-ID)"
+// @Param        ip           query  string  false  "Adresse IP (comparée à son réseau /24 ou /48)"
+// @Param        since        query  string  false  "Date de début (RFC 3339)"
+// @Param        until        query  string  false  "Date de fin (RFC 3339)"
+// @Param        limit        query  int     false  "Nombre d'entrées (50 par défaut, 200 max)"
+// @Param        offset       query  int     false  "Décalage"
+// @Success      200  {object}  map[string]interface{}  "entries, count"
+// @Failure      400  {object}  map[string]string
+// @Failure      401  {object}  map[string]string
+// @Failure      403  {object}  map[string]string
+// @Router       /admin/audit [get]
+func (h *AuditHandler) ListAuditLog(c *gin.Context) {
+	userID := middleware.GetCurrentUser(c)
+	if userID == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Not authenticated"})
+		return
+	}
+
+	ctx, cancel := database.GetContext(10 * time.Second)
+	defer cancel()
+
+	if !isAdmin(ctx, h.db, *userID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Admin access required"})
+		return
+	}
+
+	conditions := []string{}
+	args := []interface{}{}
+	addFilter := func(condition string, value interface{}) {
+		args = append(args, value)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+
+	for _, param := range []string{"actor_id", "poll_id"} {
+		if value := c.Query(param); value != "" {
+			id, err := uuid.Parse(value)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid " + param})
+				return
+			}
+			addFilter("a."+param+" = $%d", id)
+		}
+	}
+	if action := c.Query("action"); action != "" {
+		if strings.HasSuffix(action, ".") {
+			addFilter("a.action LIKE $%d", action+"%")
+		} else {
+			addFilter("a.action = $%d", action)
+		}
+	}
+	if value := c.Query("target_type"); value != "" {
+		addFilter("a.target_type = $%d", value)
+	}
+	if value := c.Query("target_id"); value != "" {
+		addFilter("a.target_id = $%d", value)
+	}
+	if value := c.Query("request_id"); value != "" {
+		addFilter("a.request_id = $%d", value)
+	}
+	if value := c.Query("ip"); value != "" {
+		addFilter("a.ip_address = $%d", audit.MaskIP(value))
+	}
+	for param, condition := range map[string]string{"since": "a.created_at >= $%d", "until": "a.created_at < $%d"} {
+		if value := c.Query(param); value != "" {
+			t, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid " + param + ", expected RFC 3339"})
+				return
+			}
+			addFilter(condition, t)
+		}
+	}
+
+	where := ""
+	if len(conditions) > 0 {
+		where = "WHERE " + strings.Join(conditions, " AND ")
+	}
+	limit, offset := auditPage(c)
+	args = append(args, limit, offset)
+
+	rows, err := h.db.Query(ctx, fmt.Sprintf(`
+		SELECT a.id, a.actor_id, COALESCE(u.name, ''), COALESCE(u.email, ''), a.action, a.target_type, a.target_id,
+		       a.poll_id, a.changes, COALESCE(a.ip_address, ''), COALESCE(a.request_id, ''), a.created_at
+		FROM audit_log a
+		LEFT JOIN users u ON a.actor_id = u.id
+		%s
+		ORDER BY a.created_at DESC, a.id DESC
+		LIMIT $%d OFFSET $%d
+	`, where, len(args)-1, len(args)), args...)
+	if err != nil {
+		log.Printf("Error querying audit log: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch audit log"})
+		return
+	}
+	defer rows.Close()
+
+	entries := []models.AuditEntry{}
+	for rows.Next() {
+		var e models.AuditEntry
+		err := rows.Scan(&e.ID, &e.ActorID, &e.ActorName, &e.ActorEmail, &e.Action, &e.TargetType, &e.TargetID,
+			&e.PollID, &e.Changes, &e.IPAddress, &e.RequestID, &e.CreatedAt)
+		if err != nil {
+			log.Printf("Error scanning audit entry: %v", err)
+			continue
+		}
+		entries = append(entries, e)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"entries": entries,
+		"count":   len(entries),
+	})
+}
+
+// GetPollActivity returns the history of a poll for its organizer
+// @Summary      Activité d'un sondage
+// @Description  Retourne l'historique des modifications d'un sondage, de ses votes et commentaires (créateur uniquement)
+// @Tags         polls
+// @Produce      json
+// @Security     BearerAuth
+// @Param        id      path   string  true   "UUID du sondage"
+// @Param        limit   query  int     false  "Nombre d'entrées (50 par défaut, 200 max)"
+// @Param        offset  query  int     false  "Décalage"
+// @Success      200  {object}  map[string]interface{}  "activity, count"
+// @Failure      400  {object}  map[string]string
+// @Failure      401  {object}  map[string]string
+// @Failure      403  {object}  map[string]string
+// @Failure      404  {object}  map[string]string
+// @Router       /polls/{id}/activity [get]
+func (h *AuditHandler) GetPollActivity(c *gin.Context) {
+	userID := middleware.GetCurrentUser(c)
+	if userID == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Not authenticated"})
+		return
+	}
+
+	pollID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid poll ID"})
+		return
+	}
+
+	ctx, cancel := database.GetContext()
+	defer cancel()
+
+	var creatorID *uuid.UUID
+	err = h.db.QueryRow(ctx, "SELECT creator_id FROM polls WHERE id = $1", pollID).Scan(&creatorID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Poll not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if creatorID == nil || *creatorID != *userID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only the creator can view the poll activity"})
+		return
+	}
+
+	limit, offset := auditPage(c)
+
+	// Organizers see who did what, but not the IPs and request IDs of participants
+	rows, err := h.db.Query(ctx, `
+		SELECT a.id, a.actor_id, COALESCE(u.name, ''), a.action, a.target_type, a.target_id, a.changes, a.created_at
+		FROM audit_log a
+		LEFT JOIN users u ON a.actor_id = u.id
+		WHERE a.poll_id = $1
+		ORDER BY a.created_at DESC, a.id DESC
+		LIMIT $2 OFFSET $3
+	`, pollID, limit, offset)
+	if err != nil {
+		log.Printf("Error querying poll activity: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch activity"})
+		return
+	}
+	defer rows.Close()
+
+	activity := []models.AuditEntry{}
+	for rows.Next() {
+		e := models.AuditEntry{PollID: &pollID}
+		err := rows.Scan(&e.ID, &e.ActorID, &e.ActorName, &e.Action, &e.TargetType, &e.TargetID, &e.Changes, &e.CreatedAt)
+		if err != nil {
+			log.Printf("Error scanning poll activity: %v", err)
+			continue
+		}
+		activity = append(activity, e)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"activity": activity,
+		"count":    len(activity),
+	})
+}
@@ -18,17 +18,25 @@ import (
 	"golang.org/x/crypto/bcrypt"
 	"golang.org/x/oauth2"
 	"golang.org/x/oauth2/google"
+	"doodle-clone/internal/audit"
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"doodle-clone/internal/config"
 	"doodle-clone/internal/database"
+	"doodle-clone/internal/email"
+	"doodle-clone/internal/jwtkeys"
 	"doodle-clone/internal/middleware"
 	"doodle-clone/internal/models"
+	"doodle-clone/internal/notify"
 )
 
 type AuthHandler struct {
 	db          *pgxpool.Pool
 	oauthConfig *oauth2.Config
+	notifier    notify.Notifier
+	templates   *email.Templates
+	ticker      *time.Ticker
+	stopCh      chan struct{}
 }
 
 func NewAuthHandler(db *pgxpool.Pool) *AuthHandler {
@@ -44,76 +52,23 @@ func NewAuthHandler(db *pgxpool.Pool) *AuthHandler {
 			},
 			Endpoint: google.Endpoint,
 		},
+		stopCh: make(chan struct{}),
 	}
 }
 
-// generateToken creates a JWT token for a user
-func (h *AuthHandler) generateToken(userID uuid.UUID, email string) (string, error) {
+// generateToken creates a JWT token for a user session
+func (h *AuthHandler) generateToken(userID uuid.UUID, email string, sessionID uuid.UUID) (string, error) {
 	claims := middleware.Claims{
-		UserID: userID,
-		Email:  email,
+		UserID:    userID,
+		Email:     email,
+		SessionID: sessionID,
 		RegisteredClaims: jwt.RegisteredClaims{
 			ExpiresAt: jwt.NewNumericDate(time.Now().Add(config.AppConfig.JWTExpiry)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 		},
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(config.AppConfig.JWTSecret))
-}
-
-// generateRefreshToken creates a refresh token
-func (h *AuthHandler) generateRefreshToken(userID uuid.UUID) (string, error) {
-	// Generate random token
-	b := make([]byte, 32)
-	if _, err := rand.Read(b); err != nil {
-		return "", err
-	}
-	token := base64.URLEncoding.EncodeToString(b)
-
-	// Store in database
-	ctx, cancel := database.GetContext()
-	defer cancel()
-
-	_, err := h.db.Exec(ctx, `
-		INSERT INTO refresh_tokens (user_id, token, expires_at)
-		VALUES ($1, $2, $3)
-	`, userID, token, time.Now().Add(config.AppConfig.RefreshExpiry))
-
-	return token, err
-}
-
-// validateRefreshToken checks if a refresh token is valid
-func (h *AuthHandler) validateRefreshToken(token string) (uuid.UUID, error) {
-	ctx, cancel := database.GetContext()
-	defer cancel()
-
-	var userID uuid.UUID
-	var expiresAt time.Time
-
-	err := h.db.QueryRow(ctx, `
-		SELECT user_id, expires_at
-		FROM refresh_tokens
-		WHERE token = $1
-	`, token).Scan(&userID, &expiresAt)
-
-	if err != nil {
-		return uuid.Nil, errors.New("invalid refresh token")
-	}
-
-	if time.Now().After(expiresAt) {
-		// Delete expired token
-		h.deleteRefreshToken(token)
-		return uuid.Nil, errors.New("refresh token expired")
-	}
-
-	return userID, nil
-}
-
-func (h *AuthHandler) deleteRefreshToken(token string) {
-	ctx, cancel := database.GetContext()
-	defer cancel()
-	h.db.Exec(ctx, "DELETE FROM refresh_tokens WHERE token = $1", token)
+	return middleware.GenerateToken(claims)
 }
 
 // Register handles user registration
@@ -170,29 +125,22 @@ func (h *AuthHandler) Register(c *gin.Context) {
 	}
 
 	// Generate tokens
-	token, err := h.generateToken(userID, req.Email)
+	refreshToken, sessionID, err := h.generateRefreshToken(c, userID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate refresh token"})
 		return
 	}
 
-	refreshToken, err := h.generateRefreshToken(userID)
+	token, err := h.generateToken(userID, req.Email, sessionID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate refresh token"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
 		return
 	}
 
 	// Set httpOnly cookie for refresh token
-	c.SetSameSite(http.SameSiteLaxMode)
-	c.SetCookie(
-		"refresh_token",
-		refreshToken,
-		int(config.AppConfig.RefreshExpiry.Seconds()),
-		"/",
-		"",
-		config.IsProduction(),
-		true, // httpOnly
-	)
+	setRefreshCookie(c, refreshToken)
+
+	h.auditLogin(ctx, c, audit.ActionRegister, userID, sessionID, "email")
 
 	user := models.User{
 		ID:        userID,
@@ -220,6 +168,7 @@ func (h *AuthHandler) Register(c *gin.Context) {
 // @Success      200  {object}  models.AuthResponse
 // @Failure      400  {object}  map[string]string
 // @Failure      401  {object}  map[string]string
+// @Failure      429  {object}  map[string]interface{}  "error, retry_after"
 // @Failure      500  {object}  map[string]string
 // @Router       /auth/login [post]
 func (h *AuthHandler) Login(c *gin.Context) {
@@ -232,19 +181,32 @@ func (h *AuthHandler) Login(c *gin.Context) {
 	ctx, cancel := database.GetContext()
 	defer cancel()
 
+	// Slow down, then lock out, repeated failures on the account or from the IP
+	attemptEmail := normalizeEmail(req.Email)
+	wait, err := h.loginRetryAfter(ctx, attemptEmail, c.ClientIP())
+	if err != nil {
+		log.Printf("Login throttle check failed: %v", err)
+	}
+	if wait > 0 {
+		h.recordLoginAttempt(ctx, c, attemptEmail, nil, false, loginReasonThrottled)
+		abortThrottledLogin(c, wait)
+		return
+	}
+
 	// Get user
 	var user models.User
 	var avatar sql.NullString
-	err := h.db.QueryRow(ctx, `
-		SELECT id, email, password_hash, name, avatar, provider, created_at, updated_at
+	err = h.db.QueryRow(ctx, `
+		SELECT id, email, password_hash, name, avatar, provider, COALESCE(locale, ''), created_at, updated_at
 		FROM users WHERE email = $1
-	`, req.Email).Scan(&user.ID, &user.Email, &user.PasswordHash, &user.Name, &avatar, &user.Provider, &user.CreatedAt, &user.UpdatedAt)
+	`, req.Email).Scan(&user.ID, &user.Email, &user.PasswordHash, &user.Name, &avatar, &user.Provider, &user.Locale, &user.CreatedAt, &user.UpdatedAt)
 	if avatar.Valid {
 		user.Avatar = avatar.String
 	}
 
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
+			h.loginFailed(ctx, c, attemptEmail, nil, "", loginReasonUnknownEmail)
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
 			return
 		}
@@ -255,6 +217,7 @@ func (h *AuthHandler) Login(c *gin.Context) {
 
 	// Check provider
 	if user.Provider != "email" {
+		h.recordLoginAttempt(ctx, c, attemptEmail, &user.ID, false, loginReasonWrongProvider)
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Please use Google OAuth to login"})
 		return
 	}
@@ -262,34 +225,29 @@ func (h *AuthHandler) Login(c *gin.Context) {
 	// Verify password
 	err = bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(req.Password))
 	if err != nil {
+		h.loginFailed(ctx, c, attemptEmail, &user.ID, user.Name, loginReasonInvalidPassword)
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
 		return
 	}
+	h.recordLoginAttempt(ctx, c, attemptEmail, &user.ID, true, "")
 
 	// Generate tokens
-	token, err := h.generateToken(user.ID, user.Email)
+	refreshToken, sessionID, err := h.generateRefreshToken(c, user.ID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate refresh token"})
 		return
 	}
 
-	refreshToken, err := h.generateRefreshToken(user.ID)
+	token, err := h.generateToken(user.ID, user.Email, sessionID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate refresh token"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
 		return
 	}
 
 	// Set httpOnly cookie
-	c.SetSameSite(http.SameSiteLaxMode)
-	c.SetCookie(
-		"refresh_token",
-		refreshToken,
-		int(config.AppConfig.RefreshExpiry.Seconds()),
-		"/",
-		"",
-		config.IsProduction(),
-		true,
-	)
+	setRefreshCookie(c, refreshToken)
+
+	h.auditLogin(ctx, c, audit.ActionLogin, user.ID, sessionID, "email")
 
 	user.PasswordHash = ""
 	c.JSON(http.StatusOK, models.AuthResponse{
@@ -317,10 +275,16 @@ func (h *AuthHandler) Refresh(c *gin.Context) {
 		return
 	}
 
-	// Validate refresh token
-	userID, err := h.validateRefreshToken(refreshToken)
+	// Exchange the refresh token for its successor
+	userID, sessionID, newRefreshToken, err := h.rotateRefreshToken(c, refreshToken)
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		if errors.Is(err, errInvalidRefreshToken) || errors.Is(err, errRefreshTokenExpired) || errors.Is(err, errRefreshTokenReused) {
+			clearRefreshCookie(c)
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+		log.Printf("Refresh token rotation failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to refresh token"})
 		return
 	}
 
@@ -330,42 +294,24 @@ func (h *AuthHandler) Refresh(c *gin.Context) {
 
 	var user models.User
 	err = h.db.QueryRow(ctx, `
-		SELECT id, email, name, avatar, provider, created_at, updated_at
+		SELECT id, email, name, COALESCE(avatar, ''), provider, COALESCE(locale, ''), created_at, updated_at
 		FROM users WHERE id = $1
-	`, userID).Scan(&user.ID, &user.Email, &user.Name, &user.Avatar, &user.Provider, &user.CreatedAt, &user.UpdatedAt)
+	`, userID).Scan(&user.ID, &user.Email, &user.Name, &user.Avatar, &user.Provider, &user.Locale, &user.CreatedAt, &user.UpdatedAt)
 
 	if err != nil {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
 		return
 	}
 
-	// Generate new tokens
-	token, err := h.generateToken(user.ID, user.Email)
+	// Generate new access token
+	token, err := h.generateToken(user.ID, user.Email, sessionID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
 		return
 	}
 
-	newRefreshToken, err := h.generateRefreshToken(user.ID)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate refresh token"})
-		return
-	}
-
-	// Delete old token
-	h.deleteRefreshToken(refreshToken)
-
 	// Set new cookie
-	c.SetSameSite(http.SameSiteLaxMode)
-	c.SetCookie(
-		"refresh_token",
-		newRefreshToken,
-		int(config.AppConfig.RefreshExpiry.Seconds()),
-		"/",
-		"",
-		config.IsProduction(),
-		true,
-	)
+	setRefreshCookie(c, newRefreshToken)
 
 	c.JSON(http.StatusOK, models.AuthResponse{
 		Token:        token,
@@ -376,7 +322,7 @@ func (h *AuthHandler) Refresh(c *gin.Context) {
 
 // Logout handles user logout
 // @Summary      Déconnexion
-// @Description  Déconnecte l'utilisateur et supprime le refresh token
+// @Description  Déconnecte l'utilisateur et révoque la session du refresh token
 // @Tags         auth
 // @Accept       json
 // @Produce      json
@@ -386,20 +332,18 @@ func (h *AuthHandler) Logout(c *gin.Context) {
 	// Get refresh token from cookie
 	refreshToken, err := c.Cookie("refresh_token")
 	if err == nil {
-		h.deleteRefreshToken(refreshToken)
+		if userID, sessionID, ok := h.revokeRefreshTokenFamily(refreshToken); ok {
+			ctx, cancel := database.GetContext()
+			defer cancel()
+
+			entry := newAuditEntry(c, audit.ActionLogout, audit.TargetSession, sessionID.String())
+			entry.ActorID = &userID
+			recordAudit(ctx, h.db, entry)
+		}
 	}
 
 	// Clear cookie
-	c.SetSameSite(http.SameSiteLaxMode)
-	c.SetCookie(
-		"refresh_token",
-		"",
-		-1,
-		"/",
-		"",
-		config.IsProduction(),
-		true,
-	)
+	clearRefreshCookie(c)
 
 	c.JSON(http.StatusOK, gin.H{"message": "Logged out successfully"})
 }
@@ -427,9 +371,9 @@ func (h *AuthHandler) GetMe(c *gin.Context) {
 
 	var user models.User
 	err := h.db.QueryRow(ctx, `
-		SELECT id, email, name, avatar, provider, created_at, updated_at
+		SELECT id, email, name, avatar, provider, COALESCE(locale, ''), created_at, updated_at
 		FROM users WHERE id = $1
-	`, *userID).Scan(&user.ID, &user.Email, &user.Name, &user.Avatar, &user.Provider, &user.CreatedAt, &user.UpdatedAt)
+	`, *userID).Scan(&user.ID, &user.Email, &user.Name, &user.Avatar, &user.Provider, &user.Locale, &user.CreatedAt, &user.UpdatedAt)
 
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
@@ -528,9 +472,9 @@ func (h *AuthHandler) GoogleCallback(c *gin.Context) {
 	// Check if user exists
 	var user models.User
 	err = h.db.QueryRow(ctx, `
-		SELECT id, email, name, avatar, provider, created_at, updated_at
+		SELECT id, email, name, avatar, provider, COALESCE(locale, ''), created_at, updated_at
 		FROM users WHERE email = $1
-	`, googleUser.Email).Scan(&user.ID, &user.Email, &user.Name, &user.Avatar, &user.Provider, &user.CreatedAt, &user.UpdatedAt)
+	`, googleUser.Email).Scan(&user.ID, &user.Email, &user.Name, &user.Avatar, &user.Provider, &user.Locale, &user.CreatedAt, &user.UpdatedAt)
 
 	var userID uuid.UUID
 	userName := googleUser.Name
@@ -538,6 +482,7 @@ func (h *AuthHandler) GoogleCallback(c *gin.Context) {
 		userName = googleUser.Email
 	}
 
+	action := audit.ActionLogin
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			// Create new user
@@ -550,6 +495,7 @@ func (h *AuthHandler) GoogleCallback(c *gin.Context) {
 				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create user"})
 				return
 			}
+			action = audit.ActionRegister
 		} else {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
 			return
@@ -564,23 +510,35 @@ func (h *AuthHandler) GoogleCallback(c *gin.Context) {
 		email = user.Email
 	}
 
-	tokenStr, err := h.generateToken(userID, email)
+	refreshToken, sessionID, err := h.generateRefreshToken(c, userID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate refresh token"})
 		return
 	}
+	setRefreshCookie(c, refreshToken)
 
-	_, err = h.generateRefreshToken(userID)
+	tokenStr, err := h.generateToken(userID, email, sessionID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate refresh token"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
 		return
 	}
 
+	h.auditLogin(ctx, c, action, userID, sessionID, "google")
+
 	// Redirect to frontend with token
 	redirectURL := fmt.Sprintf("%s/auth/callback?token=%s", config.AppConfig.FrontendURL, tokenStr)
 	c.Redirect(http.StatusTemporaryRedirect, redirectURL)
 }
 
+// auditLogin records the start of a session, on registration or login.
+// The request is not authenticated yet, so the actor is set explicitly.
+func (h *AuthHandler) auditLogin(ctx context.Context, c *gin.Context, action string, userID, sessionID uuid.UUID, provider string) {
+	entry := newAuditEntry(c, action, audit.TargetUser, userID.String())
+	entry.ActorID = &userID
+	entry.Changes = audit.Diff(nil, map[string]interface{}{"session_id": sessionID, "provider": provider})
+	recordAudit(ctx, h.db, entry)
+}
+
 // generateStateToken creates a random state token for OAuth
 func generateStateToken() string {
 	b := make([]byte, 16)
@@ -590,7 +548,7 @@ func generateStateToken() string {
 
 // UpdateProfile updates user profile
 // @Summary      Mettre à jour le profil
-// @Description  Met à jour le nom et l'email de l'utilisateur
+// @Description  Met à jour le nom, l'email et la langue des emails (fr, en) de l'utilisateur
 // @Tags         auth
 // @Accept       json
 // @Produce      json
@@ -633,28 +591,38 @@ func (h *AuthHandler) UpdateProfile(c *gin.Context) {
 	}
 
 	// Update user
-	_, err = h.db.Exec(ctx, `
-		UPDATE users SET name = $1, email = $2, updated_at = CURRENT_TIMESTAMP
-		WHERE id = $3
-	`, req.Name, req.Email, *userID)
+	var oldName, oldEmail, oldLocale, newLocale string
+	err = h.db.QueryRow(ctx, `
+		UPDATE users u SET name = $1, email = $2, locale = COALESCE(NULLIF($4, ''), u.locale), updated_at = CURRENT_TIMESTAMP
+		FROM (SELECT id, name, email, locale FROM users WHERE id = $3) old
+		WHERE u.id = old.id
+		RETURNING old.name, old.email, COALESCE(old.locale, ''), COALESCE(u.locale, '')
+	`, req.Name, req.Email, *userID, req.Locale).Scan(&oldName, &oldEmail, &oldLocale, &newLocale)
 
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update profile"})
 		return
 	}
 
+	entry := newAuditEntry(c, audit.ActionProfileUpdate, audit.TargetUser, userID.String())
+	entry.Changes = audit.Diff(
+		map[string]interface{}{"name": oldName, "email": oldEmail, "locale": oldLocale},
+		map[string]interface{}{"name": req.Name, "email": req.Email, "locale": newLocale},
+	)
+	recordAudit(ctx, h.db, entry)
+
 	c.JSON(http.StatusOK, gin.H{"message": "Profile updated successfully"})
 }
 
-// ChangePassword changes user password
+// ChangePassword changes user password and revokes every existing session
 // @Summary      Changer le mot de passe
-// @Description  Change le mot de passe de l'utilisateur
+// @Description  Change le mot de passe de l'utilisateur, révoque toutes ses sessions et en ouvre une nouvelle
 // @Tags         auth
 // @Accept       json
 // @Produce      json
 // @Security     BearerAuth
 // @Param        request body models.ChangePasswordRequest true "Ancien et nouveau mot de passe"
-// @Success      200  {object}  map[string]string
+// @Success      200  {object}  map[string]interface{}  "message, token"
 // @Failure      400  {object}  map[string]string
 // @Failure      401  {object}  map[string]string
 // @Failure      500  {object}  map[string]string
@@ -697,16 +665,73 @@ func (h *AuthHandler) ChangePassword(c *gin.Context) {
 		return
 	}
 
-	// Update password
-	_, err = h.db.Exec(ctx, `
+	// Update password and revoke every session in the same transaction
+	tx, err := h.db.Begin(ctx)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, `
 		UPDATE users SET password_hash = $1, updated_at = CURRENT_TIMESTAMP
 		WHERE id = $2
 	`, string(newHash), *userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update password"})
+		return
+	}
 
+	revoked, err := revokeSessions(ctx, tx, *userID, uuid.Nil)
 	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke sessions"})
+		return
+	}
+
+	entry := newAuditEntry(c, audit.ActionPasswordChange, audit.TargetUser, userID.String())
+	entry.Changes = map[string]audit.Change{"revoked_sessions": {New: revoked}}
+	if err := audit.Record(ctx, tx, entry); err != nil {
+		log.Printf("Failed to record password change: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update password"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Password changed successfully"})
+	if err := tx.Commit(ctx); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update password"})
+		return
+	}
+
+	// Start a fresh session so the current client stays logged in
+	refreshToken, sessionID, err := h.generateRefreshToken(c, *userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate refresh token"})
+		return
+	}
+	setRefreshCookie(c, refreshToken)
+
+	email, _ := c.Get("user_email")
+	emailStr, _ := email.(string)
+	token, err := h.generateToken(*userID, emailStr, sessionID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":       "Password changed successfully",
+		"token":         token,
+		"refresh_token": refreshToken,
+	})
+}
+
+// JWKS publishes the public keys used to sign access tokens
+// @Summary      Clés publiques JWT
+// @Description  Renvoie le JWKS permettant aux autres services de vérifier les jetons d'accès
+// @Tags         auth
+// @Produce      json
+// @Success      200  {object}  jwtkeys.JWKS
+// @Router       /.well-known/jwks.json [get]
+func (h *AuthHandler) JWKS(c *gin.Context) {
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, jwtkeys.Default().JWKS())
 }
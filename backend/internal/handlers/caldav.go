@@ -0,0 +1,703 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"doodle-clone/internal/audit"
+	"doodle-clone/internal/caldav"
+	"doodle-clone/internal/config"
+	"doodle-clone/internal/database"
+	"doodle-clone/internal/events"
+	"doodle-clone/internal/ical"
+	"doodle-clone/internal/middleware"
+	"doodle-clone/internal/models"
+	"doodle-clone/internal/secrets"
+	"doodle-clone/internal/webhooks"
+)
+
+const (
+	// caldavSyncTick is how often the worker looks for accounts due for a sync
+	caldavSyncTick = time.Minute
+	// caldavSyncBatch is the number of accounts synced per tick
+	caldavSyncBatch = 20
+)
+
+// CalDAVHandler connects the CalDAV calendars of users, and fills in their votes from them
+type CalDAVHandler struct {
+	db     *pgxpool.Pool
+	box    *secrets.Box // nil when the integration is disabled
+	client *caldav.Client
+	ticker *time.Ticker
+	stopCh chan struct{}
+}
+
+// NewCalDAVHandler creates a new CalDAV handler. Without CALDAV_ENCRYPTION_KEY, passwords
+// cannot be stored and the integration is disabled.
+func NewCalDAVHandler(db *pgxpool.Pool) *CalDAVHandler {
+	box, err := secrets.NewBox(config.AppConfig.CalDAVEncryptionKey)
+	if err != nil {
+		log.Printf("CalDAV integration disabled: %v", err)
+	}
+	return &CalDAVHandler{
+		db:     db,
+		box:    box,
+		client: caldav.NewClient(webhooks.NewClient(config.AppConfig.CalDAVTimeout, config.AppConfig.CalDAVAllowPrivate)),
+		stopCh: make(chan struct{}),
+	}
+}
+
+// caldavContext returns a context long enough for the database and the CalDAV server
+func caldavContext() (context.Context, context.CancelFunc) {
+	return database.GetContext(config.AppConfig.CalDAVTimeout + 10*time.Second)
+}
+
+// GetCalDAVAccount returns the CalDAV calendar of the current user
+// @Summary      Obtenir le calendrier CalDAV
+// @Description  Retourne le calendrier CalDAV connecté (sans son mot de passe) et l'état de sa dernière synchronisation
+// @Tags         calendar
+// @Produce      json
+// @Security     BearerAuth
+// @Success      200  {object}  models.CalDAVAccount
+// @Failure      401  {object}  map[string]string
+// @Failure      404  {object}  map[string]string
+// @Router       /user/caldav [get]
+func (h *CalDAVHandler) GetCalDAVAccount(c *gin.Context) {
+	userID := middleware.GetCurrentUser(c)
+	if userID == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Not authenticated"})
+		return
+	}
+
+	ctx, cancel := database.GetContext()
+	defer cancel()
+
+	account, _, err := h.loadAccount(ctx, *userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No CalDAV calendar connected"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch CalDAV calendar"})
+		return
+	}
+
+	c.JSON(http.StatusOK, account)
+}
+
+// ConnectCalDAV connects or updates the CalDAV calendar of the current user
+// @Summary      Connecter un calendrier CalDAV
+// @Description  Vérifie l'accès au calendrier (URL de la collection et mot de passe d'application) puis l'enregistre, le mot de passe étant chiffré. Sans mot de passe, le mot de passe actuel est conservé si l'URL ne change pas. Avec auto_fill, les votes des sondages ouverts auxquels l'utilisateur participe sont remplis et tenus à jour.
+// @Tags         calendar
+// @Accept       json
+// @Produce      json
+// @Security     BearerAuth
+// @Param        request  body      models.ConnectCalDAVRequest  true  "Calendrier"
+// @Success      200  {object}  models.CalDAVAccount
+// @Failure      400  {object}  map[string]string
+// @Failure      401  {object}  map[string]string
+// @Failure      503  {object}  map[string]string
+// @Router       /user/caldav [put]
+func (h *CalDAVHandler) ConnectCalDAV(c *gin.Context) {
+	userID := middleware.GetCurrentUser(c)
+	if userID == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Not authenticated"})
+		return
+	}
+	if h.box == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "CalDAV integration is not enabled"})
+		return
+	}
+
+	var req models.ConnectCalDAVRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := caldav.ValidateURL(req.URL); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx, cancel := caldavContext()
+	defer cancel()
+
+	// The current password is kept when none is given, if it can still be read. It is
+	// only ever sent to the server it was given for.
+	before, sealed, err := h.loadAccount(ctx, *userID)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch CalDAV calendar"})
+		return
+	}
+	password := req.Password
+	if password == "" && before != nil && before.URL == req.URL {
+		if current, err := h.credentials(*userID, before.URL, before.Username, sealed); err == nil {
+			password = current.Password
+		}
+	}
+	if password == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Password is required"})
+		return
+	}
+
+	if err := h.client.Verify(ctx, caldav.Account{URL: req.URL, Username: req.Username, Password: password}); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Cannot access the calendar: %v", err)})
+		return
+	}
+	sealed, err = h.box.Seal([]byte(password), userID[:])
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save CalDAV calendar"})
+		return
+	}
+
+	// The next sync is due right away
+	account := models.CalDAVAccount{UserID: *userID, URL: req.URL, Username: req.Username, AutoFill: req.AutoFill}
+	err = h.db.QueryRow(ctx, `
+		INSERT INTO caldav_accounts (user_id, url, username, password_encrypted, auto_fill)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (user_id) DO UPDATE SET
+			url = EXCLUDED.url, username = EXCLUDED.username, password_encrypted = EXCLUDED.password_encrypted,
+			auto_fill = EXCLUDED.auto_fill, last_sync_at = NULL, last_error = NULL, updated_at = CURRENT_TIMESTAMP
+		RETURNING created_at, updated_at
+	`, *userID, req.URL, req.Username, sealed, req.AutoFill).Scan(&account.CreatedAt, &account.UpdatedAt)
+	if err != nil {
+		log.Printf("Failed to save CalDAV calendar: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save CalDAV calendar"})
+		return
+	}
+
+	entry := newAuditEntry(c, audit.ActionCalDAVConnect, audit.TargetCalDAV, userID.String())
+	after := caldavSnapshot(&account)
+	after["password_changed"] = req.Password != ""
+	entry.Changes = audit.Diff(caldavSnapshot(before), after)
+	recordAudit(ctx, h.db, entry)
+
+	c.JSON(http.StatusOK, account)
+}
+
+// DisconnectCalDAV forgets the CalDAV calendar of the current user
+// @Summary      Déconnecter le calendrier CalDAV
+// @Description  Supprime le calendrier et son mot de passe. Les votes remplis depuis le calendrier sont conservés mais ne sont plus mis à jour.
+// @Tags         calendar
+// @Produce      json
+// @Security     BearerAuth
+// @Success      200  {object}  map[string]string
+// @Failure      401  {object}  map[string]string
+// @Failure      404  {object}  map[string]string
+// @Router       /user/caldav [delete]
+func (h *CalDAVHandler) DisconnectCalDAV(c *gin.Context) {
+	userID := middleware.GetCurrentUser(c)
+	if userID == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Not authenticated"})
+		return
+	}
+
+	ctx, cancel := database.GetContext()
+	defer cancel()
+
+	tx, err := h.db.Begin(ctx)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to disconnect CalDAV calendar"})
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	tag, err := tx.Exec(ctx, `DELETE FROM caldav_accounts WHERE user_id = $1`, *userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to disconnect CalDAV calendar"})
+		return
+	}
+	if tag.RowsAffected() == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No CalDAV calendar connected"})
+		return
+	}
+	_, err = tx.Exec(ctx, `UPDATE votes SET source = NULL WHERE user_id = $1 AND source = $2`, *userID, models.VoteSourceCalDAV)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to disconnect CalDAV calendar"})
+		return
+	}
+	if err := audit.Record(ctx, tx, newAuditEntry(c, audit.ActionCalDAVDisconnect, audit.TargetCalDAV, userID.String())); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to disconnect CalDAV calendar"})
+		return
+	}
+	if err := tx.Commit(ctx); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to disconnect CalDAV calendar"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "CalDAV calendar disconnected successfully"})
+}
+
+// SyncCalDAV fills in the votes of the current user from their calendar right away
+// @Summary      Synchroniser le calendrier CalDAV
+// @Description  Remplit les votes des sondages ouverts auxquels l'utilisateur participe depuis son calendrier, sans attendre la synchronisation périodique. Les votes saisis à la main ne sont jamais modifiés.
+// @Tags         calendar
+// @Produce      json
+// @Security     BearerAuth
+// @Success      200  {object}  models.CalDAVSyncResult
+// @Failure      401  {object}  map[string]string
+// @Failure      404  {object}  map[string]string
+// @Failure      409  {object}  map[string]string
+// @Failure      502  {object}  map[string]string
+// @Failure      503  {object}  map[string]string
+// @Router       /user/caldav/sync [post]
+func (h *CalDAVHandler) SyncCalDAV(c *gin.Context) {
+	userID := middleware.GetCurrentUser(c)
+	if userID == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Not authenticated"})
+		return
+	}
+	if h.box == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "CalDAV integration is not enabled"})
+		return
+	}
+
+	ctx, cancel := caldavContext()
+	defer cancel()
+
+	account, ok := h.loadCredentials(c, ctx, *userID)
+	if !ok {
+		return
+	}
+
+	result, err := h.syncAccount(ctx, *userID, *account)
+	h.recordSync(ctx, *userID, err)
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": fmt.Sprintf("Failed to read the calendar: %v", err)})
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// GetPollAvailability compares the date options of a poll with the calendar of the current user
+// @Summary      Disponibilités selon le calendrier CalDAV
+// @Description  Indique pour chaque option de date si l'utilisateur est occupé d'après les créneaux libres/occupés de son calendrier CalDAV, et la réponse suggérée (« non » si occupé, « oui » sinon). Rien n'est enregistré.
+// @Tags         votes
+// @Produce      json
+// @Security     BearerAuth
+// @Param        id   path      string  true  "UUID ou code d'accès du sondage"
+// @Success      200  {object}  map[string]interface{}
+// @Failure      401  {object}  map[string]string
+// @Failure      404  {object}  map[string]string
+// @Failure      409  {object}  map[string]string
+// @Failure      502  {object}  map[string]string
+// @Failure      503  {object}  map[string]string
+// @Router       /polls/{id}/availability [get]
+func (h *CalDAVHandler) GetPollAvailability(c *gin.Context) {
+	userID := middleware.GetCurrentUser(c)
+	if userID == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Not authenticated"})
+		return
+	}
+	if h.box == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "CalDAV integration is not enabled"})
+		return
+	}
+
+	ctx, cancel := caldavContext()
+	defer cancel()
+
+	account, ok := h.loadCredentials(c, ctx, *userID)
+	if !ok {
+		return
+	}
+
+	rows, err := h.db.Query(ctx, `
+		SELECT d.id, d.start_time, d.end_time
+		FROM date_options d
+		JOIN polls p ON p.id = d.poll_id
+		WHERE p.id::text = $1 OR p.access_code = $1
+		ORDER BY d.start_time
+	`, c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch date options"})
+		return
+	}
+	var availability []models.DateOptionAvailability
+	for rows.Next() {
+		var a models.DateOptionAvailability
+		if err := rows.Scan(&a.DateOptionID, &a.StartTime, &a.EndTime); err != nil {
+			rows.Close()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch date options"})
+			return
+		}
+		availability = append(availability, a)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch date options"})
+		return
+	}
+	if len(availability) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Poll not found or without date options"})
+		return
+	}
+
+	from, to := availabilityRange(availability)
+	busy, err := h.client.FreeBusy(ctx, *account, from, to)
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": fmt.Sprintf("Failed to read the calendar: %v", err)})
+		return
+	}
+	busyCount := markBusy(availability, busy)
+
+	c.JSON(http.StatusOK, gin.H{
+		"date_options": availability,
+		"busy_count":   busyCount,
+	})
+}
+
+// loadAccount reads the CalDAV account of a user, with its sealed password
+func (h *CalDAVHandler) loadAccount(ctx context.Context, userID uuid.UUID) (*models.CalDAVAccount, []byte, error) {
+	account := models.CalDAVAccount{UserID: userID}
+	var sealed []byte
+	err := h.db.QueryRow(ctx, `
+		SELECT url, username, password_encrypted, auto_fill, last_sync_at, last_error, created_at, updated_at
+		FROM caldav_accounts WHERE user_id = $1
+	`, userID).Scan(&account.URL, &account.Username, &sealed, &account.AutoFill, &account.LastSyncAt,
+		&account.LastError, &account.CreatedAt, &account.UpdatedAt)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &account, sealed, nil
+}
+
+// loadCredentials reads the CalDAV account of a user and opens its password, writing
+// the error response if it cannot
+func (h *CalDAVHandler) loadCredentials(c *gin.Context, ctx context.Context, userID uuid.UUID) (*caldav.Account, bool) {
+	account, sealed, err := h.loadAccount(ctx, userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No CalDAV calendar connected"})
+		return nil, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch CalDAV calendar"})
+		return nil, false
+	}
+	credentials, err := h.credentials(userID, account.URL, account.Username, sealed)
+	if err != nil {
+		log.Printf("CalDAV calendar of user %s: %v", userID, err)
+		c.JSON(http.StatusConflict, gin.H{"error": "The CalDAV password cannot be read anymore, connect the calendar again"})
+		return nil, false
+	}
+	return credentials, true
+}
+
+// credentials opens the sealed password of an account
+func (h *CalDAVHandler) credentials(userID uuid.UUID, url, username string, sealed []byte) (*caldav.Account, error) {
+	password, err := h.box.Open(sealed, userID[:])
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt CalDAV password: %w", err)
+	}
+	return &caldav.Account{URL: url, Username: username, Password: string(password)}, nil
+}
+
+// caldavSnapshot returns the audited fields of a CalDAV account
+func caldavSnapshot(a *models.CalDAVAccount) map[string]interface{} {
+	if a == nil {
+		return nil
+	}
+	return map[string]interface{}{
+		"url":       a.URL,
+		"username":  a.Username,
+		"auto_fill": a.AutoFill,
+	}
+}
+
+// availabilityRange returns the period covering the date options
+func availabilityRange(options []models.DateOptionAvailability) (from, to time.Time) {
+	from, to = options[0].StartTime, options[0].StartTime
+	for _, o := range options {
+		if o.StartTime.Before(from) {
+			from = o.StartTime
+		}
+		if end := dateOptionEnd(o.StartTime, o.EndTime); end.After(to) {
+			to = end
+		}
+	}
+	// The period includes its end, where a slot without duration may be
+	return from, to.Add(time.Second)
+}
+
+// markBusy sets the availability of the date options from busy times, and suggests a
+// response: "no" when busy, "yes" otherwise. It returns the number of busy options.
+func markBusy(options []models.DateOptionAvailability, busy []ical.Period) int {
+	count := 0
+	for i := range options {
+		o := &options[i]
+		o.Busy = false
+		o.Response = "yes"
+		start, end := o.StartTime, dateOptionEnd(o.StartTime, o.EndTime)
+		for _, b := range busy {
+			if overlaps(start, end, b.Start, b.End) {
+				o.Busy = true
+				o.Response = "no"
+				count++
+				break
+			}
+		}
+	}
+	return count
+}
+
+// StartSync starts the periodic sync of the votes of accounts with auto_fill
+func (h *CalDAVHandler) StartSync() {
+	if h.box == nil {
+		return
+	}
+	h.ticker = time.NewTicker(caldavSyncTick)
+	log.Println("CalDAV sync started")
+
+	go func() {
+		for {
+			select {
+			case <-h.ticker.C:
+				h.syncDueAccounts()
+			case <-h.stopCh:
+				h.ticker.Stop()
+				log.Println("CalDAV sync stopped")
+				return
+			}
+		}
+	}()
+}
+
+// StopSync stops the periodic sync
+func (h *CalDAVHandler) StopSync() {
+	close(h.stopCh)
+}
+
+// syncDueAccounts syncs the accounts not synced for CALDAV_SYNC_INTERVAL. Claiming an
+// account sets its sync time, so replicas do not sync it twice.
+func (h *CalDAVHandler) syncDueAccounts() {
+	ctx, cancel := database.GetContext(time.Minute)
+	defer cancel()
+
+	rows, err := h.db.Query(ctx, `
+		WITH due AS (
+			SELECT user_id FROM caldav_accounts
+			WHERE auto_fill AND (last_sync_at IS NULL OR last_sync_at <= CURRENT_TIMESTAMP - make_interval(secs => $1))
+			ORDER BY last_sync_at NULLS FIRST
+			LIMIT $2
+			FOR UPDATE SKIP LOCKED
+		)
+		UPDATE caldav_accounts a SET last_sync_at = CURRENT_TIMESTAMP
+		FROM due
+		WHERE a.user_id = due.user_id
+		RETURNING a.user_id, a.url, a.username, a.password_encrypted
+	`, config.AppConfig.CalDAVSyncInterval.Seconds(), caldavSyncBatch)
+	if err != nil {
+		log.Printf("Error claiming CalDAV accounts: %v", err)
+		return
+	}
+	type dueAccount struct {
+		UserID   uuid.UUID
+		URL      string
+		Username string
+		Sealed   []byte
+	}
+	var due []dueAccount
+	for rows.Next() {
+		var a dueAccount
+		if err := rows.Scan(&a.UserID, &a.URL, &a.Username, &a.Sealed); err != nil {
+			log.Printf("Error scanning CalDAV account: %v", err)
+			continue
+		}
+		due = append(due, a)
+	}
+	rows.Close()
+
+	for _, a := range due {
+		syncCtx, cancel := caldavContext()
+		account, err := h.credentials(a.UserID, a.URL, a.Username, a.Sealed)
+		if err == nil {
+			_, err = h.syncAccount(syncCtx, a.UserID, *account)
+		}
+		if err != nil {
+			log.Printf("Failed to sync the CalDAV calendar of user %s: %v", a.UserID, err)
+		}
+		h.recordSync(syncCtx, a.UserID, err)
+		cancel()
+	}
+}
+
+// recordSync records the outcome of a sync
+func (h *CalDAVHandler) recordSync(ctx context.Context, userID uuid.UUID, syncErr error) {
+	var message *string
+	if syncErr != nil {
+		s := syncErr.Error()
+		message = &s
+	}
+	_, err := h.db.Exec(ctx, `
+		UPDATE caldav_accounts SET last_sync_at = CURRENT_TIMESTAMP, last_error = $2 WHERE user_id = $1
+	`, userID, message)
+	if err != nil {
+		log.Printf("Failed to record the CalDAV sync of user %s: %v", userID, err)
+	}
+}
+
+// syncOption is a date option whose vote the sync may fill in
+type syncOption struct {
+	models.DateOptionAvailability
+	PollID   uuid.UUID
+	VoteID   *uuid.UUID
+	Previous *string // Response filled in by an earlier sync
+}
+
+// syncAccount fills in the votes of a user on the open polls they take part in: the
+// upcoming date options they did not answer, and those filled in by an earlier sync.
+// Votes the user entered are left alone, as are polls limiting the number of votes.
+func (h *CalDAVHandler) syncAccount(ctx context.Context, userID uuid.UUID, account caldav.Account) (models.CalDAVSyncResult, error) {
+	var result models.CalDAVSyncResult
+
+	rows, err := h.db.Query(ctx, `
+		SELECT d.id, d.poll_id, d.start_time, d.end_time, v.id, v.response
+		FROM date_options d
+		JOIN polls p ON p.id = d.poll_id
+		LEFT JOIN votes v ON v.date_option_id = d.id AND v.user_id = $1
+		WHERE p.final_date IS NULL
+		  AND (p.expires_at IS NULL OR p.expires_at > CURRENT_TIMESTAMP)
+		  AND NOT p.limit_votes
+		  AND d.start_time > CURRENT_TIMESTAMP
+		  AND EXISTS (SELECT 1 FROM votes mine WHERE mine.poll_id = p.id AND mine.user_id = $1)
+		  AND (v.id IS NULL OR v.source = $2)
+		ORDER BY d.poll_id, d.start_time
+	`, userID, models.VoteSourceCalDAV)
+	if err != nil {
+		return result, fmt.Errorf("failed to fetch date options: %w", err)
+	}
+	var options []syncOption
+	for rows.Next() {
+		var o syncOption
+		if err := rows.Scan(&o.DateOptionID, &o.PollID, &o.StartTime, &o.EndTime, &o.VoteID, &o.Previous); err != nil {
+			rows.Close()
+			return result, fmt.Errorf("failed to fetch date options: %w", err)
+		}
+		options = append(options, o)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return result, fmt.Errorf("failed to fetch date options: %w", err)
+	}
+	if len(options) == 0 {
+		return result, nil
+	}
+
+	availability := make([]models.DateOptionAvailability, len(options))
+	for i, o := range options {
+		availability[i] = o.DateOptionAvailability
+	}
+	from, to := availabilityRange(availability)
+	busy, err := h.client.FreeBusy(ctx, account, from, to)
+	if err != nil {
+		return result, err
+	}
+	markBusy(availability, busy)
+	for i := range options {
+		options[i].DateOptionAvailability = availability[i]
+	}
+
+	var userName string
+	if err := h.db.QueryRow(ctx, `SELECT name FROM users WHERE id = $1`, userID).Scan(&userName); err != nil {
+		return result, fmt.Errorf("failed to get user: %w", err)
+	}
+
+	// One transaction per poll, so a failing poll does not hold back the others
+	for start := 0; start < len(options); {
+		end := start
+		for end < len(options) && options[end].PollID == options[start].PollID {
+			end++
+		}
+		updated, err := h.fillVotes(ctx, userID, userName, options[start:end])
+		if err != nil {
+			return result, fmt.Errorf("failed to fill in the votes of poll %s: %w", options[start].PollID, err)
+		}
+		if updated > 0 {
+			result.Polls++
+			result.Updated += updated
+		}
+		start = end
+	}
+	return result, nil
+}
+
+// fillVotes writes the suggested responses of the date options of one poll
+func (h *CalDAVHandler) fillVotes(ctx context.Context, userID uuid.UUID, userName string, options []syncOption) (int, error) {
+	tx, err := h.db.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	updated := 0
+	for _, o := range options {
+		if o.Previous != nil && *o.Previous == o.Response {
+			continue
+		}
+
+		// A vote the user entered meanwhile wins
+		voteID := uuid.New()
+		err := tx.QueryRow(ctx, `
+			INSERT INTO votes (id, poll_id, date_option_id, user_id, user_name, response, source)
+			VALUES ($1, $2, $3, $4, $5, $6, $7)
+			ON CONFLICT (poll_id, date_option_id, user_id)
+			DO UPDATE SET response = EXCLUDED.response WHERE votes.source = EXCLUDED.source
+			RETURNING id
+		`, voteID, o.PollID, o.DateOptionID, userID, userName, o.Response, models.VoteSourceCalDAV).Scan(&voteID)
+		if errors.Is(err, pgx.ErrNoRows) {
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+
+		vote := models.Vote{
+			ID:           voteID,
+			PollID:       o.PollID,
+			DateOptionID: o.DateOptionID,
+			UserID:       &userID,
+			UserName:     userName,
+			Response:     o.Response,
+			Source:       models.VoteSourceCalDAV,
+		}
+		entry := audit.Entry{
+			ActorID:    &userID,
+			Action:     audit.ActionVoteCreate,
+			TargetType: audit.TargetVote,
+			TargetID:   voteID.String(),
+			PollID:     &o.PollID,
+		}
+		eventType := events.TypeVoteCreated
+		var before map[string]interface{}
+		if o.Previous != nil {
+			entry.Action = audit.ActionVoteUpdate
+			eventType = events.TypeVoteUpdated
+			before = voteSnapshot(vote)
+			before["response"] = *o.Previous
+		}
+		after := voteSnapshot(vote)
+		after["source"] = models.VoteSourceCalDAV
+		entry.Changes = audit.Diff(before, after)
+		if err := audit.Record(ctx, tx, entry); err != nil {
+			return 0, err
+		}
+		if err := publishEvent(ctx, tx, voteEvent(eventType, vote)); err != nil {
+			return 0, err
+		}
+		updated++
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return 0, err
+	}
+	return updated, nil
+}
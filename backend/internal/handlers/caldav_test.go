@@ -0,0 +1,47 @@
+package handlers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"doodle-clone/internal/ical"
+	"doodle-clone/internal/models"
+)
+
+func TestMarkBusy(t *testing.T) {
+	at := func(day, hour int) time.Time { return time.Date(2026, 3, day, hour, 0, 0, 0, time.UTC) }
+	end := func(day, hour int) *time.Time { t := at(day, hour); return &t }
+	options := []models.DateOptionAvailability{
+		{DateOptionID: uuid.New(), StartTime: at(2, 9), EndTime: end(2, 10)},
+		{DateOptionID: uuid.New(), StartTime: at(2, 14), EndTime: end(2, 16)},
+		{DateOptionID: uuid.New(), StartTime: at(3, 12)},
+		{DateOptionID: uuid.New(), StartTime: at(4, 9), EndTime: end(4, 10), Busy: true, Response: "no"},
+	}
+	busy := []ical.Period{
+		{Start: at(2, 8), End: at(2, 9)},   // Ends when the first option starts
+		{Start: at(2, 15), End: at(2, 17)}, // Overlaps the second one
+		{Start: at(3, 11), End: at(3, 13)}, // Around the third one
+	}
+
+	assert.Equal(t, 2, markBusy(options, busy))
+	var responses []string
+	for _, o := range options {
+		responses = append(responses, o.Response)
+		assert.Equal(t, o.Response == "no", o.Busy)
+	}
+	assert.Equal(t, []string{"yes", "no", "no", "yes"}, responses)
+}
+
+func TestAvailabilityRange(t *testing.T) {
+	at := func(day, hour int) time.Time { return time.Date(2026, 3, day, hour, 0, 0, 0, time.UTC) }
+	end := at(2, 12)
+	from, to := availabilityRange([]models.DateOptionAvailability{
+		{StartTime: at(3, 9)},
+		{StartTime: at(2, 10), EndTime: &end},
+		{StartTime: at(5, 18)},
+	})
+	assert.Equal(t, at(2, 10), from)
+	assert.Equal(t, at(5, 18).Add(time.Second), to, "the end includes options without duration")
+}
@@ -0,0 +1,284 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"doodle-clone/internal/audit"
+	"doodle-clone/internal/config"
+	"doodle-clone/internal/database"
+	"doodle-clone/internal/ical"
+	"doodle-clone/internal/middleware"
+	"doodle-clone/internal/models"
+)
+
+// calendarFeedPrefix marks calendar feed tokens, which only give access to the feed
+const calendarFeedPrefix = "dcal_"
+
+// calendarFeedName is shown by calendar applications for the subscription
+const calendarFeedName = "Doodle Clone"
+
+type CalendarHandler struct {
+	db *pgxpool.Pool
+}
+
+func NewCalendarHandler(db *pgxpool.Pool) *CalendarHandler {
+	return &CalendarHandler{db: db}
+}
+
+// GetCalendarFeed returns the calendar subscription of the current user
+// @Summary      Obtenir l'abonnement calendrier
+// @Description  Indique si l'abonnement calendrier de l'utilisateur est actif (sans son jeton)
+// @Tags         calendar
+// @Produce      json
+// @Security     BearerAuth
+// @Success      200  {object}  models.CalendarFeed
+// @Failure      401  {object}  map[string]string
+// @Failure      404  {object}  map[string]string
+// @Router       /user/calendar/feed [get]
+func (h *CalendarHandler) GetCalendarFeed(c *gin.Context) {
+	userID := middleware.GetCurrentUser(c)
+	if userID == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Not authenticated"})
+		return
+	}
+
+	ctx, cancel := database.GetContext()
+	defer cancel()
+
+	feed := models.CalendarFeed{UserID: *userID}
+	err := h.db.QueryRow(ctx, `
+		SELECT token_prefix, last_used_at, created_at FROM calendar_feeds WHERE user_id = $1
+	`, *userID).Scan(&feed.TokenPrefix, &feed.LastUsedAt, &feed.CreatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Calendar feed not enabled"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch calendar feed"})
+		return
+	}
+
+	c.JSON(http.StatusOK, feed)
+}
+
+// CreateCalendarFeed enables the calendar subscription of the current user, replacing its token
+// @Summary      Créer l'abonnement calendrier
+// @Description  Génère l'URL secrète (webcal) de l'abonnement aux événements de l'utilisateur. L'ancienne URL cesse de fonctionner. Le jeton n'est affiché qu'une seule fois.
+// @Tags         calendar
+// @Produce      json
+// @Security     BearerAuth
+// @Success      201  {object}  models.CreateCalendarFeedResponse
+// @Failure      401  {object}  map[string]string
+// @Failure      500  {object}  map[string]string
+// @Router       /user/calendar/feed [post]
+func (h *CalendarHandler) CreateCalendarFeed(c *gin.Context) {
+	userID := middleware.GetCurrentUser(c)
+	if userID == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Not authenticated"})
+		return
+	}
+
+	secret, err := randomToken(32)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+	token := calendarFeedPrefix + secret
+
+	ctx, cancel := database.GetContext()
+	defer cancel()
+
+	feed := models.CalendarFeed{UserID: *userID, TokenPrefix: token[:len(calendarFeedPrefix)+6]}
+	err = h.db.QueryRow(ctx, `
+		INSERT INTO calendar_feeds (user_id, token_hash, token_prefix)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (user_id) DO UPDATE SET
+			token_hash = EXCLUDED.token_hash, token_prefix = EXCLUDED.token_prefix, etag = NULL,
+			modified_at = CURRENT_TIMESTAMP, last_used_at = NULL, created_at = CURRENT_TIMESTAMP
+		RETURNING created_at
+	`, *userID, middleware.HashToken(token), feed.TokenPrefix).Scan(&feed.CreatedAt)
+	if err != nil {
+		log.Printf("Failed to create calendar feed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create calendar feed"})
+		return
+	}
+
+	entry := newAuditEntry(c, audit.ActionFeedCreate, audit.TargetFeed, userID.String())
+	entry.Changes = audit.Diff(nil, map[string]interface{}{"prefix": feed.TokenPrefix})
+	recordAudit(ctx, h.db, entry)
+
+	url := fmt.Sprintf("%s/api/user/calendar.ics?token=%s", config.AppConfig.BaseURL, token)
+	c.JSON(http.StatusCreated, models.CreateCalendarFeedResponse{
+		CalendarFeed: feed,
+		Token:        token,
+		URL:          url,
+		WebcalURL:    webcalURL(url),
+	})
+}
+
+// RevokeCalendarFeed disables the calendar subscription of the current user
+// @Summary      Révoquer l'abonnement calendrier
+// @Description  Désactive l'URL de l'abonnement calendrier
+// @Tags         calendar
+// @Produce      json
+// @Security     BearerAuth
+// @Success      200  {object}  map[string]string
+// @Failure      401  {object}  map[string]string
+// @Failure      404  {object}  map[string]string
+// @Router       /user/calendar/feed [delete]
+func (h *CalendarHandler) RevokeCalendarFeed(c *gin.Context) {
+	userID := middleware.GetCurrentUser(c)
+	if userID == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Not authenticated"})
+		return
+	}
+
+	ctx, cancel := database.GetContext()
+	defer cancel()
+
+	tag, err := h.db.Exec(ctx, `DELETE FROM calendar_feeds WHERE user_id = $1`, *userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke calendar feed"})
+		return
+	}
+	if tag.RowsAffected() == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Calendar feed not enabled"})
+		return
+	}
+
+	recordAudit(ctx, h.db, newAuditEntry(c, audit.ActionFeedRevoke, audit.TargetFeed, userID.String()))
+
+	c.JSON(http.StatusOK, gin.H{"message": "Calendar feed revoked successfully"})
+}
+
+// CalendarFeed serves the finalized events a user organized or voted yes on
+// @Summary      Abonnement calendrier (webcal)
+// @Description  Calendrier des événements fixés que l'utilisateur organise ou auxquels il a voté oui. Authentifié par le jeton de l'abonnement, les applications de calendrier ne pouvant pas envoyer d'en-tête Authorization. Gère ETag et Last-Modified.
+// @Tags         calendar
+// @Produce      text/calendar
+// @Param        token  query  string  true  "Jeton de l'abonnement"
+// @Success      200  {file}  file
+// @Success      304  "Non modifié"
+// @Failure      401  {object}  map[string]string
+// @Router       /user/calendar.ics [get]
+func (h *CalendarHandler) CalendarFeed(c *gin.Context) {
+	token := c.Query("token")
+	if !strings.HasPrefix(token, calendarFeedPrefix) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid calendar token"})
+		return
+	}
+
+	ctx, cancel := database.GetContext()
+	defer cancel()
+
+	var userID uuid.UUID
+	err := h.db.QueryRow(ctx, `
+		SELECT user_id FROM calendar_feeds WHERE token_hash = $1
+	`, middleware.HashToken(token)).Scan(&userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid calendar token"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	cal, err := h.feedCalendar(ctx, userID)
+	if err != nil {
+		log.Printf("Failed to build calendar feed of user %s: %v", userID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build calendar"})
+		return
+	}
+	body := cal.Bytes()
+
+	// The feed is only known to have changed when its content does: Last-Modified is
+	// the first time the current content was served
+	sum := sha256.Sum256(body)
+	etag := hex.EncodeToString(sum[:])
+	var modifiedAt time.Time
+	err = h.db.QueryRow(ctx, `
+		UPDATE calendar_feeds SET
+			modified_at = CASE WHEN etag IS DISTINCT FROM $2 THEN CURRENT_TIMESTAMP ELSE modified_at END,
+			etag = $2, last_used_at = CURRENT_TIMESTAMP
+		WHERE user_id = $1
+		RETURNING modified_at
+	`, userID, etag).Scan(&modifiedAt)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	// ServeContent answers If-None-Match and If-Modified-Since with 304 Not Modified
+	c.Header("ETag", `"`+etag+`"`)
+	c.Header("Content-Type", "text/calendar; charset=utf-8")
+	c.Header("Cache-Control", "private, no-cache")
+	http.ServeContent(c.Writer, c.Request, "calendar.ics", modifiedAt, bytes.NewReader(body))
+}
+
+// feedCalendar lists the finalized events a user organized or voted yes on
+func (h *CalendarHandler) feedCalendar(ctx context.Context, userID uuid.UUID) (*ical.Calendar, error) {
+	rows, err := h.db.Query(ctx, `
+		SELECT p.id, p.ics_sequence, p.updated_at, p.title, p.description, p.location, p.access_code,
+		       d.start_time, d.end_time, COALESCE(u.name, ''), COALESCE(u.email, '')
+		FROM polls p
+		JOIN date_options d ON d.id = p.final_date
+		LEFT JOIN users u ON u.id = p.creator_id
+		WHERE p.creator_id = $1
+		   OR EXISTS (
+				SELECT 1 FROM votes v
+				WHERE v.date_option_id = p.final_date AND v.user_id = $1 AND v.response = 'yes'
+		   )
+		ORDER BY d.start_time, p.id
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	cal := &ical.Calendar{ProdID: icsProdID, Name: calendarFeedName}
+	for rows.Next() {
+		var pollID uuid.UUID
+		var accessCode, organizerName, organizerEmail string
+		var event ical.Event
+		err := rows.Scan(&pollID, &event.Sequence, &event.Stamp, &event.Summary, &event.Description, &event.Location,
+			&accessCode, &event.Start, &event.End, &organizerName, &organizerEmail)
+		if err != nil {
+			return nil, err
+		}
+
+		// Same UID as the invitations, so subscribed calendars do not show the event twice
+		event.UID = pollEventUID(pollID)
+		event.URL = fmt.Sprintf("%s/poll/%s", config.AppConfig.FrontendURL, accessCode)
+		event.Status = ical.StatusConfirmed
+		if organizerEmail != "" {
+			event.Organizer = &ical.Person{Name: organizerName, Address: ical.Mailto(organizerEmail)}
+		}
+		cal.Events = append(cal.Events, event)
+	}
+	return cal, rows.Err()
+}
+
+// webcalURL returns the webcal:// form of an http(s) URL, which calendar applications
+// open as a subscription
+func webcalURL(url string) string {
+	for _, scheme := range []string{"https://", "http://"} {
+		if rest, ok := strings.CutPrefix(url, scheme); ok {
+			return "webcal://" + rest
+		}
+	}
+	return url
+}
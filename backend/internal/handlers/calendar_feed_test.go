@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"doodle-clone/internal/models"
+)
+
+func TestCalendarHandler_CalendarFeedPrefix(t *testing.T) {
+	// Tokens of other kinds are refused before any lookup
+	handler := NewCalendarHandler(nil)
+	router := setupTestContext()
+	router.GET("/user/calendar.ics", handler.CalendarFeed)
+
+	for _, token := range []string{"", "pat_0123456789", "dcal"} {
+		req, _ := http.NewRequest("GET", "/user/calendar.ics?token="+url.QueryEscape(token), nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusUnauthorized, w.Code, "token %q", token)
+	}
+}
+
+func TestCalendarHandler_CalendarFeed(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	handler := NewCalendarHandler(db)
+
+	router := setupTestContext()
+	router.Use(testAuth())
+	router.POST("/user/calendar/feed", handler.CreateCalendarFeed)
+	router.DELETE("/user/calendar/feed", handler.RevokeCalendarFeed)
+	router.GET("/user/calendar.ics", handler.CalendarFeed)
+
+	user := createTestUserWithEmail(t, db, "feed-"+uuid.NewString()+"@example.com")
+	defer cleanupTestData(t, db, user.ID, uuid.Nil)
+
+	send := func(method, path string, header http.Header) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, path, nil)
+		for k, v := range header {
+			req.Header[k] = v
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+	asUser := http.Header{"X-Test-User": {user.ID.String()}}
+
+	w := send("POST", "/user/calendar/feed", asUser)
+	require.Equal(t, http.StatusCreated, w.Code)
+	var feed models.CreateCalendarFeedResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &feed))
+	require.NotEmpty(t, feed.Token)
+	feedPath := "/user/calendar.ics?token=" + url.QueryEscape(feed.Token)
+
+	t.Run("Valid token", func(t *testing.T) {
+		w := send("GET", feedPath, nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Header().Get("Content-Type"), "text/calendar")
+		assert.Contains(t, w.Body.String(), "BEGIN:VCALENDAR")
+		etag := w.Header().Get("ETag")
+		require.NotEmpty(t, etag)
+
+		// Unchanged feed
+		w = send("GET", feedPath, http.Header{"If-None-Match": {etag}})
+		assert.Equal(t, http.StatusNotModified, w.Code)
+		assert.Empty(t, w.Body.String())
+
+		w = send("GET", feedPath, http.Header{"If-None-Match": {`"stale"`}})
+		assert.Equal(t, http.StatusOK, w.Code)
+	})
+
+	t.Run("Unknown token", func(t *testing.T) {
+		w := send("GET", "/user/calendar.ics?token="+calendarFeedPrefix+"unknown", nil)
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+
+	t.Run("Revoked token", func(t *testing.T) {
+		w := send("DELETE", "/user/calendar/feed", asUser)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		w = send("GET", feedPath, nil)
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+}
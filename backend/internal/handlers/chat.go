@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"doodle-clone/internal/chat"
+	"doodle-clone/internal/config"
+	"doodle-clone/internal/models"
+)
+
+// chatKinds maps chat notification types to the message posted
+var chatKinds = map[string]string{
+	models.NotificationTypePollCreated: chat.KindPollCreated,
+	models.NotificationTypePollClosing: chat.KindPollClosing,
+	models.NotificationTypeFinalDate:   chat.KindPollFinalized,
+}
+
+// chatEnabled tells whether a chat webhook is configured and the admin setting allows it
+func (h *NotificationHandler) chatEnabled(ctx context.Context, db querier) bool {
+	if !h.chat.Enabled() {
+		return false
+	}
+	var enabled bool
+	err := db.QueryRow(ctx, `
+		SELECT CASE WHEN value = 'true' THEN true ELSE false END
+		FROM notification_settings WHERE key = $1
+	`, models.SettingChatEnabled).Scan(&enabled)
+	return err == nil && enabled
+}
+
+// scheduleChatNotification queues a chat message about a poll for the notification worker.
+// Password-protected polls are never posted.
+func (h *NotificationHandler) scheduleChatNotification(ctx context.Context, tx pgx.Tx, pollID uuid.UUID, notificationType string) error {
+	if !h.chatEnabled(ctx, tx) {
+		return nil
+	}
+
+	_, err := tx.Exec(ctx, `
+		INSERT INTO notifications (poll_id, type, channel, scheduled_at)
+		SELECT id, $2, $3, CURRENT_TIMESTAMP FROM polls
+		WHERE id = $1 AND password_hash IS NULL
+	`, pollID, notificationType, models.NotificationChannelChat)
+	return err
+}
+
+// queueChatClosingNotices queues a closing notice, once, for the undecided polls
+// expiring within the configured notice. The unique index on chat closing notices
+// settles races between workers.
+func (h *NotificationHandler) queueChatClosingNotices(ctx context.Context) {
+	if !h.chatEnabled(ctx, h.db) {
+		return
+	}
+
+	_, err := h.db.Exec(ctx, `
+		INSERT INTO notifications (poll_id, type, channel, scheduled_at)
+		SELECT p.id, $1, $2, CURRENT_TIMESTAMP FROM polls p
+		WHERE p.expires_at > CURRENT_TIMESTAMP AND p.expires_at <= $3
+		AND p.final_date IS NULL AND p.archived_at IS NULL AND p.password_hash IS NULL
+		AND NOT EXISTS (
+			SELECT 1 FROM notifications n
+			WHERE n.poll_id = p.id AND n.type = $1 AND n.channel = $2
+		)
+		ON CONFLICT (poll_id, type) WHERE channel = 'chat' AND type = 'poll_closing' DO NOTHING
+	`, models.NotificationTypePollClosing, models.NotificationChannelChat, time.Now().Add(config.AppConfig.ChatClosingNotice))
+	if err != nil {
+		log.Printf("Failed to queue chat closing notices: %v", err)
+	}
+}
+
+// sendChatNotification posts the summary of a poll, with its current leaderboard
+func (h *NotificationHandler) sendChatNotification(ctx context.Context, pollID uuid.UUID, notificationType string) error {
+	kind, ok := chatKinds[notificationType]
+	if !ok {
+		return fmt.Errorf("unknown chat notification type: %s", notificationType)
+	}
+
+	var summary chat.PollSummary
+	var accessCode string
+	err := h.db.QueryRow(ctx, `
+		SELECT p.title, COALESCE(p.description, ''), COALESCE(p.location, ''), p.access_code,
+		       p.expires_at, p.final_date, COALESCE(u.name, '')
+		FROM polls p
+		LEFT JOIN users u ON u.id = p.creator_id
+		WHERE p.id = $1
+	`, pollID).Scan(&summary.Title, &summary.Description, &summary.Location, &accessCode,
+		&summary.ExpiresAt, &summary.FinalDate, &summary.Creator)
+	if err != nil {
+		return fmt.Errorf("failed to get poll: %w", err)
+	}
+	summary.URL = fmt.Sprintf("%s/poll/%s", config.AppConfig.FrontendURL, accessCode)
+
+	polls := &PollHandler{db: h.db}
+	summary.Options, err = polls.getDateOptionsWithStats(ctx, pollID)
+	if err != nil {
+		return fmt.Errorf("failed to get date options: %w", err)
+	}
+
+	if err := h.chat.Post(ctx, chat.PollMessage(kind, summary)); err != nil {
+		return fmt.Errorf("failed to post to chat: %w", err)
+	}
+	return nil
+}
@@ -1,13 +1,16 @@
 package handlers
 
 import (
+	"log"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
+	"doodle-clone/internal/audit"
 	"doodle-clone/internal/database"
+	"doodle-clone/internal/events"
 	"doodle-clone/internal/middleware"
 	"doodle-clone/internal/models"
 )
@@ -53,9 +56,9 @@ func (h *CommentHandler) GetComments(c *gin.Context) {
 	// Get comments with user info
 	rows, err := h.db.Query(ctx, `
 		SELECT c.id, c.poll_id, c.user_id, c.content, c.created_at,
-		       u.id, u.name, u.avatar, u.email
+		       u.id, COALESCE(u.name, 'Deleted user'), COALESCE(u.avatar, ''), COALESCE(u.email, '')
 		FROM comments c
-		JOIN users u ON c.user_id = u.id
+		LEFT JOIN users u ON c.user_id = u.id
 		WHERE c.poll_id = $1
 		ORDER BY c.created_at DESC
 		LIMIT 100
@@ -131,9 +134,16 @@ func (h *CommentHandler) CreateComment(c *gin.Context) {
 		return
 	}
 
+	tx, err := h.db.Begin(ctx)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create comment"})
+		return
+	}
+	defer tx.Rollback(ctx)
+
 	// Create comment
 	commentID := uuid.New()
-	_, err = h.db.Exec(ctx, `
+	_, err = tx.Exec(ctx, `
 		INSERT INTO comments (id, poll_id, user_id, content)
 		VALUES ($1, $2, $3, $4)
 	`, commentID, pollID, *userID, req.Content)
@@ -145,7 +155,7 @@ func (h *CommentHandler) CreateComment(c *gin.Context) {
 
 	// Get created comment with user info
 	var comment models.CommentWithUser
-	err = h.db.QueryRow(ctx, `
+	err = tx.QueryRow(ctx, `
 		SELECT c.id, c.poll_id, c.user_id, c.content, c.created_at,
 		       u.id, u.name, u.avatar
 		FROM comments c
@@ -161,6 +171,36 @@ func (h *CommentHandler) CreateComment(c *gin.Context) {
 		return
 	}
 
+	entry := newAuditEntry(c, audit.ActionCommentCreate, audit.TargetComment, commentID.String())
+	entry.PollID = &comment.PollID
+	entry.Changes = audit.Diff(nil, map[string]interface{}{"content": comment.Content})
+	if err := audit.Record(ctx, tx, entry); err != nil {
+		log.Printf("Error recording comment: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create comment"})
+		return
+	}
+	err = publishEvent(ctx, tx, events.Event{
+		PollID: comment.PollID,
+		Type:   events.TypeCommentCreated,
+		Data: map[string]interface{}{
+			"comment_id": comment.ID,
+			"content":    comment.Content,
+			"user_id":    comment.User.ID,
+			"user_name":  comment.User.Name,
+			"created_at": comment.CreatedAt,
+		},
+	})
+	if err != nil {
+		log.Printf("Error recording comment event: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create comment"})
+		return
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create comment"})
+		return
+	}
+
 	c.JSON(http.StatusCreated, comment)
 }
 
@@ -206,10 +246,11 @@ func (h *CommentHandler) UpdateComment(c *gin.Context) {
 	defer cancel()
 
 	// Get the comment and verify ownership
-	var commentUserID uuid.UUID
+	var commentUserID, commentPollID uuid.UUID
+	var content string
 	err := h.db.QueryRow(ctx, `
-		SELECT user_id FROM comments WHERE id = $1 AND poll_id = $2
-	`, commentID, pollID).Scan(&commentUserID)
+		SELECT user_id, poll_id, content FROM comments WHERE id = $1 AND poll_id = $2
+	`, commentID, pollID).Scan(&commentUserID, &commentPollID, &content)
 
 	if err != nil {
 		if err == pgx.ErrNoRows {
@@ -226,8 +267,15 @@ func (h *CommentHandler) UpdateComment(c *gin.Context) {
 		return
 	}
 
+	tx, err := h.db.Begin(ctx)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update comment"})
+		return
+	}
+	defer tx.Rollback(ctx)
+
 	// Update comment
-	_, err = h.db.Exec(ctx, `
+	_, err = tx.Exec(ctx, `
 		UPDATE comments SET content = $1 WHERE id = $2
 	`, req.Content, commentID)
 
@@ -236,6 +284,30 @@ func (h *CommentHandler) UpdateComment(c *gin.Context) {
 		return
 	}
 
+	entry := newAuditEntry(c, audit.ActionCommentUpdate, audit.TargetComment, commentID)
+	entry.PollID = &commentPollID
+	entry.Changes = audit.Diff(map[string]interface{}{"content": content}, map[string]interface{}{"content": req.Content})
+	if err := audit.Record(ctx, tx, entry); err != nil {
+		log.Printf("Error recording comment update: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update comment"})
+		return
+	}
+	err = publishEvent(ctx, tx, events.Event{
+		PollID: commentPollID,
+		Type:   events.TypeCommentUpdated,
+		Data:   map[string]interface{}{"comment_id": commentID, "content": req.Content},
+	})
+	if err != nil {
+		log.Printf("Error recording comment event: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update comment"})
+		return
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update comment"})
+		return
+	}
+
 	c.JSON(http.StatusOK, gin.H{"message": "Comment updated successfully"})
 }
 
@@ -274,14 +346,15 @@ func (h *CommentHandler) DeleteComment(c *gin.Context) {
 	defer cancel()
 
 	// Get the comment and poll creator
-	var commentUserID uuid.UUID
+	var commentUserID, commentPollID uuid.UUID
 	var pollCreatorID uuid.UUID
+	var content string
 	err := h.db.QueryRow(ctx, `
-		SELECT c.user_id, p.creator_id
+		SELECT c.user_id, c.poll_id, c.content, p.creator_id
 		FROM comments c
 		JOIN polls p ON c.poll_id = p.id
 		WHERE c.id = $1 AND c.poll_id = $2
-	`, commentID, pollID).Scan(&commentUserID, &pollCreatorID)
+	`, commentID, pollID).Scan(&commentUserID, &commentPollID, &content, &pollCreatorID)
 
 	if err != nil {
 		if err == pgx.ErrNoRows {
@@ -298,12 +371,43 @@ func (h *CommentHandler) DeleteComment(c *gin.Context) {
 		return
 	}
 
+	tx, err := h.db.Begin(ctx)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete comment"})
+		return
+	}
+	defer tx.Rollback(ctx)
+
 	// Delete comment
-	_, err = h.db.Exec(ctx, "DELETE FROM comments WHERE id = $1", commentID)
+	_, err = tx.Exec(ctx, "DELETE FROM comments WHERE id = $1", commentID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete comment"})
 		return
 	}
 
+	entry := newAuditEntry(c, audit.ActionCommentDelete, audit.TargetComment, commentID)
+	entry.PollID = &commentPollID
+	entry.Changes = audit.Diff(map[string]interface{}{"content": content, "user_id": commentUserID}, nil)
+	if err := audit.Record(ctx, tx, entry); err != nil {
+		log.Printf("Error recording comment deletion: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete comment"})
+		return
+	}
+	err = publishEvent(ctx, tx, events.Event{
+		PollID: commentPollID,
+		Type:   events.TypeCommentDeleted,
+		Data:   map[string]interface{}{"comment_id": commentID},
+	})
+	if err != nil {
+		log.Printf("Error recording comment event: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete comment"})
+		return
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete comment"})
+		return
+	}
+
 	c.JSON(http.StatusOK, gin.H{"message": "Comment deleted successfully"})
 }
@@ -0,0 +1,395 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"doodle-clone/internal/audit"
+	"doodle-clone/internal/database"
+	"doodle-clone/internal/events"
+	"doodle-clone/internal/ical"
+	"doodle-clone/internal/middleware"
+	"doodle-clone/internal/models"
+)
+
+const (
+	// maxCalendarUpload is the size limit of uploaded .ics files
+	maxCalendarUpload = 1 << 20
+	// maxImportedDates is the number of date options one import may create
+	maxImportedDates = 100
+	// maxBusyOccurrences bounds the busy times read from a participant's calendar
+	maxBusyOccurrences = 10000
+)
+
+// ImportDateOptions creates date options from the events of an uploaded calendar
+// @Summary      Importer des dates depuis un fichier ICS
+// @Description  Crée une option de date pour chaque événement (et chaque occurrence des événements récurrents) du fichier .ics compris dans la période demandée. Les dates déjà proposées et les événements annulés sont ignorés.
+// @Tags         polls
+// @Accept       multipart/form-data
+// @Produce      json
+// @Security     BearerAuth
+// @Param        id    path      string  true   "UUID du sondage"
+// @Param        file  formData  file    true   "Fichier .ics (1 Mo maximum)"
+// @Param        from  formData  string  false  "Début de la période (RFC 3339 ou AAAA-MM-JJ, maintenant par défaut)"
+// @Param        to    formData  string  false  "Fin de la période (un an après le début par défaut)"
+// @Param        tz    formData  string  false  "Fuseau horaire des dates sans fuseau (IANA, UTC par défaut)"
+// @Success      201  {object}  map[string]interface{}
+// @Failure      400  {object}  map[string]string
+// @Failure      401  {object}  map[string]string
+// @Failure      403  {object}  map[string]string
+// @Failure      500  {object}  map[string]string
+// @Router       /polls/{id}/dates/import [post]
+func (h *PollHandler) ImportDateOptions(c *gin.Context) {
+	userID := middleware.GetCurrentUser(c)
+	if userID == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Not authenticated"})
+		return
+	}
+
+	pollID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid poll ID"})
+		return
+	}
+
+	calendar, loc, err := readCalendarUpload(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	from, to, err := importRange(c, loc)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx, cancel := database.GetContext()
+	defer cancel()
+
+	// Check if user is the creator
+	var creatorID uuid.UUID
+	err = h.db.QueryRow(ctx, "SELECT creator_id FROM polls WHERE id = $1", pollID).Scan(&creatorID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	if creatorID != *userID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only the creator can add date options"})
+		return
+	}
+
+	// Dates the poll already proposes
+	rows, err := h.db.Query(ctx, `SELECT start_time, end_time FROM date_options WHERE poll_id = $1`, pollID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch date options"})
+		return
+	}
+	seen := map[string]bool{}
+	for rows.Next() {
+		var start time.Time
+		var end *time.Time
+		if err := rows.Scan(&start, &end); err != nil {
+			rows.Close()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch date options"})
+			return
+		}
+		seen[dateOptionKey(start, end)] = true
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch date options"})
+		return
+	}
+
+	var candidates []ical.Event
+	skipped := 0
+	for _, event := range calendar {
+		if event.Status == ical.StatusCancelled {
+			skipped++
+			continue
+		}
+		// Enough instances to go past the limit once the known dates are left out
+		for _, o := range event.Occurrences(from, to, maxImportedDates+len(seen)+1) {
+			// Only events starting in the range, not those already under way
+			if o.Start.Before(from) {
+				continue
+			}
+			key := dateOptionKey(o.Start, o.End)
+			if seen[key] {
+				skipped++
+				continue
+			}
+			seen[key] = true
+			candidates = append(candidates, o)
+		}
+		if len(candidates) > maxImportedDates {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": fmt.Sprintf("The calendar has more than %d new dates in this period, narrow the date range", maxImportedDates),
+			})
+			return
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].Start.Before(candidates[j].Start)
+	})
+
+	tx, err := h.db.Begin(ctx)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to import date options"})
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	dateOptions := make([]models.DateOption, 0, len(candidates))
+	for _, o := range candidates {
+		var dateOption models.DateOption
+		err = tx.QueryRow(ctx, `
+			INSERT INTO date_options (id, poll_id, start_time, end_time)
+			VALUES ($1, $2, $3, $4)
+			RETURNING id, poll_id, start_time, end_time, created_at
+		`, uuid.New(), pollID, o.Start, o.End).Scan(&dateOption.ID, &dateOption.PollID, &dateOption.StartTime, &dateOption.EndTime, &dateOption.CreatedAt)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to import date options"})
+			return
+		}
+
+		err = publishEvent(ctx, tx, dateOptionEvent(events.TypeDateOptionCreated, dateOption.PollID, dateOption.ID, dateOption.StartTime, dateOption.EndTime))
+		if err != nil {
+			log.Printf("Failed to record date option event: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to import date options"})
+			return
+		}
+		dateOptions = append(dateOptions, dateOption)
+	}
+
+	if len(dateOptions) > 0 {
+		if _, err := recordPollVersion(ctx, tx, pollID, userID, models.PollVersionDateAdd, nil); err != nil {
+			log.Printf("Failed to record version of poll %s: %v", pollID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to import date options"})
+			return
+		}
+
+		ids := make([]uuid.UUID, len(dateOptions))
+		for i, do := range dateOptions {
+			ids[i] = do.ID
+		}
+		entry := newAuditEntry(c, audit.ActionPollDateImport, audit.TargetPoll, pollID.String())
+		entry.PollID = &pollID
+		entry.Changes = audit.Diff(nil, map[string]interface{}{
+			"date_option_ids": ids,
+			"from":            from,
+			"to":              to,
+		})
+		if err := audit.Record(ctx, tx, entry); err != nil {
+			log.Printf("Error recording date import: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to import date options"})
+			return
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to import date options"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"date_options": dateOptions,
+		"count":        len(dateOptions),
+		"skipped":      skipped,
+	})
+}
+
+// CheckBusyDates compares the date options of a poll with a participant's calendar
+// @Summary      Comparer les dates avec son agenda
+// @Description  Indique les options de date en conflit avec les événements du fichier .ics d'un participant, pour pré-remplir « non » sur ces créneaux. Les événements marqués disponibles (TRANSP:TRANSPARENT) ou annulés sont ignorés. Ni le fichier ni les réponses ne sont enregistrés.
+// @Tags         votes
+// @Accept       multipart/form-data
+// @Produce      json
+// @Param        id    path      string  true   "UUID ou code d'accès du sondage"
+// @Param        file  formData  file    true   "Fichier .ics (1 Mo maximum)"
+// @Param        tz    formData  string  false  "Fuseau horaire des dates sans fuseau (IANA, UTC par défaut)"
+// @Success      200  {object}  map[string]interface{}
+// @Failure      400  {object}  map[string]string
+// @Failure      404  {object}  map[string]string
+// @Failure      500  {object}  map[string]string
+// @Router       /polls/{id}/dates/busy [post]
+func (h *PollHandler) CheckBusyDates(c *gin.Context) {
+	calendar, _, err := readCalendarUpload(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx, cancel := database.GetContext()
+	defer cancel()
+
+	rows, err := h.db.Query(ctx, `
+		SELECT d.id, d.start_time, d.end_time
+		FROM date_options d
+		JOIN polls p ON p.id = d.poll_id
+		WHERE p.id::text = $1 OR p.access_code = $1
+		ORDER BY d.start_time
+	`, c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch date options"})
+		return
+	}
+	var availability []models.DateOptionAvailability
+	for rows.Next() {
+		var a models.DateOptionAvailability
+		if err := rows.Scan(&a.DateOptionID, &a.StartTime, &a.EndTime); err != nil {
+			rows.Close()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch date options"})
+			return
+		}
+		availability = append(availability, a)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch date options"})
+		return
+	}
+	if len(availability) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Poll not found or without date options"})
+		return
+	}
+
+	// Busy times around the date options
+	from := availability[0].StartTime
+	to := from
+	for _, a := range availability {
+		if end := dateOptionEnd(a.StartTime, a.EndTime); end.After(to) {
+			to = end
+		}
+	}
+	var busy []ical.Event
+	for _, event := range calendar {
+		if event.Transparent || event.Status == ical.StatusCancelled {
+			continue
+		}
+		// The range includes its end, where a slot without duration may be
+		busy = append(busy, event.Occurrences(from, to.Add(time.Second), maxBusyOccurrences-len(busy))...)
+		if len(busy) >= maxBusyOccurrences {
+			break
+		}
+	}
+
+	busyCount := 0
+	for i := range availability {
+		a := &availability[i]
+		start, end := a.StartTime, dateOptionEnd(a.StartTime, a.EndTime)
+		for _, b := range busy {
+			if !overlaps(start, end, b.Start, dateOptionEnd(b.Start, b.End)) {
+				continue
+			}
+			a.Busy = true
+			a.Response = "no"
+			a.Conflict = b.Summary
+			busyCount++
+			break
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"date_options": availability,
+		"busy_count":   busyCount,
+	})
+}
+
+// readCalendarUpload parses the "file" field of a multipart form. Times without a time
+// zone are read in the "tz" field, UTC by default. Errors are meant for the user.
+func readCalendarUpload(c *gin.Context) ([]ical.Event, *time.Location, error) {
+	// The limit must be set before the form is read, by FormFile or PostForm
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxCalendarUpload+64*1024)
+	header, err := c.FormFile("file")
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			return nil, nil, errors.New("The calendar file is too large")
+		}
+		return nil, nil, errors.New("A calendar file is required")
+	}
+
+	loc := time.UTC
+	if tz := c.PostForm("tz"); tz != "" {
+		if loc, err = time.LoadLocation(tz); err != nil {
+			return nil, nil, fmt.Errorf("Unknown time zone %q", tz)
+		}
+	}
+	if header.Size > maxCalendarUpload {
+		return nil, nil, errors.New("The calendar file is too large")
+	}
+
+	file, err := header.Open()
+	if err != nil {
+		return nil, nil, errors.New("Failed to read the calendar file")
+	}
+	defer file.Close()
+
+	calendar, err := ical.Parse(file, loc)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Invalid calendar file: %v", err)
+	}
+	return calendar, loc, nil
+}
+
+// importRange reads the period to import, from now to a year later by default
+func importRange(c *gin.Context, loc *time.Location) (from, to time.Time, err error) {
+	from = time.Now()
+	if v := c.PostForm("from"); v != "" {
+		if from, err = parseRangeBound(v, loc); err != nil {
+			return from, to, errors.New("Invalid from date")
+		}
+	}
+	to = from.AddDate(1, 0, 0)
+	if v := c.PostForm("to"); v != "" {
+		if to, err = parseRangeBound(v, loc); err != nil {
+			return from, to, errors.New("Invalid to date")
+		}
+	}
+	if !to.After(from) {
+		return from, to, errors.New("The end of the period must be after its start")
+	}
+	return from, to, nil
+}
+
+// parseRangeBound reads a RFC 3339 time, or a date at midnight in loc
+func parseRangeBound(value string, loc *time.Location) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.ParseInLocation(time.DateOnly, value, loc)
+}
+
+// dateOptionKey identifies the slot of a date option, whatever its time zone
+func dateOptionKey(start time.Time, end *time.Time) string {
+	key := start.UTC().Format(time.RFC3339)
+	if end != nil {
+		key += "/" + end.UTC().Format(time.RFC3339)
+	}
+	return key
+}
+
+// dateOptionEnd returns the end of a slot, its start when it has none
+func dateOptionEnd(start time.Time, end *time.Time) time.Time {
+	if end == nil {
+		return start
+	}
+	return *end
+}
+
+// overlaps tells whether two slots share some time. A slot without duration overlaps
+// the slots it falls in, and those starting with it.
+func overlaps(start1, end1, start2, end2 time.Time) bool {
+	if start1.Equal(start2) {
+		return true
+	}
+	return start1.Before(end2) && start2.Before(end1)
+}
@@ -0,0 +1,48 @@
+package handlers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOverlaps(t *testing.T) {
+	at := func(hour int) time.Time { return time.Date(2026, 3, 14, hour, 0, 0, 0, time.UTC) }
+
+	assert.True(t, overlaps(at(10), at(12), at(11), at(13)))
+	assert.True(t, overlaps(at(10), at(12), at(9), at(14)))
+	assert.False(t, overlaps(at(10), at(12), at(12), at(13)), "back to back slots")
+	assert.False(t, overlaps(at(10), at(12), at(8), at(10)))
+
+	// Slots without duration
+	assert.True(t, overlaps(at(11), at(11), at(10), at(12)))
+	assert.True(t, overlaps(at(10), at(10), at(10), at(12)))
+	assert.False(t, overlaps(at(12), at(12), at(10), at(12)))
+	assert.True(t, overlaps(at(10), at(10), at(10), at(10)))
+}
+
+func TestDateOptionKey(t *testing.T) {
+	paris := time.FixedZone("CET", 3600)
+	start := time.Date(2026, 3, 14, 10, 0, 0, 0, time.UTC)
+	end := start.Add(time.Hour)
+	endParis := end.In(paris)
+
+	assert.Equal(t, dateOptionKey(start, &end), dateOptionKey(start.In(paris), &endParis))
+	assert.NotEqual(t, dateOptionKey(start, &end), dateOptionKey(start, nil))
+}
+
+func TestParseRangeBound(t *testing.T) {
+	paris := time.FixedZone("CET", 3600)
+
+	d, err := parseRangeBound("2026-03-14", paris)
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2026, 3, 13, 23, 0, 0, 0, time.UTC), d.UTC())
+
+	d, err = parseRangeBound("2026-03-14T10:00:00Z", paris)
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2026, 3, 14, 10, 0, 0, 0, time.UTC), d)
+
+	_, err = parseRangeBound("14/03/2026", paris)
+	assert.Error(t, err)
+}
@@ -0,0 +1,283 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"doodle-clone/internal/config"
+	"doodle-clone/internal/database"
+	"doodle-clone/internal/email"
+	"doodle-clone/internal/middleware"
+	"doodle-clone/internal/models"
+	"doodle-clone/internal/notify"
+)
+
+// testEmailPrefix marks the subject of emails sent from the admin test action
+const testEmailPrefix = "[Test] "
+
+// PreviewEmail renders a notification without sending it
+// @Summary      Prévisualiser un email
+// @Description  Génère une notification pour un sondage et un destinataire, sans l'envoyer (admin uniquement)
+// @Tags         admin
+// @Produce      json
+// @Produce      html
+// @Security     BearerAuth
+// @Param        type     query  string  true   "Type de notification (event_reminder, new_vote, account_locked...)"
+// @Param        poll_id  query  string  false  "UUID du sondage (sauf account_locked)"
+// @Param        user_id  query  string  false  "UUID du destinataire (créateur du sondage, ou soi-même pour account_locked, par défaut)"
+// @Param        locale   query  string  false  "Langue (celle du destinataire par défaut)"
+// @Param        format   query  string  false  "json (défaut), html ou text"
+// @Success      200  {object}  map[string]interface{}  "to, subject, html, text"
+// @Failure      400  {object}  map[string]string
+// @Failure      401  {object}  map[string]string
+// @Failure      403  {object}  map[string]string
+// @Failure      404  {object}  map[string]string
+// @Router       /admin/emails/preview [get]
+func (h *NotificationHandler) PreviewEmail(c *gin.Context) {
+	userID := middleware.GetCurrentUser(c)
+	if userID == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Not authenticated"})
+		return
+	}
+
+	notificationType := c.Query("type")
+	pollID, err := optionalUUID(c.Query("poll_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid poll ID"})
+		return
+	}
+	recipientID, err := optionalUUID(c.Query("user_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+	format := c.DefaultQuery("format", "json")
+	if format != "json" && format != "html" && format != "text" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid format"})
+		return
+	}
+
+	ctx, cancel := database.GetContext()
+	defer cancel()
+
+	if !isAdmin(ctx, h.db, *userID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Admin access required"})
+		return
+	}
+
+	to, msg, ok := h.renderEmail(c, ctx, notificationType, pollID, recipientID, c.Query("locale"))
+	if !ok {
+		return
+	}
+
+	switch format {
+	case "html":
+		c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(msg.HTML))
+	case "text":
+		c.Data(http.StatusOK, "text/plain; charset=utf-8", []byte(msg.Subject+"\n\n"+msg.Text))
+	default:
+		c.JSON(http.StatusOK, gin.H{
+			"to":      to,
+			"subject": msg.Subject,
+			"html":    msg.HTML,
+			"text":    msg.Text,
+		})
+	}
+}
+
+// SendTestEmail sends a notification to the current admin through the configured backend
+// @Summary      Envoyer un email de test
+// @Description  Envoie une notification à l'administrateur connecté, par le canal configuré pour son type (admin uniquement)
+// @Tags         admin
+// @Accept       json
+// @Produce      json
+// @Security     BearerAuth
+// @Param        request  body  models.TestEmailRequest  true  "Type, sondage et langue"
+// @Success      200  {object}  map[string]string  "message, to"
+// @Failure      400  {object}  map[string]string
+// @Failure      401  {object}  map[string]string
+// @Failure      403  {object}  map[string]string
+// @Failure      404  {object}  map[string]string
+// @Failure      502  {object}  map[string]string
+// @Router       /admin/emails/test [post]
+func (h *NotificationHandler) SendTestEmail(c *gin.Context) {
+	userID := middleware.GetCurrentUser(c)
+	if userID == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Not authenticated"})
+		return
+	}
+
+	var req models.TestEmailRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx, cancel := database.GetContext(30 * time.Second)
+	defer cancel()
+
+	if !isAdmin(ctx, h.db, *userID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Admin access required"})
+		return
+	}
+
+	to, msg, ok := h.renderEmail(c, ctx, req.Type, req.PollID, userID, req.Locale)
+	if !ok {
+		return
+	}
+
+	err := h.notifier.Notify(ctx, notify.Message{
+		Type:    req.Type,
+		To:      []string{to},
+		Subject: testEmailPrefix + msg.Subject,
+		HTML:    msg.HTML,
+		Text:    msg.Text,
+	})
+	if err != nil {
+		log.Printf("Failed to send test email to %s: %v", to, err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to send test email: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Test email sent", "to": to})
+}
+
+// EmailDiagnostics reports the email configuration and checks the SMTP server
+// @Summary      Diagnostic des emails
+// @Description  Indique le canal des notifications, les modèles disponibles et teste la connexion au serveur SMTP (admin uniquement)
+// @Tags         admin
+// @Produce      json
+// @Security     BearerAuth
+// @Success      200  {object}  map[string]interface{}
+// @Failure      401  {object}  map[string]string
+// @Failure      403  {object}  map[string]string
+// @Router       /admin/emails/diagnostics [get]
+func (h *NotificationHandler) EmailDiagnostics(c *gin.Context) {
+	userID := middleware.GetCurrentUser(c)
+	if userID == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Not authenticated"})
+		return
+	}
+
+	ctx, cancel := database.GetContext()
+	defer cancel()
+
+	if !isAdmin(ctx, h.db, *userID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Admin access required"})
+		return
+	}
+
+	smtp := gin.H{"configured": email.IsConfigured()}
+	if email.IsConfigured() {
+		sender := email.NewSender()
+		smtp["address"] = sender.Address()
+
+		// Dials, starts TLS and authenticates, without sending anything
+		start := time.Now()
+		err := sender.Check()
+		smtp["reachable"] = err == nil
+		smtp["duration_ms"] = time.Since(start).Milliseconds()
+		if err != nil {
+			smtp["error"] = err.Error()
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"backend":        notify.Describe(),
+		"smtp":           smtp,
+		"templates":      email.TemplateNames(),
+		"locales":        email.Locales,
+		"default_locale": config.AppConfig.EmailLocale,
+		"templates_dir":  config.AppConfig.EmailTemplatesDir,
+	})
+}
+
+// renderEmail renders a notification for the preview and test actions, answering the
+// request when it fails
+func (h *NotificationHandler) renderEmail(c *gin.Context, ctx context.Context, notificationType string, pollID, recipientID *uuid.UUID, locale string) (string, *email.Rendered, bool) {
+	if !isEmailTemplate(notificationType) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Unknown notification type"})
+		return "", nil, false
+	}
+	if locale != "" && !email.IsLocale(locale) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Unsupported locale"})
+		return "", nil, false
+	}
+
+	var to string
+	var msg *email.Rendered
+	var err error
+	if notificationType == models.NotificationTypeAccountLocked {
+		// Sent to users, not about polls: the admin's own account by default
+		if recipientID == nil {
+			recipientID = middleware.GetCurrentUser(c)
+		}
+		to, msg, err = h.renderAccountLocked(ctx, c.ClientIP(), *recipientID, locale)
+	} else {
+		if pollID == nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "poll_id is required"})
+			return "", nil, false
+		}
+		to, msg, err = h.renderNotification(ctx, *pollID, recipientID, notificationType, locale)
+	}
+	if errors.Is(err, pgx.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Poll or user not found"})
+		return "", nil, false
+	}
+	if err != nil {
+		log.Printf("Failed to render %s email: %v", notificationType, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to render email"})
+		return "", nil, false
+	}
+	return to, msg, true
+}
+
+// renderAccountLocked writes the lockout warning of a user as if they had just been locked out
+func (h *NotificationHandler) renderAccountLocked(ctx context.Context, ipAddress string, userID uuid.UUID, locale string) (string, *email.Rendered, error) {
+	data := email.Data{
+		URL:         config.AppConfig.FrontendURL + "/profile",
+		IPAddress:   ipAddress,
+		LockedUntil: time.Now().Add(config.AppConfig.LoginLockoutDuration),
+	}
+	var to string
+	err := h.db.QueryRow(ctx, `
+		SELECT email, name, COALESCE(locale, '') FROM users WHERE id = $1
+	`, userID).Scan(&to, &data.RecipientName, &data.Locale)
+	if err != nil {
+		return "", nil, err
+	}
+	if locale != "" {
+		data.Locale = locale
+	}
+
+	msg, err := h.templates.Render(models.NotificationTypeAccountLocked, data)
+	return to, msg, err
+}
+
+// isEmailTemplate checks if a notification type is written from a template
+func isEmailTemplate(notificationType string) bool {
+	for _, name := range email.TemplateNames() {
+		if name == notificationType {
+			return true
+		}
+	}
+	return false
+}
+
+// optionalUUID parses an optional UUID parameter
+func optionalUUID(s string) (*uuid.UUID, error) {
+	if s == "" {
+		return nil, nil
+	}
+	id, err := uuid.Parse(s)
+	if err != nil {
+		return nil, err
+	}
+	return &id, nil
+}
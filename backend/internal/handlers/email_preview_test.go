@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"doodle-clone/internal/email"
+)
+
+func TestNotificationHandler_PreviewEmail(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	templates, err := email.LoadTemplates("", "fr")
+	require.NoError(t, err)
+	handler := NewNotificationHandler(db, nil, templates)
+
+	router := setupTestContext()
+	router.GET("/admin/emails/preview", testAuth(), handler.PreviewEmail)
+
+	admin := createTestUserWithEmail(t, db, "admin-"+uuid.NewString()+"@example.com")
+	defer cleanupTestData(t, db, admin.ID, uuid.Nil)
+	user := createTestUserWithEmail(t, db, "user-"+uuid.NewString()+"@example.com")
+	defer cleanupTestData(t, db, user.ID, uuid.Nil)
+
+	saved := adminEmails
+	adminEmails = append([]string{admin.Email}, adminEmails...)
+	defer func() { adminEmails = saved }()
+
+	preview := func(userID uuid.UUID, query string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("GET", "/admin/emails/preview?"+query, nil)
+		req.Header.Set("X-Test-User", userID.String())
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("Admin", func(t *testing.T) {
+		w := preview(admin.ID, "type=account_locked&locale=en")
+		assert.Equal(t, http.StatusOK, w.Code)
+		var response map[string]string
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		assert.Equal(t, admin.Email, response["to"])
+		assert.NotEmpty(t, response["subject"])
+		assert.NotEmpty(t, response["html"])
+		assert.NotEmpty(t, response["text"])
+	})
+
+	t.Run("Not an admin", func(t *testing.T) {
+		w := preview(user.ID, "type=account_locked")
+		assert.Equal(t, http.StatusForbidden, w.Code)
+	})
+
+	t.Run("Not authenticated", func(t *testing.T) {
+		req, _ := http.NewRequest("GET", "/admin/emails/preview?type=account_locked", nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+
+	t.Run("Unknown template", func(t *testing.T) {
+		w := preview(admin.ID, "type=no_such_template")
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+
+	t.Run("Unknown locale", func(t *testing.T) {
+		w := preview(admin.ID, "type=account_locked&locale=xx")
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+
+	t.Run("Unknown recipient", func(t *testing.T) {
+		w := preview(admin.ID, "type=account_locked&user_id="+uuid.NewString())
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+}
@@ -0,0 +1,165 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"doodle-clone/internal/config"
+	"doodle-clone/internal/database"
+	"doodle-clone/internal/events"
+	"doodle-clone/internal/models"
+	"doodle-clone/internal/outbox"
+)
+
+// publishEvent records an event in the outbox, with the transaction of the change it
+// describes. Once committed, the relay delivers it to the live streams, the webhooks
+// and the notifications (see RelayHandlers); on error, roll the change back.
+func publishEvent(ctx context.Context, tx execer, e events.Event) error {
+	return outbox.Record(ctx, tx, e)
+}
+
+// RelayHandlers returns the effects of poll events, applied by the outbox relay
+func RelayHandlers(notifications *NotificationHandler) []outbox.Handler {
+	return []outbox.Handler{
+		outbox.LiveStreams,
+		func(ctx context.Context, tx pgx.Tx, e events.Event) error {
+			return enqueueWebhooks(ctx, tx, e)
+		},
+		notifications.HandleEvent,
+	}
+}
+
+// voteEvent builds the event of a vote, its voter kept apart for anonymous polls
+func voteEvent(eventType string, v models.Vote) events.Event {
+	return events.Event{
+		PollID: v.PollID,
+		Type:   eventType,
+		Data: map[string]interface{}{
+			"vote_id":        v.ID,
+			"date_option_id": v.DateOptionID,
+			"response":       v.Response,
+		},
+		Voter: &events.Voter{UserID: v.UserID, Name: v.UserName},
+	}
+}
+
+// dateOptionEvent builds the event of a date option added to or removed from a poll
+func dateOptionEvent(eventType string, pollID, dateOptionID uuid.UUID, startTime time.Time, endTime *time.Time) events.Event {
+	return events.Event{
+		PollID: pollID,
+		Type:   eventType,
+		Data: map[string]interface{}{
+			"date_option_id": dateOptionID,
+			"start_time":     startTime,
+			"end_time":       endTime,
+		},
+	}
+}
+
+// EventHandler streams live poll updates
+type EventHandler struct {
+	db     *pgxpool.Pool
+	broker *events.Broker
+}
+
+// NewEventHandler creates a new event handler
+func NewEventHandler(db *pgxpool.Pool, broker *events.Broker) *EventHandler {
+	return &EventHandler{db: db, broker: broker}
+}
+
+// StreamPollEvents streams the changes of a poll as Server-Sent Events
+// @Summary      Flux d'événements d'un sondage
+// @Description  Flux Server-Sent Events des votes, commentaires, dates et de la date finale d'un sondage. Les votants ne sont pas inclus sur les sondages anonymes.
+// @Tags         polls
+// @Produce      text/event-stream
+// @Param        id           path   string  true   "UUID du sondage ou code d'accès"
+// @Param        poll_access  query  string  false  "Jeton d'accès d'un sondage protégé par mot de passe"
+// @Success      200  {string}  string  "event: vote-created"
+// @Failure      403  {object}  map[string]interface{}
+// @Failure      404  {object}  map[string]string
+// @Router       /polls/{id}/events [get]
+func (h *EventHandler) StreamPollEvents(c *gin.Context) {
+	ctx, cancel := database.GetContext()
+	defer cancel()
+
+	query := `SELECT id, anonymous FROM polls WHERE access_code = $1`
+	if _, err := uuid.Parse(c.Param("id")); err == nil {
+		query = `SELECT id, anonymous FROM polls WHERE id = $1`
+	}
+
+	var pollID uuid.UUID
+	var anonymous bool
+	err := h.db.QueryRow(ctx, query, c.Param("id")).Scan(&pollID, &anonymous)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Poll not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	cancel()
+
+	sub := h.broker.Subscribe(pollID)
+	defer sub.Close()
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no") // Disable proxy buffering in nginx
+	c.Status(http.StatusOK)
+
+	if !writeSSE(c, "ready", map[string]interface{}{"poll_id": pollID}) {
+		return
+	}
+
+	heartbeat := time.NewTicker(config.AppConfig.EventStreamHeartbeat)
+	defer heartbeat.Stop()
+	maxAge := time.NewTimer(config.AppConfig.EventStreamMaxAge)
+	defer maxAge.Stop()
+
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case <-maxAge.C:
+			return
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(c.Writer, ": ping\n\n"); err != nil {
+				return
+			}
+			c.Writer.Flush()
+		case e, ok := <-sub.C:
+			if !ok {
+				// Dropped for lagging behind, or shutting down: the client reconnects
+				return
+			}
+			if !writeSSE(c, e.Type, e.Payload(!anonymous)) {
+				return
+			}
+		}
+	}
+}
+
+// writeSSE writes one event to the stream, returning false once the client is gone
+func writeSSE(c *gin.Context, eventType string, data interface{}) bool {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		log.Printf("Error encoding %s event: %v", eventType, err)
+		return true
+	}
+	if _, err := fmt.Fprintf(c.Writer, "event: %s\ndata: %s\n\n", eventType, payload); err != nil {
+		return false
+	}
+	c.Writer.Flush()
+	return true
+}
@@ -11,7 +11,10 @@ import (
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/jung-kurt/gofpdf"
+	"doodle-clone/internal/config"
 	"doodle-clone/internal/database"
+	"doodle-clone/internal/ical"
+	"doodle-clone/internal/middleware"
 	"doodle-clone/internal/models"
 )
 
@@ -173,52 +176,50 @@ func (h *ExportHandler) ExportICS(c *gin.Context) {
 		return
 	}
 
-	// If final date is set, export only that
-	// Otherwise export all dates
-	var datesToExport []models.DateOptionWithStats
-	if poll.FinalDate != nil {
-		for _, do := range poll.DateOptions {
-			if do.ID == *poll.FinalDate {
-				datesToExport = []models.DateOptionWithStats{do}
-				break
-			}
+	// If final date is set, export only that, as a confirmed event with its attendees.
+	// Otherwise export all dates as tentative events.
+	now := time.Now()
+	cal := ical.Calendar{ProdID: icsProdID, Method: "PUBLISH"}
+	url := fmt.Sprintf("%s/poll/%s", config.AppConfig.FrontendURL, poll.AccessCode)
+	for _, do := range poll.DateOptions {
+		if poll.FinalDate != nil && do.ID != *poll.FinalDate {
+			continue
 		}
-	} else {
-		datesToExport = poll.DateOptions
-	}
 
-	// Generate ICS content
-	ics := "BEGIN:VCALENDAR\r\n"
-	ics += "VERSION:2.0\r\n"
-	ics += "PRODID:-//Doodle Clone//EN\r\n"
-	ics += "CALSCALE:GREGORIAN\r\n"
-	ics += "METHOD:PUBLISH\r\n"
-
-	for _, do := range datesToExport {
-		ics += "BEGIN:VEVENT\r\n"
-		ics += fmt.Sprintf("DTSTART:%s\r\n", formatICSDate(do.StartTime))
-		if do.EndTime != nil {
-			ics += fmt.Sprintf("DTEND:%s\r\n", formatICSDate(*do.EndTime))
+		event := ical.Event{
+			UID:         fmt.Sprintf("%s@doodleclone", do.ID),
+			Stamp:       now,
+			Start:       do.StartTime,
+			End:         do.EndTime,
+			Summary:     poll.Title,
+			Description: icsDescription(poll.Description, do),
+			Location:    poll.Location,
+			URL:         url,
+			Status:      ical.StatusTentative,
 		}
-		ics += fmt.Sprintf("SUMMARY:%s\r\n", poll.Title)
-		if poll.Location != "" {
-			ics += fmt.Sprintf("LOCATION:%s\r\n", poll.Location)
-		}
-		if poll.Description != "" {
-			ics += fmt.Sprintf("DESCRIPTION:%s\\r\\\\nVote count: %d yes, %d no, %d maybe\r\n",
-				poll.Description, do.YesCount, do.NoCount, do.MaybeCount)
+		if poll.FinalDate != nil {
+			event.UID = pollEventUID(poll.ID)
+			event.Sequence = poll.Sequence
+			event.Status = ical.StatusConfirmed
+			if poll.Creator.Email != "" {
+				event.Organizer = &ical.Person{Name: poll.Creator.Name, Address: ical.Mailto(poll.Creator.Email)}
+			}
+			if !poll.Anonymous {
+				viewer := middleware.GetCurrentUser(c)
+				event.Attendees, err = h.icsAttendees(ctx, do.ID, viewer != nil && *viewer == poll.CreatorID)
+				if err != nil {
+					c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch attendees"})
+					return
+				}
+			}
 		}
-		ics += fmt.Sprintf("UID:%s@doodleclone\r\n", do.ID.String())
-		ics += "END:VEVENT\r\n"
+		cal.Events = append(cal.Events, event)
 	}
 
-	ics += "END:VCALENDAR\r\n"
-
 	// Set headers
-	c.Header("Content-Type", "text/calendar")
 	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=poll_%s.ics", pollID))
 
-	c.String(http.StatusOK, ics)
+	c.Data(http.StatusOK, "text/calendar; charset=utf-8", cal.Bytes())
 }
 
 // ExportCSV generates a CSV export of votes
@@ -298,6 +299,7 @@ func (h *ExportHandler) ExportCSV(c *gin.Context) {
 
 type PollExport struct {
 	models.Poll
+	Sequence     int // SEQUENCE of the calendar event of the final date
 	Creator      models.User
 	DateOptions  []models.DateOptionWithStats
 	Votes        []models.Vote
@@ -310,15 +312,15 @@ func (h *ExportHandler) getPollWithDetails(ctx context.Context, pollID uuid.UUID
 	err := h.db.QueryRow(ctx, `
 		SELECT p.id, p.title, p.description, p.location, p.creator_id, p.expires_at,
 		       p.allow_multiple, p.allow_maybe, p.anonymous, p.limit_votes, p.max_votes_per_user,
-		       p.final_date, p.created_at, p.updated_at,
-		       u.id, u.name, u.avatar, u.email
+		       p.final_date, p.created_at, p.updated_at, p.access_code, p.ics_sequence,
+		       u.id, COALESCE(u.name, 'Deleted user'), COALESCE(u.avatar, ''), COALESCE(u.email, '')
 		FROM polls p
 		LEFT JOIN users u ON p.creator_id = u.id
 		WHERE p.id = $1
 	`, pollID).Scan(
 		&poll.ID, &poll.Title, &poll.Description, &poll.Location, &poll.CreatorID, &poll.ExpiresAt,
 		&poll.AllowMultiple, &poll.AllowMaybe, &poll.Anonymous, &poll.LimitVotes, &poll.MaxVotesPerUser,
-		&poll.FinalDate, &poll.CreatedAt, &poll.UpdatedAt,
+		&poll.FinalDate, &poll.CreatedAt, &poll.UpdatedAt, &poll.AccessCode, &poll.Sequence,
 		&poll.Creator.ID, &poll.Creator.Name, &poll.Creator.Avatar, &poll.Creator.Email,
 	)
 
@@ -388,6 +390,53 @@ func formatDateTime(t time.Time) string {
 	return t.Format("2006-01-02 15:04")
 }
 
-func formatICSDate(t time.Time) string {
-	return t.Format("20060102T150405")
+// icsProdID identifies the application in the calendars it writes
+const icsProdID = "-//Doodle Clone//EN"
+
+// icsDescription describes a date option of a poll with its vote counts
+func icsDescription(description string, do models.DateOptionWithStats) string {
+	counts := fmt.Sprintf("Vote count: %d yes, %d no, %d maybe", do.YesCount, do.NoCount, do.MaybeCount)
+	if description == "" {
+		return counts
+	}
+	return description + "\n\n" + counts
+}
+
+// icsAttendees lists the users who voted yes for a date option. Email addresses are only
+// given to the poll creator: other people get an opaque URN for each attendee.
+func (h *ExportHandler) icsAttendees(ctx context.Context, dateOptionID uuid.UUID, withEmails bool) ([]ical.Attendee, error) {
+	rows, err := h.db.Query(ctx, `
+		SELECT v.id, v.user_id, v.user_name, COALESCE(u.email, '')
+		FROM votes v
+		LEFT JOIN users u ON v.user_id = u.id
+		WHERE v.date_option_id = $1 AND v.response = 'yes'
+		ORDER BY v.created_at
+	`, dateOptionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var attendees []ical.Attendee
+	for rows.Next() {
+		var voteID uuid.UUID
+		var userID *uuid.UUID
+		var name, email string
+		if err := rows.Scan(&voteID, &userID, &name, &email); err != nil {
+			return nil, err
+		}
+
+		address := "urn:uuid:" + voteID.String()
+		if userID != nil {
+			address = "urn:uuid:" + userID.String()
+		}
+		if withEmails && email != "" {
+			address = ical.Mailto(email)
+		}
+		attendees = append(attendees, ical.Attendee{
+			Person:   ical.Person{Name: name, Address: address},
+			PartStat: ical.PartStatAccepted,
+		})
+	}
+	return attendees, rows.Err()
 }
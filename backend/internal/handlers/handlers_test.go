@@ -15,7 +15,6 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"doodle-clone/internal/config"
-	"doodle-clone/internal/database"
 	"doodle-clone/internal/middleware"
 	"doodle-clone/internal/models"
 )
@@ -71,6 +70,27 @@ func createTestUser(t *testing.T, db *pgxpool.Pool) *models.User {
 	}
 }
 
+// createTestUserWithEmail creates a test user with the given email in the database
+func createTestUserWithEmail(t *testing.T, db *pgxpool.Pool, email string) *models.User {
+	user := &models.User{ID: uuid.New(), Email: email, Name: "Test User", Provider: "email"}
+	_, err := db.Exec(context.Background(), `
+		INSERT INTO users (id, email, password_hash, name, provider)
+		VALUES ($1, $2, $3, $4, 'email')
+	`, user.ID, user.Email, "$2a$10$testhash", user.Name)
+	require.NoError(t, err, "Failed to create test user")
+	return user
+}
+
+// testAuth authenticates requests as the user of the X-Test-User header
+func testAuth() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if userID, err := uuid.Parse(c.GetHeader("X-Test-User")); err == nil {
+			c.Set("user_id", userID)
+		}
+		c.Next()
+	}
+}
+
 // createTestPoll creates a test poll in the database
 func createTestPoll(t *testing.T, db *pgxpool.Pool, creatorID uuid.UUID) *models.Poll {
 	pollID := uuid.New()
@@ -0,0 +1,410 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"doodle-clone/internal/database"
+	"doodle-clone/internal/events"
+	"doodle-clone/internal/middleware"
+	"doodle-clone/internal/models"
+)
+
+// inboxMaxActors is how many authors a merged notification remembers
+const inboxMaxActors = 10
+
+// inboxRecipients selects, for each event type, the users notified in the notification
+// center ($1 is the poll, $2 the author of the event) and the notification type
+var inboxRecipients = map[string]struct {
+	notificationType string
+	query            string
+}{
+	// The poll creator, unless voting on their own poll
+	events.TypeVoteCreated: {models.NotificationTypeNewVote, `
+		SELECT creator_id FROM polls WHERE id = $1 AND creator_id IS DISTINCT FROM $2`},
+	// The poll creator and the other commenters
+	events.TypeCommentCreated: {models.NotificationTypeNewComment, `
+		SELECT creator_id FROM polls WHERE id = $1
+		UNION
+		SELECT user_id FROM comments WHERE poll_id = $1`},
+	// The participants, other than the creator who made the change
+	events.TypePollFinalized: {models.NotificationTypeFinalDate, `
+		SELECT user_id FROM votes WHERE poll_id = $1`},
+	events.TypeDateOptionCreated: {models.NotificationTypePollChanged, `
+		SELECT user_id FROM votes WHERE poll_id = $1`},
+	events.TypeDateOptionDeleted: {models.NotificationTypePollChanged, `
+		SELECT user_id FROM votes WHERE poll_id = $1`},
+}
+
+// addToInbox adds a poll event to the notification center of the users it concerns,
+// merging it into their unread notification of the same type and poll
+func addToInbox(ctx context.Context, tx pgx.Tx, e events.Event) error {
+	recipients, ok := inboxRecipients[e.Type]
+	if !ok {
+		return nil
+	}
+
+	var authorID *uuid.UUID
+	var author string
+	switch {
+	case e.Voter != nil:
+		authorID, author = e.Voter.UserID, e.Voter.Name
+	case e.Type == events.TypeCommentCreated:
+		if id, err := uuid.Parse(eventString(e, "user_id")); err == nil {
+			authorID = &id
+		}
+		author = eventString(e, "user_name")
+	default:
+		// Changes made by the poll creator
+		err := tx.QueryRow(ctx, `
+			SELECT u.id, u.name FROM polls p JOIN users u ON u.id = p.creator_id WHERE p.id = $1
+		`, e.PollID).Scan(&authorID, &author)
+		if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+			return err
+		}
+	}
+	actors := []string{}
+	if author != "" {
+		actors = append(actors, author)
+	}
+
+	_, err := tx.Exec(ctx, `
+		INSERT INTO user_notifications (user_id, poll_id, type, actors)
+		SELECT r.user_id, $1, $3, $4
+		FROM (`+recipients.query+`) AS r(user_id)
+		WHERE r.user_id IS NOT NULL AND r.user_id IS DISTINCT FROM $2
+		AND NOT EXISTS (
+			SELECT 1 FROM notification_preferences np
+			WHERE np.user_id = r.user_id AND np.type = $3 AND NOT np.in_app
+		)
+		ON CONFLICT (user_id, poll_id, type) WHERE read_at IS NULL DO UPDATE SET
+			actors = CASE WHEN EXCLUDED.actors <@ user_notifications.actors THEN user_notifications.actors
+			              ELSE (user_notifications.actors || EXCLUDED.actors)[greatest(1, cardinality(user_notifications.actors) + 2 - $5):]
+			         END,
+			count = user_notifications.count + CASE WHEN EXCLUDED.actors <@ user_notifications.actors THEN 0 ELSE 1 END,
+			updated_at = CURRENT_TIMESTAMP
+	`, e.PollID, authorID, recipients.notificationType, actors, inboxMaxActors)
+	return err
+}
+
+// eventString returns a string field of the data of an event
+func eventString(e events.Event, key string) string {
+	s, _ := e.Data[key].(string)
+	return s
+}
+
+// emailEnabled tells whether a user accepts a type of notification by email
+func emailEnabled(ctx context.Context, db querier, userID uuid.UUID, notificationType string) (bool, error) {
+	var enabled bool
+	err := db.QueryRow(ctx, `
+		SELECT NOT EXISTS (
+			SELECT 1 FROM notification_preferences WHERE user_id = $1 AND type = $2 AND NOT email
+		)
+	`, userID, notificationType).Scan(&enabled)
+	return enabled, err
+}
+
+// ListInbox returns the notification center of the current user
+// @Summary      Centre de notifications
+// @Description  Retourne les notifications de l'utilisateur, les plus récentes d'abord, avec le nombre de non lues
+// @Tags         notifications
+// @Produce      json
+// @Security     BearerAuth
+// @Param        unread  query  bool  false  "Seulement les non lues"
+// @Param        limit   query  int   false  "Nombre de notifications (50 par défaut, 200 max)"
+// @Param        offset  query  int   false  "Décalage"
+// @Success      200  {object}  map[string]interface{}  "notifications, count, unread"
+// @Failure      401  {object}  map[string]string
+// @Failure      500  {object}  map[string]string
+// @Router       /user/notifications [get]
+func (h *NotificationHandler) ListInbox(c *gin.Context) {
+	userID := middleware.GetCurrentUser(c)
+	if userID == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Not authenticated"})
+		return
+	}
+	limit, offset := auditPage(c)
+	unreadOnly := c.Query("unread") == "true"
+
+	ctx, cancel := database.GetContext()
+	defer cancel()
+
+	rows, err := h.db.Query(ctx, `
+		SELECT n.id, n.type, n.poll_id, p.title, p.access_code,
+		       CASE WHEN p.anonymous AND n.type = $2 THEN '{}' ELSE n.actors END,
+		       n.count, n.read_at, n.created_at, n.updated_at
+		FROM user_notifications n
+		JOIN polls p ON p.id = n.poll_id
+		WHERE n.user_id = $1 AND (NOT $3 OR n.read_at IS NULL)
+		ORDER BY n.updated_at DESC
+		LIMIT $4 OFFSET $5
+	`, *userID, models.NotificationTypeNewVote, unreadOnly, limit, offset)
+	if err != nil {
+		log.Printf("Error querying notification center: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch notifications"})
+		return
+	}
+	defer rows.Close()
+
+	notifications := []models.InboxNotification{}
+	for rows.Next() {
+		var n models.InboxNotification
+		err := rows.Scan(&n.ID, &n.Type, &n.PollID, &n.PollTitle, &n.AccessCode, &n.Actors,
+			&n.Count, &n.ReadAt, &n.CreatedAt, &n.UpdatedAt)
+		if err != nil {
+			log.Printf("Error scanning notification: %v", err)
+			continue
+		}
+		notifications = append(notifications, n)
+	}
+
+	unread, err := h.unreadCount(ctx, *userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch notifications"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"notifications": notifications,
+		"count":         len(notifications),
+		"unread":        unread,
+	})
+}
+
+// CountUnreadInbox returns the number of unread notifications, for a badge
+// @Summary      Notifications non lues
+// @Description  Retourne le nombre de notifications non lues de l'utilisateur
+// @Tags         notifications
+// @Produce      json
+// @Security     BearerAuth
+// @Success      200  {object}  map[string]int  "unread"
+// @Failure      401  {object}  map[string]string
+// @Failure      500  {object}  map[string]string
+// @Router       /user/notifications/unread-count [get]
+func (h *NotificationHandler) CountUnreadInbox(c *gin.Context) {
+	userID := middleware.GetCurrentUser(c)
+	if userID == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Not authenticated"})
+		return
+	}
+
+	ctx, cancel := database.GetContext()
+	defer cancel()
+
+	unread, err := h.unreadCount(ctx, *userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to count notifications"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"unread": unread})
+}
+
+// MarkInboxRead marks a notification of the current user as read
+// @Summary      Marquer une notification comme lue
+// @Description  Marque une notification du centre de notifications comme lue
+// @Tags         notifications
+// @Produce      json
+// @Security     BearerAuth
+// @Param        notificationId  path  string  true  "ID de la notification"
+// @Success      200  {object}  map[string]interface{}  "message, unread"
+// @Failure      400  {object}  map[string]string
+// @Failure      401  {object}  map[string]string
+// @Failure      404  {object}  map[string]string
+// @Router       /user/notifications/{notificationId}/read [post]
+func (h *NotificationHandler) MarkInboxRead(c *gin.Context) {
+	userID := middleware.GetCurrentUser(c)
+	if userID == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Not authenticated"})
+		return
+	}
+
+	notificationID, err := uuid.Parse(c.Param("notificationId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid notification ID"})
+		return
+	}
+
+	ctx, cancel := database.GetContext()
+	defer cancel()
+
+	// Reading twice is not an error
+	tag, err := h.db.Exec(ctx, `
+		UPDATE user_notifications SET read_at = COALESCE(read_at, CURRENT_TIMESTAMP)
+		WHERE id = $1 AND user_id = $2
+	`, notificationID, *userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update notification"})
+		return
+	}
+	if tag.RowsAffected() == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Notification not found"})
+		return
+	}
+
+	unread, err := h.unreadCount(ctx, *userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to count notifications"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Notification marked as read", "unread": unread})
+}
+
+// MarkAllInboxRead marks every notification of the current user as read
+// @Summary      Tout marquer comme lu
+// @Description  Marque toutes les notifications de l'utilisateur comme lues
+// @Tags         notifications
+// @Produce      json
+// @Security     BearerAuth
+// @Success      200  {object}  map[string]interface{}  "message, updated"
+// @Failure      401  {object}  map[string]string
+// @Failure      500  {object}  map[string]string
+// @Router       /user/notifications/read-all [post]
+func (h *NotificationHandler) MarkAllInboxRead(c *gin.Context) {
+	userID := middleware.GetCurrentUser(c)
+	if userID == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Not authenticated"})
+		return
+	}
+
+	ctx, cancel := database.GetContext()
+	defer cancel()
+
+	tag, err := h.db.Exec(ctx, `
+		UPDATE user_notifications SET read_at = CURRENT_TIMESTAMP
+		WHERE user_id = $1 AND read_at IS NULL
+	`, *userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update notifications"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "All notifications marked as read", "updated": tag.RowsAffected()})
+}
+
+// GetNotificationPreferences returns how the current user receives each type of notification
+// @Summary      Préférences de notification
+// @Description  Indique, pour chaque type, si l'utilisateur reçoit les notifications dans l'application et par email
+// @Tags         notifications
+// @Produce      json
+// @Security     BearerAuth
+// @Success      200  {object}  map[string]interface{}  "preferences"
+// @Failure      401  {object}  map[string]string
+// @Failure      500  {object}  map[string]string
+// @Router       /user/notifications/preferences [get]
+func (h *NotificationHandler) GetNotificationPreferences(c *gin.Context) {
+	userID := middleware.GetCurrentUser(c)
+	if userID == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Not authenticated"})
+		return
+	}
+
+	ctx, cancel := database.GetContext()
+	defer cancel()
+
+	preferences, err := h.notificationPreferences(ctx, *userID)
+	if err != nil {
+		log.Printf("Error querying notification preferences: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch preferences"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"preferences": preferences})
+}
+
+// UpdateNotificationPreferences changes how the current user receives some types of notification
+// @Summary      Modifier les préférences de notification
+// @Description  Active ou désactive, par type, les notifications dans l'application et par email
+// @Tags         notifications
+// @Accept       json
+// @Produce      json
+// @Security     BearerAuth
+// @Param        request  body  models.UpdateNotificationPreferencesRequest  true  "Préférences par type"
+// @Success      200  {object}  map[string]interface{}  "preferences"
+// @Failure      400  {object}  map[string]string
+// @Failure      401  {object}  map[string]string
+// @Failure      500  {object}  map[string]string
+// @Router       /user/notifications/preferences [put]
+func (h *NotificationHandler) UpdateNotificationPreferences(c *gin.Context) {
+	userID := middleware.GetCurrentUser(c)
+	if userID == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Not authenticated"})
+		return
+	}
+
+	var req models.UpdateNotificationPreferencesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	for _, p := range req.Preferences {
+		if !models.IsUserNotificationType(p.Type) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown notification type: " + p.Type})
+			return
+		}
+	}
+
+	ctx, cancel := database.GetContext()
+	defer cancel()
+
+	batch := &pgx.Batch{}
+	for _, p := range req.Preferences {
+		batch.Queue(`
+			INSERT INTO notification_preferences (user_id, type, in_app, email)
+			VALUES ($1, $2, $3, $4)
+			ON CONFLICT (user_id, type) DO UPDATE SET in_app = $3, email = $4
+		`, *userID, p.Type, p.InApp, p.Email)
+	}
+	if err := h.db.SendBatch(ctx, batch).Close(); err != nil {
+		log.Printf("Error updating notification preferences: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update preferences"})
+		return
+	}
+
+	preferences, err := h.notificationPreferences(ctx, *userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch preferences"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"preferences": preferences})
+}
+
+// notificationPreferences returns the preferences of a user for every type, enabled by default
+func (h *NotificationHandler) notificationPreferences(ctx context.Context, userID uuid.UUID) ([]models.NotificationPreference, error) {
+	rows, err := h.db.Query(ctx, `
+		SELECT t.type, COALESCE(np.in_app, true), COALESCE(np.email, true)
+		FROM unnest($2::text[]) WITH ORDINALITY AS t(type, position)
+		LEFT JOIN notification_preferences np ON np.user_id = $1 AND np.type = t.type
+		ORDER BY t.position
+	`, userID, models.UserNotificationTypes)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	preferences := []models.NotificationPreference{}
+	for rows.Next() {
+		var p models.NotificationPreference
+		if err := rows.Scan(&p.Type, &p.InApp, &p.Email); err != nil {
+			return nil, err
+		}
+		preferences = append(preferences, p)
+	}
+	return preferences, rows.Err()
+}
+
+// unreadCount counts the unread notifications of a user
+func (h *NotificationHandler) unreadCount(ctx context.Context, userID uuid.UUID) (int, error) {
+	var unread int
+	err := h.db.QueryRow(ctx, `
+		SELECT COUNT(*) FROM user_notifications WHERE user_id = $1 AND read_at IS NULL
+	`, userID).Scan(&unread)
+	return unread, err
+}
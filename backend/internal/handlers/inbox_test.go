@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"doodle-clone/internal/models"
+)
+
+// createTestInboxItem adds an unread notification to the notification center of a user
+func createTestInboxItem(t *testing.T, db *pgxpool.Pool, userID, pollID uuid.UUID, notificationType string) uuid.UUID {
+	var id uuid.UUID
+	err := db.QueryRow(context.Background(), `
+		INSERT INTO user_notifications (user_id, poll_id, type, actors)
+		VALUES ($1, $2, $3, ARRAY['Alice'])
+		RETURNING id
+	`, userID, pollID, notificationType).Scan(&id)
+	require.NoError(t, err, "Failed to create test notification")
+	return id
+}
+
+func TestNotificationHandler_Inbox(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	handler := NewNotificationHandler(db, nil, nil)
+
+	router := setupTestContext()
+	router.Use(testAuth())
+	router.GET("/user/notifications/unread-count", handler.CountUnreadInbox)
+	router.POST("/user/notifications/read-all", handler.MarkAllInboxRead)
+	router.POST("/user/notifications/:notificationId/read", handler.MarkInboxRead)
+
+	owner := createTestUserWithEmail(t, db, "owner-"+uuid.NewString()+"@example.com")
+	other := createTestUserWithEmail(t, db, "other-"+uuid.NewString()+"@example.com")
+	defer cleanupTestData(t, db, other.ID, uuid.Nil)
+	poll := createTestPoll(t, db, owner.ID)
+	defer cleanupTestData(t, db, owner.ID, poll.ID)
+
+	vote := createTestInboxItem(t, db, owner.ID, poll.ID, models.NotificationTypeNewVote)
+	comment := createTestInboxItem(t, db, owner.ID, poll.ID, models.NotificationTypeNewComment)
+	othersComment := createTestInboxItem(t, db, other.ID, poll.ID, models.NotificationTypeNewComment)
+
+	post := func(userID uuid.UUID, path string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("POST", path, nil)
+		req.Header.Set("X-Test-User", userID.String())
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+	unread := func(userID uuid.UUID) int {
+		req, _ := http.NewRequest("GET", "/user/notifications/unread-count", nil)
+		req.Header.Set("X-Test-User", userID.String())
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code)
+		var response struct {
+			Unread int `json:"unread"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		return response.Unread
+	}
+
+	require.Equal(t, 2, unread(owner.ID))
+	require.Equal(t, 1, unread(other.ID))
+
+	t.Run("Another user's notification", func(t *testing.T) {
+		w := post(other.ID, "/user/notifications/"+vote.String()+"/read")
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		assert.Equal(t, 2, unread(owner.ID), "the notification must stay unread")
+	})
+
+	t.Run("Mark as read", func(t *testing.T) {
+		w := post(owner.ID, "/user/notifications/"+vote.String()+"/read")
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, 1, unread(owner.ID))
+
+		// Reading twice is not an error
+		w = post(owner.ID, "/user/notifications/"+vote.String()+"/read")
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, 1, unread(owner.ID))
+	})
+
+	t.Run("Invalid ID", func(t *testing.T) {
+		w := post(owner.ID, "/user/notifications/not-a-uuid/read")
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("Not authenticated", func(t *testing.T) {
+		req, _ := http.NewRequest("POST", "/user/notifications/"+comment.String()+"/read", nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+
+	t.Run("Mark all as read", func(t *testing.T) {
+		w := post(owner.ID, "/user/notifications/read-all")
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, 0, unread(owner.ID))
+		assert.Equal(t, 1, unread(other.ID), "other users' notifications must stay unread")
+
+		w = post(other.ID, "/user/notifications/"+othersComment.String()+"/read")
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, 0, unread(other.ID))
+	})
+}
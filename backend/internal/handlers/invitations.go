@@ -0,0 +1,267 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"doodle-clone/internal/config"
+	"doodle-clone/internal/email"
+	"doodle-clone/internal/ical"
+	"doodle-clone/internal/models"
+	"doodle-clone/internal/notify"
+)
+
+// invitation is the calendar event of the final date of a poll
+type invitation struct {
+	PollID      uuid.UUID
+	OrganizerID *uuid.UUID
+	Sequence    int
+	Summary     string
+	Description string
+	Location    string
+	Start       time.Time
+	End         *time.Time
+}
+
+// pollEventUID is the UID of the event of a finalized poll. It does not depend on the
+// final date, so that calendars move the event when the poll is rescheduled.
+func pollEventUID(pollID uuid.UUID) string {
+	return fmt.Sprintf("poll-%s@doodleclone", pollID)
+}
+
+// loadInvitation reads the event of a poll, pgx.ErrNoRows when it has no final date
+func loadInvitation(ctx context.Context, db querier, pollID uuid.UUID) (*invitation, error) {
+	inv := invitation{PollID: pollID}
+	err := db.QueryRow(ctx, `
+		SELECT p.creator_id, p.ics_sequence, p.title, p.description, p.location, d.start_time, d.end_time
+		FROM polls p
+		JOIN date_options d ON d.id = p.final_date
+		WHERE p.id = $1
+	`, pollID).Scan(&inv.OrganizerID, &inv.Sequence, &inv.Summary, &inv.Description, &inv.Location, &inv.Start, &inv.End)
+	if err != nil {
+		return nil, err
+	}
+	return &inv, nil
+}
+
+// invitationCalendar writes the iTIP message of an event for one attendee: a REQUEST
+// showing Accept/Decline buttons, or a CANCEL removing the event from their calendar
+func invitationCalendar(ctx context.Context, db querier, inv *invitation, method string, attendeeID uuid.UUID) (*email.Calendar, error) {
+	var attendee ical.Attendee
+	err := db.QueryRow(ctx, `SELECT name, email FROM users WHERE id = $1`, attendeeID).Scan(&attendee.Name, &attendee.Address)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get attendee: %w", err)
+	}
+	attendee.Address = ical.Mailto(attendee.Address)
+
+	// Replies go to the poll creator. Without one, the event still needs an organizer.
+	organizer := ical.Person{Address: ical.Mailto(config.AppConfig.SMTPFrom)}
+	if inv.OrganizerID != nil {
+		err := db.QueryRow(ctx, `SELECT name, email FROM users WHERE id = $1`, *inv.OrganizerID).Scan(&organizer.Name, &organizer.Address)
+		if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("failed to get organizer: %w", err)
+		}
+		if err == nil {
+			organizer.Address = ical.Mailto(organizer.Address)
+		}
+	}
+
+	event := ical.Event{
+		UID:       pollEventUID(inv.PollID),
+		Sequence:  inv.Sequence,
+		Stamp:     time.Now(),
+		Start:     inv.Start,
+		End:       inv.End,
+		Summary:   inv.Summary,
+		Organizer: &organizer,
+	}
+	switch method {
+	case ical.MethodRequest:
+		event.Description = inv.Description
+		event.Location = inv.Location
+		event.Status = ical.StatusConfirmed
+		attendee.PartStat = ical.PartStatNeedsAction
+		attendee.RSVP = true
+	case ical.MethodCancel:
+		// A cancellation is a new revision of the event
+		event.Sequence++
+		event.Status = ical.StatusCancelled
+	}
+	event.Attendees = []ical.Attendee{attendee}
+
+	cal := ical.Calendar{ProdID: icsProdID, Method: method, Events: []ical.Event{event}}
+	return &email.Calendar{Method: method, Content: string(cal.Bytes())}, nil
+}
+
+// recordInvitation remembers that a participant received the event, to cancel it later.
+// The poll may have lost its final date, or been deleted, while the email was sent: the
+// cancellation is then due right away.
+func recordInvitation(ctx context.Context, db execer, inv *invitation, userID uuid.UUID) error {
+	_, err := db.Exec(ctx, `
+		INSERT INTO calendar_invitations (poll_id, user_id, organizer_id, sequence, summary, start_time, end_time, cancel_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7,
+			CASE WHEN EXISTS (SELECT 1 FROM polls WHERE id = $1 AND final_date IS NOT NULL) THEN NULL ELSE CURRENT_TIMESTAMP END)
+		ON CONFLICT (poll_id, user_id) DO UPDATE SET
+			organizer_id = EXCLUDED.organizer_id, sequence = EXCLUDED.sequence, summary = EXCLUDED.summary,
+			start_time = EXCLUDED.start_time, end_time = EXCLUDED.end_time, cancel_at = EXCLUDED.cancel_at,
+			attempts = 0, error_message = NULL, invited_at = CURRENT_TIMESTAMP
+	`, inv.PollID, userID, inv.OrganizerID, inv.Sequence, inv.Summary, inv.Start, inv.End)
+	return err
+}
+
+// scheduleFinalDateEmails sends the final date, with its invitation, to the participants
+// of a poll other than its creator. Participants who withdrew get a cancellation.
+func scheduleFinalDateEmails(ctx context.Context, tx pgx.Tx, pollID uuid.UUID) error {
+	_, err := tx.Exec(ctx, `
+		DELETE FROM notifications WHERE poll_id = $1 AND type = $2 AND channel = $3 AND status = $4
+	`, pollID, models.NotificationTypeFinalDate, models.NotificationChannelEmail, models.NotificationStatusPending)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx, `
+		INSERT INTO notifications (poll_id, user_id, type, channel, scheduled_at)
+		SELECT DISTINCT v.poll_id, v.user_id, $2, $3, CURRENT_TIMESTAMP
+		FROM votes v
+		JOIN polls p ON p.id = v.poll_id
+		WHERE v.poll_id = $1 AND v.user_id IS NOT NULL AND v.user_id IS DISTINCT FROM p.creator_id
+	`, pollID, models.NotificationTypeFinalDate, models.NotificationChannelEmail)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx, `
+		UPDATE calendar_invitations SET cancel_at = CURRENT_TIMESTAMP, attempts = 0
+		WHERE poll_id = $1 AND cancel_at IS NULL
+		  AND user_id NOT IN (SELECT user_id FROM votes WHERE poll_id = $1 AND user_id IS NOT NULL)
+	`, pollID)
+	return err
+}
+
+// cancelInvitations queues the cancellation of the event of a poll that was deleted or
+// no longer has a final date
+func cancelInvitations(ctx context.Context, db execer, pollID uuid.UUID) error {
+	_, err := db.Exec(ctx, `
+		UPDATE calendar_invitations SET cancel_at = CURRENT_TIMESTAMP, attempts = 0
+		WHERE poll_id = $1 AND cancel_at IS NULL
+		  AND NOT EXISTS (SELECT 1 FROM polls WHERE id = $1 AND final_date IS NOT NULL)
+	`, pollID)
+	return err
+}
+
+// claimedCancellation is an invitation this worker is cancelling
+type claimedCancellation struct {
+	invitation
+	UserID   uuid.UUID
+	Attempts int
+}
+
+// sendCalendarCancellations sends the due cancellations. They are claimed like
+// notifications, and the invitation is forgotten once cancelled.
+func (h *NotificationHandler) sendCalendarCancellations(ctx context.Context) {
+	rows, err := h.db.Query(ctx, `
+		WITH due AS (
+			SELECT poll_id, user_id FROM calendar_invitations
+			WHERE cancel_at <= CURRENT_TIMESTAMP
+			ORDER BY cancel_at
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		UPDATE calendar_invitations ci
+		SET attempts = ci.attempts + 1, cancel_at = CURRENT_TIMESTAMP + make_interval(secs => $2)
+		FROM due
+		WHERE ci.poll_id = due.poll_id AND ci.user_id = due.user_id
+		RETURNING ci.poll_id, ci.user_id, ci.organizer_id, ci.sequence, ci.summary, ci.start_time, ci.end_time, ci.attempts
+	`, notificationBatchSize, notificationLease.Seconds())
+	if err != nil {
+		log.Printf("Error claiming calendar cancellations: %v", err)
+		return
+	}
+	var cancellations []claimedCancellation
+	for rows.Next() {
+		var c claimedCancellation
+		err := rows.Scan(&c.PollID, &c.UserID, &c.OrganizerID, &c.Sequence, &c.Summary, &c.Start, &c.End, &c.Attempts)
+		if err != nil {
+			log.Printf("Error scanning calendar cancellation: %v", err)
+			continue
+		}
+		cancellations = append(cancellations, c)
+	}
+	rows.Close()
+
+	for _, c := range cancellations {
+		sendErr := h.sendCalendarCancellation(ctx, c)
+
+		switch {
+		case sendErr == nil || c.Attempts >= config.AppConfig.NotificationMaxAttempts:
+			if sendErr != nil {
+				log.Printf("Giving up cancelling the event of poll %s for user %s: %v", c.PollID, c.UserID, sendErr)
+			}
+			_, err = h.db.Exec(ctx, `
+				DELETE FROM calendar_invitations WHERE poll_id = $1 AND user_id = $2 AND sequence = $3
+			`, c.PollID, c.UserID, c.Sequence)
+		default:
+			log.Printf("Failed to cancel the event of poll %s for user %s (attempt %d): %v", c.PollID, c.UserID, c.Attempts, sendErr)
+			_, err = h.db.Exec(ctx, `
+				UPDATE calendar_invitations SET cancel_at = CURRENT_TIMESTAMP + make_interval(secs => $3), error_message = $4
+				WHERE poll_id = $1 AND user_id = $2
+			`, c.PollID, c.UserID, notificationBackoff(c.Attempts).Seconds(), sendErr.Error())
+		}
+		if err != nil {
+			log.Printf("Failed to update calendar invitation of poll %s: %v", c.PollID, err)
+		}
+	}
+}
+
+// sendCalendarCancellation tells a participant that an event is cancelled. The poll may be
+// gone, so the email only uses what was recorded with the invitation.
+func (h *NotificationHandler) sendCalendarCancellation(ctx context.Context, c claimedCancellation) error {
+	data := email.Data{PollTitle: c.Summary, Date: &c.Start}
+	var to string
+	err := h.db.QueryRow(ctx, `
+		SELECT email, name, COALESCE(locale, '') FROM users WHERE id = $1
+	`, c.UserID).Scan(&to, &data.RecipientName, &data.Locale)
+	if err != nil {
+		return fmt.Errorf("failed to get recipient: %w", err)
+	}
+
+	msg, err := h.templates.Render(models.NotificationTypeEventCancelled, data)
+	if err != nil {
+		return err
+	}
+	calendar, err := invitationCalendar(ctx, h.db, &c.invitation, ical.MethodCancel, c.UserID)
+	if err != nil {
+		return err
+	}
+
+	return h.notifier.Notify(ctx, notify.Message{
+		Type:     models.NotificationTypeEventCancelled,
+		To:       []string{to},
+		Subject:  msg.Subject,
+		HTML:     msg.HTML,
+		Text:     msg.Text,
+		Calendar: calendar,
+	})
+}
+
+// finalDateInvitation returns the invitation to attach to the final date email of a
+// participant, nil when the poll no longer has a final date
+func (h *NotificationHandler) finalDateInvitation(ctx context.Context, pollID, userID uuid.UUID) (*invitation, *email.Calendar, error) {
+	inv, err := loadInvitation(ctx, h.db, pollID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get final date: %w", err)
+	}
+	calendar, err := invitationCalendar(ctx, h.db, inv, ical.MethodRequest, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return inv, calendar, nil
+}
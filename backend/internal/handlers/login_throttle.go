@@ -0,0 +1,208 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"doodle-clone/internal/config"
+	"doodle-clone/internal/database"
+	"doodle-clone/internal/email"
+	"doodle-clone/internal/models"
+	"doodle-clone/internal/notify"
+)
+
+// Reasons recorded in login_attempts
+const (
+	loginReasonInvalidPassword = "invalid_password"
+	loginReasonUnknownEmail    = "unknown_email"
+	loginReasonWrongProvider   = "wrong_provider"
+	loginReasonThrottled       = "throttled"
+)
+
+// Failures allowed before delays kick in, and the delay after the first one
+const (
+	loginFreeFailures = 2
+	loginBaseDelay    = time.Second
+)
+
+// SetNotifier lets the auth handler send security notifications, written with templates
+func (h *AuthHandler) SetNotifier(notifier notify.Notifier, templates *email.Templates) {
+	h.notifier = notifier
+	h.templates = templates
+}
+
+// loginDelay returns how long a client has to wait before the next login attempt,
+// given the failed attempts counted in the current window and the time of the last one.
+// The delay doubles with each failure past loginFreeFailures, until maxFailures
+// turns it into a lockout.
+func loginDelay(failures, maxFailures int, last, now time.Time) time.Duration {
+	if failures <= loginFreeFailures || maxFailures <= 0 {
+		return 0
+	}
+
+	lockout := config.AppConfig.LoginLockoutDuration
+	wait := lockout
+	if failures < maxFailures {
+		wait = loginBaseDelay * time.Duration(math.Pow(2, float64(failures-loginFreeFailures-1)))
+		if wait > lockout {
+			wait = lockout
+		}
+	}
+
+	if remaining := last.Add(wait).Sub(now); remaining > 0 {
+		return remaining
+	}
+	return 0
+}
+
+// countLoginFailures counts the failed attempts of the current window for an email or an IP.
+// For an account, a successful login starts a new window.
+func (h *AuthHandler) countLoginFailures(ctx context.Context, column, value string) (int, time.Time, error) {
+	var count int
+	var last *time.Time
+	err := h.db.QueryRow(ctx, fmt.Sprintf(`
+		SELECT COUNT(*), MAX(created_at)
+		FROM login_attempts
+		WHERE %[1]s = $1 AND NOT success AND reason <> $2
+		AND created_at > $3
+		AND ($4 = false OR created_at > COALESCE(
+			(SELECT MAX(created_at) FROM login_attempts WHERE %[1]s = $1 AND success), '-infinity'))
+	`, column), value, loginReasonThrottled, time.Now().Add(-config.AppConfig.LoginFailureWindow), column == "email").Scan(&count, &last)
+	if err != nil || last == nil {
+		return count, time.Time{}, err
+	}
+	return count, *last, nil
+}
+
+// loginRetryAfter returns how long the email and IP of a login request must wait
+func (h *AuthHandler) loginRetryAfter(ctx context.Context, emailAddr, ip string) (time.Duration, error) {
+	now := time.Now()
+
+	failures, last, err := h.countLoginFailures(ctx, "email", emailAddr)
+	if err != nil {
+		return 0, err
+	}
+	wait := loginDelay(failures, config.AppConfig.LoginMaxFailures, last, now)
+
+	ipFailures, ipLast, err := h.countLoginFailures(ctx, "ip_address", ip)
+	if err != nil {
+		return 0, err
+	}
+	if ipWait := loginDelay(ipFailures, config.AppConfig.LoginMaxFailuresPerIP, ipLast, now); ipWait > wait {
+		wait = ipWait
+	}
+
+	return wait, nil
+}
+
+// recordLoginAttempt adds a login attempt to the audit table
+func (h *AuthHandler) recordLoginAttempt(ctx context.Context, c *gin.Context, emailAddr string, userID *uuid.UUID, success bool, reason string) {
+	session := newSessionInfo(c)
+	var reasonArg *string
+	if reason != "" {
+		reasonArg = &reason
+	}
+
+	_, err := h.db.Exec(ctx, `
+		INSERT INTO login_attempts (email, user_id, ip_address, user_agent, success, reason)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`, emailAddr, userID, session.IPAddress, session.UserAgent, success, reasonArg)
+	if err != nil {
+		log.Printf("Failed to record login attempt: %v", err)
+	}
+}
+
+// loginFailed records a failed attempt and warns the owner when it locks the account
+func (h *AuthHandler) loginFailed(ctx context.Context, c *gin.Context, emailAddr string, userID *uuid.UUID, userName, reason string) {
+	h.recordLoginAttempt(ctx, c, emailAddr, userID, false, reason)
+	if userID == nil {
+		return
+	}
+
+	failures, _, err := h.countLoginFailures(ctx, "email", emailAddr)
+	if err != nil {
+		log.Printf("Failed to count login failures: %v", err)
+		return
+	}
+	// Only the failure that triggers the lockout sends an email
+	if failures != config.AppConfig.LoginMaxFailures {
+		return
+	}
+
+	log.Printf("Account %s locked after %d failed logins (last from %s)", emailAddr, failures, c.ClientIP())
+	if h.notifier == nil || h.templates == nil {
+		return
+	}
+
+	data := email.Data{
+		RecipientName: userName,
+		URL:           config.AppConfig.FrontendURL + "/profile",
+		IPAddress:     c.ClientIP(),
+		LockedUntil:   time.Now().Add(config.AppConfig.LoginLockoutDuration),
+	}
+	go func() {
+		ctx, cancel := database.GetContext(30 * time.Second)
+		defer cancel()
+
+		h.db.QueryRow(ctx, "SELECT COALESCE(locale, '') FROM users WHERE id = $1", *userID).Scan(&data.Locale)
+		msg, err := h.templates.Render(models.NotificationTypeAccountLocked, data)
+		if err != nil {
+			log.Printf("Failed to write lockout email to %s: %v", emailAddr, err)
+			return
+		}
+
+		err = h.notifier.Notify(ctx, notify.Message{
+			Type:    models.NotificationTypeAccountLocked,
+			To:      []string{emailAddr},
+			Subject: msg.Subject,
+			HTML:    msg.HTML,
+			Text:    msg.Text,
+		})
+		if err != nil {
+			log.Printf("Failed to send lockout email to %s: %v", emailAddr, err)
+		}
+	}()
+}
+
+// abortThrottledLogin answers 429 with a Retry-After header
+func abortThrottledLogin(c *gin.Context, wait time.Duration) {
+	seconds := int(math.Ceil(wait.Seconds()))
+	c.Header("Retry-After", strconv.Itoa(seconds))
+	c.JSON(http.StatusTooManyRequests, gin.H{
+		"error":       "Too many failed login attempts. Please try again later.",
+		"retry_after": seconds,
+	})
+}
+
+// normalizeEmail makes attempts on "Alice@x.com" and "alice@x.com " count for the same account
+func normalizeEmail(emailAddr string) string {
+	return strings.ToLower(strings.TrimSpace(emailAddr))
+}
+
+// purgeLoginAttempts deletes login attempts older than the audit retention
+func (h *AuthHandler) purgeLoginAttempts() {
+	ctx, cancel := database.GetContext(30 * time.Second)
+	defer cancel()
+
+	retention := config.AppConfig.LoginAuditRetention
+	if retention <= 0 {
+		return
+	}
+
+	tag, err := h.db.Exec(ctx, `DELETE FROM login_attempts WHERE created_at < $1`, time.Now().Add(-retention))
+	if err != nil {
+		log.Printf("Error purging login attempts: %v", err)
+		return
+	}
+	if tag.RowsAffected() > 0 {
+		log.Printf("Purged %d old login attempts", tag.RowsAffected())
+	}
+}
@@ -0,0 +1,45 @@
+package handlers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"doodle-clone/internal/config"
+)
+
+func TestLoginDelay(t *testing.T) {
+	saved := config.AppConfig
+	config.AppConfig = &config.Config{LoginLockoutDuration: 15 * time.Minute}
+	defer func() { config.AppConfig = saved }()
+
+	now := time.Date(2026, 3, 14, 10, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name        string
+		failures    int
+		maxFailures int
+		last        time.Time
+		want        time.Duration
+	}{
+		{"No failure", 0, 10, time.Time{}, 0},
+		{"Free failures", loginFreeFailures, 10, now, 0},
+		{"First delay", loginFreeFailures + 1, 10, now, loginBaseDelay},
+		{"Delay doubles", loginFreeFailures + 2, 10, now, 2 * loginBaseDelay},
+		{"Delay doubles again", loginFreeFailures + 3, 10, now, 4 * loginBaseDelay},
+		{"Delay capped at the lockout", 20, 30, now, 15 * time.Minute},
+		{"Lockout at max failures", 10, 10, now, 15 * time.Minute},
+		{"Lockout past max failures", 12, 10, now, 15 * time.Minute},
+		{"Throttling disabled", 12, 0, now, 0},
+		{"Delay partly elapsed", loginFreeFailures + 2, 10, now.Add(-500 * time.Millisecond), 1500 * time.Millisecond},
+		{"Delay expired", loginFreeFailures + 2, 10, now.Add(-3 * time.Second), 0},
+		{"Lockout partly elapsed", 10, 10, now.Add(-10 * time.Minute), 5 * time.Minute},
+		{"Lockout expired", 10, 10, now.Add(-15 * time.Minute), 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, loginDelay(tt.failures, tt.maxFailures, tt.last, now))
+		})
+	}
+}
@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
@@ -9,38 +10,71 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
+	"doodle-clone/internal/chat"
+	"doodle-clone/internal/config"
 	"doodle-clone/internal/database"
 	"doodle-clone/internal/email"
+	"doodle-clone/internal/events"
 	"doodle-clone/internal/middleware"
 	"doodle-clone/internal/models"
+	"doodle-clone/internal/notify"
 )
 
 type NotificationHandler struct {
-	db     *pgxpool.Pool
-	email  *email.Sender
-	ticker *time.Ticker
-	stopCh chan struct{}
+	db        *pgxpool.Pool
+	notifier  notify.Notifier
+	templates *email.Templates
+	chat      *chat.Client
+	ticker    *time.Ticker
+	stopCh    chan struct{}
 }
 
-func NewNotificationHandler(db *pgxpool.Pool, emailSender *email.Sender) *NotificationHandler {
+func NewNotificationHandler(db *pgxpool.Pool, notifier notify.Notifier, templates *email.Templates) *NotificationHandler {
 	return &NotificationHandler{
-		db:     db,
-		email:  emailSender,
-		stopCh: make(chan struct{}),
+		db:        db,
+		notifier:  notifier,
+		templates: templates,
+		chat:      chat.NewClient(config.AppConfig.ChatWebhookURL, 10*time.Second),
+		stopCh:    make(chan struct{}),
 	}
 }
 
+// Notifications claimed per run, how long a claim lasts before another replica
+// may take the notification over, and the backoff between attempts
+const (
+	notificationBatchSize   = 100
+	notificationLease       = 5 * time.Minute
+	notificationBaseBackoff = time.Minute
+	notificationMaxBackoff  = 6 * time.Hour
+)
+
+// notificationBackoff returns the delay before retrying a notification after
+// attempts failed ones: 1m, 2m, 4m... up to 6h
+func notificationBackoff(attempts int) time.Duration {
+	delay := notificationBaseBackoff
+	for i := 1; i < attempts; i++ {
+		delay *= 2
+		if delay >= notificationMaxBackoff {
+			return notificationMaxBackoff
+		}
+	}
+	return delay
+}
+
 // StartBackgroundWorker starts the background worker to process notifications
 func (h *NotificationHandler) StartBackgroundWorker() {
-	// Run every 5 minutes
-	h.ticker = time.NewTicker(5 * time.Minute)
+	interval := config.AppConfig.NotificationInterval
+	if interval <= 0 {
+		interval = 5 * time.Minute
+	}
+	h.ticker = time.NewTicker(interval)
 	log.Println("Notification worker started")
 
-	// Run immediately on start
-	go h.processPendingNotifications()
-
 	go func() {
+		// Run immediately on start
+		h.processPendingNotifications()
 		for {
 			select {
 			case <-h.ticker.C:
@@ -59,199 +93,241 @@ func (h *NotificationHandler) StopBackgroundWorker() {
 	close(h.stopCh)
 }
 
-// processPendingNotifications processes all pending notifications
+// claimedNotification is a notification this worker is sending
+type claimedNotification struct {
+	ID       uuid.UUID
+	PollID   uuid.UUID
+	UserID   *uuid.UUID
+	Type     string
+	Channel  string
+	Attempts int
+}
+
+// processPendingNotifications sends the notifications that are due
 func (h *NotificationHandler) processPendingNotifications() {
-	ctx, cancel := database.GetContext(30 * time.Second)
+	ctx, cancel := database.GetContext(notificationLease)
 	defer cancel()
 
-	// Get pending notifications that are due
-	now := time.Now()
-	rows, err := h.db.Query(ctx, `
-		SELECT id, poll_id, user_id, type, scheduled_at
-		FROM notifications
-		WHERE status = $1 AND scheduled_at <= $2
-		ORDER BY scheduled_at ASC
-		LIMIT 100
-	`, models.NotificationStatusPending, now)
+	h.queueChatClosingNotices(ctx)
+
+	notifications, err := h.claimDueNotifications(ctx)
 	if err != nil {
-		log.Printf("Error fetching pending notifications: %v", err)
+		log.Printf("Error claiming pending notifications: %v", err)
 		return
 	}
-	defer rows.Close()
+	if len(notifications) > 0 {
+		log.Printf("Processing %d pending notifications", len(notifications))
+	}
+
+	for _, n := range notifications {
+		var err error
+		if n.Channel == models.NotificationChannelChat {
+			err = h.sendChatNotification(ctx, n.PollID, n.Type)
+		} else {
+			err = h.sendNotification(ctx, n.ID, n.PollID, n.UserID, n.Type)
+		}
+		if err != nil {
+			log.Printf("Failed to send notification %s (attempt %d): %v", n.ID, n.Attempts, err)
+		}
+		h.recordNotificationResult(ctx, n, err)
+	}
+
+	h.sendCalendarCancellations(ctx)
+}
 
-	var notifications []struct {
-		ID     uuid.UUID
-		PollID uuid.UUID
-		UserID *uuid.UUID
-		Type   string
+// claimDueNotifications takes a batch of due notifications. The claim pushes their next
+// attempt past the lease, so other replicas skip them while they are being sent, and
+// picks them up again if this one dies.
+func (h *NotificationHandler) claimDueNotifications(ctx context.Context) ([]claimedNotification, error) {
+	rows, err := h.db.Query(ctx, `
+		WITH due AS (
+			SELECT id FROM notifications
+			WHERE status = $1 AND COALESCE(next_attempt_at, scheduled_at) <= CURRENT_TIMESTAMP
+			ORDER BY COALESCE(next_attempt_at, scheduled_at)
+			LIMIT $2
+			FOR UPDATE SKIP LOCKED
+		)
+		UPDATE notifications n
+		SET attempts = n.attempts + 1, next_attempt_at = CURRENT_TIMESTAMP + make_interval(secs => $3)
+		FROM due
+		WHERE n.id = due.id
+		RETURNING n.id, n.poll_id, n.user_id, n.type, n.channel, n.attempts
+	`, models.NotificationStatusPending, notificationBatchSize, notificationLease.Seconds())
+	if err != nil {
+		return nil, err
 	}
+	defer rows.Close()
 
+	var notifications []claimedNotification
 	for rows.Next() {
-		var n struct {
-			ID     uuid.UUID
-			PollID uuid.UUID
-			UserID *uuid.UUID
-			Type   string
-		}
-		if err := rows.Scan(&n.ID, &n.PollID, &n.UserID, &n.Type); err != nil {
+		var n claimedNotification
+		if err := rows.Scan(&n.ID, &n.PollID, &n.UserID, &n.Type, &n.Channel, &n.Attempts); err != nil {
 			log.Printf("Error scanning notification: %v", err)
 			continue
 		}
 		notifications = append(notifications, n)
 	}
+	return notifications, rows.Err()
+}
 
-	log.Printf("Processing %d pending notifications", len(notifications))
+// recordNotificationResult marks a notification sent, schedules a retry with exponential
+// backoff, or gives up after the maximum attempts, leaving it failed for an admin to requeue
+func (h *NotificationHandler) recordNotificationResult(ctx context.Context, n claimedNotification, sendErr error) {
+	var err error
+	switch {
+	case sendErr == nil:
+		_, err = h.db.Exec(ctx, `
+			UPDATE notifications SET status = $1, sent_at = CURRENT_TIMESTAMP, next_attempt_at = NULL, error_message = NULL
+			WHERE id = $2
+		`, models.NotificationStatusSent, n.ID)
+	case n.Attempts >= config.AppConfig.NotificationMaxAttempts:
+		_, err = h.db.Exec(ctx, `
+			UPDATE notifications SET status = $1, next_attempt_at = NULL, error_message = $2
+			WHERE id = $3
+		`, models.NotificationStatusFailed, sendErr.Error(), n.ID)
+	default:
+		_, err = h.db.Exec(ctx, `
+			UPDATE notifications SET next_attempt_at = CURRENT_TIMESTAMP + make_interval(secs => $1), error_message = $2
+			WHERE id = $3
+		`, notificationBackoff(n.Attempts).Seconds(), sendErr.Error(), n.ID)
+	}
+	if err != nil {
+		log.Printf("Failed to update notification %s: %v", n.ID, err)
+	}
+}
 
-	for _, n := range notifications {
-		if err := h.sendNotification(ctx, n.ID, n.PollID, n.UserID, n.Type); err != nil {
-			log.Printf("Failed to send notification %s: %v", n.ID, err)
-			h.updateNotificationStatus(ctx, n.ID, models.NotificationStatusFailed, err.Error())
-		} else {
-			h.updateNotificationStatus(ctx, n.ID, models.NotificationStatusSent, "")
+// sendNotification sends a notification, written in the recipient's language
+func (h *NotificationHandler) sendNotification(ctx context.Context, notificationID, pollID uuid.UUID, userID *uuid.UUID, notificationType string) error {
+	// Checked when sending, so turning a type off also drops the queued emails
+	if userID != nil && models.IsUserNotificationType(notificationType) {
+		enabled, err := emailEnabled(ctx, h.db, *userID, notificationType)
+		if err != nil {
+			return fmt.Errorf("failed to get preferences: %w", err)
+		}
+		if !enabled {
+			return nil
+		}
+	}
+
+	to, msg, err := h.renderNotification(ctx, pollID, userID, notificationType, "")
+	if err != nil {
+		return err
+	}
+
+	// Participants get the final date as a calendar invitation
+	var inv *invitation
+	var calendar *email.Calendar
+	if notificationType == models.NotificationTypeFinalDate && userID != nil {
+		inv, calendar, err = h.finalDateInvitation(ctx, pollID, *userID)
+		if err != nil {
+			return err
 		}
 	}
+
+	// Send through the backend routed for this type
+	err = h.notifier.Notify(ctx, notify.Message{
+		Type:     notificationType,
+		To:       []string{to},
+		Subject:  msg.Subject,
+		HTML:     msg.HTML,
+		Text:     msg.Text,
+		Calendar: calendar,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to send notification: %w", err)
+	}
+
+	if inv != nil {
+		if err := recordInvitation(ctx, h.db, inv, *userID); err != nil {
+			log.Printf("Failed to record the invitation of user %s to poll %s: %v", *userID, pollID, err)
+		}
+	}
+	return nil
 }
 
-// sendNotification sends a notification
-func (h *NotificationHandler) sendNotification(ctx context.Context, notificationID, pollID uuid.UUID, userID *uuid.UUID, notificationType string) error {
-	// Get poll details
+// renderNotification writes a notification about a poll for its recipient (the poll creator
+// when userID is nil) and returns their address. The recipient's language is used unless
+// locale is given.
+func (h *NotificationHandler) renderNotification(ctx context.Context, pollID uuid.UUID, userID *uuid.UUID, notificationType, locale string) (string, *email.Rendered, error) {
+	// Get poll details, with the final date if set
 	var poll struct {
 		Title      string
 		AccessCode string
-		CreatorID  uuid.UUID
+		CreatorID  *uuid.UUID
+		FinalDate  *time.Time
 	}
 	err := h.db.QueryRow(ctx, `
-		SELECT title, access_code, creator_id FROM polls WHERE id = $1
-	`, pollID).Scan(&poll.Title, &poll.AccessCode, &poll.CreatorID)
+		SELECT p.title, p.access_code, p.creator_id, d.start_time
+		FROM polls p
+		LEFT JOIN date_options d ON d.id = p.final_date
+		WHERE p.id = $1
+	`, pollID).Scan(&poll.Title, &poll.AccessCode, &poll.CreatorID, &poll.FinalDate)
 	if err != nil {
-		return fmt.Errorf("failed to get poll: %w", err)
+		return "", nil, fmt.Errorf("failed to get poll: %w", err)
 	}
 
-	// Get the final date if set
-	var dateOption struct {
-		StartTime time.Time
+	recipientID := userID
+	if recipientID == nil {
+		recipientID = poll.CreatorID
 	}
-	var hasFinalDate bool
-	_ = h.db.QueryRow(ctx, `
-		SELECT start_time FROM date_options
-		WHERE poll_id = $1 AND id = (SELECT final_date FROM polls WHERE id = $1)
-	`, pollID).Scan(&dateOption.StartTime)
-	if err == nil {
-		hasFinalDate = true
+	if recipientID == nil {
+		return "", nil, errors.New("the poll creator deleted their account")
 	}
-
-	var recipientEmail string
-	var recipientName string
-
-	if userID != nil {
-		// Get user details
-		err = h.db.QueryRow(ctx, `
-			SELECT email, name FROM users WHERE id = $1
-		`, *userID).Scan(&recipientEmail, &recipientName)
-		if err != nil {
-			return fmt.Errorf("failed to get user: %w", err)
-		}
-	} else {
-		// Send to poll creator
-		err = h.db.QueryRow(ctx, `
-			SELECT email, name FROM users WHERE id = $1
-		`, poll.CreatorID).Scan(&recipientEmail, &recipientName)
-		if err != nil {
-			return fmt.Errorf("failed to get creator: %w", err)
-		}
+	data := email.Data{
+		PollTitle: poll.Title,
+		URL:       fmt.Sprintf("%s/poll/%s", config.AppConfig.FrontendURL, poll.AccessCode),
+		Date:      poll.FinalDate,
 	}
-
-	// Build email based on type
-	var subject, body string
-	baseURL := "http://localhost:5173" // TODO: from config
-	pollURL := fmt.Sprintf("%s/poll/%s", baseURL, poll.AccessCode)
-
-	switch notificationType {
-	case models.NotificationTypeEventReminder:
-		subject = fmt.Sprintf("Rappel: %s", poll.Title)
-		body = fmt.Sprintf(`
-			<h2>Rappel pour l'événement : %s</h2>
-			<p>Bonjour %s,</p>
-			<p>Ceci est un rappel pour l'événement <strong>%s</strong>.</p>
-			%s
-			<p><a href="%s" style="padding: 10px 20px; background: #4F46E5; color: white; text-decoration: none; border-radius: 5px;">Voir le sondage</a></p>
-		`, poll.Title, recipientName, poll.Title,
-			func() string {
-				if hasFinalDate {
-					return fmt.Sprintf("<p>Date et heure: <strong>%s</strong></p>", dateOption.StartTime.Format("02/01/2006 à 15:04"))
-				}
-				return ""
-			}(), pollURL)
-
-	case models.NotificationTypeNewVote:
-		subject = fmt.Sprintf("Nouveau vote pour: %s", poll.Title)
-		body = fmt.Sprintf(`
-			<h2>Nouveau vote enregistré</h2>
-			<p>Bonjour %s,</p>
-			<p>Un nouveau vote a été enregistré pour le sondage <strong>%s</strong>.</p>
-			<p><a href="%s" style="padding: 10px 20px; background: #4F46E5; color: white; text-decoration: none; border-radius: 5px;">Voir le sondage</a></p>
-		`, recipientName, poll.Title, pollURL)
-
-	case models.NotificationTypeNewComment:
-		subject = fmt.Sprintf("Nouveau commentaire pour: %s", poll.Title)
-		body = fmt.Sprintf(`
-			<h2>Nouveau commentaire</h2>
-			<p>Bonjour %s,</p>
-			<p>Un nouveau commentaire a été ajouté au sondage <strong>%s</strong>.</p>
-			<p><a href="%s" style="padding: 10px 20px; background: #4F46E5; color: white; text-decoration: none; border-radius: 5px;">Voir le sondage</a></p>
-		`, recipientName, poll.Title, pollURL)
-
-	case models.NotificationTypeFinalDate:
-		subject = fmt.Sprintf("Date fixée pour: %s", poll.Title)
-		body = fmt.Sprintf(`
-			<h2>Date finale fixée</h2>
-			<p>Bonjour %s,</p>
-			<p>La date finale a été fixée pour le sondage <strong>%s</strong>.</p>
-			%s
-			<p><a href="%s" style="padding: 10px 20px; background: #4F46E5; color: white; text-decoration: none; border-radius: 5px;">Voir le sondage</a></p>
-		`, recipientName, poll.Title,
-			func() string {
-				if hasFinalDate {
-					return fmt.Sprintf("<p>Date retenue: <strong>%s</strong></p>", dateOption.StartTime.Format("02/01/2006 à 15:04"))
-				}
-				return ""
-			}(), pollURL)
-	}
-
-	// Send email
-	if err := h.email.Send([]string{recipientEmail}, subject, body); err != nil {
-		return fmt.Errorf("failed to send email: %w", err)
+	var to string
+	err = h.db.QueryRow(ctx, `
+		SELECT email, name, COALESCE(locale, '') FROM users WHERE id = $1
+	`, *recipientID).Scan(&to, &data.RecipientName, &data.Locale)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to get recipient: %w", err)
+	}
+	if locale != "" {
+		data.Locale = locale
 	}
 
-	return nil
+	msg, err := h.templates.Render(notificationType, data)
+	return to, msg, err
 }
 
-// updateNotificationStatus updates the status of a notification
-func (h *NotificationHandler) updateNotificationStatus(ctx context.Context, notificationID uuid.UUID, status, errorMessage string) {
-	now := time.Now()
-	var errMsg *string
-	if errorMessage != "" {
-		errMsg = &errorMessage
+// HandleEvent fills the notification centers and schedules the emails following a poll
+// event: reminders and calendar invitations once finalized, cancellations when the final
+// date is removed. Run by the outbox relay, in the transaction that marks the event relayed.
+func (h *NotificationHandler) HandleEvent(ctx context.Context, tx pgx.Tx, e events.Event) error {
+	if err := addToInbox(ctx, tx, e); err != nil {
+		return fmt.Errorf("failed to update notification centers: %w", err)
 	}
 
-	_, err := h.db.Exec(ctx, `
-		UPDATE notifications SET status = $1, sent_at = $2, error_message = $3
-		WHERE id = $4
-	`, status, now, errMsg, notificationID)
-	if err != nil {
-		log.Printf("Failed to update notification status: %v", err)
+	switch e.Type {
+	case events.TypePollCreated:
+		return h.scheduleChatNotification(ctx, tx, e.PollID, models.NotificationTypePollCreated)
+	case events.TypePollFinalized:
+		if err := scheduleReminders(ctx, tx, e.PollID); err != nil {
+			return fmt.Errorf("failed to schedule reminders: %w", err)
+		}
+		if err := scheduleFinalDateEmails(ctx, tx, e.PollID); err != nil {
+			return fmt.Errorf("failed to schedule final date emails: %w", err)
+		}
+		return h.scheduleChatNotification(ctx, tx, e.PollID, models.NotificationTypeFinalDate)
+	case events.TypeDateOptionDeleted:
+		// Deleting the final date option unsets it
+		if err := cancelInvitations(ctx, tx, e.PollID); err != nil {
+			return fmt.Errorf("failed to cancel invitations: %w", err)
+		}
 	}
+	return nil
 }
 
-// ScheduleReminderForPoll schedules reminder notifications for all participants of a poll
-func (h *NotificationHandler) ScheduleReminderForPoll(pollID uuid.UUID) error {
-	ctx, cancel := database.GetContext()
-	defer cancel()
-
+// scheduleReminders schedules reminder notifications for all participants of a poll,
+// replacing those scheduled for a previous final date
+func scheduleReminders(ctx context.Context, tx pgx.Tx, pollID uuid.UUID) error {
 	// Check if reminders are enabled
 	var enabled bool
 	var hoursBefore int
-	err := h.db.QueryRow(ctx, `
+	err := tx.QueryRow(ctx, `
 		SELECT CASE WHEN value = 'true' THEN true ELSE false END
 		FROM notification_settings WHERE key = $1
 	`, models.SettingReminderEnabled).Scan(&enabled)
@@ -259,7 +335,7 @@ func (h *NotificationHandler) ScheduleReminderForPoll(pollID uuid.UUID) error {
 		return nil // Reminders disabled
 	}
 
-	err = h.db.QueryRow(ctx, `
+	err = tx.QueryRow(ctx, `
 		SELECT value::int FROM notification_settings WHERE key = $1
 	`, models.SettingReminderHours).Scan(&hoursBefore)
 	if err != nil {
@@ -267,18 +343,22 @@ func (h *NotificationHandler) ScheduleReminderForPoll(pollID uuid.UUID) error {
 	}
 
 	// Get poll final date
-	var finalDateID *uuid.UUID
-	err = h.db.QueryRow(ctx, `SELECT final_date FROM polls WHERE id = $1`, pollID).Scan(&finalDateID)
-	if err != nil || finalDateID == nil {
+	var eventTime time.Time
+	err = tx.QueryRow(ctx, `
+		SELECT d.start_time FROM polls p JOIN date_options d ON d.id = p.final_date
+		WHERE p.id = $1
+	`, pollID).Scan(&eventTime)
+	if errors.Is(err, pgx.ErrNoRows) {
 		return nil // No final date set
 	}
-
-	var eventTime time.Time
-	err = h.db.QueryRow(ctx, `
-		SELECT start_time FROM date_options WHERE id = $1
-	`, *finalDateID).Scan(&eventTime)
 	if err != nil {
-		return nil
+		return err
+	}
+
+	if _, err := tx.Exec(ctx, `
+		DELETE FROM notifications WHERE poll_id = $1 AND type = $2 AND status = 'pending'
+	`, pollID, models.NotificationTypeEventReminder); err != nil {
+		return err
 	}
 
 	// Calculate reminder time
@@ -288,37 +368,13 @@ func (h *NotificationHandler) ScheduleReminderForPoll(pollID uuid.UUID) error {
 		return nil // Event already passed or reminder time passed
 	}
 
-	// Get all participants (users who voted)
-	rows, err := h.db.Query(ctx, `
-		SELECT DISTINCT user_id FROM votes WHERE poll_id = $1 AND user_id IS NOT NULL
-	`, pollID)
-	if err != nil {
-		return err
-	}
-	defer rows.Close()
-
-	for rows.Next() {
-		var userID uuid.UUID
-		if err := rows.Scan(&userID); err != nil {
-			continue
-		}
-
-		// Check if notification already scheduled
-		var exists bool
-		h.db.QueryRow(ctx, `
-			SELECT EXISTS(SELECT 1 FROM notifications
-			WHERE poll_id = $1 AND user_id = $2 AND type = $3 AND status = 'pending')
-		`, pollID, userID, models.NotificationTypeEventReminder).Scan(&exists)
-
-		if !exists {
-			h.db.Exec(ctx, `
-				INSERT INTO notifications (id, poll_id, user_id, type, scheduled_at)
-				VALUES ($1, $2, $3, $4, $5)
-			`, uuid.New(), pollID, userID, models.NotificationTypeEventReminder, reminderTime)
-		}
-	}
-
-	return nil
+	// Notify all participants (users who voted)
+	_, err = tx.Exec(ctx, `
+		INSERT INTO notifications (poll_id, user_id, type, scheduled_at)
+		SELECT DISTINCT poll_id, user_id, $2, $3::timestamptz FROM votes
+		WHERE poll_id = $1 AND user_id IS NOT NULL
+	`, pollID, models.NotificationTypeEventReminder, reminderTime)
+	return err
 }
 
 // GetNotificationSettings returns all notification settings
@@ -343,10 +399,7 @@ func (h *NotificationHandler) GetNotificationSettings(c *gin.Context) {
 	ctx, cancel := database.GetContext()
 	defer cancel()
 
-	// Check if user is admin
-	var isAdmin bool
-	h.db.QueryRow(ctx, `SELECT email IN ($1, $2, $3) FROM users WHERE id = $4`, "steph.leminhnhut@gmail.com", "stephane.le@gmail.com", "stephane.consulting.ai@gmail.com", *userID).Scan(&isAdmin)
-	if !isAdmin {
+	if !isAdmin(ctx, h.db, *userID) {
 		c.JSON(http.StatusForbidden, gin.H{"error": "Admin access required"})
 		return
 	}
@@ -403,10 +456,7 @@ func (h *NotificationHandler) UpdateNotificationSetting(c *gin.Context) {
 	ctx, cancel := database.GetContext()
 	defer cancel()
 
-	// Check if user is admin
-	var isAdmin bool
-	h.db.QueryRow(ctx, `SELECT email IN ($1, $2, $3) FROM users WHERE id = $4`, "steph.leminhnhut@gmail.com", "stephane.le@gmail.com", "stephane.consulting.ai@gmail.com", *userID).Scan(&isAdmin)
-	if !isAdmin {
+	if !isAdmin(ctx, h.db, *userID) {
 		c.JSON(http.StatusForbidden, gin.H{"error": "Admin access required"})
 		return
 	}
@@ -423,3 +473,163 @@ func (h *NotificationHandler) UpdateNotificationSetting(c *gin.Context) {
 
 	c.JSON(http.StatusOK, gin.H{"message": "Setting updated"})
 }
+
+// ListNotifications returns queued notifications, the failed ones by default
+// @Summary      Lister les notifications
+// @Description  Retourne les notifications d'un statut (failed par défaut), avec leurs tentatives et la dernière erreur (admin uniquement)
+// @Tags         admin
+// @Produce      json
+// @Security     BearerAuth
+// @Param        status  query  string  false  "pending, sent ou failed (défaut)"
+// @Param        type    query  string  false  "Type de notification"
+// @Param        limit   query  int     false  "Nombre de notifications (50 par défaut, 200 max)"
+// @Param        offset  query  int     false  "Décalage"
+// @Success      200  {object}  map[string]interface{}  "notifications, count"
+// @Failure      400  {object}  map[string]string
+// @Failure      401  {object}  map[string]string
+// @Failure      403  {object}  map[string]string
+// @Router       /admin/notifications [get]
+func (h *NotificationHandler) ListNotifications(c *gin.Context) {
+	userID := middleware.GetCurrentUser(c)
+	if userID == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Not authenticated"})
+		return
+	}
+
+	status := c.DefaultQuery("status", models.NotificationStatusFailed)
+	switch status {
+	case models.NotificationStatusPending, models.NotificationStatusSent, models.NotificationStatusFailed:
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid status"})
+		return
+	}
+	limit, offset := auditPage(c)
+
+	ctx, cancel := database.GetContext()
+	defer cancel()
+
+	if !isAdmin(ctx, h.db, *userID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Admin access required"})
+		return
+	}
+
+	rows, err := h.db.Query(ctx, `
+		SELECT id, poll_id, user_id, type, channel, status, scheduled_at, attempts,
+		       CASE WHEN status = 'pending' THEN next_attempt_at END, sent_at, error_message, created_at
+		FROM notifications
+		WHERE status = $1 AND ($2 = '' OR type = $2)
+		ORDER BY COALESCE(next_attempt_at, scheduled_at) DESC
+		LIMIT $3 OFFSET $4
+	`, status, c.Query("type"), limit, offset)
+	if err != nil {
+		log.Printf("Error querying notifications: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch notifications"})
+		return
+	}
+	defer rows.Close()
+
+	notifications := []models.Notification{}
+	for rows.Next() {
+		var n models.Notification
+		err := rows.Scan(&n.ID, &n.PollID, &n.UserID, &n.Type, &n.Channel, &n.Status, &n.ScheduledAt, &n.Attempts,
+			&n.NextAttempt, &n.SentAt, &n.ErrorMessage, &n.CreatedAt)
+		if err != nil {
+			log.Printf("Error scanning notification: %v", err)
+			continue
+		}
+		notifications = append(notifications, n)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"notifications": notifications,
+		"count":         len(notifications),
+	})
+}
+
+// RequeueNotification sends a failed notification again
+// @Summary      Renvoyer une notification
+// @Description  Remet une notification en échec dans la file, avec un nouveau nombre de tentatives (admin uniquement)
+// @Tags         admin
+// @Produce      json
+// @Security     BearerAuth
+// @Param        notificationId  path  string  true  "ID de la notification"
+// @Success      200  {object}  map[string]string
+// @Failure      400  {object}  map[string]string
+// @Failure      401  {object}  map[string]string
+// @Failure      403  {object}  map[string]string
+// @Failure      404  {object}  map[string]string
+// @Router       /admin/notifications/{notificationId}/requeue [post]
+func (h *NotificationHandler) RequeueNotification(c *gin.Context) {
+	userID := middleware.GetCurrentUser(c)
+	if userID == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Not authenticated"})
+		return
+	}
+
+	notificationID, err := uuid.Parse(c.Param("notificationId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid notification ID"})
+		return
+	}
+
+	ctx, cancel := database.GetContext()
+	defer cancel()
+
+	if !isAdmin(ctx, h.db, *userID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Admin access required"})
+		return
+	}
+
+	tag, err := h.db.Exec(ctx, `
+		UPDATE notifications SET status = $1, attempts = 0, next_attempt_at = NULL, error_message = NULL
+		WHERE id = $2 AND status = $3
+	`, models.NotificationStatusPending, notificationID, models.NotificationStatusFailed)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to requeue notification"})
+		return
+	}
+	if tag.RowsAffected() == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Failed notification not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Notification requeued"})
+}
+
+// RequeueFailedNotifications sends every failed notification again, after an outage
+// @Summary      Renvoyer les notifications en échec
+// @Description  Remet dans la file toutes les notifications en échec, éventuellement d'un seul type (admin uniquement)
+// @Tags         admin
+// @Produce      json
+// @Security     BearerAuth
+// @Param        type  query  string  false  "Type de notification"
+// @Success      200  {object}  map[string]interface{}  "requeued"
+// @Failure      401  {object}  map[string]string
+// @Failure      403  {object}  map[string]string
+// @Router       /admin/notifications/requeue [post]
+func (h *NotificationHandler) RequeueFailedNotifications(c *gin.Context) {
+	userID := middleware.GetCurrentUser(c)
+	if userID == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Not authenticated"})
+		return
+	}
+
+	ctx, cancel := database.GetContext()
+	defer cancel()
+
+	if !isAdmin(ctx, h.db, *userID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Admin access required"})
+		return
+	}
+
+	tag, err := h.db.Exec(ctx, `
+		UPDATE notifications SET status = $1, attempts = 0, next_attempt_at = NULL, error_message = NULL
+		WHERE status = $2 AND ($3 = '' OR type = $3)
+	`, models.NotificationStatusPending, models.NotificationStatusFailed, c.Query("type"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to requeue notifications"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"requeued": tag.RowsAffected()})
+}
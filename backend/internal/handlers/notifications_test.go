@@ -0,0 +1,16 @@
+package handlers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNotificationBackoff(t *testing.T) {
+	assert.Equal(t, time.Minute, notificationBackoff(1))
+	assert.Equal(t, 2*time.Minute, notificationBackoff(2))
+	assert.Equal(t, 16*time.Minute, notificationBackoff(5))
+	assert.Equal(t, 6*time.Hour, notificationBackoff(12))
+	assert.Equal(t, 6*time.Hour, notificationBackoff(100))
+}
@@ -0,0 +1,160 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"golang.org/x/crypto/bcrypt"
+	"doodle-clone/internal/config"
+	"doodle-clone/internal/database"
+	"doodle-clone/internal/middleware"
+	"doodle-clone/internal/models"
+)
+
+// minPollPasswordLength is enforced when a password is set on an existing poll
+const minPollPasswordLength = 8
+
+// hashPollPassword hashes a poll password for storage
+func hashPollPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	return string(hash), err
+}
+
+// pollUnlockRetryAfter returns how long unlocking a poll is refused after too many
+// wrong passwords within the window
+func (h *PollHandler) pollUnlockRetryAfter(ctx context.Context, pollID uuid.UUID) (time.Duration, error) {
+	maxFailures := config.AppConfig.PollUnlockMaxFailures
+	window := config.AppConfig.PollUnlockWindow
+	if maxFailures <= 0 {
+		return 0, nil
+	}
+
+	// The window reopens when the oldest failure that keeps it full expires
+	var oldest *time.Time
+	err := h.db.QueryRow(ctx, `
+		SELECT created_at FROM poll_unlock_failures
+		WHERE poll_id = $1 AND created_at > $2
+		ORDER BY created_at DESC
+		OFFSET $3 LIMIT 1
+	`, pollID, time.Now().Add(-window), maxFailures-1).Scan(&oldest)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	if oldest == nil {
+		return 0, nil
+	}
+	if wait := oldest.Add(window).Sub(time.Now()); wait > 0 {
+		return wait, nil
+	}
+	return 0, nil
+}
+
+// recordPollUnlockFailure stores a wrong password and drops failures past the window
+func (h *PollHandler) recordPollUnlockFailure(ctx context.Context, c *gin.Context, pollID uuid.UUID) {
+	_, err := h.db.Exec(ctx, `
+		INSERT INTO poll_unlock_failures (poll_id, ip_address) VALUES ($1, $2)
+	`, pollID, c.ClientIP())
+	if err != nil {
+		log.Printf("Failed to record poll unlock failure: %v", err)
+		return
+	}
+
+	_, err = h.db.Exec(ctx, `
+		DELETE FROM poll_unlock_failures WHERE poll_id = $1 AND created_at < $2
+	`, pollID, time.Now().Add(-config.AppConfig.PollUnlockWindow))
+	if err != nil {
+		log.Printf("Failed to purge poll unlock failures: %v", err)
+	}
+}
+
+// UnlockPoll exchanges the password of a poll for a poll access token
+// @Summary      Déverrouiller un sondage
+// @Description  Vérifie le mot de passe d'un sondage protégé et délivre un jeton d'accès de courte durée, à envoyer dans l'en-tête X-Poll-Access (ou le paramètre poll_access)
+// @Tags         polls
+// @Accept       json
+// @Produce      json
+// @Param        id      path      string                    true  "UUID du sondage ou code d'accès"
+// @Param        request body      models.UnlockPollRequest  true  "Mot de passe"
+// @Success      200  {object}  map[string]interface{}  "poll_access_token, expires_at"
+// @Failure      400  {object}  map[string]string
+// @Failure      401  {object}  map[string]string
+// @Failure      404  {object}  map[string]string
+// @Failure      429  {object}  map[string]interface{}
+// @Router       /polls/{id}/unlock [post]
+func (h *PollHandler) UnlockPoll(c *gin.Context) {
+	var req models.UnlockPollRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx, cancel := database.GetContext()
+	defer cancel()
+
+	query := `SELECT id, password_hash FROM polls WHERE access_code = $1`
+	if _, err := uuid.Parse(c.Param("id")); err == nil {
+		query = `SELECT id, password_hash FROM polls WHERE id = $1`
+	}
+
+	var pollID uuid.UUID
+	var passwordHash *string
+	err := h.db.QueryRow(ctx, query, c.Param("id")).Scan(&pollID, &passwordHash)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Poll not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if passwordHash == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "This poll is not password protected"})
+		return
+	}
+
+	wait, err := h.pollUnlockRetryAfter(ctx, pollID)
+	if err != nil {
+		log.Printf("Error counting poll unlock failures: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if wait > 0 {
+		seconds := int(math.Ceil(wait.Seconds()))
+		c.Header("Retry-After", strconv.Itoa(seconds))
+		c.JSON(http.StatusTooManyRequests, gin.H{
+			"error":       "Too many wrong passwords for this poll. Please try again later.",
+			"retry_after": seconds,
+		})
+		return
+	}
+
+	if bcrypt.CompareHashAndPassword([]byte(*passwordHash), []byte(req.Password)) != nil {
+		h.recordPollUnlockFailure(ctx, c, pollID)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid password"})
+		return
+	}
+
+	token, expiresAt, err := middleware.GeneratePollAccessToken(pollID, *passwordHash)
+	if err != nil {
+		log.Printf("Error signing poll access token: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unlock poll"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"poll_id":           pollID,
+		"poll_access_token": token,
+		"expires_at":        expiresAt,
+	})
+}
@@ -0,0 +1,514 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"doodle-clone/internal/audit"
+	"doodle-clone/internal/database"
+	"doodle-clone/internal/events"
+	"doodle-clone/internal/middleware"
+	"doodle-clone/internal/models"
+)
+
+// querier is implemented by both *pgxpool.Pool and pgx.Tx
+type querier interface {
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+// versionedPollFields are the poll fields kept in versions, along with the date options
+var versionedPollFields = []string{"title", "description", "location", "expires_at"}
+
+// recordPollVersion snapshots the current configuration of a poll as its next version.
+// It runs in the transaction of the change, so a poll never changes without its version.
+func recordPollVersion(ctx context.Context, db querier, pollID uuid.UUID, userID *uuid.UUID, reason string, revertedFrom *int) (int, error) {
+	var version int
+	err := db.QueryRow(ctx, `
+		INSERT INTO poll_versions (poll_id, version, title, description, location, expires_at, date_options,
+		                           reason, reverted_from, created_by)
+		SELECT p.id, COALESCE((SELECT MAX(version) FROM poll_versions WHERE poll_id = p.id), 0) + 1,
+		       p.title, p.description, p.location, p.expires_at,
+		       COALESCE((
+		           SELECT jsonb_agg(jsonb_build_object('id', d.id, 'start_time', d.start_time, 'end_time', d.end_time)
+		                            ORDER BY d.start_time, d.id)
+		           FROM date_options d WHERE d.poll_id = p.id
+		       ), '[]'::jsonb),
+		       $2, $3, $4
+		FROM polls p WHERE p.id = $1
+		RETURNING version
+	`, pollID, reason, revertedFrom, userID).Scan(&version)
+	return version, err
+}
+
+// loadPollVersion reads one version of a poll
+func (h *PollHandler) loadPollVersion(ctx context.Context, pollID uuid.UUID, version int) (*models.PollVersion, error) {
+	var v models.PollVersion
+	err := h.db.QueryRow(ctx, `
+		SELECT v.id, v.poll_id, v.version, v.title, COALESCE(v.description, ''), COALESCE(v.location, ''),
+		       v.expires_at, v.date_options, v.reason, v.reverted_from, v.created_by, COALESCE(u.name, ''), v.created_at
+		FROM poll_versions v
+		LEFT JOIN users u ON v.created_by = u.id
+		WHERE v.poll_id = $1 AND v.version = $2
+	`, pollID, version).Scan(&v.ID, &v.PollID, &v.Version, &v.Title, &v.Description, &v.Location,
+		&v.ExpiresAt, &v.DateOptions, &v.Reason, &v.RevertedFrom, &v.CreatedBy, &v.CreatedByName, &v.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &v, nil
+}
+
+// loadCurrentPollVersion reads the live configuration of a poll in the shape of a version
+func loadCurrentPollVersion(ctx context.Context, db querier, pollID uuid.UUID) (*models.PollVersion, error) {
+	v := models.PollVersion{PollID: pollID}
+	err := db.QueryRow(ctx, `
+		SELECT p.title, COALESCE(p.description, ''), COALESCE(p.location, ''), p.expires_at,
+		       COALESCE((
+		           SELECT jsonb_agg(jsonb_build_object('id', d.id, 'start_time', d.start_time, 'end_time', d.end_time)
+		                            ORDER BY d.start_time, d.id)
+		           FROM date_options d WHERE d.poll_id = p.id
+		       ), '[]'::jsonb)
+		FROM polls p WHERE p.id = $1
+	`, pollID).Scan(&v.Title, &v.Description, &v.Location, &v.ExpiresAt, &v.DateOptions)
+	if err != nil {
+		return nil, err
+	}
+	return &v, nil
+}
+
+// pollVersionFields returns the restorable fields of a version, keyed like the API
+func pollVersionFields(v *models.PollVersion) map[string]interface{} {
+	if v == nil {
+		return nil
+	}
+	return map[string]interface{}{
+		"title":       v.Title,
+		"description": v.Description,
+		"location":    v.Location,
+		"expires_at":  v.ExpiresAt,
+	}
+}
+
+// diffPollVersions compares two versions; from may be nil for the first version
+func diffPollVersions(from, to *models.PollVersion) models.PollVersionDiff {
+	diff := models.PollVersionDiff{
+		To:           to.Version,
+		Changes:      map[string]interface{}{},
+		DatesAdded:   []models.PollVersionDateOption{},
+		DatesRemoved: []models.PollVersionDateOption{},
+	}
+
+	var fromDates []models.PollVersionDateOption
+	if from != nil {
+		diff.From = from.Version
+		fromDates = from.DateOptions
+	}
+	for field, change := range audit.Diff(pollVersionFields(from), pollVersionFields(to)) {
+		diff.Changes[field] = change
+	}
+
+	// Date options cannot be edited, only added or removed, so their ID is enough
+	inFrom := make(map[uuid.UUID]bool, len(fromDates))
+	for _, d := range fromDates {
+		inFrom[d.ID] = true
+	}
+	inTo := make(map[uuid.UUID]bool, len(to.DateOptions))
+	for _, d := range to.DateOptions {
+		inTo[d.ID] = true
+		if !inFrom[d.ID] {
+			diff.DatesAdded = append(diff.DatesAdded, d)
+		}
+	}
+	for _, d := range fromDates {
+		if !inTo[d.ID] {
+			diff.DatesRemoved = append(diff.DatesRemoved, d)
+		}
+	}
+	return diff
+}
+
+// parsePollVersionParams reads the poll UUID and the version number of a route
+func parsePollVersionParams(c *gin.Context) (uuid.UUID, int, bool) {
+	pollID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid poll ID"})
+		return uuid.Nil, 0, false
+	}
+	version, err := strconv.Atoi(c.Param("version"))
+	if err != nil || version <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid version"})
+		return uuid.Nil, 0, false
+	}
+	return pollID, version, true
+}
+
+// ListPollVersions returns the versions of a poll, newest first
+// @Summary      Historique des versions d'un sondage
+// @Description  Retourne les versions successives du titre, de la description, du lieu, de l'expiration et des dates d'un sondage (créateur uniquement)
+// @Tags         polls
+// @Produce      json
+// @Security     BearerAuth
+// @Param        id   path      string  true  "UUID du sondage"
+// @Success      200  {object}  map[string]interface{}  "versions, count"
+// @Failure      400  {object}  map[string]string
+// @Failure      401  {object}  map[string]string
+// @Failure      403  {object}  map[string]string
+// @Failure      404  {object}  map[string]string
+// @Router       /polls/{id}/versions [get]
+func (h *PollHandler) ListPollVersions(c *gin.Context) {
+	pollID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid poll ID"})
+		return
+	}
+
+	ctx, cancel := database.GetContext()
+	defer cancel()
+
+	if !requirePollCreator(c, ctx, h.db, pollID, "Only the creator can view the poll history") {
+		return
+	}
+
+	rows, err := h.db.Query(ctx, `
+		SELECT v.id, v.poll_id, v.version, v.title, COALESCE(v.description, ''), COALESCE(v.location, ''),
+		       v.expires_at, v.date_options, v.reason, v.reverted_from, v.created_by, COALESCE(u.name, ''), v.created_at
+		FROM poll_versions v
+		LEFT JOIN users u ON v.created_by = u.id
+		WHERE v.poll_id = $1
+		ORDER BY v.version DESC
+	`, pollID)
+	if err != nil {
+		log.Printf("Error querying poll versions: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch versions"})
+		return
+	}
+	defer rows.Close()
+
+	versions := []models.PollVersion{}
+	for rows.Next() {
+		var v models.PollVersion
+		err := rows.Scan(&v.ID, &v.PollID, &v.Version, &v.Title, &v.Description, &v.Location,
+			&v.ExpiresAt, &v.DateOptions, &v.Reason, &v.RevertedFrom, &v.CreatedBy, &v.CreatedByName, &v.CreatedAt)
+		if err != nil {
+			log.Printf("Error scanning poll version: %v", err)
+			continue
+		}
+		versions = append(versions, v)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"versions": versions,
+		"count":    len(versions),
+	})
+}
+
+// GetPollVersion returns one version of a poll
+// @Summary      Version d'un sondage
+// @Description  Retourne une version d'un sondage (créateur uniquement)
+// @Tags         polls
+// @Produce      json
+// @Security     BearerAuth
+// @Param        id       path      string  true  "UUID du sondage"
+// @Param        version  path      int     true  "Numéro de version"
+// @Success      200  {object}  models.PollVersion
+// @Failure      400  {object}  map[string]string
+// @Failure      401  {object}  map[string]string
+// @Failure      403  {object}  map[string]string
+// @Failure      404  {object}  map[string]string
+// @Router       /polls/{id}/versions/{version} [get]
+func (h *PollHandler) GetPollVersion(c *gin.Context) {
+	pollID, version, ok := parsePollVersionParams(c)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := database.GetContext()
+	defer cancel()
+
+	if !requirePollCreator(c, ctx, h.db, pollID, "Only the creator can view the poll history") {
+		return
+	}
+
+	v, err := h.loadPollVersion(ctx, pollID, version)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Version not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, v)
+}
+
+// DiffPollVersion compares a version of a poll with another one
+// @Summary      Différences entre versions
+// @Description  Compare une version avec la précédente, une autre version (against=N) ou l'état actuel (against=current)
+// @Tags         polls
+// @Produce      json
+// @Security     BearerAuth
+// @Param        id       path      string  true   "UUID du sondage"
+// @Param        version  path      int     true   "Numéro de version"
+// @Param        against  query     string  false  "Version de référence (numéro ou current, précédente par défaut)"
+// @Success      200  {object}  models.PollVersionDiff
+// @Failure      400  {object}  map[string]string
+// @Failure      401  {object}  map[string]string
+// @Failure      403  {object}  map[string]string
+// @Failure      404  {object}  map[string]string
+// @Router       /polls/{id}/versions/{version}/diff [get]
+func (h *PollHandler) DiffPollVersion(c *gin.Context) {
+	pollID, version, ok := parsePollVersionParams(c)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := database.GetContext()
+	defer cancel()
+
+	if !requirePollCreator(c, ctx, h.db, pollID, "Only the creator can view the poll history") {
+		return
+	}
+
+	to, err := h.loadPollVersion(ctx, pollID, version)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Version not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	// The current state is compared as "from", so the diff reads as what a revert would do
+	var from *models.PollVersion
+	against := c.Query("against")
+	switch {
+	case against == "current":
+		from, err = loadCurrentPollVersion(ctx, h.db, pollID)
+	case against != "":
+		n, convErr := strconv.Atoi(against)
+		if convErr != nil || n <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid against, expected a version number or current"})
+			return
+		}
+		from, err = h.loadPollVersion(ctx, pollID, n)
+	case version > 1:
+		from, err = h.loadPollVersion(ctx, pollID, version-1)
+	}
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Version not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, diffPollVersions(from, to))
+}
+
+// RevertPollVersion restores the configuration of a poll from one of its versions
+// @Summary      Restaurer une version
+// @Description  Restaure le titre, la description, le lieu, l'expiration et les dates d'une version (créateur uniquement). Les dates absentes de la version sont supprimées avec leurs votes ; les participants sont prévenus si les dates changent.
+// @Tags         polls
+// @Produce      json
+// @Security     BearerAuth
+// @Param        id       path      string  true  "UUID du sondage"
+// @Param        version  path      int     true  "Numéro de version"
+// @Success      200  {object}  map[string]interface{}  "version, diff, votes_removed"
+// @Failure      400  {object}  map[string]string
+// @Failure      401  {object}  map[string]string
+// @Failure      403  {object}  map[string]string
+// @Failure      404  {object}  map[string]string
+// @Failure      409  {object}  map[string]string
+// @Router       /polls/{id}/versions/{version}/revert [post]
+func (h *PollHandler) RevertPollVersion(c *gin.Context) {
+	pollID, version, ok := parsePollVersionParams(c)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := database.GetContext()
+	defer cancel()
+
+	if !requirePollCreator(c, ctx, h.db, pollID, "Only the creator can restore a version") {
+		return
+	}
+	userID := middleware.GetCurrentUser(c)
+
+	target, err := h.loadPollVersion(ctx, pollID, version)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Version not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	tx, err := h.db.Begin(ctx)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	// Lock the poll so concurrent edits cannot slip between the diff and the restore
+	var finalDate *uuid.UUID
+	if err := tx.QueryRow(ctx, "SELECT final_date FROM polls WHERE id = $1 FOR UPDATE", pollID).Scan(&finalDate); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	current, err := loadCurrentPollVersion(ctx, tx, pollID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	diff := diffPollVersions(current, target)
+	diff.From = 0 // The current state, which may not match any version number
+	if len(diff.Changes) == 0 && len(diff.DatesAdded) == 0 && len(diff.DatesRemoved) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "The poll already matches this version"})
+		return
+	}
+
+	removedIDs := make([]uuid.UUID, 0, len(diff.DatesRemoved))
+	for _, d := range diff.DatesRemoved {
+		if finalDate != nil && d.ID == *finalDate {
+			c.JSON(http.StatusConflict, gin.H{"error": "The final date is not part of this version"})
+			return
+		}
+		removedIDs = append(removedIDs, d.ID)
+	}
+
+	_, err = tx.Exec(ctx, `
+		UPDATE polls SET title = $1, description = $2, location = $3, expires_at = $4, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $5
+	`, target.Title, target.Description, target.Location, target.ExpiresAt, pollID)
+	if err != nil {
+		log.Printf("Error restoring poll %s: %v", pollID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to restore version"})
+		return
+	}
+
+	datesChanged := len(diff.DatesAdded) > 0 || len(diff.DatesRemoved) > 0
+	if datesChanged {
+		// Warn participants before their votes on removed dates go away
+		if err := schedulePollChangedNotifications(ctx, tx, pollID, *userID); err != nil {
+			log.Printf("Error scheduling poll change notifications: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to restore version"})
+			return
+		}
+	}
+
+	var votesRemoved int64
+	if len(removedIDs) > 0 {
+		tag, err := tx.Exec(ctx, `DELETE FROM votes WHERE poll_id = $1 AND date_option_id = ANY($2)`, pollID, removedIDs)
+		if err != nil {
+			log.Printf("Error removing votes of reverted dates: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to restore version"})
+			return
+		}
+		votesRemoved = tag.RowsAffected()
+
+		_, err = tx.Exec(ctx, `DELETE FROM date_options WHERE poll_id = $1 AND id = ANY($2)`, pollID, removedIDs)
+		if err != nil {
+			log.Printf("Error removing reverted dates: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to restore version"})
+			return
+		}
+	}
+
+	// Restored dates keep their ID, so later versions still recognize them
+	for _, d := range diff.DatesAdded {
+		_, err := tx.Exec(ctx, `
+			INSERT INTO date_options (id, poll_id, start_time, end_time)
+			VALUES ($1, $2, $3, $4)
+		`, d.ID, pollID, d.StartTime, d.EndTime)
+		if err != nil {
+			log.Printf("Error restoring date option %s: %v", d.ID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to restore version"})
+			return
+		}
+	}
+
+	newVersion, err := recordPollVersion(ctx, tx, pollID, userID, models.PollVersionRevert, &version)
+	if err != nil {
+		log.Printf("Error recording reverted version: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to restore version"})
+		return
+	}
+
+	entry := newAuditEntry(c, audit.ActionPollRevert, audit.TargetPoll, pollID.String())
+	entry.PollID = &pollID
+	entry.Changes = audit.Diff(pollVersionFields(current), pollVersionFields(target))
+	if entry.Changes == nil {
+		entry.Changes = map[string]audit.Change{}
+	}
+	entry.Changes["version"] = audit.Change{Old: version, New: newVersion}
+	if datesChanged {
+		entry.Changes["date_options"] = audit.Change{Old: len(current.DateOptions), New: len(target.DateOptions)}
+	}
+	if err := audit.Record(ctx, tx, entry); err != nil {
+		log.Printf("Error recording poll revert: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to restore version"})
+		return
+	}
+
+	// Recorded in the transaction, so streams only hear of a committed revert
+	dateEvents := []events.Event{}
+	for _, d := range diff.DatesRemoved {
+		dateEvents = append(dateEvents, dateOptionEvent(events.TypeDateOptionDeleted, pollID, d.ID, d.StartTime, d.EndTime))
+	}
+	for _, d := range diff.DatesAdded {
+		dateEvents = append(dateEvents, dateOptionEvent(events.TypeDateOptionCreated, pollID, d.ID, d.StartTime, d.EndTime))
+	}
+	for _, e := range dateEvents {
+		if err := publishEvent(ctx, tx, e); err != nil {
+			log.Printf("Error recording poll revert event: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to restore version"})
+			return
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to restore version"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":       "Version restored",
+		"version":       newVersion,
+		"reverted_from": version,
+		"diff":          diff,
+		"votes_removed": votesRemoved,
+	})
+}
+
+// schedulePollChangedNotifications warns the registered participants of a poll, other
+// than its creator, that its dates changed
+func schedulePollChangedNotifications(ctx context.Context, tx pgx.Tx, pollID, creatorID uuid.UUID) error {
+	var enabled string
+	err := tx.QueryRow(ctx, `SELECT value FROM notification_settings WHERE key = $1`,
+		models.SettingPollChangedEnabled).Scan(&enabled)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return err
+	}
+	if enabled == "false" {
+		return nil
+	}
+
+	_, err = tx.Exec(ctx, `
+		INSERT INTO notifications (poll_id, user_id, type, scheduled_at)
+		SELECT DISTINCT $1::uuid, user_id, $2, CURRENT_TIMESTAMP
+		FROM votes
+		WHERE poll_id = $1 AND user_id IS NOT NULL AND user_id <> $3
+	`, pollID, models.NotificationTypePollChanged, creatorID)
+	return err
+}
@@ -0,0 +1,42 @@
+package handlers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"doodle-clone/internal/audit"
+	"doodle-clone/internal/models"
+)
+
+func TestDiffPollVersions(t *testing.T) {
+	kept := models.PollVersionDateOption{ID: uuid.New(), StartTime: time.Date(2024, 6, 1, 10, 0, 0, 0, time.UTC)}
+	dropped := models.PollVersionDateOption{ID: uuid.New(), StartTime: time.Date(2024, 6, 2, 10, 0, 0, 0, time.UTC)}
+	added := models.PollVersionDateOption{ID: uuid.New(), StartTime: time.Date(2024, 6, 3, 10, 0, 0, 0, time.UTC)}
+
+	v1 := &models.PollVersion{Version: 1, Title: "Team lunch", Location: "Paris", DateOptions: []models.PollVersionDateOption{kept, dropped}}
+	v2 := &models.PollVersion{Version: 2, Title: "Team dinner", Location: "Paris", DateOptions: []models.PollVersionDateOption{kept, added}}
+
+	diff := diffPollVersions(v1, v2)
+	assert.Equal(t, 1, diff.From)
+	assert.Equal(t, 2, diff.To)
+	assert.Equal(t, map[string]interface{}{"title": audit.Change{Old: "Team lunch", New: "Team dinner"}}, diff.Changes)
+	assert.Equal(t, []models.PollVersionDateOption{added}, diff.DatesAdded)
+	assert.Equal(t, []models.PollVersionDateOption{dropped}, diff.DatesRemoved)
+
+	t.Run("First version", func(t *testing.T) {
+		diff := diffPollVersions(nil, v1)
+		assert.Equal(t, 0, diff.From)
+		assert.Contains(t, diff.Changes, "title")
+		assert.Len(t, diff.DatesAdded, 2)
+		assert.Empty(t, diff.DatesRemoved)
+	})
+
+	t.Run("Same version", func(t *testing.T) {
+		diff := diffPollVersions(v2, v2)
+		assert.Empty(t, diff.Changes)
+		assert.Empty(t, diff.DatesAdded)
+		assert.Empty(t, diff.DatesRemoved)
+	})
+}
@@ -7,29 +7,28 @@ import (
 	"log"
 	"math/big"
 	"net/http"
+	"sort"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
+	"doodle-clone/internal/audit"
 	"doodle-clone/internal/database"
+	"doodle-clone/internal/events"
 	"doodle-clone/internal/middleware"
 	"doodle-clone/internal/models"
 )
 
 type PollHandler struct {
-	db                  *pgxpool.Pool
-	notificationHandler *NotificationHandler
+	db *pgxpool.Pool
 }
 
 func NewPollHandler(db *pgxpool.Pool) *PollHandler {
 	return &PollHandler{db: db}
 }
 
-func (h *PollHandler) SetNotificationHandler(nh *NotificationHandler) {
-	h.notificationHandler = nh
-}
-
 // ListPolls returns a list of public polls
 // @Summary      Lister les sondages
 // @Description  Retourne la liste des sondages publics
@@ -54,12 +53,13 @@ func (h *PollHandler) ListPolls(c *gin.Context) {
 		SELECT p.id, p.title, p.description, p.location, p.creator_id, p.access_code, p.expires_at,
 		       p.allow_multiple, p.allow_maybe, p.anonymous, p.limit_votes, p.max_votes_per_user,
 		       p.final_date, p.created_at, p.updated_at,
-		       u.id, u.name, u.avatar,
+		       u.id, COALESCE(u.name, 'Deleted user'), u.avatar,
 		       COUNT(DISTINCT v.user_id) as participant_count
 		FROM polls p
 		LEFT JOIN users u ON p.creator_id = u.id
 		LEFT JOIN votes v ON p.id = v.poll_id
-		WHERE p.expires_at IS NULL OR p.expires_at > CURRENT_TIMESTAMP
+		WHERE (p.expires_at IS NULL OR p.expires_at > CURRENT_TIMESTAMP)
+		AND p.password_hash IS NULL -- Password-protected polls are never listed
 	`
 
 	args := []interface{}{}
@@ -148,15 +148,15 @@ func (h *PollHandler) GetPoll(c *gin.Context) {
 	err := h.db.QueryRow(ctx, `
 		SELECT p.id, p.title, p.description, p.location, p.creator_id, p.access_code, p.expires_at,
 		       p.allow_multiple, p.allow_maybe, p.anonymous, p.limit_votes, p.max_votes_per_user,
-		       p.final_date, p.created_at, p.updated_at,
-		       u.id, u.name, u.avatar, u.email
+		       p.final_date, p.password_hash IS NOT NULL, p.created_at, p.updated_at,
+		       u.id, COALESCE(u.name, 'Deleted user'), u.avatar, COALESCE(u.email, '')
 		FROM polls p
 		LEFT JOIN users u ON p.creator_id = u.id
 		WHERE p.id = $1
 	`, pollID).Scan(
 		&poll.ID, &poll.Title, &poll.Description, &poll.Location, &poll.CreatorID, &poll.AccessCode, &poll.ExpiresAt,
 		&poll.AllowMultiple, &poll.AllowMaybe, &poll.Anonymous, &poll.LimitVotes, &poll.MaxVotesPerUser,
-		&poll.FinalDate, &poll.CreatedAt, &poll.UpdatedAt,
+		&poll.FinalDate, &poll.HasPassword, &poll.CreatedAt, &poll.UpdatedAt,
 		&creator.ID, &creator.Name, &creatorAvatar, &creator.Email,
 	)
 
@@ -165,15 +165,15 @@ func (h *PollHandler) GetPoll(c *gin.Context) {
 		err = h.db.QueryRow(ctx, `
 			SELECT p.id, p.title, p.description, p.location, p.creator_id, p.access_code, p.expires_at,
 			       p.allow_multiple, p.allow_maybe, p.anonymous, p.limit_votes, p.max_votes_per_user,
-			       p.final_date, p.created_at, p.updated_at,
-			       u.id, u.name, u.avatar, u.email
+			       p.final_date, p.password_hash IS NOT NULL, p.created_at, p.updated_at,
+			       u.id, COALESCE(u.name, 'Deleted user'), u.avatar, COALESCE(u.email, '')
 			FROM polls p
 			LEFT JOIN users u ON p.creator_id = u.id
 			WHERE p.access_code = $1
 		`, pollID).Scan(
 			&poll.ID, &poll.Title, &poll.Description, &poll.Location, &poll.CreatorID, &poll.AccessCode, &poll.ExpiresAt,
 			&poll.AllowMultiple, &poll.AllowMaybe, &poll.Anonymous, &poll.LimitVotes, &poll.MaxVotesPerUser,
-			&poll.FinalDate, &poll.CreatedAt, &poll.UpdatedAt,
+			&poll.FinalDate, &poll.HasPassword, &poll.CreatedAt, &poll.UpdatedAt,
 			&creator.ID, &creator.Name, &creatorAvatar, &creator.Email,
 		)
 	}
@@ -262,14 +262,32 @@ func (h *PollHandler) CreatePoll(c *gin.Context) {
 		accessCode = generateAccessCode()
 	}
 
+	// Hash the optional poll password
+	var passwordHash *string
+	if req.Password != "" {
+		hash, err := hashPollPassword(req.Password)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash password"})
+			return
+		}
+		passwordHash = &hash
+	}
+
+	tx, err := h.db.Begin(ctx)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create poll"})
+		return
+	}
+	defer tx.Rollback(ctx)
+
 	// Create poll
 	pollID := uuid.New()
-	_, err := h.db.Exec(ctx, `
+	_, err = tx.Exec(ctx, `
 		INSERT INTO polls (id, title, description, location, creator_id, access_code, expires_at,
-		                  allow_multiple, allow_maybe, anonymous, limit_votes, max_votes_per_user)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+		                  allow_multiple, allow_maybe, anonymous, limit_votes, max_votes_per_user, password_hash)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
 	`, pollID, req.Title, req.Description, req.Location, *userID, accessCode, req.ExpiresAt,
-		req.AllowMultiple, req.AllowMaybe, req.Anonymous, req.LimitVotes, req.MaxVotesPerUser)
+		req.AllowMultiple, req.AllowMaybe, req.Anonymous, req.LimitVotes, req.MaxVotesPerUser, passwordHash)
 
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create poll"})
@@ -279,7 +297,7 @@ func (h *PollHandler) CreatePoll(c *gin.Context) {
 	// Create date options
 	for _, date := range req.Dates {
 		dateOptionID := uuid.New()
-		_, err = h.db.Exec(ctx, `
+		_, err = tx.Exec(ctx, `
 			INSERT INTO date_options (id, poll_id, start_time, end_time)
 			VALUES ($1, $2, $3, $4)
 		`, dateOptionID, pollID, date.StartTime, date.EndTime)
@@ -289,22 +307,44 @@ func (h *PollHandler) CreatePoll(c *gin.Context) {
 		}
 	}
 
+	if err := publishEvent(ctx, tx, events.Event{PollID: pollID, Type: events.TypePollCreated}); err != nil {
+		log.Printf("Failed to record creation of poll %s: %v", pollID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create poll"})
+		return
+	}
+
+	if _, err := recordPollVersion(ctx, tx, pollID, userID, models.PollVersionCreate, nil); err != nil {
+		log.Printf("Failed to record version of poll %s: %v", pollID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create poll"})
+		return
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create poll"})
+		return
+	}
+
 	// Get created poll
 	var poll models.Poll
 	err = h.db.QueryRow(ctx, `
 		SELECT id, title, description, location, creator_id, access_code, expires_at,
 		       allow_multiple, allow_maybe, anonymous, limit_votes, max_votes_per_user,
-		       final_date, created_at, updated_at
+		       final_date, password_hash IS NOT NULL, created_at, updated_at
 		FROM polls WHERE id = $1
 	`, pollID).Scan(&poll.ID, &poll.Title, &poll.Description, &poll.Location, &poll.CreatorID, &poll.AccessCode, &poll.ExpiresAt,
 		&poll.AllowMultiple, &poll.AllowMaybe, &poll.Anonymous, &poll.LimitVotes, &poll.MaxVotesPerUser,
-		&poll.FinalDate, &poll.CreatedAt, &poll.UpdatedAt)
+		&poll.FinalDate, &poll.HasPassword, &poll.CreatedAt, &poll.UpdatedAt)
 
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve created poll"})
 		return
 	}
 
+	entry := newAuditEntry(c, audit.ActionPollCreate, audit.TargetPoll, pollID.String())
+	entry.PollID = &pollID
+	entry.Changes = audit.Diff(nil, newPollSnapshot(poll))
+	recordAudit(ctx, h.db, entry)
+
 	c.JSON(http.StatusCreated, poll)
 }
 
@@ -374,6 +414,12 @@ func (h *PollHandler) UpdatePoll(c *gin.Context) {
 		return
 	}
 
+	before, err := loadPollSnapshot(ctx, h.db, pollID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
 	// Build dynamic update query
 	updates := []string{}
 	args := []interface{}{}
@@ -399,6 +445,25 @@ func (h *PollHandler) UpdatePoll(c *gin.Context) {
 		args = append(args, *req.ExpiresAt)
 		argCount++
 	}
+	if req.Password != nil {
+		// An empty password removes the protection; a new one revokes issued access tokens
+		var passwordHash *string
+		if *req.Password != "" {
+			if len(*req.Password) < minPollPasswordLength {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Password must be at least 8 characters"})
+				return
+			}
+			hash, err := hashPollPassword(*req.Password)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash password"})
+				return
+			}
+			passwordHash = &hash
+		}
+		updates = append(updates, "password_hash = $"+string(rune('0'+argCount)))
+		args = append(args, passwordHash)
+		argCount++
+	}
 
 	if len(updates) == 0 {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "No fields to update"})
@@ -414,11 +479,68 @@ func (h *PollHandler) UpdatePoll(c *gin.Context) {
 	}
 	query += " WHERE id = $" + string(rune('0'+argCount))
 
-	_, err = h.db.Exec(ctx, query, args...)
+	tx, err := h.db.Begin(ctx)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update poll"})
 		return
 	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, query, args...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update poll"})
+		return
+	}
+
+	after, err := loadPollSnapshot(ctx, tx, pollID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update poll"})
+		return
+	}
+	entry := newAuditEntry(c, audit.ActionPollUpdate, audit.TargetPoll, pollID)
+	entry.PollID = before.id
+	entry.Changes = audit.Diff(before, after)
+	if err := audit.Record(ctx, tx, entry); err != nil {
+		log.Printf("Error recording poll update: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update poll"})
+		return
+	}
+
+	// Subscribers are told which fields changed, and reload the poll
+	if len(entry.Changes) > 0 {
+		fields := make([]string, 0, len(entry.Changes))
+		for field := range entry.Changes {
+			fields = append(fields, field)
+		}
+		sort.Strings(fields)
+		err = publishEvent(ctx, tx, events.Event{
+			PollID: *before.id,
+			Type:   events.TypePollUpdated,
+			Data:   map[string]interface{}{"fields": fields},
+		})
+		if err != nil {
+			log.Printf("Failed to record update of poll %s: %v", pollID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update poll"})
+			return
+		}
+	}
+
+	// Password and voting rules are not versioned
+	for _, field := range versionedPollFields {
+		if _, ok := entry.Changes[field]; ok {
+			if _, err := recordPollVersion(ctx, tx, *before.id, userID, models.PollVersionUpdate, nil); err != nil {
+				log.Printf("Failed to record version of poll %s: %v", pollID, err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update poll"})
+				return
+			}
+			break
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update poll"})
+		return
+	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "Poll updated successfully"})
 }
@@ -471,12 +593,58 @@ func (h *PollHandler) DeletePoll(c *gin.Context) {
 		return
 	}
 
-	// Delete poll (cascade will delete related records)
-	_, err = h.db.Exec(ctx, "DELETE FROM polls WHERE id = $1", pollID)
+	before, err := loadPollSnapshot(ctx, h.db, pollID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	tx, err := h.db.Begin(ctx)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete poll"})
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	// Delete poll (cascade will delete related records), and the event from the calendars
+	// of the participants who were invited
+	_, err = tx.Exec(ctx, "DELETE FROM polls WHERE id = $1", pollID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete poll"})
 		return
 	}
+	if err := cancelInvitations(ctx, tx, *before.id); err != nil {
+		log.Printf("Error cancelling invitations of poll %s: %v", pollID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete poll"})
+		return
+	}
+
+	entry := newAuditEntry(c, audit.ActionPollDelete, audit.TargetPoll, pollID)
+	entry.PollID = before.id
+	entry.Changes = audit.Diff(before, nil)
+	if err := audit.Record(ctx, tx, entry); err != nil {
+		log.Printf("Error recording poll deletion: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete poll"})
+		return
+	}
+
+	// The poll is gone when the event is relayed: it carries its creator, whose webhooks
+	// on all their polls receive it
+	err = publishEvent(ctx, tx, events.Event{
+		PollID: *before.id,
+		Type:   events.TypePollDeleted,
+		Data:   map[string]interface{}{"title": before.Title, "creator_id": creatorID.String()},
+	})
+	if err != nil {
+		log.Printf("Failed to record deletion of poll %s: %v", pollID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete poll"})
+		return
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete poll"})
+		return
+	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "Poll deleted successfully"})
 }
@@ -547,17 +715,52 @@ func (h *PollHandler) SetFinalDate(c *gin.Context) {
 		return
 	}
 
-	// Set final date
-	_, err = h.db.Exec(ctx, "UPDATE polls SET final_date = $1 WHERE id = $2", req.DateOptionID, pollID)
+	tx, err := h.db.Begin(ctx)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to set final date"})
 		return
 	}
+	defer tx.Rollback(ctx)
+
+	// Set final date. Rescheduling bumps the SEQUENCE of the calendar event.
+	var previous *uuid.UUID
+	err = tx.QueryRow(ctx, `
+		UPDATE polls p SET final_date = $1,
+			ics_sequence = p.ics_sequence + CASE WHEN old.final_date IS NOT NULL AND old.final_date <> $1 THEN 1 ELSE 0 END
+		FROM (SELECT id, final_date FROM polls WHERE id = $2) old
+		WHERE p.id = old.id
+		RETURNING old.final_date
+	`, req.DateOptionID, pollID).Scan(&previous)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to set final date"})
+		return
+	}
+
+	pollUUID, _ := uuid.Parse(pollID)
+	entry := newAuditEntry(c, audit.ActionPollFinalDate, audit.TargetPoll, pollID)
+	entry.PollID = &pollUUID
+	entry.Changes = map[string]audit.Change{"final_date": {Old: previous, New: req.DateOptionID}}
+	if err := audit.Record(ctx, tx, entry); err != nil {
+		log.Printf("Error recording final date: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to set final date"})
+		return
+	}
+
+	// The relay schedules the reminders and the chat announcement
+	err = publishEvent(ctx, tx, events.Event{
+		PollID: pollUUID,
+		Type:   events.TypePollFinalized,
+		Data:   map[string]interface{}{"date_option_id": req.DateOptionID},
+	})
+	if err != nil {
+		log.Printf("Failed to record final date event: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to set final date"})
+		return
+	}
 
-	// Schedule reminder notifications
-	if h.notificationHandler != nil {
-		pollUUID, _ := uuid.Parse(pollID)
-		go h.notificationHandler.ScheduleReminderForPoll(pollUUID)
+	if err := tx.Commit(ctx); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to set final date"})
+		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "Final date set successfully"})
@@ -586,13 +789,13 @@ func (h *PollHandler) GetUserPolls(c *gin.Context) {
 
 	rows, err := h.db.Query(ctx, `
 		SELECT p.id, p.title, p.description, p.location, p.expires_at,
-		       p.final_date, p.created_at, p.updated_at,
+		       p.final_date, p.password_hash IS NOT NULL, p.created_at, p.updated_at,
 		       COUNT(DISTINCT v.user_id) as participant_count
 		FROM polls p
 		LEFT JOIN votes v ON p.id = v.poll_id
 		WHERE p.creator_id = $1
 		GROUP BY p.id, p.title, p.description, p.location, p.expires_at,
-		         p.final_date, p.created_at, p.updated_at
+		         p.final_date, p.password_hash, p.created_at, p.updated_at
 		ORDER BY p.created_at DESC
 	`, *userID)
 
@@ -609,7 +812,7 @@ func (h *PollHandler) GetUserPolls(c *gin.Context) {
 
 		err := rows.Scan(
 			&poll.ID, &poll.Title, &poll.Description, &poll.Location, &poll.ExpiresAt,
-			&poll.FinalDate, &poll.CreatedAt, &poll.UpdatedAt,
+			&poll.FinalDate, &poll.HasPassword, &poll.CreatedAt, &poll.UpdatedAt,
 			&participantCount,
 		)
 		if err != nil {
@@ -675,27 +878,54 @@ func (h *PollHandler) AddDateOption(c *gin.Context) {
 		return
 	}
 
+	tx, err := h.db.Begin(ctx)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create date option"})
+		return
+	}
+	defer tx.Rollback(ctx)
+
 	// Create date option
-	dateOptionID := uuid.New()
-	_, err = h.db.Exec(ctx, `
+	var dateOption models.DateOption
+	err = tx.QueryRow(ctx, `
 		INSERT INTO date_options (id, poll_id, start_time, end_time)
 		VALUES ($1, $2, $3, $4)
-	`, dateOptionID, pollID, req.StartTime, req.EndTime)
+		RETURNING id, poll_id, start_time, end_time, created_at
+	`, uuid.New(), pollID, req.StartTime, req.EndTime).Scan(&dateOption.ID, &dateOption.PollID, &dateOption.StartTime, &dateOption.EndTime, &dateOption.CreatedAt)
 
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create date option"})
 		return
 	}
 
-	// Get created date option
-	var dateOption models.DateOption
-	err = h.db.QueryRow(ctx, `
-		SELECT id, poll_id, start_time, end_time, created_at
-		FROM date_options WHERE id = $1
-	`, dateOptionID).Scan(&dateOption.ID, &dateOption.PollID, &dateOption.StartTime, &dateOption.EndTime, &dateOption.CreatedAt)
-
+	err = publishEvent(ctx, tx, dateOptionEvent(events.TypeDateOptionCreated, dateOption.PollID, dateOption.ID, dateOption.StartTime, dateOption.EndTime))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve created date option"})
+		log.Printf("Failed to record date option event: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create date option"})
+		return
+	}
+
+	if _, err := recordPollVersion(ctx, tx, dateOption.PollID, userID, models.PollVersionDateAdd, nil); err != nil {
+		log.Printf("Failed to record version of poll %s: %v", pollID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create date option"})
+		return
+	}
+
+	entry := newAuditEntry(c, audit.ActionPollDateAdd, audit.TargetPoll, pollID)
+	entry.PollID = &dateOption.PollID
+	entry.Changes = audit.Diff(nil, map[string]interface{}{
+		"date_option_id": dateOption.ID,
+		"start_time":     dateOption.StartTime,
+		"end_time":       dateOption.EndTime,
+	})
+	if err := audit.Record(ctx, tx, entry); err != nil {
+		log.Printf("Error recording date option: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create date option"})
+		return
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create date option"})
 		return
 	}
 
@@ -704,6 +934,53 @@ func (h *PollHandler) AddDateOption(c *gin.Context) {
 
 // Helper functions
 
+// pollSnapshot holds the fields of a poll tracked in the audit log
+type pollSnapshot struct {
+	id              *uuid.UUID
+	Title           string     `json:"title"`
+	Description     string     `json:"description"`
+	Location        string     `json:"location"`
+	ExpiresAt       *time.Time `json:"expires_at"`
+	AllowMultiple   bool       `json:"allow_multiple"`
+	AllowMaybe      bool       `json:"allow_maybe"`
+	Anonymous       bool       `json:"anonymous"`
+	LimitVotes      bool       `json:"limit_votes"`
+	MaxVotesPerUser int        `json:"max_votes_per_user"`
+	HasPassword     bool       `json:"has_password"`
+}
+
+func newPollSnapshot(poll models.Poll) pollSnapshot {
+	return pollSnapshot{
+		id:              &poll.ID,
+		Title:           poll.Title,
+		Description:     poll.Description,
+		Location:        poll.Location,
+		ExpiresAt:       poll.ExpiresAt,
+		AllowMultiple:   poll.AllowMultiple,
+		AllowMaybe:      poll.AllowMaybe,
+		Anonymous:       poll.Anonymous,
+		LimitVotes:      poll.LimitVotes,
+		MaxVotesPerUser: poll.MaxVotesPerUser,
+		HasPassword:     poll.HasPassword,
+	}
+}
+
+// loadPollSnapshot reads the audited fields of a poll
+func loadPollSnapshot(ctx context.Context, db querier, pollID string) (*pollSnapshot, error) {
+	var poll models.Poll
+	err := db.QueryRow(ctx, `
+		SELECT id, title, COALESCE(description, ''), COALESCE(location, ''), expires_at,
+		       allow_multiple, allow_maybe, anonymous, limit_votes, max_votes_per_user, password_hash IS NOT NULL
+		FROM polls WHERE id = $1
+	`, pollID).Scan(&poll.ID, &poll.Title, &poll.Description, &poll.Location, &poll.ExpiresAt,
+		&poll.AllowMultiple, &poll.AllowMaybe, &poll.Anonymous, &poll.LimitVotes, &poll.MaxVotesPerUser, &poll.HasPassword)
+	if err != nil {
+		return nil, err
+	}
+	snapshot := newPollSnapshot(poll)
+	return &snapshot, nil
+}
+
 func (h *PollHandler) getDateOptionsWithStats(ctx context.Context, pollID uuid.UUID) ([]models.DateOptionWithStats, error) {
 	log.Printf("Fetching date options for poll: %s", pollID)
 	rows, err := h.db.Query(ctx, `
@@ -747,9 +1024,9 @@ func (h *PollHandler) getDateOptionsWithStats(ctx context.Context, pollID uuid.U
 func (h *PollHandler) getComments(ctx context.Context, pollID uuid.UUID) ([]models.CommentWithUser, error) {
 	rows, err := h.db.Query(ctx, `
 		SELECT c.id, c.poll_id, c.user_id, c.content, c.created_at,
-		       u.id, u.name, u.avatar
+		       u.id, COALESCE(u.name, 'Deleted user'), COALESCE(u.avatar, '')
 		FROM comments c
-		JOIN users u ON c.user_id = u.id
+		LEFT JOIN users u ON c.user_id = u.id
 		WHERE c.poll_id = $1
 		ORDER BY c.created_at DESC
 	`, pollID)
@@ -0,0 +1,280 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"doodle-clone/internal/config"
+	"doodle-clone/internal/database"
+	"doodle-clone/internal/middleware"
+)
+
+var (
+	errInvalidRefreshToken = errors.New("invalid refresh token")
+	errRefreshTokenExpired = errors.New("refresh token expired")
+	errRefreshTokenReused  = errors.New("refresh token reuse detected, please log in again")
+)
+
+// execer is implemented by both *pgxpool.Pool and pgx.Tx
+type execer interface {
+	Exec(ctx context.Context, sql string, arguments ...any) (pgconn.CommandTag, error)
+}
+
+// randomToken returns a URL-safe random string built from n random bytes
+func randomToken(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// sessionInfo describes the client holding a refresh token family
+type sessionInfo struct {
+	StartedAt time.Time
+	UserAgent string
+	IPAddress string
+}
+
+// newSessionInfo captures the client of the current request
+func newSessionInfo(c *gin.Context) sessionInfo {
+	userAgent := c.Request.UserAgent()
+	if len(userAgent) > 500 {
+		userAgent = userAgent[:500]
+	}
+	return sessionInfo{
+		StartedAt: time.Now(),
+		UserAgent: userAgent,
+		IPAddress: c.ClientIP(),
+	}
+}
+
+// generateRefreshToken creates a refresh token starting a new token family (session).
+// It returns the token and the session ID, which is the family ID.
+func (h *AuthHandler) generateRefreshToken(c *gin.Context, userID uuid.UUID) (string, uuid.UUID, error) {
+	ctx, cancel := database.GetContext()
+	defer cancel()
+
+	sessionID := uuid.New()
+	token, _, err := insertRefreshToken(ctx, h.db, userID, sessionID, newSessionInfo(c))
+	return token, sessionID, err
+}
+
+// insertRefreshToken stores the hash of a new refresh token in the given family
+func insertRefreshToken(ctx context.Context, db execer, userID, familyID uuid.UUID, session sessionInfo) (string, uuid.UUID, error) {
+	token, err := randomToken(32)
+	if err != nil {
+		return "", uuid.Nil, err
+	}
+
+	tokenID := uuid.New()
+	_, err = db.Exec(ctx, `
+		INSERT INTO refresh_tokens (id, user_id, token_hash, family_id, session_started_at, user_agent, ip_address, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	`, tokenID, userID, middleware.HashToken(token), familyID, session.StartedAt, session.UserAgent, session.IPAddress,
+		time.Now().Add(config.AppConfig.RefreshExpiry))
+	if err != nil {
+		return "", uuid.Nil, err
+	}
+
+	return token, tokenID, nil
+}
+
+// rotateRefreshToken consumes a refresh token and issues its successor in the same family.
+// Presenting a token that was already rotated revokes the whole family.
+// It returns the user ID, the session ID and the new token.
+func (h *AuthHandler) rotateRefreshToken(c *gin.Context, token string) (uuid.UUID, uuid.UUID, string, error) {
+	ctx, cancel := database.GetContext()
+	defer cancel()
+
+	tx, err := h.db.Begin(ctx)
+	if err != nil {
+		return uuid.Nil, uuid.Nil, "", err
+	}
+	defer tx.Rollback(ctx)
+
+	var tokenID, userID, familyID uuid.UUID
+	var replacedBy *uuid.UUID
+	var revokedAt *time.Time
+	var expiresAt, startedAt time.Time
+	err = tx.QueryRow(ctx, `
+		SELECT id, user_id, family_id, replaced_by, revoked_at, expires_at, session_started_at
+		FROM refresh_tokens
+		WHERE token_hash = $1
+		FOR UPDATE
+	`, middleware.HashToken(token)).Scan(&tokenID, &userID, &familyID, &replacedBy, &revokedAt, &expiresAt, &startedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return uuid.Nil, uuid.Nil, "", errInvalidRefreshToken
+		}
+		return uuid.Nil, uuid.Nil, "", err
+	}
+
+	if revokedAt != nil {
+		if replacedBy == nil {
+			return uuid.Nil, uuid.Nil, "", errInvalidRefreshToken
+		}
+		// The token was already exchanged: someone is replaying it
+		log.Printf("Refresh token reuse detected for user %s, revoking family %s", userID, familyID)
+		if _, err := tx.Exec(ctx, `
+			UPDATE refresh_tokens SET revoked_at = CURRENT_TIMESTAMP
+			WHERE family_id = $1 AND revoked_at IS NULL
+		`, familyID); err != nil {
+			return uuid.Nil, uuid.Nil, "", err
+		}
+		if err := tx.Commit(ctx); err != nil {
+			return uuid.Nil, uuid.Nil, "", err
+		}
+		return uuid.Nil, uuid.Nil, "", errRefreshTokenReused
+	}
+
+	if time.Now().After(expiresAt) {
+		if _, err := tx.Exec(ctx, `UPDATE refresh_tokens SET revoked_at = CURRENT_TIMESTAMP WHERE id = $1`, tokenID); err != nil {
+			return uuid.Nil, uuid.Nil, "", err
+		}
+		if err := tx.Commit(ctx); err != nil {
+			return uuid.Nil, uuid.Nil, "", err
+		}
+		return uuid.Nil, uuid.Nil, "", errRefreshTokenExpired
+	}
+
+	// The successor keeps the session start but records the latest client
+	session := newSessionInfo(c)
+	session.StartedAt = startedAt
+	newToken, newID, err := insertRefreshToken(ctx, tx, userID, familyID, session)
+	if err != nil {
+		return uuid.Nil, uuid.Nil, "", err
+	}
+
+	_, err = tx.Exec(ctx, `
+		UPDATE refresh_tokens SET revoked_at = CURRENT_TIMESTAMP, replaced_by = $1
+		WHERE id = $2
+	`, newID, tokenID)
+	if err != nil {
+		return uuid.Nil, uuid.Nil, "", err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return uuid.Nil, uuid.Nil, "", err
+	}
+
+	return userID, familyID, newToken, nil
+}
+
+// revokeRefreshTokenFamily revokes every token descending from the same login as token.
+// It returns the owner and the session ID if a session was still active.
+func (h *AuthHandler) revokeRefreshTokenFamily(token string) (uuid.UUID, uuid.UUID, bool) {
+	ctx, cancel := database.GetContext()
+	defer cancel()
+
+	var userID, familyID uuid.UUID
+	err := h.db.QueryRow(ctx, `
+		WITH revoked AS (
+			UPDATE refresh_tokens SET revoked_at = CURRENT_TIMESTAMP
+			WHERE revoked_at IS NULL
+			AND family_id = (SELECT family_id FROM refresh_tokens WHERE token_hash = $1)
+			RETURNING user_id, family_id
+		)
+		SELECT user_id, family_id FROM revoked LIMIT 1
+	`, middleware.HashToken(token)).Scan(&userID, &familyID)
+	if err != nil {
+		if !errors.Is(err, pgx.ErrNoRows) {
+			log.Printf("Failed to revoke refresh token family: %v", err)
+		}
+		return uuid.Nil, uuid.Nil, false
+	}
+	return userID, familyID, true
+}
+
+// revokeSessions revokes the refresh token families of a user, except keep if set.
+// It returns the number of sessions revoked.
+func revokeSessions(ctx context.Context, db execer, userID uuid.UUID, keep uuid.UUID) (int64, error) {
+	tag, err := db.Exec(ctx, `
+		UPDATE refresh_tokens SET revoked_at = CURRENT_TIMESTAMP
+		WHERE user_id = $1 AND family_id != $2 AND revoked_at IS NULL
+	`, userID, keep)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
+
+// setRefreshCookie stores the refresh token in an httpOnly cookie
+func setRefreshCookie(c *gin.Context, token string) {
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(
+		"refresh_token",
+		token,
+		int(config.AppConfig.RefreshExpiry.Seconds()),
+		"/",
+		"",
+		config.IsProduction(),
+		true, // httpOnly
+	)
+}
+
+// clearRefreshCookie removes the refresh token cookie
+func clearRefreshCookie(c *gin.Context) {
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie("refresh_token", "", -1, "/", "", config.IsProduction(), true)
+}
+
+// StartTokenCleanup starts a background worker purging expired refresh tokens
+// and login attempts past their audit retention
+func (h *AuthHandler) StartTokenCleanup() {
+	interval := config.AppConfig.TokenCleanupInterval
+	if interval <= 0 {
+		interval = time.Hour
+	}
+	h.ticker = time.NewTicker(interval)
+	log.Println("Refresh token cleanup worker started")
+
+	go func() {
+		h.purgeExpiredRefreshTokens()
+		h.purgeLoginAttempts()
+	}()
+
+	go func() {
+		for {
+			select {
+			case <-h.ticker.C:
+				h.purgeExpiredRefreshTokens()
+				h.purgeLoginAttempts()
+			case <-h.stopCh:
+				h.ticker.Stop()
+				log.Println("Refresh token cleanup worker stopped")
+				return
+			}
+		}
+	}()
+}
+
+// StopTokenCleanup stops the refresh token cleanup worker
+func (h *AuthHandler) StopTokenCleanup() {
+	close(h.stopCh)
+}
+
+// purgeExpiredRefreshTokens deletes refresh tokens past their expiry.
+// Revoked tokens are kept until then so that reuse can still be detected.
+func (h *AuthHandler) purgeExpiredRefreshTokens() {
+	ctx, cancel := database.GetContext(30 * time.Second)
+	defer cancel()
+
+	tag, err := h.db.Exec(ctx, `DELETE FROM refresh_tokens WHERE expires_at < CURRENT_TIMESTAMP`)
+	if err != nil {
+		log.Printf("Error purging expired refresh tokens: %v", err)
+		return
+	}
+	if tag.RowsAffected() > 0 {
+		log.Printf("Purged %d expired refresh tokens", tag.RowsAffected())
+	}
+}
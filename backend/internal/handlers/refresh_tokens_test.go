@@ -0,0 +1,131 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"doodle-clone/internal/config"
+	"doodle-clone/internal/middleware"
+	"doodle-clone/internal/models"
+)
+
+func TestAuthHandler_RefreshTokenRotation(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	config.AppConfig.RefreshExpiry = time.Hour
+	handler := NewAuthHandler(db)
+
+	router := setupTestContext()
+	router.POST("/refresh", handler.Refresh)
+	router.POST("/logout", handler.Logout)
+
+	user := createTestUserWithEmail(t, db, "refresh-"+uuid.NewString()+"@example.com")
+	defer cleanupTestData(t, db, user.ID, uuid.Nil)
+	ctx := context.Background()
+
+	login := func() (string, uuid.UUID) {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest("POST", "/login", nil)
+		token, sessionID, err := handler.generateRefreshToken(c, user.ID)
+		require.NoError(t, err)
+		return token, sessionID
+	}
+	send := func(path, token string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("POST", path, nil)
+		req.AddCookie(&http.Cookie{Name: "refresh_token", Value: token})
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+	activeTokens := func(sessionID uuid.UUID) int {
+		var n int
+		err := db.QueryRow(ctx, `
+			SELECT COUNT(*) FROM refresh_tokens WHERE family_id = $1 AND revoked_at IS NULL
+		`, sessionID).Scan(&n)
+		require.NoError(t, err)
+		return n
+	}
+
+	t.Run("Only hashes are stored", func(t *testing.T) {
+		token, _ := login()
+		var stored string
+		err := db.QueryRow(ctx, `SELECT token_hash FROM refresh_tokens WHERE token_hash = $1`,
+			middleware.HashToken(token)).Scan(&stored)
+		require.NoError(t, err)
+		assert.NotEqual(t, token, stored)
+
+		var plaintext int
+		err = db.QueryRow(ctx, `SELECT COUNT(*) FROM refresh_tokens WHERE token_hash = $1`, token).Scan(&plaintext)
+		require.NoError(t, err)
+		assert.Zero(t, plaintext)
+	})
+
+	t.Run("Rotation", func(t *testing.T) {
+		token, sessionID := login()
+
+		w := send("/refresh", token)
+		require.Equal(t, http.StatusOK, w.Code)
+		var response models.AuthResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		assert.NotEmpty(t, response.Token)
+		assert.NotEqual(t, token, response.RefreshToken)
+		assert.Equal(t, 1, activeTokens(sessionID), "the successor replaces the token")
+
+		// The successor can be exchanged in turn
+		w = send("/refresh", response.RefreshToken)
+		assert.Equal(t, http.StatusOK, w.Code)
+	})
+
+	t.Run("Replaying a rotated token revokes the family", func(t *testing.T) {
+		token, sessionID := login()
+
+		w := send("/refresh", token)
+		require.Equal(t, http.StatusOK, w.Code)
+		var response models.AuthResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+
+		w = send("/refresh", token)
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		assert.Contains(t, w.Body.String(), "reuse")
+		assert.Zero(t, activeTokens(sessionID))
+
+		// The legitimate successor is revoked too
+		w = send("/refresh", response.RefreshToken)
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+
+	t.Run("Other sessions are untouched", func(t *testing.T) {
+		other, otherSession := login()
+		token, _ := login()
+		send("/refresh", token)
+		send("/refresh", token)
+
+		assert.Equal(t, 1, activeTokens(otherSession))
+		w := send("/refresh", other)
+		assert.Equal(t, http.StatusOK, w.Code)
+	})
+
+	t.Run("Logout revokes the family", func(t *testing.T) {
+		token, sessionID := login()
+
+		w := send("/logout", token)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Zero(t, activeTokens(sessionID))
+
+		w = send("/refresh", token)
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+
+	t.Run("Unknown token", func(t *testing.T) {
+		w := send("/refresh", "not-a-token")
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+}
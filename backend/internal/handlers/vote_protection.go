@@ -0,0 +1,629 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"doodle-clone/internal/antispam"
+	"doodle-clone/internal/audit"
+	"doodle-clone/internal/config"
+	"doodle-clone/internal/database"
+	"doodle-clone/internal/events"
+	"doodle-clone/internal/middleware"
+	"doodle-clone/internal/models"
+)
+
+const (
+	deviceCookie    = "doodle_device"
+	deviceCookieAge = 365 * 24 * 60 * 60
+	powChallengeTTL = 10 * time.Minute
+)
+
+// anonymousBallot holds what is stored with the votes of an anonymous ballot
+type anonymousBallot struct {
+	ID              uuid.UUID
+	DeviceHash      string
+	FingerprintHash *string
+	PowNonce        *string
+}
+
+// resolvePollID returns the UUID of a poll from its UUID or access code
+func (h *VoteHandler) resolvePollID(ctx context.Context, idOrCode string) (uuid.UUID, error) {
+	var pollID uuid.UUID
+	err := h.db.QueryRow(ctx, `SELECT id FROM polls WHERE id::text = $1 OR access_code = $1`, idOrCode).Scan(&pollID)
+	return pollID, err
+}
+
+// getPollProtection returns the protections of a poll, or the defaults if none were set
+func (h *VoteHandler) getPollProtection(ctx context.Context, pollID uuid.UUID) (models.PollProtection, error) {
+	p := models.PollProtection{PollID: pollID, PowDifficulty: antispam.DefaultDifficulty, NameBlocklist: []string{}}
+	err := h.db.QueryRow(ctx, `
+		SELECT require_pow, pow_difficulty, one_ballot_per_device, block_duplicate_names, name_blocklist, updated_at
+		FROM poll_protections WHERE poll_id = $1
+	`, pollID).Scan(&p.RequirePow, &p.PowDifficulty, &p.OneBallotPerDevice, &p.BlockDuplicateNames, &p.NameBlocklist, &p.UpdatedAt)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return p, err
+	}
+	return p, nil
+}
+
+// requirePollCreator answers 403 or 404 unless the current user created the poll
+func (h *VoteHandler) requirePollCreator(c *gin.Context, ctx context.Context, pollID uuid.UUID) bool {
+	return requirePollCreator(c, ctx, h.db, pollID, "Only the creator can moderate this poll")
+}
+
+// requirePollCreator is shared by the handlers reserved to the organizer of a poll;
+// forbidden is the message sent to other users
+func requirePollCreator(c *gin.Context, ctx context.Context, db *pgxpool.Pool, pollID uuid.UUID, forbidden string) bool {
+	userID := middleware.GetCurrentUser(c)
+	if userID == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Not authenticated"})
+		return false
+	}
+
+	var creatorID *uuid.UUID
+	err := db.QueryRow(ctx, "SELECT creator_id FROM polls WHERE id = $1", pollID).Scan(&creatorID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Poll not found"})
+			return false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return false
+	}
+	if creatorID == nil || *creatorID != *userID {
+		c.JSON(http.StatusForbidden, gin.H{"error": forbidden})
+		return false
+	}
+	return true
+}
+
+// deviceID returns the device cookie of the voter, setting a new one if missing
+func deviceID(c *gin.Context) string {
+	if id, err := c.Cookie(deviceCookie); err == nil && id != "" {
+		return id
+	}
+	id, err := antispam.NewDeviceID()
+	if err != nil {
+		return ""
+	}
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(deviceCookie, id, deviceCookieAge, "/", "", config.IsProduction(), true)
+	return id
+}
+
+// checkAnonymousBallot applies the protections of a poll to an anonymous ballot.
+// On rejection it answers the request and returns false.
+func (h *VoteHandler) checkAnonymousBallot(c *gin.Context, ctx context.Context, pollID uuid.UUID, req *models.CreateVoteRequest, userName string) (*anonymousBallot, bool) {
+	protection, err := h.getPollProtection(ctx, pollID)
+	if err != nil {
+		log.Printf("Error fetching poll protection: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check vote"})
+		return nil, false
+	}
+
+	secret := antispam.Secret()
+	ballot := &anonymousBallot{
+		ID:         uuid.New(),
+		DeviceHash: antispam.HashDevice(secret, deviceID(c)),
+	}
+	if req.Fingerprint != "" {
+		hash := antispam.HashDevice(secret, req.Fingerprint)
+		ballot.FingerprintHash = &hash
+	}
+
+	if protection.RequirePow {
+		if req.PowChallenge == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "This poll requires a proof-of-work challenge"})
+			return nil, false
+		}
+		nonce, err := antispam.Verify(secret, pollID, req.PowChallenge, req.PowSolution, time.Now())
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return nil, false
+		}
+
+		var used bool
+		err = h.db.QueryRow(ctx, `SELECT EXISTS(SELECT 1 FROM votes WHERE pow_nonce = $1)`, nonce).Scan(&used)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check vote"})
+			return nil, false
+		}
+		if used {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "This proof-of-work challenge was already used"})
+			return nil, false
+		}
+		ballot.PowNonce = &nonce
+	}
+
+	if _, blocked := antispam.BlockedName(userName, protection.NameBlocklist); blocked {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "This name is not allowed on this poll"})
+		return nil, false
+	}
+
+	if protection.OneBallotPerDevice {
+		var exists bool
+		err := h.db.QueryRow(ctx, `
+			SELECT EXISTS(
+				SELECT 1 FROM votes
+				WHERE poll_id = $1 AND (device_hash = $2 OR ($3::text IS NOT NULL AND fingerprint_hash = $3))
+			)
+		`, pollID, ballot.DeviceHash, ballot.FingerprintHash).Scan(&exists)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check vote"})
+			return nil, false
+		}
+		if exists {
+			c.JSON(http.StatusConflict, gin.H{"error": "A vote was already submitted from this device"})
+			return nil, false
+		}
+	}
+
+	if protection.BlockDuplicateNames {
+		duplicate, err := h.nameTaken(ctx, pollID, userName)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check vote"})
+			return nil, false
+		}
+		if duplicate {
+			c.JSON(http.StatusConflict, gin.H{"error": "Someone already voted with this name"})
+			return nil, false
+		}
+	}
+
+	return ballot, true
+}
+
+// nameTaken reports whether a voter of the poll already uses a name equivalent to name
+func (h *VoteHandler) nameTaken(ctx context.Context, pollID uuid.UUID, name string) (bool, error) {
+	rows, err := h.db.Query(ctx, `SELECT DISTINCT user_name FROM votes WHERE poll_id = $1`, pollID)
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+
+	normalized := antispam.NormalizeName(name)
+	for rows.Next() {
+		var existing string
+		if err := rows.Scan(&existing); err != nil {
+			return false, err
+		}
+		if antispam.NormalizeName(existing) == normalized {
+			return true, nil
+		}
+	}
+	return false, rows.Err()
+}
+
+// GetVoteChallenge issues a proof-of-work challenge for voting on a poll
+// @Summary      Défi anti-spam
+// @Description  Délivre un défi de preuve de travail à résoudre avant un vote anonyme
+// @Tags         votes
+// @Produce      json
+// @Param        id   path      string  true  "UUID du sondage ou code d'accès"
+// @Success      200  {object}  map[string]interface{}  "challenge, difficulty, expires_at, required"
+// @Failure      404  {object}  map[string]string
+// @Failure      500  {object}  map[string]string
+// @Router       /polls/{id}/vote/challenge [get]
+func (h *VoteHandler) GetVoteChallenge(c *gin.Context) {
+	ctx, cancel := database.GetContext()
+	defer cancel()
+
+	pollID, err := h.resolvePollID(ctx, c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Poll not found"})
+		return
+	}
+
+	protection, err := h.getPollProtection(ctx, pollID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create challenge"})
+		return
+	}
+
+	challenge, err := antispam.NewChallenge(antispam.Secret(), pollID, protection.PowDifficulty, powChallengeTTL)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create challenge"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"challenge":  challenge.Token,
+		"difficulty": challenge.Difficulty,
+		"expires_at": challenge.ExpiresAt,
+		"required":   protection.RequirePow,
+	})
+}
+
+// GetPollProtection returns the anti-spam settings of a poll
+// @Summary      Protections anti-spam
+// @Description  Retourne les protections appliquées aux votes anonymes (créateur uniquement)
+// @Tags         moderation
+// @Produce      json
+// @Security     BearerAuth
+// @Param        id   path      string  true  "UUID du sondage"
+// @Success      200  {object}  models.PollProtection
+// @Failure      401  {object}  map[string]string
+// @Failure      403  {object}  map[string]string
+// @Failure      404  {object}  map[string]string
+// @Router       /polls/{id}/protection [get]
+func (h *VoteHandler) GetPollProtection(c *gin.Context) {
+	pollID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid poll ID"})
+		return
+	}
+
+	ctx, cancel := database.GetContext()
+	defer cancel()
+
+	if !h.requirePollCreator(c, ctx, pollID) {
+		return
+	}
+
+	protection, err := h.getPollProtection(ctx, pollID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch protection"})
+		return
+	}
+	c.JSON(http.StatusOK, protection)
+}
+
+// UpdatePollProtection changes the anti-spam settings of a poll
+// @Summary      Configurer les protections anti-spam
+// @Description  Active la preuve de travail, un bulletin par appareil, la liste de noms interdits ou le refus des doublons de noms
+// @Tags         moderation
+// @Accept       json
+// @Produce      json
+// @Security     BearerAuth
+// @Param        id      path      string                              true  "UUID du sondage"
+// @Param        request body      models.UpdatePollProtectionRequest  true  "Protections"
+// @Success      200  {object}  models.PollProtection
+// @Failure      400  {object}  map[string]string
+// @Failure      401  {object}  map[string]string
+// @Failure      403  {object}  map[string]string
+// @Failure      404  {object}  map[string]string
+// @Router       /polls/{id}/protection [put]
+func (h *VoteHandler) UpdatePollProtection(c *gin.Context) {
+	pollID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid poll ID"})
+		return
+	}
+
+	var req models.UpdatePollProtectionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx, cancel := database.GetContext()
+	defer cancel()
+
+	if !h.requirePollCreator(c, ctx, pollID) {
+		return
+	}
+
+	protection, err := h.getPollProtection(ctx, pollID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch protection"})
+		return
+	}
+	before := protection
+
+	if req.RequirePow != nil {
+		protection.RequirePow = *req.RequirePow
+	}
+	if req.PowDifficulty != nil {
+		if err := antispam.ValidateDifficulty(*req.PowDifficulty); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		protection.PowDifficulty = *req.PowDifficulty
+	}
+	if req.OneBallotPerDevice != nil {
+		protection.OneBallotPerDevice = *req.OneBallotPerDevice
+	}
+	if req.BlockDuplicateNames != nil {
+		protection.BlockDuplicateNames = *req.BlockDuplicateNames
+	}
+	if req.NameBlocklist != nil {
+		protection.NameBlocklist = req.NameBlocklist
+	}
+
+	err = h.db.QueryRow(ctx, `
+		INSERT INTO poll_protections (poll_id, require_pow, pow_difficulty, one_ballot_per_device, block_duplicate_names, name_blocklist)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (poll_id) DO UPDATE SET
+			require_pow = $2, pow_difficulty = $3, one_ballot_per_device = $4,
+			block_duplicate_names = $5, name_blocklist = $6, updated_at = CURRENT_TIMESTAMP
+		RETURNING updated_at
+	`, pollID, protection.RequirePow, protection.PowDifficulty, protection.OneBallotPerDevice,
+		protection.BlockDuplicateNames, protection.NameBlocklist).Scan(&protection.UpdatedAt)
+	if err != nil {
+		log.Printf("Error updating poll protection: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update protection"})
+		return
+	}
+
+	entry := newAuditEntry(c, audit.ActionPollProtectionUpdate, audit.TargetPoll, pollID.String())
+	entry.PollID = &pollID
+	entry.Changes = audit.Diff(before, protection)
+	recordAudit(ctx, h.db, entry)
+
+	c.JSON(http.StatusOK, protection)
+}
+
+// ListBallots returns the anonymous ballots of a poll with hints of abuse
+// @Summary      Modération des votes anonymes
+// @Description  Liste les bulletins anonymes avec les signaux suspects (même appareil, nom en double)
+// @Tags         moderation
+// @Produce      json
+// @Security     BearerAuth
+// @Param        id   path      string  true  "UUID du sondage"
+// @Success      200  {object}  map[string]interface{}  "ballots, count"
+// @Failure      401  {object}  map[string]string
+// @Failure      403  {object}  map[string]string
+// @Failure      404  {object}  map[string]string
+// @Router       /polls/{id}/moderation [get]
+func (h *VoteHandler) ListBallots(c *gin.Context) {
+	pollID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid poll ID"})
+		return
+	}
+
+	ctx, cancel := database.GetContext()
+	defer cancel()
+
+	if !h.requirePollCreator(c, ctx, pollID) {
+		return
+	}
+
+	// Votes cast before ballots existed form a ballot each
+	rows, err := h.db.Query(ctx, `
+		SELECT COALESCE(ballot_id, id), id, date_option_id, user_id, user_name, response, created_at,
+		       COALESCE(device_hash, ''), flagged, COALESCE(flag_reason, '')
+		FROM votes
+		WHERE poll_id = $1
+		ORDER BY created_at
+	`, pollID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch ballots"})
+		return
+	}
+	defer rows.Close()
+
+	ballots := []*models.Ballot{}
+	byID := make(map[uuid.UUID]*models.Ballot)
+	ballotDevice := make(map[uuid.UUID]string)
+	devices := make(map[string]map[uuid.UUID]bool)
+	// Voters (user or ballot IDs) per normalized name
+	voters := make(map[string]map[uuid.UUID]bool)
+	addVoter := func(name string, id uuid.UUID) {
+		key := antispam.NormalizeName(name)
+		if voters[key] == nil {
+			voters[key] = make(map[uuid.UUID]bool)
+		}
+		voters[key][id] = true
+	}
+
+	for rows.Next() {
+		var ballotID uuid.UUID
+		var v models.Vote
+		var deviceHash, flagReason string
+		var flagged bool
+		err := rows.Scan(&ballotID, &v.ID, &v.DateOptionID, &v.UserID, &v.UserName, &v.Response, &v.CreatedAt,
+			&deviceHash, &flagged, &flagReason)
+		if err != nil {
+			log.Printf("Error scanning ballot vote: %v", err)
+			continue
+		}
+		v.PollID = pollID
+
+		// Registered voters are not moderated, but their names count for duplicates
+		if v.UserID != nil {
+			addVoter(v.UserName, *v.UserID)
+			continue
+		}
+
+		b, ok := byID[ballotID]
+		if !ok {
+			b = &models.Ballot{ID: ballotID, UserName: v.UserName, Votes: []models.Vote{}, CreatedAt: v.CreatedAt}
+			byID[ballotID] = b
+			ballots = append(ballots, b)
+			addVoter(v.UserName, ballotID)
+			if deviceHash != "" {
+				ballotDevice[ballotID] = deviceHash
+				if devices[deviceHash] == nil {
+					devices[deviceHash] = make(map[uuid.UUID]bool)
+				}
+				devices[deviceHash][ballotID] = true
+			}
+		}
+		b.Flagged = b.Flagged || flagged
+		if flagReason != "" {
+			b.FlagReason = flagReason
+		}
+		b.Votes = append(b.Votes, v)
+	}
+
+	for _, b := range ballots {
+		if device, ok := ballotDevice[b.ID]; ok {
+			b.SameDeviceBallots = len(devices[device]) - 1
+		}
+		b.DuplicateName = len(voters[antispam.NormalizeName(b.UserName)]) > 1
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"ballots": ballots,
+		"count":   len(ballots),
+	})
+}
+
+// FlagBallot flags or unflags an anonymous ballot
+// @Summary      Signaler un bulletin
+// @Description  Marque (ou non) un bulletin anonyme comme suspect
+// @Tags         moderation
+// @Accept       json
+// @Produce      json
+// @Security     BearerAuth
+// @Param        id        path      string                    true  "UUID du sondage"
+// @Param        ballotId  path      string                    true  "ID du bulletin"
+// @Param        request   body      models.FlagBallotRequest  true  "Signalement"
+// @Success      200  {object}  map[string]string
+// @Failure      400  {object}  map[string]string
+// @Failure      403  {object}  map[string]string
+// @Failure      404  {object}  map[string]string
+// @Router       /polls/{id}/moderation/{ballotId} [put]
+func (h *VoteHandler) FlagBallot(c *gin.Context) {
+	pollID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid poll ID"})
+		return
+	}
+	ballotID, err := uuid.Parse(c.Param("ballotId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ballot ID"})
+		return
+	}
+
+	var req models.FlagBallotRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx, cancel := database.GetContext()
+	defer cancel()
+
+	if !h.requirePollCreator(c, ctx, pollID) {
+		return
+	}
+
+	var reason *string
+	if *req.Flagged && req.Reason != "" {
+		reason = &req.Reason
+	}
+
+	tag, err := h.db.Exec(ctx, `
+		UPDATE votes SET flagged = $3, flag_reason = $4
+		WHERE poll_id = $1 AND COALESCE(ballot_id, id) = $2 AND user_id IS NULL
+	`, pollID, ballotID, *req.Flagged, reason)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to flag ballot"})
+		return
+	}
+	if tag.RowsAffected() == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Ballot not found"})
+		return
+	}
+
+	entry := newAuditEntry(c, audit.ActionBallotFlag, audit.TargetBallot, ballotID.String())
+	entry.PollID = &pollID
+	entry.Changes = audit.Diff(nil, map[string]interface{}{"flagged": *req.Flagged, "flag_reason": reason})
+	recordAudit(ctx, h.db, entry)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Ballot updated"})
+}
+
+// DeleteBallot removes an anonymous ballot and its votes
+// @Summary      Supprimer un bulletin
+// @Description  Supprime un bulletin anonyme et tous ses votes
+// @Tags         moderation
+// @Produce      json
+// @Security     BearerAuth
+// @Param        id        path      string  true  "UUID du sondage"
+// @Param        ballotId  path      string  true  "ID du bulletin"
+// @Success      200  {object}  map[string]interface{}
+// @Failure      400  {object}  map[string]string
+// @Failure      403  {object}  map[string]string
+// @Failure      404  {object}  map[string]string
+// @Router       /polls/{id}/moderation/{ballotId} [delete]
+func (h *VoteHandler) DeleteBallot(c *gin.Context) {
+	pollID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid poll ID"})
+		return
+	}
+	ballotID, err := uuid.Parse(c.Param("ballotId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ballot ID"})
+		return
+	}
+
+	ctx, cancel := database.GetContext()
+	defer cancel()
+
+	if !h.requirePollCreator(c, ctx, pollID) {
+		return
+	}
+
+	tx, err := h.db.Begin(ctx)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete ballot"})
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	rows, err := tx.Query(ctx, `
+		DELETE FROM votes
+		WHERE poll_id = $1 AND COALESCE(ballot_id, id) = $2 AND user_id IS NULL
+		RETURNING id, date_option_id, user_name, response
+	`, pollID, ballotID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete ballot"})
+		return
+	}
+	deleted := []map[string]interface{}{}
+	deletedVotes := []models.Vote{}
+	for rows.Next() {
+		v := models.Vote{PollID: pollID}
+		if err := rows.Scan(&v.ID, &v.DateOptionID, &v.UserName, &v.Response); err == nil {
+			deleted = append(deleted, voteSnapshot(v))
+			deletedVotes = append(deletedVotes, v)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete ballot"})
+		return
+	}
+	if len(deleted) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Ballot not found"})
+		return
+	}
+
+	entry := newAuditEntry(c, audit.ActionBallotDelete, audit.TargetBallot, ballotID.String())
+	entry.PollID = &pollID
+	entry.Changes = audit.Diff(map[string]interface{}{"votes": deleted}, nil)
+	if err := audit.Record(ctx, tx, entry); err != nil {
+		log.Printf("Error recording ballot deletion: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete ballot"})
+		return
+	}
+	for _, v := range deletedVotes {
+		if err := publishEvent(ctx, tx, voteEvent(events.TypeVoteDeleted, v)); err != nil {
+			log.Printf("Error recording vote event: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete ballot"})
+			return
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete ballot"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Ballot deleted",
+		"votes":   len(deleted),
+	})
+}
@@ -8,7 +8,9 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5/pgxpool"
+	"doodle-clone/internal/audit"
 	"doodle-clone/internal/database"
+	"doodle-clone/internal/events"
 	"doodle-clone/internal/middleware"
 	"doodle-clone/internal/models"
 )
@@ -57,7 +59,7 @@ func (h *VoteHandler) GetVotes(c *gin.Context) {
 
 	// Get votes grouped by user
 	rows, err := h.db.Query(ctx, `
-		SELECT v.id, v.poll_id, v.date_option_id, v.user_id, v.user_name, v.response, v.created_at,
+		SELECT v.id, v.poll_id, v.date_option_id, v.user_id, v.user_name, v.response, COALESCE(v.source, ''), v.created_at,
 		       u.id, u.name, u.avatar
 		FROM votes v
 		LEFT JOIN users u ON v.user_id = u.id
@@ -80,7 +82,7 @@ func (h *VoteHandler) GetVotes(c *gin.Context) {
 		var user models.User
 
 		err := rows.Scan(
-			&vote.ID, &vote.PollID, &vote.DateOptionID, &userIDPtr, &vote.UserName, &vote.Response, &vote.CreatedAt,
+			&vote.ID, &vote.PollID, &vote.DateOptionID, &userIDPtr, &vote.UserName, &vote.Response, &vote.Source, &vote.CreatedAt,
 			&user.ID, &user.Name, &user.Avatar,
 		)
 		if err != nil {
@@ -259,6 +261,48 @@ func (h *VoteHandler) CreateVote(c *gin.Context) {
 		}
 	}
 
+	// Apply the poll's anti-spam protections to anonymous ballots
+	ballot := &anonymousBallot{}
+	if userID == nil {
+		var ok bool
+		if ballot, ok = h.checkAnonymousBallot(c, ctx, poll.ID, &req, userName); !ok {
+			return
+		}
+	}
+	var ballotID *uuid.UUID
+	var deviceHash *string
+	if userID == nil {
+		ballotID = &ballot.ID
+		if ballot.DeviceHash != "" {
+			deviceHash = &ballot.DeviceHash
+		}
+	}
+
+	// Previous responses of a registered voter, for the audit log
+	previous := map[uuid.UUID]string{}
+	if userID != nil {
+		rows, err := h.db.Query(ctx, `
+			SELECT date_option_id, response FROM votes WHERE poll_id = $1 AND user_id = $2
+		`, poll.ID, *userID)
+		if err == nil {
+			for rows.Next() {
+				var dateOptionID uuid.UUID
+				var response string
+				if rows.Scan(&dateOptionID, &response) == nil {
+					previous[dateOptionID] = response
+				}
+			}
+			rows.Close()
+		}
+	}
+
+	tx, err := h.db.Begin(ctx)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create vote"})
+		return
+	}
+	defer tx.Rollback(ctx)
+
 	// Create votes
 	createdVotes := []models.Vote{}
 	for _, voteItem := range votesToCreate {
@@ -273,12 +317,16 @@ func (h *VoteHandler) CreateVote(c *gin.Context) {
 		log.Printf("Creating vote: pollID=%s, dateOptionID=%s, userID=%v, displayName=%s, response=%s",
 			poll.ID, voteItem.DateOptionID, userIDPtr, displayName, voteItem.Response)
 
-		_, err = h.db.Exec(ctx, `
-			INSERT INTO votes (id, poll_id, date_option_id, user_id, user_name, response)
-			VALUES ($1, $2, $3, $4, $5, $6)
+		// An existing vote keeps its ID when updated, and is no longer synced with a calendar
+		err = tx.QueryRow(ctx, `
+			INSERT INTO votes (id, poll_id, date_option_id, user_id, user_name, response,
+				ballot_id, device_hash, fingerprint_hash, pow_nonce)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
 			ON CONFLICT (poll_id, date_option_id, user_id)
-			DO UPDATE SET response = $6, user_name = $5
-		`, voteID, poll.ID, voteItem.DateOptionID, userIDPtr, displayName, voteItem.Response)
+			DO UPDATE SET response = $6, user_name = $5, source = NULL
+			RETURNING id
+		`, voteID, poll.ID, voteItem.DateOptionID, userIDPtr, displayName, voteItem.Response,
+			ballotID, deviceHash, ballot.FingerprintHash, ballot.PowNonce).Scan(&voteID)
 
 		if err != nil {
 			log.Printf("Error creating vote: %v", err)
@@ -286,14 +334,46 @@ func (h *VoteHandler) CreateVote(c *gin.Context) {
 			return
 		}
 
-		createdVotes = append(createdVotes, models.Vote{
+		vote := models.Vote{
 			ID:          voteID,
 			PollID:      poll.ID,
 			DateOptionID: voteItem.DateOptionID,
 			UserID:      userIDPtr,
 			UserName:    displayName,
 			Response:    voteItem.Response,
-		})
+		}
+		createdVotes = append(createdVotes, vote)
+
+		entry := newAuditEntry(c, audit.ActionVoteCreate, audit.TargetVote, voteID.String())
+		entry.PollID = &poll.ID
+		eventType := events.TypeVoteCreated
+		var before map[string]interface{}
+		if response, ok := previous[voteItem.DateOptionID]; ok {
+			entry.Action = audit.ActionVoteUpdate
+			eventType = events.TypeVoteUpdated
+			before = voteSnapshot(vote)
+			before["response"] = response
+		}
+		after := voteSnapshot(vote)
+		if ballotID != nil {
+			after["ballot_id"] = *ballotID
+		}
+		entry.Changes = audit.Diff(before, after)
+		if err := audit.Record(ctx, tx, entry); err != nil {
+			log.Printf("Error recording vote: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create vote"})
+			return
+		}
+		if err := publishEvent(ctx, tx, voteEvent(eventType, vote)); err != nil {
+			log.Printf("Error recording vote event: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create vote"})
+			return
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create vote"})
+		return
 	}
 
 	c.JSON(http.StatusCreated, gin.H{
@@ -340,9 +420,9 @@ func (h *VoteHandler) UpdateVote(c *gin.Context) {
 	// Get the vote
 	var vote models.Vote
 	err := h.db.QueryRow(ctx, `
-		SELECT id, poll_id, date_option_id, user_id, response
+		SELECT id, poll_id, date_option_id, user_id, user_name, response
 		FROM votes WHERE id = $1
-	`, voteID).Scan(&vote.ID, &vote.PollID, &vote.DateOptionID, &vote.UserID, &vote.Response)
+	`, voteID).Scan(&vote.ID, &vote.PollID, &vote.DateOptionID, &vote.UserID, &vote.UserName, &vote.Response)
 
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Vote not found"})
@@ -374,9 +454,16 @@ func (h *VoteHandler) UpdateVote(c *gin.Context) {
 		return
 	}
 
+	tx, err := h.db.Begin(ctx)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update vote"})
+		return
+	}
+	defer tx.Rollback(ctx)
+
 	// Update vote
-	_, err = h.db.Exec(ctx, `
-		UPDATE votes SET response = $1 WHERE id = $2
+	_, err = tx.Exec(ctx, `
+		UPDATE votes SET response = $1, source = NULL WHERE id = $2
 	`, req.Response, voteID)
 
 	if err != nil {
@@ -384,6 +471,27 @@ func (h *VoteHandler) UpdateVote(c *gin.Context) {
 		return
 	}
 
+	before := voteSnapshot(vote)
+	vote.Response = req.Response
+	entry := newAuditEntry(c, audit.ActionVoteUpdate, audit.TargetVote, vote.ID.String())
+	entry.PollID = &vote.PollID
+	entry.Changes = audit.Diff(before, voteSnapshot(vote))
+	if err := audit.Record(ctx, tx, entry); err != nil {
+		log.Printf("Error recording vote update: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update vote"})
+		return
+	}
+	if err := publishEvent(ctx, tx, voteEvent(events.TypeVoteUpdated, vote)); err != nil {
+		log.Printf("Error recording vote event: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update vote"})
+		return
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update vote"})
+		return
+	}
+
 	c.JSON(http.StatusOK, gin.H{"message": "Vote updated successfully"})
 }
 
@@ -418,9 +526,9 @@ func (h *VoteHandler) DeleteVote(c *gin.Context) {
 	// Get the vote
 	var vote models.Vote
 	err := h.db.QueryRow(ctx, `
-		SELECT id, user_id, poll_id
+		SELECT id, user_id, poll_id, date_option_id, user_name, response
 		FROM votes WHERE id = $1
-	`, voteID).Scan(&vote.ID, &vote.UserID, &vote.PollID)
+	`, voteID).Scan(&vote.ID, &vote.UserID, &vote.PollID, &vote.DateOptionID, &vote.UserName, &vote.Response)
 
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Vote not found"})
@@ -445,13 +553,40 @@ func (h *VoteHandler) DeleteVote(c *gin.Context) {
 		}
 	}
 
+	tx, err := h.db.Begin(ctx)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete vote"})
+		return
+	}
+	defer tx.Rollback(ctx)
+
 	// Delete vote
-	_, err = h.db.Exec(ctx, "DELETE FROM votes WHERE id = $1", voteID)
+	_, err = tx.Exec(ctx, "DELETE FROM votes WHERE id = $1", voteID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete vote"})
 		return
 	}
 
+	// The actor may be the poll creator removing someone else's vote
+	entry := newAuditEntry(c, audit.ActionVoteDelete, audit.TargetVote, vote.ID.String())
+	entry.PollID = &vote.PollID
+	entry.Changes = audit.Diff(voteSnapshot(vote), nil)
+	if err := audit.Record(ctx, tx, entry); err != nil {
+		log.Printf("Error recording vote deletion: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete vote"})
+		return
+	}
+	if err := publishEvent(ctx, tx, voteEvent(events.TypeVoteDeleted, vote)); err != nil {
+		log.Printf("Error recording vote event: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete vote"})
+		return
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete vote"})
+		return
+	}
+
 	c.JSON(http.StatusOK, gin.H{"message": "Vote deleted successfully"})
 }
 
@@ -519,6 +654,19 @@ func (h *VoteHandler) GetUserVotes(c *gin.Context) {
 	})
 }
 
+// voteSnapshot holds the fields of a vote tracked in the audit log
+func voteSnapshot(v models.Vote) map[string]interface{} {
+	snapshot := map[string]interface{}{
+		"date_option_id": v.DateOptionID,
+		"user_name":      v.UserName,
+		"response":       v.Response,
+	}
+	if v.UserID != nil {
+		snapshot["user_id"] = *v.UserID
+	}
+	return snapshot
+}
+
 // now returns the current time
 func now() time.Time {
 	return time.Now()
@@ -0,0 +1,733 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"doodle-clone/internal/audit"
+	"doodle-clone/internal/config"
+	"doodle-clone/internal/database"
+	"doodle-clone/internal/events"
+	"doodle-clone/internal/middleware"
+	"doodle-clone/internal/models"
+	"doodle-clone/internal/webhooks"
+)
+
+const (
+	maxWebhooksPerUser  = 20
+	webhookBatchSize    = 20
+	webhookPurgeEvery   = time.Hour
+	defaultDeliveryList = 50
+	maxDeliveryList     = 200
+)
+
+// webhookPayload is the JSON body of a delivery
+type webhookPayload struct {
+	Event      string                 `json:"event"`
+	PollID     uuid.UUID              `json:"poll_id"`
+	OccurredAt time.Time              `json:"occurred_at"`
+	Data       map[string]interface{} `json:"data"`
+}
+
+// enqueueWebhooks queues a delivery of an event for each matching webhook: those of the
+// poll, and those of its creator covering all their polls. Webhooks belong to the
+// organizer, so voters are included even on anonymous polls.
+func enqueueWebhooks(ctx context.Context, db execer, e events.Event) error {
+	payload, err := json.Marshal(webhookPayload{
+		Event:      e.Type,
+		PollID:     e.PollID,
+		OccurredAt: time.Now().UTC(),
+		Data:       e.Payload(true),
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(ctx, `
+		INSERT INTO webhook_deliveries (webhook_id, event_type, payload)
+		SELECT w.id, $2, $3
+		FROM webhooks w
+		WHERE w.active
+		AND (w.poll_id = $1 OR (w.poll_id IS NULL AND w.user_id = COALESCE(
+			(SELECT creator_id FROM polls WHERE id = $1), NULLIF($4, '')::uuid)))
+		AND (cardinality(w.events) = 0 OR $2 = ANY(w.events))
+	`, e.PollID, e.Type, payload, eventString(e, "creator_id"))
+	return err
+}
+
+// WebhookHandler manages webhooks and delivers their events
+type WebhookHandler struct {
+	db     *pgxpool.Pool
+	client *http.Client
+	ticker *time.Ticker
+	stopCh chan struct{}
+}
+
+// NewWebhookHandler creates a new webhook handler
+func NewWebhookHandler(db *pgxpool.Pool) *WebhookHandler {
+	return &WebhookHandler{
+		db:     db,
+		client: webhooks.NewClient(config.AppConfig.WebhookTimeout, config.AppConfig.WebhookAllowPrivate),
+		stopCh: make(chan struct{}),
+	}
+}
+
+// validateWebhookEvents returns the first unknown event type of a filter
+func validateWebhookEvents(filter []string) (string, bool) {
+	for _, e := range filter {
+		if !events.IsPollEventType(e) {
+			return e, false
+		}
+	}
+	return "", true
+}
+
+// newWebhookSecret generates a signing secret
+func newWebhookSecret() (string, error) {
+	secret, err := randomToken(32)
+	if err != nil {
+		return "", err
+	}
+	return webhooks.SecretPrefix + secret, nil
+}
+
+// loadWebhook reads a webhook of the given user
+func (h *WebhookHandler) loadWebhook(ctx context.Context, webhookID, userID uuid.UUID) (*models.Webhook, error) {
+	var w models.Webhook
+	err := h.db.QueryRow(ctx, `
+		SELECT id, user_id, poll_id, url, events, COALESCE(description, ''), active, created_at, updated_at
+		FROM webhooks WHERE id = $1 AND user_id = $2
+	`, webhookID, userID).Scan(&w.ID, &w.UserID, &w.PollID, &w.URL, &w.Events, &w.Description, &w.Active, &w.CreatedAt, &w.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &w, nil
+}
+
+// webhookFromParam reads the webhook of the route, writing the error response if missing
+func (h *WebhookHandler) webhookFromParam(c *gin.Context, ctx context.Context, userID uuid.UUID) (*models.Webhook, bool) {
+	webhookID, err := uuid.Parse(c.Param("webhookId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid webhook ID"})
+		return nil, false
+	}
+	w, err := h.loadWebhook(ctx, webhookID, userID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Webhook not found"})
+			return nil, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return nil, false
+	}
+	return w, true
+}
+
+// webhookSnapshot returns the audited fields of a webhook
+func webhookSnapshot(w models.Webhook) map[string]interface{} {
+	return map[string]interface{}{
+		"url":         w.URL,
+		"poll_id":     w.PollID,
+		"events":      w.Events,
+		"description": w.Description,
+		"active":      w.Active,
+	}
+}
+
+// CreateWebhook registers a webhook for a poll or for every poll of the current user
+// @Summary      Créer un webhook
+// @Description  Abonne une URL aux événements d'un sondage (poll_id, créateur uniquement) ou de tous les sondages de l'utilisateur. Le secret de signature n'est affiché qu'une seule fois.
+// @Tags         webhooks
+// @Accept       json
+// @Produce      json
+// @Security     BearerAuth
+// @Param        request body      models.CreateWebhookRequest  true  "URL, sondage et filtre d'événements"
+// @Success      201  {object}  models.WebhookSecretResponse
+// @Failure      400  {object}  map[string]string
+// @Failure      401  {object}  map[string]string
+// @Failure      403  {object}  map[string]string
+// @Failure      404  {object}  map[string]string
+// @Router       /user/webhooks [post]
+func (h *WebhookHandler) CreateWebhook(c *gin.Context) {
+	userID := middleware.GetCurrentUser(c)
+	if userID == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Not authenticated"})
+		return
+	}
+
+	var req models.CreateWebhookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := webhooks.ValidateURL(req.URL); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Events == nil {
+		req.Events = []string{}
+	}
+	if unknown, ok := validateWebhookEvents(req.Events); !ok {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":        "Unknown event: " + unknown,
+			"valid_events": events.PollEventTypes,
+		})
+		return
+	}
+
+	ctx, cancel := database.GetContext()
+	defer cancel()
+
+	if req.PollID != nil && !requirePollCreator(c, ctx, h.db, *req.PollID, "Only the creator can add webhooks to this poll") {
+		return
+	}
+
+	var count int
+	if err := h.db.QueryRow(ctx, "SELECT COUNT(*) FROM webhooks WHERE user_id = $1", *userID).Scan(&count); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if count >= maxWebhooksPerUser {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Too many webhooks, delete unused ones first"})
+		return
+	}
+
+	secret, err := newWebhookSecret()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate secret"})
+		return
+	}
+
+	w := models.Webhook{
+		ID:          uuid.New(),
+		UserID:      *userID,
+		PollID:      req.PollID,
+		URL:         req.URL,
+		Events:      req.Events,
+		Description: req.Description,
+		Active:      true,
+	}
+	err = h.db.QueryRow(ctx, `
+		INSERT INTO webhooks (id, user_id, poll_id, url, secret, events, description)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING created_at, updated_at
+	`, w.ID, w.UserID, w.PollID, w.URL, secret, w.Events, w.Description).Scan(&w.CreatedAt, &w.UpdatedAt)
+	if err != nil {
+		log.Printf("Failed to create webhook: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create webhook"})
+		return
+	}
+
+	entry := newAuditEntry(c, audit.ActionWebhookCreate, audit.TargetWebhook, w.ID.String())
+	entry.PollID = w.PollID
+	entry.Changes = audit.Diff(nil, webhookSnapshot(w))
+	recordAudit(ctx, h.db, entry)
+
+	c.JSON(http.StatusCreated, models.WebhookSecretResponse{Webhook: w, Secret: secret})
+}
+
+// ListWebhooks returns the webhooks of the current user
+// @Summary      Lister les webhooks
+// @Description  Retourne les webhooks de l'utilisateur (sans leur secret)
+// @Tags         webhooks
+// @Produce      json
+// @Security     BearerAuth
+// @Success      200  {object}  map[string]interface{}  "webhooks, count"
+// @Failure      401  {object}  map[string]string
+// @Router       /user/webhooks [get]
+func (h *WebhookHandler) ListWebhooks(c *gin.Context) {
+	userID := middleware.GetCurrentUser(c)
+	if userID == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Not authenticated"})
+		return
+	}
+
+	ctx, cancel := database.GetContext()
+	defer cancel()
+
+	rows, err := h.db.Query(ctx, `
+		SELECT id, user_id, poll_id, url, events, COALESCE(description, ''), active, created_at, updated_at
+		FROM webhooks WHERE user_id = $1
+		ORDER BY created_at DESC
+	`, *userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch webhooks"})
+		return
+	}
+	defer rows.Close()
+
+	list := []models.Webhook{}
+	for rows.Next() {
+		var w models.Webhook
+		if err := rows.Scan(&w.ID, &w.UserID, &w.PollID, &w.URL, &w.Events, &w.Description, &w.Active, &w.CreatedAt, &w.UpdatedAt); err != nil {
+			log.Printf("Error scanning webhook: %v", err)
+			continue
+		}
+		list = append(list, w)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"webhooks": list,
+		"count":    len(list),
+	})
+}
+
+// UpdateWebhook changes the URL, filter or state of a webhook, or rotates its secret
+// @Summary      Modifier un webhook
+// @Description  Modifie l'URL, le filtre d'événements, la description ou l'activation d'un webhook. rotate_secret génère un nouveau secret, affiché une seule fois.
+// @Tags         webhooks
+// @Accept       json
+// @Produce      json
+// @Security     BearerAuth
+// @Param        webhookId path      string                       true  "ID du webhook"
+// @Param        request   body      models.UpdateWebhookRequest  true  "Champs à modifier"
+// @Success      200  {object}  models.WebhookSecretResponse
+// @Failure      400  {object}  map[string]string
+// @Failure      401  {object}  map[string]string
+// @Failure      404  {object}  map[string]string
+// @Router       /user/webhooks/{webhookId} [put]
+func (h *WebhookHandler) UpdateWebhook(c *gin.Context) {
+	userID := middleware.GetCurrentUser(c)
+	if userID == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Not authenticated"})
+		return
+	}
+
+	var req models.UpdateWebhookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx, cancel := database.GetContext()
+	defer cancel()
+
+	w, ok := h.webhookFromParam(c, ctx, *userID)
+	if !ok {
+		return
+	}
+	before := webhookSnapshot(*w)
+
+	if req.URL != nil {
+		if err := webhooks.ValidateURL(*req.URL); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		w.URL = *req.URL
+	}
+	if req.Events != nil {
+		if unknown, ok := validateWebhookEvents(*req.Events); !ok {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":        "Unknown event: " + unknown,
+				"valid_events": events.PollEventTypes,
+			})
+			return
+		}
+		w.Events = *req.Events
+		if w.Events == nil {
+			w.Events = []string{}
+		}
+	}
+	if req.Description != nil {
+		w.Description = *req.Description
+	}
+	if req.Active != nil {
+		w.Active = *req.Active
+	}
+
+	var secret *string
+	if req.RotateSecret {
+		s, err := newWebhookSecret()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate secret"})
+			return
+		}
+		secret = &s
+	}
+
+	err := h.db.QueryRow(ctx, `
+		UPDATE webhooks SET url = $1, events = $2, description = $3, active = $4,
+		       secret = COALESCE($5, secret), updated_at = CURRENT_TIMESTAMP
+		WHERE id = $6
+		RETURNING updated_at
+	`, w.URL, w.Events, w.Description, w.Active, secret, w.ID).Scan(&w.UpdatedAt)
+	if err != nil {
+		log.Printf("Failed to update webhook: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update webhook"})
+		return
+	}
+
+	entry := newAuditEntry(c, audit.ActionWebhookUpdate, audit.TargetWebhook, w.ID.String())
+	entry.PollID = w.PollID
+	entry.Changes = audit.Diff(before, webhookSnapshot(*w))
+	if secret != nil {
+		if entry.Changes == nil {
+			entry.Changes = map[string]audit.Change{}
+		}
+		entry.Changes["secret"] = audit.Change{New: "rotated"}
+	}
+	recordAudit(ctx, h.db, entry)
+
+	response := models.WebhookSecretResponse{Webhook: *w}
+	if secret != nil {
+		response.Secret = *secret
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// DeleteWebhook deletes a webhook and its delivery log
+// @Summary      Supprimer un webhook
+// @Description  Supprime un webhook et son historique de livraisons
+// @Tags         webhooks
+// @Produce      json
+// @Security     BearerAuth
+// @Param        webhookId path      string  true  "ID du webhook"
+// @Success      200  {object}  map[string]string
+// @Failure      400  {object}  map[string]string
+// @Failure      401  {object}  map[string]string
+// @Failure      404  {object}  map[string]string
+// @Router       /user/webhooks/{webhookId} [delete]
+func (h *WebhookHandler) DeleteWebhook(c *gin.Context) {
+	userID := middleware.GetCurrentUser(c)
+	if userID == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Not authenticated"})
+		return
+	}
+
+	ctx, cancel := database.GetContext()
+	defer cancel()
+
+	w, ok := h.webhookFromParam(c, ctx, *userID)
+	if !ok {
+		return
+	}
+
+	if _, err := h.db.Exec(ctx, "DELETE FROM webhooks WHERE id = $1", w.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete webhook"})
+		return
+	}
+
+	entry := newAuditEntry(c, audit.ActionWebhookDelete, audit.TargetWebhook, w.ID.String())
+	entry.PollID = w.PollID
+	entry.Changes = audit.Diff(webhookSnapshot(*w), nil)
+	recordAudit(ctx, h.db, entry)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Webhook deleted successfully"})
+}
+
+// ListWebhookDeliveries returns the delivery log of a webhook, newest first
+// @Summary      Livraisons d'un webhook
+// @Description  Retourne l'historique des livraisons d'un webhook : statut, tentatives, code et début de la réponse du destinataire
+// @Tags         webhooks
+// @Produce      json
+// @Security     BearerAuth
+// @Param        webhookId path      string  true   "ID du webhook"
+// @Param        status    query     string  false  "pending, delivered ou failed"
+// @Param        limit     query     int     false  "Nombre de livraisons (50 par défaut, 200 max)"
+// @Param        offset    query     int     false  "Décalage"
+// @Success      200  {object}  map[string]interface{}  "deliveries, count"
+// @Failure      400  {object}  map[string]string
+// @Failure      401  {object}  map[string]string
+// @Failure      404  {object}  map[string]string
+// @Router       /user/webhooks/{webhookId}/deliveries [get]
+func (h *WebhookHandler) ListWebhookDeliveries(c *gin.Context) {
+	userID := middleware.GetCurrentUser(c)
+	if userID == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Not authenticated"})
+		return
+	}
+
+	status := c.Query("status")
+	switch status {
+	case "", models.WebhookDeliveryPending, models.WebhookDeliveryDelivered, models.WebhookDeliveryFailed:
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid status"})
+		return
+	}
+
+	limit, err := strconv.Atoi(c.Query("limit"))
+	if err != nil || limit <= 0 {
+		limit = defaultDeliveryList
+	}
+	if limit > maxDeliveryList {
+		limit = maxDeliveryList
+	}
+	offset, err := strconv.Atoi(c.Query("offset"))
+	if err != nil || offset < 0 {
+		offset = 0
+	}
+
+	ctx, cancel := database.GetContext()
+	defer cancel()
+
+	w, ok := h.webhookFromParam(c, ctx, *userID)
+	if !ok {
+		return
+	}
+
+	rows, err := h.db.Query(ctx, `
+		SELECT id, webhook_id, event_type, payload, status, attempts,
+		       CASE WHEN status = 'pending' THEN next_attempt_at END,
+		       last_status_code, last_error, last_response, redelivery_of, delivered_at, created_at
+		FROM webhook_deliveries
+		WHERE webhook_id = $1 AND ($2 = '' OR status = $2)
+		ORDER BY created_at DESC
+		LIMIT $3 OFFSET $4
+	`, w.ID, status, limit, offset)
+	if err != nil {
+		log.Printf("Error querying webhook deliveries: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch deliveries"})
+		return
+	}
+	defer rows.Close()
+
+	deliveries := []models.WebhookDelivery{}
+	for rows.Next() {
+		var d models.WebhookDelivery
+		err := rows.Scan(&d.ID, &d.WebhookID, &d.EventType, &d.Payload, &d.Status, &d.Attempts, &d.NextAttemptAt,
+			&d.LastStatusCode, &d.LastError, &d.LastResponse, &d.RedeliveryOf, &d.DeliveredAt, &d.CreatedAt)
+		if err != nil {
+			log.Printf("Error scanning webhook delivery: %v", err)
+			continue
+		}
+		deliveries = append(deliveries, d)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"deliveries": deliveries,
+		"count":      len(deliveries),
+	})
+}
+
+// RedeliverWebhook queues a delivery again, as a new delivery with the same payload
+// @Summary      Relivrer un événement
+// @Description  Renvoie le contenu d'une livraison précédente dans une nouvelle livraison
+// @Tags         webhooks
+// @Produce      json
+// @Security     BearerAuth
+// @Param        webhookId  path      string  true  "ID du webhook"
+// @Param        deliveryId path      string  true  "ID de la livraison"
+// @Success      202  {object}  models.WebhookDelivery
+// @Failure      400  {object}  map[string]string
+// @Failure      401  {object}  map[string]string
+// @Failure      404  {object}  map[string]string
+// @Router       /user/webhooks/{webhookId}/deliveries/{deliveryId}/redeliver [post]
+func (h *WebhookHandler) RedeliverWebhook(c *gin.Context) {
+	userID := middleware.GetCurrentUser(c)
+	if userID == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Not authenticated"})
+		return
+	}
+
+	deliveryID, err := uuid.Parse(c.Param("deliveryId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid delivery ID"})
+		return
+	}
+
+	ctx, cancel := database.GetContext()
+	defer cancel()
+
+	w, ok := h.webhookFromParam(c, ctx, *userID)
+	if !ok {
+		return
+	}
+	if !w.Active {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Webhook is disabled"})
+		return
+	}
+
+	var d models.WebhookDelivery
+	err = h.db.QueryRow(ctx, `
+		INSERT INTO webhook_deliveries (webhook_id, event_type, payload, redelivery_of)
+		SELECT webhook_id, event_type, payload, id
+		FROM webhook_deliveries WHERE id = $1 AND webhook_id = $2
+		RETURNING id, webhook_id, event_type, payload, status, attempts, next_attempt_at, redelivery_of, created_at
+	`, deliveryID, w.ID).Scan(&d.ID, &d.WebhookID, &d.EventType, &d.Payload, &d.Status, &d.Attempts,
+		&d.NextAttemptAt, &d.RedeliveryOf, &d.CreatedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Delivery not found"})
+			return
+		}
+		log.Printf("Failed to queue redelivery: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to queue redelivery"})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, d)
+}
+
+// StartDispatcher starts delivering queued webhook events in the background
+func (h *WebhookHandler) StartDispatcher() {
+	interval := config.AppConfig.WebhookInterval
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+	h.ticker = time.NewTicker(interval)
+	log.Println("Webhook dispatcher started")
+
+	go func() {
+		var lastPurge time.Time
+		for {
+			select {
+			case <-h.ticker.C:
+				h.dispatchDueDeliveries()
+				if time.Since(lastPurge) > webhookPurgeEvery {
+					h.purgeWebhookDeliveries()
+					lastPurge = time.Now()
+				}
+			case <-h.stopCh:
+				h.ticker.Stop()
+				log.Println("Webhook dispatcher stopped")
+				return
+			}
+		}
+	}()
+}
+
+// StopDispatcher stops the webhook dispatcher
+func (h *WebhookHandler) StopDispatcher() {
+	close(h.stopCh)
+}
+
+// dueDelivery is a delivery claimed by this dispatcher
+type dueDelivery struct {
+	ID        uuid.UUID
+	EventType string
+	Payload   string
+	Attempts  int
+	URL       string
+	Secret    string
+	Active    bool
+}
+
+// dispatchDueDeliveries sends a batch of due deliveries. Claiming pushes their next attempt
+// past the request timeout, so other replicas skip them, and a crash only delays them.
+func (h *WebhookHandler) dispatchDueDeliveries() {
+	timeout := config.AppConfig.WebhookTimeout
+	ctx, cancel := database.GetContext(2*timeout + 10*time.Second)
+	defer cancel()
+
+	rows, err := h.db.Query(ctx, `
+		WITH due AS (
+			SELECT id FROM webhook_deliveries
+			WHERE status = 'pending' AND next_attempt_at <= CURRENT_TIMESTAMP
+			ORDER BY next_attempt_at
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		UPDATE webhook_deliveries d
+		SET attempts = d.attempts + 1, next_attempt_at = CURRENT_TIMESTAMP + make_interval(secs => $2)
+		FROM due, webhooks w
+		WHERE d.id = due.id AND w.id = d.webhook_id
+		RETURNING d.id, d.event_type, d.payload::text, d.attempts, w.url, w.secret, w.active
+	`, webhookBatchSize, (2 * timeout).Seconds())
+	if err != nil {
+		log.Printf("Error claiming webhook deliveries: %v", err)
+		return
+	}
+
+	var due []dueDelivery
+	for rows.Next() {
+		var d dueDelivery
+		if err := rows.Scan(&d.ID, &d.EventType, &d.Payload, &d.Attempts, &d.URL, &d.Secret, &d.Active); err != nil {
+			log.Printf("Error scanning webhook delivery: %v", err)
+			continue
+		}
+		due = append(due, d)
+	}
+	rows.Close()
+
+	var wg sync.WaitGroup
+	for _, d := range due {
+		wg.Add(1)
+		go func(d dueDelivery) {
+			defer wg.Done()
+			h.deliver(ctx, d)
+		}(d)
+	}
+	wg.Wait()
+}
+
+// deliver sends one delivery and records the outcome
+func (h *WebhookHandler) deliver(ctx context.Context, d dueDelivery) {
+	if !d.Active {
+		h.recordDeliveryFailure(ctx, d, webhooks.Result{}, errors.New("webhook is disabled"), true)
+		return
+	}
+
+	result, err := webhooks.Deliver(ctx, h.client, webhooks.Delivery{
+		ID:     d.ID.String(),
+		Event:  d.EventType,
+		URL:    d.URL,
+		Secret: d.Secret,
+		Body:   []byte(d.Payload),
+	})
+	if err != nil {
+		h.recordDeliveryFailure(ctx, d, result, err, d.Attempts >= config.AppConfig.WebhookMaxAttempts)
+		return
+	}
+
+	_, err = h.db.Exec(ctx, `
+		UPDATE webhook_deliveries
+		SET status = $1, delivered_at = CURRENT_TIMESTAMP, last_status_code = $2, last_error = NULL, last_response = $3
+		WHERE id = $4
+	`, models.WebhookDeliveryDelivered, result.StatusCode, result.Body, d.ID)
+	if err != nil {
+		log.Printf("Failed to update webhook delivery %s: %v", d.ID, err)
+	}
+}
+
+// recordDeliveryFailure schedules the next attempt with exponential backoff, or gives up
+func (h *WebhookHandler) recordDeliveryFailure(ctx context.Context, d dueDelivery, result webhooks.Result, deliveryErr error, final bool) {
+	var statusCode *int
+	var response *string
+	if result.StatusCode != 0 {
+		statusCode = &result.StatusCode
+		response = &result.Body
+	}
+
+	status := models.WebhookDeliveryPending
+	if final {
+		status = models.WebhookDeliveryFailed
+	}
+
+	_, err := h.db.Exec(ctx, `
+		UPDATE webhook_deliveries
+		SET status = $1, next_attempt_at = CURRENT_TIMESTAMP + make_interval(secs => $2),
+		    last_status_code = $3, last_error = $4, last_response = $5
+		WHERE id = $6
+	`, status, webhooks.Backoff(d.Attempts).Seconds(), statusCode, deliveryErr.Error(), response, d.ID)
+	if err != nil {
+		log.Printf("Failed to update webhook delivery %s: %v", d.ID, err)
+	}
+}
+
+// purgeWebhookDeliveries deletes finished deliveries past the retention period
+func (h *WebhookHandler) purgeWebhookDeliveries() {
+	ctx, cancel := database.GetContext(30 * time.Second)
+	defer cancel()
+
+	tag, err := h.db.Exec(ctx, `
+		DELETE FROM webhook_deliveries
+		WHERE status <> 'pending' AND created_at < $1
+	`, time.Now().Add(-config.AppConfig.WebhookDeliveryRetention))
+	if err != nil {
+		log.Printf("Failed to purge webhook deliveries: %v", err)
+		return
+	}
+	if n := tag.RowsAffected(); n > 0 {
+		log.Printf("Purged %d webhook deliveries", n)
+	}
+}
@@ -0,0 +1,284 @@
+// Package ical writes iCalendar (RFC 5545) files
+package ical
+
+import (
+	"bytes"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Methods of iTIP (RFC 5546) messages
+const (
+	MethodPublish = "PUBLISH"
+	MethodRequest = "REQUEST"
+	MethodCancel  = "CANCEL"
+)
+
+// Event statuses
+const (
+	StatusTentative = "TENTATIVE"
+	StatusConfirmed = "CONFIRMED"
+	StatusCancelled = "CANCELLED"
+)
+
+// Participation statuses of attendees
+const (
+	PartStatAccepted    = "ACCEPTED"
+	PartStatTentative   = "TENTATIVE"
+	PartStatDeclined    = "DECLINED"
+	PartStatNeedsAction = "NEEDS-ACTION"
+)
+
+// maxLineOctets is the longest content line allowed, without its CRLF
+const maxLineOctets = 75
+
+// timeLayout formats UTC date-times ("form #2" of RFC 5545)
+const timeLayout = "20060102T150405Z"
+
+// Calendar is a VCALENDAR object
+type Calendar struct {
+	ProdID string
+	Method string // PUBLISH, REQUEST, CANCEL... Omitted when empty
+	Name   string // Shown by clients as the calendar name (X-WR-CALNAME)
+	Events []Event
+}
+
+// Event is a VEVENT component. Times are written in UTC.
+type Event struct {
+	UID         string
+	Sequence    int       // Revision, bumped when the event is rescheduled
+	Stamp       time.Time // Creation of this iCalendar object
+	Start       time.Time
+	End         *time.Time
+	AllDay      bool // Start and End are dates, written in their own time zone
+	Summary     string
+	Description string
+	Location    string
+	URL         string
+	Status      string
+	Transparent bool // The event does not make its attendees busy
+	RRule       string
+	ExDates     []time.Time // Occurrences removed from the RRULE
+	Organizer   *Person
+	Attendees   []Attendee
+}
+
+// Person is a calendar user: a name and a URI, usually "mailto:<email>"
+type Person struct {
+	Name    string
+	Address string
+}
+
+// Attendee is a participant of an event
+type Attendee struct {
+	Person
+	PartStat string
+	RSVP     bool // The organizer expects a reply
+}
+
+// Mailto returns the calendar address of an email
+func Mailto(email string) string {
+	return "mailto:" + email
+}
+
+// Encode writes the calendar with CRLF line endings, escaping text values and folding
+// lines longer than 75 octets
+func (cal *Calendar) Encode(w io.Writer) error {
+	var b bytes.Buffer
+	e := encoder{&b}
+
+	e.line("BEGIN", "VCALENDAR")
+	e.line("VERSION", "2.0")
+	e.text("PRODID", cal.ProdID)
+	e.line("CALSCALE", "GREGORIAN")
+	if cal.Method != "" {
+		e.line("METHOD", cal.Method)
+	}
+	if cal.Name != "" {
+		e.text("X-WR-CALNAME", cal.Name)
+	}
+	for _, ev := range cal.Events {
+		e.event(ev)
+	}
+	e.line("END", "VCALENDAR")
+
+	_, err := w.Write(b.Bytes())
+	return err
+}
+
+// Bytes returns the encoded calendar
+func (cal *Calendar) Bytes() []byte {
+	var b bytes.Buffer
+	cal.Encode(&b)
+	return b.Bytes()
+}
+
+// FormatTime formats a DATE-TIME value in UTC
+func FormatTime(t time.Time) string {
+	return t.UTC().Format(timeLayout)
+}
+
+// EscapeText escapes a TEXT value: backslashes, semicolons, commas and newlines.
+// Other control characters are dropped.
+func EscapeText(s string) string {
+	var b strings.Builder
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+	for _, r := range s {
+		switch {
+		case r == '\\' || r == ';' || r == ',':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r == '\n' || r == '\r':
+			b.WriteString(`\n`)
+		case r == '\t' || !isControl(r):
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// Fold splits a content line into lines of at most 75 octets, continuation lines
+// starting with a space, without cutting UTF-8 sequences. Lines are joined with CRLF.
+func Fold(line string) string {
+	if len(line) <= maxLineOctets {
+		return line
+	}
+	var b strings.Builder
+	limit := maxLineOctets
+	for len(line) > limit {
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(line[cut]) {
+			cut--
+		}
+		b.WriteString(line[:cut])
+		b.WriteString("\r\n ")
+		line = line[cut:]
+		// The leading space counts in the continuation line
+		limit = maxLineOctets - 1
+	}
+	b.WriteString(line)
+	return b.String()
+}
+
+// encoder writes content lines
+type encoder struct {
+	b *bytes.Buffer
+}
+
+// param is a property parameter
+type param struct {
+	name, value string
+}
+
+func (e encoder) event(ev Event) {
+	e.line("BEGIN", "VEVENT")
+	e.text("UID", ev.UID)
+	e.line("SEQUENCE", strconv.Itoa(ev.Sequence))
+	e.line("DTSTAMP", FormatTime(ev.Stamp))
+	e.time("DTSTART", ev.Start, ev.AllDay)
+	if ev.End != nil {
+		e.time("DTEND", *ev.End, ev.AllDay)
+	}
+	if ev.RRule != "" {
+		e.line("RRULE", stripControls(ev.RRule))
+	}
+	for _, t := range ev.ExDates {
+		e.time("EXDATE", t, ev.AllDay)
+	}
+	e.text("SUMMARY", ev.Summary)
+	if ev.Description != "" {
+		e.text("DESCRIPTION", ev.Description)
+	}
+	if ev.Location != "" {
+		e.text("LOCATION", ev.Location)
+	}
+	if ev.URL != "" {
+		e.line("URL", stripControls(ev.URL))
+	}
+	if ev.Status != "" {
+		e.line("STATUS", ev.Status)
+	}
+	if ev.Transparent {
+		e.line("TRANSP", "TRANSPARENT")
+	}
+	if ev.Organizer != nil {
+		e.person("ORGANIZER", ev.Organizer.Name, ev.Organizer.Address)
+	}
+	for _, a := range ev.Attendees {
+		var params []param
+		if a.PartStat != "" {
+			params = append(params, param{"PARTSTAT", a.PartStat})
+		}
+		if a.RSVP {
+			params = append(params, param{"RSVP", "TRUE"})
+		}
+		e.person("ATTENDEE", a.Name, a.Address, params...)
+	}
+	e.line("END", "VEVENT")
+}
+
+// person writes a CAL-ADDRESS property with the common name of the user
+func (e encoder) person(name, commonName, address string, params ...param) {
+	if commonName != "" {
+		params = append([]param{{"CN", commonName}}, params...)
+	}
+	e.line(name, stripControls(address), params...)
+}
+
+// time writes a DATE-TIME property in UTC, or a DATE one
+func (e encoder) time(name string, t time.Time, date bool) {
+	if date {
+		e.line(name, t.Format(dateLayout), param{"VALUE", "DATE"})
+		return
+	}
+	e.line(name, FormatTime(t))
+}
+
+// text writes a TEXT property
+func (e encoder) text(name, value string) {
+	e.line(name, EscapeText(value))
+}
+
+// line writes a folded content line. value must already be escaped.
+func (e encoder) line(name, value string, params ...param) {
+	var l strings.Builder
+	l.WriteString(name)
+	for _, p := range params {
+		l.WriteByte(';')
+		l.WriteString(p.name)
+		l.WriteByte('=')
+		l.WriteString(quoteParam(p.value))
+	}
+	l.WriteByte(':')
+	l.WriteString(value)
+
+	e.b.WriteString(Fold(l.String()))
+	e.b.WriteString("\r\n")
+}
+
+// quoteParam writes a parameter value, quoted when it contains ":", ";" or ",".
+// Double quotes cannot be escaped, so they become single quotes.
+func quoteParam(s string) string {
+	s = strings.ReplaceAll(stripControls(s), `"`, "'")
+	if strings.ContainsAny(s, ":;,") {
+		return `"` + s + `"`
+	}
+	return s
+}
+
+// stripControls drops the control characters, which would break content lines
+func stripControls(s string) string {
+	return strings.Map(func(r rune) rune {
+		if isControl(r) {
+			return -1
+		}
+		return r
+	}, s)
+}
+
+func isControl(r rune) bool {
+	return r < 0x20 || r == 0x7f
+}
@@ -0,0 +1,108 @@
+package ical
+
+import (
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEscapeText(t *testing.T) {
+	assert.Equal(t, `Apéro\, bar\; puis resto`, EscapeText("Apéro, bar; puis resto"))
+	assert.Equal(t, `C:\\Users`, EscapeText(`C:\Users`))
+	assert.Equal(t, `ligne 1\nligne 2\nligne 3`, EscapeText("ligne 1\r\nligne 2\nligne 3"))
+	assert.Equal(t, "a\tbc", EscapeText("a\tb\x00c\x1b"))
+}
+
+func TestFold(t *testing.T) {
+	short := strings.Repeat("a", 75)
+	assert.Equal(t, short, Fold(short))
+
+	long := "DESCRIPTION:" + strings.Repeat("é", 100)
+	folded := Fold(long)
+	lines := strings.Split(folded, "\r\n")
+	assert.Greater(t, len(lines), 2)
+	for i, line := range lines {
+		assert.LessOrEqual(t, len(line), 75, "line %d", i)
+		assert.True(t, utf8.ValidString(line), "line %d cuts a character", i)
+		if i > 0 {
+			assert.True(t, strings.HasPrefix(line, " "), "continuation line %d", i)
+		}
+	}
+
+	// Unfolding gives the original line back
+	assert.Equal(t, long, strings.ReplaceAll(folded, "\r\n ", ""))
+}
+
+func TestFormatTime(t *testing.T) {
+	paris := time.FixedZone("CEST", 2*3600)
+	assert.Equal(t, "20260314T163000Z", FormatTime(time.Date(2026, 3, 14, 18, 30, 0, 0, paris)))
+}
+
+func TestEncode(t *testing.T) {
+	start := time.Date(2026, 3, 14, 18, 30, 0, 0, time.UTC)
+	end := start.Add(2 * time.Hour)
+	cal := Calendar{
+		ProdID: "-//Doodle Clone//EN",
+		Method: MethodPublish,
+		Events: []Event{{
+			UID:         "poll-1@doodleclone",
+			Sequence:    2,
+			Stamp:       time.Date(2026, 3, 1, 9, 0, 0, 0, time.UTC),
+			Start:       start,
+			End:         &end,
+			Summary:     "Apéro, enfin; vraiment",
+			Description: "Ramenez à boire\nVotes : 3 oui",
+			Location:    "Bar \"Le Zinc\"",
+			Status:      StatusConfirmed,
+			Organizer:   &Person{Name: "Alice", Address: Mailto("alice@example.com")},
+			Attendees: []Attendee{
+				{Person: Person{Name: "Dupont, Jean", Address: Mailto("jean@example.com")}, PartStat: PartStatNeedsAction, RSVP: true},
+				{Person: Person{Name: `Bob "the builder"`, Address: "urn:uuid:5f0c"}},
+			},
+		}},
+	}
+
+	ics := string(cal.Bytes())
+	assert.True(t, strings.HasPrefix(ics, "BEGIN:VCALENDAR\r\nVERSION:2.0\r\nPRODID:-//Doodle Clone//EN\r\n"))
+	assert.True(t, strings.HasSuffix(ics, "END:VEVENT\r\nEND:VCALENDAR\r\n"))
+	assert.NotContains(t, strings.ReplaceAll(ics, "\r\n", ""), "\n", "every line ends with CRLF")
+
+	unfolded := strings.ReplaceAll(ics, "\r\n ", "")
+	for _, line := range []string{
+		"METHOD:PUBLISH",
+		"UID:poll-1@doodleclone",
+		"SEQUENCE:2",
+		"DTSTAMP:20260301T090000Z",
+		"DTSTART:20260314T183000Z",
+		"DTEND:20260314T203000Z",
+		`SUMMARY:Apéro\, enfin\; vraiment`,
+		`DESCRIPTION:Ramenez à boire\nVotes : 3 oui`,
+		`LOCATION:Bar "Le Zinc"`,
+		"STATUS:CONFIRMED",
+		"ORGANIZER;CN=Alice:mailto:alice@example.com",
+		`ATTENDEE;CN="Dupont, Jean";PARTSTAT=NEEDS-ACTION;RSVP=TRUE:mailto:jean@example.com`,
+		"ATTENDEE;CN=Bob 'the builder':urn:uuid:5f0c",
+	} {
+		assert.Contains(t, unfolded, "\r\n"+line+"\r\n")
+	}
+}
+
+func TestEncodeFoldsLongLines(t *testing.T) {
+	cal := Calendar{ProdID: "-//Test//EN", Events: []Event{{
+		UID:         "1@test",
+		Summary:     strings.Repeat("Réunion ", 20),
+		Description: strings.Repeat("x", 300),
+	}}}
+
+	ics := string(cal.Bytes())
+	for _, line := range strings.Split(strings.TrimSuffix(ics, "\r\n"), "\r\n") {
+		assert.LessOrEqual(t, len(line), 75)
+	}
+	assert.NotContains(t, ics, "METHOD:")
+
+	unfolded := strings.ReplaceAll(ics, "\r\n ", "")
+	assert.Contains(t, unfolded, "\r\nDESCRIPTION:"+strings.Repeat("x", 300)+"\r\n")
+}
@@ -0,0 +1,439 @@
+package ical
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrNoCalendar is returned when the data has no VCALENDAR object
+var ErrNoCalendar = errors.New("not an iCalendar file")
+
+// Layouts of DATE values and of DATE-TIME values in local time
+const (
+	dateLayout      = "20060102"
+	localTimeLayout = "20060102T150405"
+)
+
+// property is a parsed content line
+type property struct {
+	name   string
+	params map[string]string
+	value  string
+}
+
+// Parse reads the events of an iCalendar file. Times without a time zone, and those
+// of a TZID that is not an IANA name (Outlook's "Romance Standard Time"...), are read
+// in loc. Modified instances of recurring events (RECURRENCE-ID) are returned as events
+// of their own, and excluded from the occurrences of the recurring event.
+func Parse(r io.Reader, loc *time.Location) ([]Event, error) {
+	lines, err := unfold(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var events []Event
+	var current *eventReader
+	overrides := map[string][]time.Time{} // Instances replaced by a RECURRENCE-ID, by UID
+	var depth []string                    // Components being read
+	calendar := false
+	for i, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		p, err := parseLine(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", i+1, err)
+		}
+
+		switch p.name {
+		case "BEGIN":
+			component := strings.ToUpper(p.value)
+			if len(depth) == 0 && component != "VCALENDAR" {
+				return nil, ErrNoCalendar
+			}
+			calendar = true
+			depth = append(depth, component)
+			if component == "VEVENT" && len(depth) == 2 {
+				current = &eventReader{}
+			}
+			continue
+		case "END":
+			if len(depth) == 0 {
+				return nil, fmt.Errorf("line %d: unexpected END", i+1)
+			}
+			if len(depth) == 2 && current != nil {
+				event, err := current.finish()
+				if err != nil {
+					return nil, fmt.Errorf("line %d: %w", i+1, err)
+				}
+				if current.recurrenceID != nil {
+					overrides[event.UID] = append(overrides[event.UID], *current.recurrenceID)
+				}
+				events = append(events, event)
+				current = nil
+			}
+			depth = depth[:len(depth)-1]
+			continue
+		}
+
+		// Only the properties of events matter, not those of their alarms
+		if current == nil || len(depth) != 2 {
+			continue
+		}
+		if err := current.set(p, loc); err != nil {
+			return nil, fmt.Errorf("line %d: invalid %s: %w", i+1, p.name, err)
+		}
+	}
+	if !calendar || len(depth) > 0 {
+		return nil, ErrNoCalendar
+	}
+
+	for i := range events {
+		if events[i].RRule != "" {
+			events[i].ExDates = append(events[i].ExDates, overrides[events[i].UID]...)
+		}
+	}
+	return events, nil
+}
+
+// Period is a busy time of a VFREEBUSY
+type Period struct {
+	Start time.Time
+	End   time.Time
+}
+
+// ParseFreeBusy reads the busy times of the VFREEBUSY components of an iCalendar file,
+// as answered to a CalDAV free-busy query. FREE periods are left out; tentative and
+// unavailable ones count as busy.
+func ParseFreeBusy(r io.Reader) ([]Period, error) {
+	lines, err := unfold(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var periods []Period
+	var depth []string
+	calendar := false
+	for i, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		p, err := parseLine(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", i+1, err)
+		}
+
+		switch p.name {
+		case "BEGIN":
+			component := strings.ToUpper(p.value)
+			if len(depth) == 0 && component != "VCALENDAR" {
+				return nil, ErrNoCalendar
+			}
+			calendar = true
+			depth = append(depth, component)
+			continue
+		case "END":
+			if len(depth) == 0 {
+				return nil, fmt.Errorf("line %d: unexpected END", i+1)
+			}
+			depth = depth[:len(depth)-1]
+			continue
+		}
+
+		if p.name != "FREEBUSY" || len(depth) != 2 || depth[1] != "VFREEBUSY" {
+			continue
+		}
+		if strings.EqualFold(p.params["FBTYPE"], "FREE") {
+			continue
+		}
+		for _, v := range strings.Split(p.value, ",") {
+			period, err := parsePeriod(v)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: invalid FREEBUSY: %w", i+1, err)
+			}
+			periods = append(periods, period)
+		}
+	}
+	if !calendar || len(depth) > 0 {
+		return nil, ErrNoCalendar
+	}
+	return periods, nil
+}
+
+// parsePeriod reads a PERIOD value: "start/end" or "start/duration", in UTC
+func parsePeriod(value string) (Period, error) {
+	startValue, endValue, ok := strings.Cut(strings.TrimSpace(value), "/")
+	if !ok {
+		return Period{}, fmt.Errorf("invalid period %q", value)
+	}
+	start, _, err := parseTime(property{value: startValue}, time.UTC)
+	if err != nil {
+		return Period{}, err
+	}
+	if strings.HasPrefix(endValue, "P") || strings.HasPrefix(endValue, "+") || strings.HasPrefix(endValue, "-") {
+		d, err := parseDuration(endValue)
+		if err != nil {
+			return Period{}, err
+		}
+		return Period{Start: start, End: start.Add(d)}, nil
+	}
+	end, _, err := parseTime(property{value: endValue}, time.UTC)
+	if err != nil {
+		return Period{}, err
+	}
+	return Period{Start: start, End: end}, nil
+}
+
+// eventReader collects the properties of a VEVENT, which come in any order
+type eventReader struct {
+	event        Event
+	duration     *time.Duration
+	recurrenceID *time.Time
+}
+
+// set reads a property of the event
+func (r *eventReader) set(p property, loc *time.Location) error {
+	e := &r.event
+	var err error
+	switch p.name {
+	case "UID":
+		e.UID = p.value
+	case "SUMMARY":
+		e.Summary = unescapeText(p.value)
+	case "DESCRIPTION":
+		e.Description = unescapeText(p.value)
+	case "LOCATION":
+		e.Location = unescapeText(p.value)
+	case "URL":
+		e.URL = p.value
+	case "STATUS":
+		e.Status = strings.ToUpper(p.value)
+	case "TRANSP":
+		e.Transparent = strings.EqualFold(p.value, "TRANSPARENT")
+	case "SEQUENCE":
+		e.Sequence, _ = strconv.Atoi(p.value)
+	case "DTSTAMP":
+		e.Stamp, _, err = parseTime(p, loc)
+	case "DTSTART":
+		e.Start, e.AllDay, err = parseTime(p, loc)
+	case "DTEND":
+		var end time.Time
+		end, _, err = parseTime(p, loc)
+		e.End = &end
+	case "DURATION":
+		var d time.Duration
+		d, err = parseDuration(p.value)
+		r.duration = &d
+	case "RRULE":
+		e.RRule = p.value
+	case "EXDATE":
+		for _, v := range strings.Split(p.value, ",") {
+			var t time.Time
+			if t, _, err = parseTime(property{params: p.params, value: v}, loc); err != nil {
+				break
+			}
+			e.ExDates = append(e.ExDates, t)
+		}
+	case "RECURRENCE-ID":
+		var t time.Time
+		t, _, err = parseTime(p, loc)
+		r.recurrenceID = &t
+	}
+	return err
+}
+
+// finish checks the event and works out its end: DTEND, DTSTART + DURATION, or the
+// next day for all-day events
+func (r *eventReader) finish() (Event, error) {
+	e := r.event
+	if e.Start.IsZero() {
+		return e, errors.New("event without DTSTART")
+	}
+	if r.duration != nil {
+		end := e.Start.Add(*r.duration)
+		e.End = &end
+	}
+	if e.End == nil && e.AllDay {
+		end := e.Start.AddDate(0, 0, 1)
+		e.End = &end
+	}
+	if e.End != nil && e.End.Before(e.Start) {
+		e.End = nil
+	}
+	return e, nil
+}
+
+// unfold reads the content lines, joining the continuation lines. LF line endings are
+// accepted as well as CRLF.
+func unfold(r io.Reader) ([]string, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	var lines []string
+	for scanner.Scan() {
+		line := strings.TrimSuffix(scanner.Text(), "\r")
+		if (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) && len(lines) > 0 {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return lines, scanner.Err()
+}
+
+// parseLine splits a content line into its name, parameters and value
+func parseLine(line string) (property, error) {
+	p := property{params: map[string]string{}}
+
+	// The value starts at the first colon outside a quoted parameter value
+	quoted := false
+	colon := -1
+	for i := 0; i < len(line) && colon < 0; i++ {
+		switch line[i] {
+		case '"':
+			quoted = !quoted
+		case ':':
+			if !quoted {
+				colon = i
+			}
+		}
+	}
+	if colon < 0 {
+		return p, errors.New("missing value")
+	}
+	p.value = line[colon+1:]
+
+	parts := splitParams(line[:colon])
+	p.name = strings.ToUpper(parts[0])
+	if p.name == "" {
+		return p, errors.New("missing property name")
+	}
+	for _, param := range parts[1:] {
+		name, value, _ := strings.Cut(param, "=")
+		p.params[strings.ToUpper(name)] = strings.Trim(value, `"`)
+	}
+	return p, nil
+}
+
+// splitParams splits "NAME;A=1;B="x;y"" on the semicolons outside quotes
+func splitParams(s string) []string {
+	var parts []string
+	quoted := false
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '"':
+			quoted = !quoted
+		case ';':
+			if !quoted {
+				parts = append(parts, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(parts, s[start:])
+}
+
+// parseTime reads a DATE or DATE-TIME value. Dates are midnight in loc.
+func parseTime(p property, loc *time.Location) (t time.Time, allDay bool, err error) {
+	value := strings.TrimSpace(p.value)
+	if strings.EqualFold(p.params["VALUE"], "DATE") || len(value) == len(dateLayout) {
+		t, err = time.ParseInLocation(dateLayout, value, loc)
+		return t, true, err
+	}
+	if strings.HasSuffix(value, "Z") {
+		t, err = time.Parse(timeLayout, value)
+		return t, false, err
+	}
+
+	zone := loc
+	if tzid := strings.TrimPrefix(p.params["TZID"], "/"); tzid != "" {
+		if l, err := time.LoadLocation(tzid); err == nil {
+			zone = l
+		}
+	}
+	t, err = time.ParseInLocation(localTimeLayout, value, zone)
+	return t, false, err
+}
+
+// parseDuration reads a DURATION value: P1W, P1DT2H, PT30M, -PT15M...
+func parseDuration(s string) (time.Duration, error) {
+	sign := time.Duration(1)
+	switch {
+	case strings.HasPrefix(s, "-"):
+		sign, s = -1, s[1:]
+	case strings.HasPrefix(s, "+"):
+		s = s[1:]
+	}
+	if !strings.HasPrefix(s, "P") || len(s) < 3 {
+		return 0, fmt.Errorf("invalid duration %q", s)
+	}
+
+	var d time.Duration
+	inTime := false
+	n := 0
+	digits := false
+	for _, r := range s[1:] {
+		switch {
+		case r >= '0' && r <= '9':
+			n = n*10 + int(r-'0')
+			digits = true
+			continue
+		case r == 'T':
+			inTime = true
+			continue
+		}
+		if !digits {
+			return 0, fmt.Errorf("invalid duration %q", s)
+		}
+		var unit time.Duration
+		switch {
+		case !inTime && r == 'W':
+			unit = 7 * 24 * time.Hour
+		case !inTime && r == 'D':
+			unit = 24 * time.Hour
+		case inTime && r == 'H':
+			unit = time.Hour
+		case inTime && r == 'M':
+			unit = time.Minute
+		case inTime && r == 'S':
+			unit = time.Second
+		default:
+			return 0, fmt.Errorf("invalid duration %q", s)
+		}
+		d += time.Duration(n) * unit
+		n, digits = 0, false
+	}
+	if digits {
+		return 0, fmt.Errorf("invalid duration %q", s)
+	}
+	return sign * d, nil
+}
+
+// unescapeText reverses EscapeText
+func unescapeText(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var b strings.Builder
+	escaped := false
+	for _, r := range s {
+		switch {
+		case escaped && (r == 'n' || r == 'N'):
+			b.WriteByte('\n')
+		case escaped:
+			b.WriteRune(r)
+		case r == '\\':
+			escaped = true
+			continue
+		default:
+			b.WriteRune(r)
+		}
+		escaped = false
+	}
+	return b.String()
+}
@@ -0,0 +1,236 @@
+package ical
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const sampleCalendar = "BEGIN:VCALENDAR\r\n" +
+	"VERSION:2.0\r\n" +
+	"PRODID:-//Test//EN\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"UID:standup@test\r\n" +
+	"DTSTART;TZID=Europe/Paris:20260302T093000\r\n" +
+	"DURATION:PT15M\r\n" +
+	"RRULE:FREQ=WEEKLY;BYDAY=MO,WE,FR;COUNT=6\r\n" +
+	"EXDATE;TZID=Europe/Paris:20260304T093000\r\n" +
+	"SUMMARY:Stand-up\\, équipe\r\n" +
+	"BEGIN:VALARM\r\n" +
+	"ACTION:DISPLAY\r\n" +
+	"DESCRIPTION:Rappel\r\n" +
+	"END:VALARM\r\n" +
+	"END:VEVENT\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"UID:standup@test\r\n" +
+	"RECURRENCE-ID;TZID=Europe/Paris:20260306T093000\r\n" +
+	"DTSTART;TZID=Europe/Paris:20260306T140000\r\n" +
+	"DTEND;TZID=Europe/Paris:20260306T141500\r\n" +
+	"SUMMARY:Stand-up décalé\r\n" +
+	"END:VEVENT\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"UID:holiday@test\r\n" +
+	"DTSTART;VALUE=DATE:20260309\r\n" +
+	"SUMMARY:Congés\r\n" +
+	"TRANSP:TRANSPARENT\r\n" +
+	"DESCRIPTION:Une description pliée sur \r\n" +
+	" deux lignes\r\n" +
+	"END:VEVENT\r\n" +
+	"END:VCALENDAR\r\n"
+
+func TestParse(t *testing.T) {
+	events, err := Parse(strings.NewReader(sampleCalendar), time.UTC)
+	require.NoError(t, err)
+	require.Len(t, events, 3)
+
+	paris, err := time.LoadLocation("Europe/Paris")
+	require.NoError(t, err)
+
+	standup := events[0]
+	assert.Equal(t, "Stand-up, équipe", standup.Summary)
+	assert.True(t, standup.Start.Equal(time.Date(2026, 3, 2, 9, 30, 0, 0, paris)))
+	require.NotNil(t, standup.End)
+	assert.Equal(t, 15*time.Minute, standup.End.Sub(standup.Start))
+	assert.Equal(t, "FREQ=WEEKLY;BYDAY=MO,WE,FR;COUNT=6", standup.RRule)
+	assert.Len(t, standup.ExDates, 2, "EXDATE and the RECURRENCE-ID override")
+	assert.Empty(t, standup.Description, "alarm properties are ignored")
+
+	moved := events[1]
+	assert.Equal(t, "Stand-up décalé", moved.Summary)
+	assert.True(t, moved.Start.Equal(time.Date(2026, 3, 6, 14, 0, 0, 0, paris)))
+
+	holiday := events[2]
+	assert.True(t, holiday.AllDay)
+	assert.True(t, holiday.Transparent)
+	assert.Equal(t, time.Date(2026, 3, 9, 0, 0, 0, 0, time.UTC), holiday.Start)
+	require.NotNil(t, holiday.End)
+	assert.Equal(t, time.Date(2026, 3, 10, 0, 0, 0, 0, time.UTC), *holiday.End)
+	assert.Equal(t, "Une description pliée sur deux lignes", holiday.Description)
+}
+
+func TestParseRoundTrip(t *testing.T) {
+	start := time.Date(2026, 3, 14, 18, 30, 0, 0, time.UTC)
+	end := start.Add(90 * time.Minute)
+	cal := Calendar{ProdID: "-//Test//EN", Events: []Event{{
+		UID:         "1@test",
+		Start:       start,
+		End:         &end,
+		Summary:     "Apéro, enfin; vraiment",
+		Description: strings.Repeat("Ligne\n", 30),
+		Status:      StatusTentative,
+	}}}
+
+	events, err := Parse(strings.NewReader(string(cal.Bytes())), time.UTC)
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	assert.Equal(t, "1@test", events[0].UID)
+	assert.Equal(t, start, events[0].Start)
+	assert.Equal(t, end, *events[0].End)
+	assert.Equal(t, cal.Events[0].Summary, events[0].Summary)
+	assert.Equal(t, cal.Events[0].Description, events[0].Description)
+	assert.Equal(t, StatusTentative, events[0].Status)
+}
+
+func TestParseErrors(t *testing.T) {
+	_, err := Parse(strings.NewReader("not a calendar"), time.UTC)
+	assert.Error(t, err)
+
+	_, err = Parse(strings.NewReader("BEGIN:VEVENT\r\nEND:VEVENT\r\n"), time.UTC)
+	assert.ErrorIs(t, err, ErrNoCalendar)
+
+	_, err = Parse(strings.NewReader("BEGIN:VCALENDAR\r\nBEGIN:VEVENT\r\n"), time.UTC)
+	assert.ErrorIs(t, err, ErrNoCalendar)
+
+	_, err = Parse(strings.NewReader("BEGIN:VCALENDAR\r\nBEGIN:VEVENT\r\nSUMMARY:x\r\nEND:VEVENT\r\nEND:VCALENDAR\r\n"), time.UTC)
+	assert.ErrorContains(t, err, "DTSTART")
+}
+
+func TestParseDuration(t *testing.T) {
+	for value, want := range map[string]time.Duration{
+		"PT15M":    15 * time.Minute,
+		"P1DT2H":   26 * time.Hour,
+		"P1W":      7 * 24 * time.Hour,
+		"-PT1H30M": -90 * time.Minute,
+	} {
+		d, err := parseDuration(value)
+		assert.NoError(t, err, value)
+		assert.Equal(t, want, d, value)
+	}
+	for _, value := range []string{"", "P", "PT", "15M", "P1H", "PT1D", "PT5"} {
+		_, err := parseDuration(value)
+		assert.Error(t, err, value)
+	}
+}
+
+func TestOccurrences(t *testing.T) {
+	events, err := Parse(strings.NewReader(sampleCalendar), time.UTC)
+	require.NoError(t, err)
+
+	from := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC)
+	var days []int
+	for _, o := range events[0].Occurrences(from, to, 100) {
+		assert.Empty(t, o.RRule)
+		assert.Equal(t, 15*time.Minute, o.End.Sub(o.Start))
+		days = append(days, o.Start.Day())
+	}
+	// COUNT=6 from Monday March 2nd, without the 4th (EXDATE) and the 6th (moved)
+	assert.Equal(t, []int{2, 9, 11, 13}, days)
+
+	// Only the instances overlapping the range, up to the limit
+	mar10 := time.Date(2026, 3, 10, 0, 0, 0, 0, time.UTC)
+	assert.Len(t, events[0].Occurrences(mar10, to, 100), 2)
+	assert.Len(t, events[0].Occurrences(from, to, 1), 1)
+
+	// A single event is its only instance
+	assert.Len(t, events[2].Occurrences(from, to, 100), 1)
+	assert.Empty(t, events[2].Occurrences(mar10, to, 100))
+}
+
+func TestOccurrencesRules(t *testing.T) {
+	paris, err := time.LoadLocation("Europe/Paris")
+	require.NoError(t, err)
+	from := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC)
+	starts := func(e Event) []string {
+		var out []string
+		for _, o := range e.Occurrences(from, to, 1000) {
+			out = append(out, o.Start.Format("01-02 15:04"))
+		}
+		return out
+	}
+
+	// Monthly on the 31st skips the shorter months
+	monthly := Event{Start: time.Date(2026, 1, 31, 10, 0, 0, 0, paris), RRule: "FREQ=MONTHLY;COUNT=4"}
+	assert.Equal(t, []string{"01-31 10:00", "03-31 10:00", "05-31 10:00", "07-31 10:00"}, starts(monthly))
+
+	// The wall clock time is kept across the change to summer time
+	daily := Event{Start: time.Date(2026, 3, 28, 10, 0, 0, 0, paris), RRule: "FREQ=DAILY;INTERVAL=1;UNTIL=20260330T235959Z"}
+	assert.Equal(t, []string{"03-28 10:00", "03-29 10:00", "03-30 10:00"}, starts(daily))
+
+	biweekly := Event{Start: time.Date(2026, 12, 1, 8, 0, 0, 0, time.UTC), RRule: "FREQ=WEEKLY;INTERVAL=2"}
+	assert.Equal(t, []string{"12-01 08:00", "12-15 08:00", "12-29 08:00"}, starts(biweekly))
+
+	// Rules that are not supported only give the first instance
+	unsupported := Event{Start: time.Date(2026, 1, 5, 8, 0, 0, 0, time.UTC), RRule: "FREQ=MONTHLY;BYDAY=1MO"}
+	assert.Equal(t, []string{"01-05 08:00"}, starts(unsupported))
+}
+
+func TestEncodeAllDayAndRecurrence(t *testing.T) {
+	start := time.Date(2026, 3, 9, 0, 0, 0, 0, time.UTC)
+	end := start.AddDate(0, 0, 1)
+	cal := Calendar{ProdID: "-//Test//EN", Events: []Event{{
+		UID:         "1@test",
+		Start:       start,
+		End:         &end,
+		AllDay:      true,
+		Transparent: true,
+		RRule:       "FREQ=YEARLY",
+		ExDates:     []time.Time{start.AddDate(1, 0, 0)},
+	}}}
+
+	ics := string(cal.Bytes())
+	for _, line := range []string{
+		"DTSTART;VALUE=DATE:20260309",
+		"DTEND;VALUE=DATE:20260310",
+		"RRULE:FREQ=YEARLY",
+		"EXDATE;VALUE=DATE:20270309",
+		"TRANSP:TRANSPARENT",
+	} {
+		assert.Contains(t, ics, "\r\n"+line+"\r\n")
+	}
+
+	events, err := Parse(strings.NewReader(ics), time.UTC)
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	assert.True(t, events[0].AllDay)
+	assert.Len(t, events[0].Occurrences(start, start.AddDate(3, 0, 0), 10), 2)
+}
+
+func TestParseFreeBusy(t *testing.T) {
+	data := "BEGIN:VCALENDAR\r\n" +
+		"VERSION:2.0\r\n" +
+		"BEGIN:VFREEBUSY\r\n" +
+		"DTSTART:20260301T000000Z\r\n" +
+		"DTEND:20260401T000000Z\r\n" +
+		"FREEBUSY:20260302T090000Z/20260302T100000Z,20260303T090000Z/PT30M\r\n" +
+		"FREEBUSY;FBTYPE=BUSY-TENTATIVE:20260304T140000Z/20260304T150000Z\r\n" +
+		"FREEBUSY;FBTYPE=FREE:20260305T090000Z/20260305T170000Z\r\n" +
+		"END:VFREEBUSY\r\n" +
+		"END:VCALENDAR\r\n"
+
+	periods, err := ParseFreeBusy(strings.NewReader(data))
+	require.NoError(t, err)
+	at := func(day, hour, min int) time.Time { return time.Date(2026, 3, day, hour, min, 0, 0, time.UTC) }
+	assert.Equal(t, []Period{
+		{Start: at(2, 9, 0), End: at(2, 10, 0)},
+		{Start: at(3, 9, 0), End: at(3, 9, 30)},
+		{Start: at(4, 14, 0), End: at(4, 15, 0)},
+	}, periods)
+
+	_, err = ParseFreeBusy(strings.NewReader("BEGIN:VCALENDAR\r\nBEGIN:VFREEBUSY\r\nFREEBUSY:20260302T090000Z\r\nEND:VFREEBUSY\r\nEND:VCALENDAR\r\n"))
+	assert.Error(t, err)
+}
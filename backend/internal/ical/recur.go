@@ -0,0 +1,187 @@
+package ical
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxRecurrences bounds the instances generated for one event, whatever its rule
+const maxRecurrences = 100000
+
+// weekdays maps the BYDAY codes of a RRULE
+var weekdays = map[string]time.Weekday{
+	"MO": time.Monday, "TU": time.Tuesday, "WE": time.Wednesday, "TH": time.Thursday,
+	"FR": time.Friday, "SA": time.Saturday, "SU": time.Sunday,
+}
+
+// rule is the subset of RRULE supported: FREQ with INTERVAL, COUNT, UNTIL, and a
+// plain list of week days for weekly rules
+type rule struct {
+	freq     string
+	interval int
+	count    int
+	until    *time.Time
+	byDay    []time.Weekday
+}
+
+// parseRule reads a RRULE value, false when it uses parts that are not supported
+func parseRule(value string, loc *time.Location) (rule, bool) {
+	r := rule{interval: 1}
+	for _, part := range strings.Split(value, ";") {
+		name, v, _ := strings.Cut(part, "=")
+		var err error
+		switch strings.ToUpper(name) {
+		case "FREQ":
+			r.freq = strings.ToUpper(v)
+		case "INTERVAL":
+			r.interval, err = strconv.Atoi(v)
+			if r.interval < 1 {
+				return r, false
+			}
+		case "COUNT":
+			r.count, err = strconv.Atoi(v)
+		case "UNTIL":
+			var t time.Time
+			t, _, err = parseTime(property{value: v}, loc)
+			r.until = &t
+		case "BYDAY":
+			for _, day := range strings.Split(strings.ToUpper(v), ",") {
+				weekday, ok := weekdays[day]
+				if !ok {
+					return r, false // Ordinal days ("1MO", "-1FR")
+				}
+				r.byDay = append(r.byDay, weekday)
+			}
+		case "WKST":
+		default:
+			return r, false
+		}
+		if err != nil {
+			return r, false
+		}
+	}
+
+	// Days of the week in the order they come, from Monday
+	sort.Slice(r.byDay, func(i, j int) bool {
+		return (r.byDay[i]+6)%7 < (r.byDay[j]+6)%7
+	})
+
+	switch r.freq {
+	case "WEEKLY":
+	case "DAILY", "MONTHLY", "YEARLY":
+		if len(r.byDay) > 0 {
+			return r, false
+		}
+	default:
+		return r, false
+	}
+	return r, true
+}
+
+// Occurrences returns the instances of the event that overlap [from, to), at most limit
+// of them. The instances of a recurring event are copies of it without RRULE, moved to
+// their start. Rules this package does not understand only give the first instance.
+func (e Event) Occurrences(from, to time.Time, limit int) []Event {
+	var duration time.Duration
+	if e.End != nil {
+		duration = e.End.Sub(e.Start)
+	}
+
+	var out []Event
+	add := func(start time.Time) bool {
+		for _, ex := range e.ExDates {
+			if ex.Equal(start) {
+				return true
+			}
+		}
+		end := start.Add(duration)
+		if start.Before(to) && (end.After(from) || !start.Before(from)) {
+			occurrence := e
+			occurrence.Start = start
+			if e.End != nil {
+				occurrence.End = &end
+			}
+			occurrence.RRule = ""
+			occurrence.ExDates = nil
+			out = append(out, occurrence)
+		}
+		return len(out) < limit
+	}
+
+	r, ok := parseRule(e.RRule, e.Start.Location())
+	if e.RRule == "" || !ok {
+		add(e.Start)
+		return out
+	}
+
+	generated := 0
+	for start := range r.starts(e.Start) {
+		if generated >= maxRecurrences || !start.Before(to) {
+			break
+		}
+		if r.until != nil && start.After(*r.until) {
+			break
+		}
+		if r.count > 0 && generated >= r.count {
+			break
+		}
+		generated++
+		if !add(start) {
+			break
+		}
+	}
+	return out
+}
+
+// starts yields the starts of the instances of a rule, in order from the first one.
+// Wall clock times are kept across DST changes, and instances on days a month does not
+// have (the 31st, February 29th) are skipped.
+func (r rule) starts(first time.Time) func(yield func(time.Time) bool) {
+	return func(yield func(time.Time) bool) {
+		y, m, d := first.Date()
+		hour, min, sec := first.Clock()
+		loc := first.Location()
+		at := func(y int, m time.Month, d int) time.Time {
+			return time.Date(y, m, d, hour, min, sec, first.Nanosecond(), loc)
+		}
+
+		if r.freq == "WEEKLY" && len(r.byDay) > 0 {
+			// Weeks start on Monday, the default WKST
+			monday := d - (int(first.Weekday())+6)%7
+			for week := 0; week < maxRecurrences; week += r.interval {
+				for _, weekday := range r.byDay {
+					start := at(y, m, monday+7*week+(int(weekday)+6)%7)
+					if start.Before(first) {
+						continue
+					}
+					if !yield(start) {
+						return
+					}
+				}
+			}
+			return
+		}
+
+		for n := 0; n < maxRecurrences; n++ {
+			var start time.Time
+			switch r.freq {
+			case "DAILY":
+				start = at(y, m, d+n*r.interval)
+			case "WEEKLY":
+				start = at(y, m, d+7*n*r.interval)
+			case "MONTHLY":
+				start = at(y, m+time.Month(n*r.interval), d)
+			case "YEARLY":
+				start = at(y+n*r.interval, m, d)
+			}
+			if start.Day() != d && (r.freq == "MONTHLY" || r.freq == "YEARLY") {
+				continue
+			}
+			if !yield(start) {
+				return
+			}
+		}
+	}
+}
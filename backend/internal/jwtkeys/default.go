@@ -0,0 +1,63 @@
+package jwtkeys
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"doodle-clone/internal/config"
+)
+
+var (
+	defaultMu  sync.Mutex
+	defaultSet *KeySet
+)
+
+// Init loads the application key set from config.AppConfig.JWTKeysDir.
+// Without a key directory an ephemeral key is generated, which is refused in production.
+// HS256 tokens signed with JWTSecret keep being accepted until JWTLegacyHS256Until.
+func Init() error {
+	var ks *KeySet
+	var err error
+	if dir := config.AppConfig.JWTKeysDir; dir != "" {
+		ks, err = LoadDir(dir, config.AppConfig.JWTActiveKID)
+		if err != nil {
+			return err
+		}
+		log.Printf("Loaded JWT signing keys from %s (active kid: %s)", dir, ks.ActiveKID())
+	} else {
+		ks, err = Generate()
+		if err != nil {
+			return err
+		}
+		log.Printf("Warning: JWT_KEYS_DIR not set, signing tokens with ephemeral key %s", ks.ActiveKID())
+	}
+
+	if until := config.AppConfig.JWTLegacyHS256Until; until.After(time.Now()) {
+		ks.SetLegacySecret(config.AppConfig.JWTSecret, until)
+		log.Printf("Warning: accepting legacy HS256 tokens signed with JWT_SECRET until %s", until.Format(time.RFC3339))
+	} else if !until.IsZero() {
+		log.Printf("JWT_LEGACY_HS256_UNTIL has passed (%s), legacy HS256 tokens are rejected", until.Format(time.RFC3339))
+	}
+
+	defaultMu.Lock()
+	defaultSet = ks
+	defaultMu.Unlock()
+	return nil
+}
+
+// Default returns the application key set, generating an ephemeral one
+// if Init was never called (tests)
+func Default() *KeySet {
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+
+	if defaultSet == nil {
+		ks, err := Generate()
+		if err != nil {
+			panic("jwtkeys: " + err.Error())
+		}
+		defaultSet = ks
+	}
+	return defaultSet
+}
@@ -0,0 +1,293 @@
+package jwtkeys
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Key is a signing or verification key identified by its kid
+type Key struct {
+	ID         string
+	Method     jwt.SigningMethod
+	PrivateKey crypto.Signer // nil for verification-only (retired) keys
+	PublicKey  crypto.PublicKey
+}
+
+// KeySet holds the keys used to sign and verify access tokens.
+// Tokens are signed with the active key; every key in the set is accepted for verification
+// so that tokens issued before a rotation stay valid until they expire.
+type KeySet struct {
+	mu     sync.RWMutex
+	keys   map[string]*Key
+	active string
+
+	// legacySecret verifies HS256 tokens issued before asymmetric signing, if set,
+	// until legacyUntil
+	legacySecret []byte
+	legacyUntil  time.Time
+}
+
+// JWK is the public part of a key as published in the JWKS document
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+// JWKS is a JSON Web Key Set document
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+var (
+	ErrUnknownKey     = errors.New("unknown signing key")
+	ErrUnexpectedAlg  = errors.New("unexpected signing method")
+	ErrNoActiveKey    = errors.New("no active signing key")
+	ErrUnsupportedKey = errors.New("unsupported key type")
+)
+
+// NewKeySet creates an empty key set
+func NewKeySet() *KeySet {
+	return &KeySet{keys: make(map[string]*Key)}
+}
+
+// Generate creates a key set with a single random Ed25519 key.
+// Tokens signed with it do not survive a restart, so it is only meant for development and tests.
+func Generate() (*KeySet, error) {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	ks := NewKeySet()
+	if err := ks.Add("dev-"+randomKID(), priv); err != nil {
+		return nil, err
+	}
+	return ks, nil
+}
+
+// LoadDir loads every *.pem file of dir into a key set. The kid of a key is its file name
+// without extension. Private keys (PKCS#8, or PKCS#1 for RSA) can sign; public keys (PKIX)
+// are kept for verification only, which is how retired keys are phased out.
+// activeKID selects the signing key; when empty, the last private key by name is used.
+func LoadDir(dir, activeKID string) (*KeySet, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+
+	ks := NewKeySet()
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		key, err := parsePEM(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", filepath.Base(file), err)
+		}
+		kid := strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))
+		if err := ks.Add(kid, key); err != nil {
+			return nil, fmt.Errorf("%s: %w", filepath.Base(file), err)
+		}
+	}
+
+	if activeKID == "" {
+		// Key files are named so that the newest sorts last (e.g. 2025-01.pem)
+		for _, file := range files {
+			kid := strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))
+			if ks.keys[kid].PrivateKey != nil {
+				activeKID = kid
+			}
+		}
+	}
+	if activeKID != "" {
+		if err := ks.SetActive(activeKID); err != nil {
+			return nil, err
+		}
+	}
+	if ks.active == "" {
+		return nil, fmt.Errorf("no private key found in %s", dir)
+	}
+	return ks, nil
+}
+
+func parsePEM(data []byte) (any, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+
+	switch block.Type {
+	case "PRIVATE KEY":
+		return x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		return x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block %q", block.Type)
+	}
+}
+
+// Add registers a private (crypto.Signer) or public key under kid.
+// The first private key added becomes the active one.
+func (ks *KeySet) Add(kid string, key any) error {
+	k := &Key{ID: kid}
+
+	switch v := key.(type) {
+	case *rsa.PrivateKey:
+		k.Method, k.PrivateKey, k.PublicKey = jwt.SigningMethodRS256, v, &v.PublicKey
+	case ed25519.PrivateKey:
+		k.Method, k.PrivateKey, k.PublicKey = jwt.SigningMethodEdDSA, v, v.Public()
+	case *rsa.PublicKey:
+		k.Method, k.PublicKey = jwt.SigningMethodRS256, v
+	case ed25519.PublicKey:
+		k.Method, k.PublicKey = jwt.SigningMethodEdDSA, v
+	case *ecdsa.PrivateKey, *ecdsa.PublicKey:
+		return fmt.Errorf("%w: use RSA or Ed25519", ErrUnsupportedKey)
+	default:
+		return ErrUnsupportedKey
+	}
+
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	ks.keys[kid] = k
+	if ks.active == "" && k.PrivateKey != nil {
+		ks.active = kid
+	}
+	return nil
+}
+
+// SetActive selects the key used to sign new tokens
+func (ks *KeySet) SetActive(kid string) error {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+
+	k, ok := ks.keys[kid]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownKey, kid)
+	}
+	if k.PrivateKey == nil {
+		return fmt.Errorf("key %s has no private part and cannot sign", kid)
+	}
+	ks.active = kid
+	return nil
+}
+
+// ActiveKID returns the kid of the signing key
+func (ks *KeySet) ActiveKID() string {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+	return ks.active
+}
+
+// SetLegacySecret accepts HS256 tokens signed with secret until the given time.
+// An empty secret disables them.
+func (ks *KeySet) SetLegacySecret(secret string, until time.Time) {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	if secret == "" {
+		ks.legacySecret = nil
+		return
+	}
+	ks.legacySecret = []byte(secret)
+	ks.legacyUntil = until
+}
+
+// Sign signs claims with the active key and sets the kid header
+func (ks *KeySet) Sign(claims jwt.Claims) (string, error) {
+	ks.mu.RLock()
+	k, ok := ks.keys[ks.active]
+	ks.mu.RUnlock()
+	if !ok {
+		return "", ErrNoActiveKey
+	}
+
+	token := jwt.NewWithClaims(k.Method, claims)
+	token.Header["kid"] = k.ID
+	return token.SignedString(k.PrivateKey)
+}
+
+// Keyfunc resolves the verification key of a token from its kid header.
+// It is meant to be passed to jwt.Parse.
+func (ks *KeySet) Keyfunc(token *jwt.Token) (interface{}, error) {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+
+	if _, ok := token.Method.(*jwt.SigningMethodHMAC); ok {
+		if ks.legacySecret == nil || token.Method != jwt.SigningMethodHS256 || !time.Now().Before(ks.legacyUntil) {
+			return nil, ErrUnexpectedAlg
+		}
+		return ks.legacySecret, nil
+	}
+
+	kid, _ := token.Header["kid"].(string)
+	k, ok := ks.keys[kid]
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+	// Never let the token pick the algorithm of our key
+	if token.Method.Alg() != k.Method.Alg() {
+		return nil, ErrUnexpectedAlg
+	}
+	return k.PublicKey, nil
+}
+
+// Parse verifies tokenString and decodes it into claims
+func (ks *KeySet) Parse(tokenString string, claims jwt.Claims) (*jwt.Token, error) {
+	return jwt.ParseWithClaims(tokenString, claims, ks.Keyfunc,
+		jwt.WithValidMethods([]string{"RS256", "EdDSA", "HS256"}))
+}
+
+// JWKS returns the public keys of the set, sorted by kid
+func (ks *KeySet) JWKS() JWKS {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+
+	doc := JWKS{Keys: make([]JWK, 0, len(ks.keys))}
+	for _, k := range ks.keys {
+		jwk := JWK{Kid: k.ID, Use: "sig", Alg: k.Method.Alg()}
+		switch pub := k.PublicKey.(type) {
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.Kty = "OKP"
+			jwk.Crv = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(pub)
+		}
+		doc.Keys = append(doc.Keys, jwk)
+	}
+	sort.Slice(doc.Keys, func(i, j int) bool { return doc.Keys[i].Kid < doc.Keys[j].Kid })
+	return doc
+}
+
+func randomKID() string {
+	b := make([]byte, 6)
+	_, _ = rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
@@ -0,0 +1,167 @@
+package jwtkeys
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writePEM(t *testing.T, dir, name, blockType string, der []byte) {
+	t.Helper()
+	data := pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der})
+	require.NoError(t, os.WriteFile(filepath.Join(dir, name), data, 0600))
+}
+
+func TestKeySet_SignAndParse(t *testing.T) {
+	ks, err := Generate()
+	require.NoError(t, err)
+
+	token, err := ks.Sign(jwt.MapClaims{"sub": "alice"})
+	require.NoError(t, err)
+
+	claims := jwt.MapClaims{}
+	parsed, err := ks.Parse(token, claims)
+	require.NoError(t, err)
+	assert.True(t, parsed.Valid)
+	assert.Equal(t, ks.ActiveKID(), parsed.Header["kid"])
+	assert.Equal(t, "EdDSA", parsed.Method.Alg())
+	assert.Equal(t, "alice", claims["sub"])
+}
+
+func TestKeySet_Rotation(t *testing.T) {
+	ks := NewKeySet()
+	_, oldKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	newKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	require.NoError(t, ks.Add("old", oldKey))
+	oldToken, err := ks.Sign(jwt.MapClaims{"sub": "alice"})
+	require.NoError(t, err)
+
+	require.NoError(t, ks.Add("new", newKey))
+	require.NoError(t, ks.SetActive("new"))
+	newToken, err := ks.Sign(jwt.MapClaims{"sub": "bob"})
+	require.NoError(t, err)
+
+	t.Run("Both keys verify", func(t *testing.T) {
+		_, err := ks.Parse(oldToken, jwt.MapClaims{})
+		assert.NoError(t, err)
+		parsed, err := ks.Parse(newToken, jwt.MapClaims{})
+		require.NoError(t, err)
+		assert.Equal(t, "RS256", parsed.Method.Alg())
+	})
+
+	t.Run("JWKS lists both keys", func(t *testing.T) {
+		doc := ks.JWKS()
+		require.Len(t, doc.Keys, 2)
+		assert.Equal(t, "new", doc.Keys[0].Kid)
+		assert.Equal(t, "RSA", doc.Keys[0].Kty)
+		assert.NotEmpty(t, doc.Keys[0].N)
+		assert.Equal(t, "AQAB", doc.Keys[0].E)
+		assert.Equal(t, "old", doc.Keys[1].Kid)
+		assert.Equal(t, "OKP", doc.Keys[1].Kty)
+		assert.Equal(t, "Ed25519", doc.Keys[1].Crv)
+	})
+
+	t.Run("Unknown kid is rejected", func(t *testing.T) {
+		other, err := Generate()
+		require.NoError(t, err)
+		token, err := other.Sign(jwt.MapClaims{"sub": "mallory"})
+		require.NoError(t, err)
+		_, err = ks.Parse(token, jwt.MapClaims{})
+		assert.ErrorIs(t, err, ErrUnknownKey)
+	})
+}
+
+func TestKeySet_LegacyHS256(t *testing.T) {
+	ks, err := Generate()
+	require.NoError(t, err)
+
+	legacy, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"sub": "alice"}).SignedString([]byte("secret"))
+	require.NoError(t, err)
+
+	_, err = ks.Parse(legacy, jwt.MapClaims{})
+	assert.Error(t, err, "HS256 must be rejected without a legacy secret")
+
+	ks.SetLegacySecret("secret", time.Now().Add(time.Hour))
+	_, err = ks.Parse(legacy, jwt.MapClaims{})
+	assert.NoError(t, err)
+
+	ks.SetLegacySecret("secret", time.Now().Add(-time.Second))
+	_, err = ks.Parse(legacy, jwt.MapClaims{})
+	assert.Error(t, err, "HS256 must be rejected once the migration window is over")
+
+	ks.SetLegacySecret("", time.Now().Add(time.Hour))
+	_, err = ks.Parse(legacy, jwt.MapClaims{})
+	assert.Error(t, err)
+}
+
+func TestKeySet_AlgorithmMismatch(t *testing.T) {
+	ks := NewKeySet()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	require.NoError(t, ks.Add("rsa", key))
+
+	// A token claiming the RSA kid but signed with EdDSA must not verify
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	forged := jwt.NewWithClaims(jwt.SigningMethodEdDSA, jwt.MapClaims{"sub": "mallory"})
+	forged.Header["kid"] = "rsa"
+	token, err := forged.SignedString(edKey)
+	require.NoError(t, err)
+
+	_, err = ks.Parse(token, jwt.MapClaims{})
+	assert.ErrorIs(t, err, ErrUnexpectedAlg)
+}
+
+func TestLoadDir(t *testing.T) {
+	dir := t.TempDir()
+
+	retired, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	pub, err := x509.MarshalPKIXPublicKey(&retired.PublicKey)
+	require.NoError(t, err)
+	writePEM(t, dir, "2024-06.pem", "PUBLIC KEY", pub)
+
+	writePEM(t, dir, "2024-12.pem", "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(retired))
+
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	der, err := x509.MarshalPKCS8PrivateKey(edKey)
+	require.NoError(t, err)
+	writePEM(t, dir, "2025-01.pem", "PRIVATE KEY", der)
+
+	t.Run("Newest private key is active by default", func(t *testing.T) {
+		ks, err := LoadDir(dir, "")
+		require.NoError(t, err)
+		assert.Equal(t, "2025-01", ks.ActiveKID())
+		assert.Len(t, ks.JWKS().Keys, 3)
+	})
+
+	t.Run("Explicit active kid", func(t *testing.T) {
+		ks, err := LoadDir(dir, "2024-12")
+		require.NoError(t, err)
+		assert.Equal(t, "2024-12", ks.ActiveKID())
+	})
+
+	t.Run("Public key cannot be active", func(t *testing.T) {
+		_, err := LoadDir(dir, "2024-06")
+		assert.Error(t, err)
+	})
+
+	t.Run("Empty directory", func(t *testing.T) {
+		_, err := LoadDir(t.TempDir(), "")
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,105 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// asAccessToken authenticates requests as a personal access token with the given
+// scopes, as authenticateAccessToken does after looking the token up
+func asAccessToken(scopes ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set("user_id", uuid.New())
+		c.Set("auth_method", AuthMethodAccessToken)
+		c.Set("token_scopes", scopes)
+		c.Next()
+	}
+}
+
+func TestHashToken(t *testing.T) {
+	hash := HashToken("dpat_secret")
+	assert.Len(t, hash, 64)
+	assert.Equal(t, hash, HashToken("dpat_secret"))
+	assert.NotEqual(t, hash, HashToken("dpat_other"))
+	assert.NotContains(t, hash, "secret")
+}
+
+func TestIsAccessToken(t *testing.T) {
+	assert.True(t, IsAccessToken("dpat_0123456789"))
+	assert.False(t, IsAccessToken("eyJhbGciOiJFZERTQSJ9.e30.sig"))
+	assert.False(t, IsAccessToken(""))
+}
+
+func TestRequireScope(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ok := func(c *gin.Context) { c.String(http.StatusOK, "ok") }
+
+	get := func(auth gin.HandlerFunc, handlers ...gin.HandlerFunc) int {
+		router := gin.New()
+		router.GET("/polls", append([]gin.HandlerFunc{auth}, append(handlers, ok)...)...)
+		req, _ := http.NewRequest("GET", "/polls", nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	t.Run("Access token with the scope", func(t *testing.T) {
+		assert.Equal(t, http.StatusOK, get(asAccessToken("polls:read", "votes:write"), RequireScope("votes:write")))
+	})
+
+	t.Run("Access token missing the scope", func(t *testing.T) {
+		assert.Equal(t, http.StatusForbidden, get(asAccessToken("polls:read"), RequireScope("votes:write")))
+		assert.Equal(t, http.StatusForbidden, get(asAccessToken(), RequireScope("polls:read")))
+	})
+
+	t.Run("Access token on a session route", func(t *testing.T) {
+		assert.Equal(t, http.StatusForbidden, get(asAccessToken("polls:read", "polls:write"), RequireSession()))
+	})
+
+	t.Run("Unauthenticated requests pass through", func(t *testing.T) {
+		noAuth := func(c *gin.Context) { c.Next() }
+		assert.Equal(t, http.StatusOK, get(noAuth, RequireScope("votes:write")))
+	})
+}
+
+func TestRequireScope_SessionToken(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	ok := func(c *gin.Context) { c.String(http.StatusOK, GetAuthMethod(c)) }
+	router.GET("/scoped", Auth(), RequireScope("votes:write"), ok)
+	router.GET("/session", Auth(), RequireSession(), ok)
+
+	session, err := GenerateToken(Claims{
+		UserID:           uuid.New(),
+		SessionID:        uuid.New(),
+		RegisteredClaims: jwt.RegisteredClaims{ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour))},
+	})
+	require.NoError(t, err)
+
+	get := func(path, token string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("GET", path, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	// Interactive sessions are not restricted by scopes
+	for _, path := range []string{"/scoped", "/session"} {
+		w := get(path, session)
+		assert.Equal(t, http.StatusOK, w.Code, path)
+		assert.Equal(t, AuthMethodSession, w.Body.String())
+	}
+
+	// Unknown access tokens are refused before any scope check
+	w := get("/scoped", AccessTokenPrefix+"unknown")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
@@ -0,0 +1,75 @@
+package middleware
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// redactedQueryParams carry credentials in URLs (calendar feed tokens, poll access
+// tokens of event streams, OAuth codes) and are kept out of the access log
+var redactedQueryParams = []string{"token", "poll_access", "code"}
+
+// Logger writes the access log to gin.DefaultWriter, like gin's logger, with the
+// credentials of query strings redacted
+func Logger() gin.HandlerFunc {
+	return LoggerWithWriter(gin.DefaultWriter)
+}
+
+// LoggerWithWriter writes the access log to out
+func LoggerWithWriter(out io.Writer) gin.HandlerFunc {
+	return gin.LoggerWithConfig(gin.LoggerConfig{Output: out, Formatter: logFormatter})
+}
+
+// logFormatter is gin's default format, on the redacted path
+func logFormatter(param gin.LogFormatterParams) string {
+	var statusColor, methodColor, resetColor string
+	if param.IsOutputColor() {
+		statusColor = param.StatusCodeColor()
+		methodColor = param.MethodColor()
+		resetColor = param.ResetColor()
+	}
+
+	if param.Latency > time.Minute {
+		param.Latency = param.Latency.Truncate(time.Second)
+	}
+	return fmt.Sprintf("[GIN] %v |%s %3d %s| %13v | %15s |%s %-7s %s %#v\n%s",
+		param.TimeStamp.Format("2006/01/02 - 15:04:05"),
+		statusColor, param.StatusCode, resetColor,
+		param.Latency,
+		param.ClientIP,
+		methodColor, param.Method, resetColor,
+		redactQuery(param.Path),
+		param.ErrorMessage,
+	)
+}
+
+// redactQuery replaces the values of credential parameters in the query of a path,
+// leaving the rest as is
+func redactQuery(path string) string {
+	base, query, ok := strings.Cut(path, "?")
+	if !ok {
+		return path
+	}
+	pairs := strings.Split(query, "&")
+	for i, pair := range pairs {
+		key, _, _ := strings.Cut(pair, "=")
+		if name, err := url.QueryUnescape(key); err == nil && isRedactedParam(name) {
+			pairs[i] = key + "=REDACTED"
+		}
+	}
+	return base + "?" + strings.Join(pairs, "&")
+}
+
+func isRedactedParam(name string) bool {
+	for _, p := range redactedQueryParams {
+		if p == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,37 @@
+package middleware
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRedactQuery(t *testing.T) {
+	assert.Equal(t, "/api/polls", redactQuery("/api/polls"))
+	assert.Equal(t, "/api/polls?page=2&limit=10", redactQuery("/api/polls?page=2&limit=10"))
+	assert.Equal(t, "/api/user/calendar.ics?token=REDACTED", redactQuery("/api/user/calendar.ics?token=dcal_secret"))
+	assert.Equal(t, "/api/polls/x/events?since=1&poll_access=REDACTED&to%6Ben=REDACTED",
+		redactQuery("/api/polls/x/events?since=1&poll_access=pat_secret&to%6Ben=dcal_secret"))
+	assert.Equal(t, "/auth/google/callback?state=abc&code=REDACTED", redactQuery("/auth/google/callback?state=abc&code=4/secret"))
+}
+
+func TestLogger(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	var out bytes.Buffer
+	router := gin.New()
+	router.Use(LoggerWithWriter(&out))
+	router.GET("/api/user/calendar.ics", func(c *gin.Context) {
+		c.Status(http.StatusUnauthorized)
+	})
+
+	req, _ := http.NewRequest("GET", "/api/user/calendar.ics?token=dcal_secret", nil)
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	assert.Contains(t, out.String(), `"/api/user/calendar.ics?token=REDACTED"`)
+	assert.Contains(t, out.String(), "401")
+	assert.NotContains(t, out.String(), "dcal_secret")
+}
@@ -1,25 +1,27 @@
 package middleware
 
 import (
-	"errors"
 	"net/http"
 	"strings"
-	"sync"
-	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
 	"doodle-clone/internal/config"
+	"doodle-clone/internal/jwtkeys"
 )
 
 // Claims represents JWT claims
 type Claims struct {
-	UserID uuid.UUID `json:"user_id"`
-	Email  string    `json:"email"`
+	UserID    uuid.UUID `json:"user_id"`
+	Email     string    `json:"email"`
+	SessionID uuid.UUID `json:"sid,omitempty"` // Refresh token family the token was issued for
 	jwt.RegisteredClaims
 }
 
+// RegisteredClaims is re-exported so callers building Claims don't need to import jwt
+type RegisteredClaims = jwt.RegisteredClaims
+
 // CORS middleware
 func CORS() gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -45,8 +47,8 @@ func CORS() gin.HandlerFunc {
 
 		c.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
 		c.Writer.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-Requested-With")
-		c.Writer.Header().Set("Access-Control-Expose-Headers", "Content-Length, Content-Type")
+		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-Requested-With, "+PollAccessHeader+", "+RequestIDHeader)
+		c.Writer.Header().Set("Access-Control-Expose-Headers", "Content-Length, Content-Type, RateLimit-Limit, RateLimit-Remaining, RateLimit-Reset, RateLimit-Policy, Retry-After, "+RequestIDHeader)
 
 		if c.Request.Method == "OPTIONS" {
 			c.AbortWithStatus(http.StatusOK)
@@ -57,7 +59,7 @@ func CORS() gin.HandlerFunc {
 	}
 }
 
-// Auth middleware verifies JWT token
+// Auth middleware verifies JWT token or personal access token
 func Auth() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		authHeader := c.GetHeader("Authorization")
@@ -74,12 +76,17 @@ func Auth() gin.HandlerFunc {
 			return
 		}
 
-		token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, errors.New("unexpected signing method")
+		if IsAccessToken(tokenString) {
+			if err := authenticateAccessToken(c, tokenString); err != nil {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired access token"})
+				c.Abort()
+				return
 			}
-			return []byte(config.AppConfig.JWTSecret), nil
-		})
+			c.Next()
+			return
+		}
+
+		token, err := jwtkeys.Default().Parse(tokenString, &Claims{})
 
 		if err != nil || !token.Valid {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired token"})
@@ -87,8 +94,9 @@ func Auth() gin.HandlerFunc {
 			return
 		}
 
+		// Tokens without a user, such as poll access tokens, do not authenticate anyone
 		claims, ok := token.Claims.(*Claims)
-		if !ok {
+		if !ok || claims.UserID == uuid.Nil {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token claims"})
 			c.Abort()
 			return
@@ -96,6 +104,8 @@ func Auth() gin.HandlerFunc {
 
 		c.Set("user_id", claims.UserID)
 		c.Set("user_email", claims.Email)
+		c.Set("session_id", claims.SessionID)
+		c.Set("auth_method", AuthMethodSession)
 		c.Next()
 	}
 }
@@ -115,17 +125,20 @@ func OptionalAuth() gin.HandlerFunc {
 			return
 		}
 
-		token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, errors.New("unexpected signing method")
-			}
-			return []byte(config.AppConfig.JWTSecret), nil
-		})
+		if IsAccessToken(tokenString) {
+			_ = authenticateAccessToken(c, tokenString)
+			c.Next()
+			return
+		}
+
+		token, err := jwtkeys.Default().Parse(tokenString, &Claims{})
 
 		if err == nil && token.Valid {
-			if claims, ok := token.Claims.(*Claims); ok {
+			if claims, ok := token.Claims.(*Claims); ok && claims.UserID != uuid.Nil {
 				c.Set("user_id", claims.UserID)
 				c.Set("user_email", claims.Email)
+				c.Set("session_id", claims.SessionID)
+				c.Set("auth_method", AuthMethodSession)
 			}
 		}
 
@@ -143,6 +156,16 @@ func GetUserID(c *gin.Context) (uuid.UUID, bool) {
 	return uid, ok
 }
 
+// GetSessionID retrieves the session ID of the access token from context
+func GetSessionID(c *gin.Context) uuid.UUID {
+	if sessionID, exists := c.Get("session_id"); exists {
+		if sid, ok := sessionID.(uuid.UUID); ok {
+			return sid
+		}
+	}
+	return uuid.Nil
+}
+
 // RequireAuth is a helper for routes that require authentication
 func RequireAuth() gin.HandlerFunc {
 	return Auth()
@@ -158,68 +181,6 @@ func GetCurrentUser(c *gin.Context) *uuid.UUID {
 	return nil
 }
 
-// RateLimiter is a simple in-memory rate limiter
-type RateLimiter struct {
-	mu       sync.RWMutex
-	visitors map[string][]time.Time
-	limit    int
-	window   time.Duration
-}
-
-// NewRateLimiter creates a new rate limiter
-func NewRateLimiter(limit int, window time.Duration) *RateLimiter {
-	return &RateLimiter{
-		visitors: make(map[string][]time.Time),
-		limit:    limit,
-		window:   window,
-	}
-}
-
-// Allow checks if the request is allowed
-func (rl *RateLimiter) Allow(ip string) bool {
-	rl.mu.Lock()
-	defer rl.mu.Unlock()
-
-	now := time.Now()
-
-	// Clean old entries
-	if visits, exists := rl.visitors[ip]; exists {
-		var valid []time.Time
-		for _, t := range visits {
-			if now.Sub(t) < rl.window {
-				valid = append(valid, t)
-			}
-		}
-		rl.visitors[ip] = valid
-	}
-
-	// Check limit
-	if len(rl.visitors[ip]) >= rl.limit {
-		return false
-	}
-
-	// Add current request
-	rl.visitors[ip] = append(rl.visitors[ip], now)
-	return true
-}
-
-// RateLimit middleware
-func RateLimit(limit int, window time.Duration) gin.HandlerFunc {
-	rl := NewRateLimiter(limit, window)
-
-	return func(c *gin.Context) {
-		ip := c.ClientIP()
-		if !rl.Allow(ip) {
-			c.JSON(http.StatusTooManyRequests, gin.H{
-				"error": "Too many requests. Please try again later.",
-			})
-			c.Abort()
-			return
-		}
-		c.Next()
-	}
-}
-
 // UserContext adds user info to context from database
 // This should be used after Auth middleware
 func UserContext() gin.HandlerFunc {
@@ -257,8 +218,7 @@ func ErrorHandler() gin.HandlerFunc {
 	}
 }
 
-// GenerateToken creates a JWT token for testing purposes
+// GenerateToken signs claims with the active key of the application key set
 func GenerateToken(claims Claims) (string, error) {
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(config.AppConfig.JWTSecret))
+	return jwtkeys.Default().Sign(claims)
 }
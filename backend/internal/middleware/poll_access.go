@@ -0,0 +1,141 @@
+package middleware
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"doodle-clone/internal/config"
+	"doodle-clone/internal/database"
+	"doodle-clone/internal/jwtkeys"
+)
+
+// Poll access tokens are sent in this header, or in the poll_access query parameter
+// for plain links such as exports
+const (
+	PollAccessHeader   = "X-Poll-Access"
+	PollAccessQuery    = "poll_access"
+	PollAccessAudience = "poll-access"
+)
+
+var errInvalidPollAccess = errors.New("invalid or expired poll access token")
+
+// PollAccessClaims are the claims of a token unlocking a password-protected poll
+type PollAccessClaims struct {
+	PollID      uuid.UUID `json:"poll_id"`
+	PasswordTag string    `json:"pwd"` // Changes with the password, revoking older tokens
+	jwt.RegisteredClaims
+}
+
+// passwordTag derives a short tag from a password hash, so that tokens do not
+// outlive a password change
+func passwordTag(passwordHash string) string {
+	sum := sha256.Sum256([]byte(passwordHash))
+	return hex.EncodeToString(sum[:8])
+}
+
+// GeneratePollAccessToken issues a short-lived token unlocking a poll protected by passwordHash
+func GeneratePollAccessToken(pollID uuid.UUID, passwordHash string) (string, time.Time, error) {
+	expiresAt := time.Now().Add(config.AppConfig.PollAccessExpiry)
+	token, err := jwtkeys.Default().Sign(PollAccessClaims{
+		PollID:      pollID,
+		PasswordTag: passwordTag(passwordHash),
+		RegisteredClaims: jwt.RegisteredClaims{
+			Audience:  jwt.ClaimStrings{PollAccessAudience},
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+		},
+	})
+	return token, expiresAt, err
+}
+
+// VerifyPollAccessToken checks that token unlocks the poll with the current passwordHash
+func VerifyPollAccessToken(tokenString string, pollID uuid.UUID, passwordHash string) error {
+	if tokenString == "" {
+		return errInvalidPollAccess
+	}
+
+	claims := &PollAccessClaims{}
+	token, err := jwtkeys.Default().Parse(tokenString, claims)
+	if err != nil || !token.Valid {
+		return errInvalidPollAccess
+	}
+
+	audience, _ := claims.GetAudience()
+	validAudience := false
+	for _, aud := range audience {
+		if aud == PollAccessAudience {
+			validAudience = true
+		}
+	}
+	if !validAudience || claims.ExpiresAt == nil || claims.PollID != pollID || claims.PasswordTag != passwordTag(passwordHash) {
+		return errInvalidPollAccess
+	}
+	return nil
+}
+
+// RequirePollAccess guards the routes of a poll (":id" being its UUID or access code).
+// Polls without a password are let through; password-protected polls require a poll
+// access token, except for their creator. It should come after Auth or OptionalAuth
+// so the creator is recognized. Unknown polls are left to the handler.
+func RequirePollAccess() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if database.Pool == nil {
+			c.Next()
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+		defer cancel()
+
+		query := `SELECT id, creator_id, password_hash FROM polls WHERE access_code = $1`
+		if _, err := uuid.Parse(c.Param("id")); err == nil {
+			query = `SELECT id, creator_id, password_hash FROM polls WHERE id = $1`
+		}
+
+		var pollID uuid.UUID
+		var creatorID *uuid.UUID
+		var passwordHash *string
+		err := database.Pool.QueryRow(ctx, query, c.Param("id")).Scan(&pollID, &creatorID, &passwordHash)
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				c.Next()
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			c.Abort()
+			return
+		}
+
+		if passwordHash == nil {
+			c.Next()
+			return
+		}
+		if userID := GetCurrentUser(c); userID != nil && creatorID != nil && *creatorID == *userID {
+			c.Next()
+			return
+		}
+
+		token := c.GetHeader(PollAccessHeader)
+		if token == "" {
+			token = c.Query(PollAccessQuery)
+		}
+		if err := VerifyPollAccessToken(token, pollID, *passwordHash); err != nil {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error":             "This poll is protected by a password",
+				"password_required": true,
+			})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
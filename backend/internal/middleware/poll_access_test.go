@@ -0,0 +1,71 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"doodle-clone/internal/config"
+	"doodle-clone/internal/jwtkeys"
+)
+
+func TestPollAccessToken(t *testing.T) {
+	if config.AppConfig == nil {
+		config.AppConfig = &config.Config{}
+	}
+	config.AppConfig.PollAccessExpiry = time.Hour
+
+	pollID := uuid.New()
+	hash := "$2a$10$examplehash"
+
+	token, expiresAt, err := GeneratePollAccessToken(pollID, hash)
+	require.NoError(t, err)
+	assert.WithinDuration(t, time.Now().Add(time.Hour), expiresAt, time.Minute)
+
+	assert.NoError(t, VerifyPollAccessToken(token, pollID, hash))
+	assert.Error(t, VerifyPollAccessToken("", pollID, hash))
+	assert.Error(t, VerifyPollAccessToken(token, uuid.New(), hash), "other poll")
+	assert.Error(t, VerifyPollAccessToken(token, pollID, "$2a$10$otherhash"), "password changed")
+
+	t.Run("User tokens do not unlock polls", func(t *testing.T) {
+		userToken, err := GenerateToken(Claims{
+			UserID:           uuid.New(),
+			RegisteredClaims: jwt.RegisteredClaims{ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour))},
+		})
+		require.NoError(t, err)
+		assert.Error(t, VerifyPollAccessToken(userToken, pollID, hash))
+	})
+
+	t.Run("Poll tokens do not authenticate users", func(t *testing.T) {
+		gin.SetMode(gin.TestMode)
+		router := gin.New()
+		router.GET("/me", Auth(), func(c *gin.Context) {
+			c.String(http.StatusOK, "ok")
+		})
+
+		req, _ := http.NewRequest("GET", "/me", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+
+	t.Run("Expired", func(t *testing.T) {
+		expired, err := jwtkeys.Default().Sign(PollAccessClaims{
+			PollID:      pollID,
+			PasswordTag: passwordTag(hash),
+			RegisteredClaims: jwt.RegisteredClaims{
+				Audience:  jwt.ClaimStrings{PollAccessAudience},
+				ExpiresAt: jwt.NewNumericDate(time.Now().Add(-time.Minute)),
+			},
+		})
+		require.NoError(t, err)
+		assert.Error(t, VerifyPollAccessToken(expired, pollID, hash))
+	})
+}
@@ -0,0 +1,63 @@
+package middleware
+
+import (
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"doodle-clone/internal/ratelimit"
+)
+
+// RateLimit limits the requests of each client under policy.
+// Authenticated requests are counted per user, others per IP, so the middleware
+// should come after Auth or OptionalAuth to count users. If the limiter fails,
+// the request is let through.
+func RateLimit(limiter ratelimit.Limiter, policy ratelimit.Policy) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := "ip:" + c.ClientIP()
+		if userID := GetCurrentUser(c); userID != nil {
+			key = "user:" + userID.String()
+		}
+
+		res, err := limiter.Allow(c.Request.Context(), key, policy)
+		if err != nil {
+			log.Printf("Rate limiter error (%s): %v", policy.Name, err)
+			c.Next()
+			return
+		}
+
+		setRateLimitHeaders(c, policy, res)
+
+		if !res.Allowed {
+			c.Header("Retry-After", strconv.Itoa(ceilSeconds(res.RetryAfter)))
+			c.JSON(http.StatusTooManyRequests, gin.H{
+				"error": "Too many requests. Please try again later.",
+			})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// setRateLimitHeaders sets the RateLimit-* headers. When several policies apply
+// to a route, the one with the fewest remaining requests is reported.
+func setRateLimitHeaders(c *gin.Context, policy ratelimit.Policy, res ratelimit.Result) {
+	if current := c.Writer.Header().Get("RateLimit-Remaining"); current != "" {
+		if remaining, err := strconv.Atoi(current); err == nil && remaining <= res.Remaining {
+			return
+		}
+	}
+
+	c.Header("RateLimit-Limit", strconv.Itoa(res.Limit))
+	c.Header("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+	c.Header("RateLimit-Reset", strconv.Itoa(ceilSeconds(res.Reset)))
+	c.Header("RateLimit-Policy", policy.String())
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
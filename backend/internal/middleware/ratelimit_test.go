@@ -0,0 +1,82 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"doodle-clone/internal/ratelimit"
+)
+
+func TestRateLimit(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	limiter := ratelimit.NewMemoryLimiter()
+	strict := ratelimit.Policy{Name: "strict", Limit: 2, Window: time.Minute}
+	loose := ratelimit.Policy{Name: "loose", Limit: 100, Window: time.Minute}
+
+	router := gin.New()
+	router.Use(RateLimit(limiter, loose))
+	router.GET("/ping", RateLimit(limiter, strict), func(c *gin.Context) {
+		c.String(http.StatusOK, "pong")
+	})
+
+	get := func() *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("GET", "/ping", nil)
+		req.RemoteAddr = "203.0.113.7:1234"
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := get()
+	assert.Equal(t, http.StatusOK, w.Code)
+	// The strictest policy is reported
+	assert.Equal(t, "2", w.Header().Get("RateLimit-Limit"))
+	assert.Equal(t, "1", w.Header().Get("RateLimit-Remaining"))
+	assert.Equal(t, "2;w=60", w.Header().Get("RateLimit-Policy"))
+	assert.Empty(t, w.Header().Get("Retry-After"))
+
+	get()
+	w = get()
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "0", w.Header().Get("RateLimit-Remaining"))
+	assert.Equal(t, "30", w.Header().Get("Retry-After"))
+}
+
+func TestRateLimit_ForwardedFor(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	strict := ratelimit.Policy{Name: "strict", Limit: 1, Window: time.Minute}
+	newRouter := func(trusted []string) *gin.Engine {
+		router := gin.New()
+		require.NoError(t, router.SetTrustedProxies(trusted))
+		router.GET("/ping", RateLimit(ratelimit.NewMemoryLimiter(), strict), func(c *gin.Context) {
+			c.String(http.StatusOK, "pong")
+		})
+		return router
+	}
+	get := func(router *gin.Engine, forwardedFor string) int {
+		req, _ := http.NewRequest("GET", "/ping", nil)
+		req.RemoteAddr = "10.42.0.5:1234"
+		req.Header.Set("X-Forwarded-For", forwardedFor)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	// Without trusted proxies, a spoofed header does not give a new bucket
+	router := newRouter(nil)
+	assert.Equal(t, http.StatusOK, get(router, "198.51.100.1"))
+	assert.Equal(t, http.StatusTooManyRequests, get(router, "198.51.100.2"))
+
+	// Behind a trusted proxy, each forwarded client has its own bucket
+	router = newRouter([]string{"10.42.0.0/16"})
+	assert.Equal(t, http.StatusOK, get(router, "198.51.100.1"))
+	assert.Equal(t, http.StatusOK, get(router, "198.51.100.2"))
+	assert.Equal(t, http.StatusTooManyRequests, get(router, "198.51.100.1"))
+}
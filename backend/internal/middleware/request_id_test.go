@@ -0,0 +1,42 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequestID(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(RequestID())
+	router.GET("/ping", func(c *gin.Context) {
+		c.String(http.StatusOK, GetRequestID(c))
+	})
+
+	get := func(header string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("GET", "/ping", nil)
+		if header != "" {
+			req.Header.Set(RequestIDHeader, header)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := get("")
+	_, err := uuid.Parse(w.Body.String())
+	assert.NoError(t, err)
+	assert.Equal(t, w.Body.String(), w.Header().Get(RequestIDHeader))
+
+	w = get("edge-1234.abc")
+	assert.Equal(t, "edge-1234.abc", w.Body.String())
+
+	// Unsafe IDs are replaced rather than logged as is
+	w = get("bad id\nwith newline")
+	assert.NotEqual(t, "bad id\nwith newline", w.Body.String())
+}
@@ -0,0 +1,65 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// PersonalAccessToken is a named, scoped and expiring token for scripts and integrations
+type PersonalAccessToken struct {
+	ID          uuid.UUID  `json:"id" db:"id"`
+	UserID      uuid.UUID  `json:"user_id" db:"user_id"`
+	Name        string     `json:"name" db:"name"`
+	TokenPrefix string     `json:"token_prefix" db:"token_prefix"` // First characters, to recognize the token
+	Scopes      []string   `json:"scopes" db:"scopes"`
+	ExpiresAt   *time.Time `json:"expires_at" db:"expires_at"`
+	LastUsedAt  *time.Time `json:"last_used_at" db:"last_used_at"`
+	CreatedAt   time.Time  `json:"created_at" db:"created_at"`
+}
+
+// TableName returns the table name for PersonalAccessToken
+func (PersonalAccessToken) TableName() string {
+	return "personal_access_tokens"
+}
+
+// CreateAccessTokenRequest is the request payload for creating a personal access token
+type CreateAccessTokenRequest struct {
+	Name          string   `json:"name" binding:"required,min=1,max=100"`
+	Scopes        []string `json:"scopes" binding:"required,min=1"`
+	ExpiresInDays int      `json:"expires_in_days" binding:"omitempty,min=1,max=365"`
+}
+
+// CreateAccessTokenResponse contains the plaintext token, shown only once
+type CreateAccessTokenResponse struct {
+	PersonalAccessToken
+	Token string `json:"token"`
+}
+
+// Access token scopes
+const (
+	ScopePollsRead     = "polls:read"
+	ScopePollsWrite    = "polls:write"
+	ScopeVotesRead     = "votes:read"
+	ScopeVotesWrite    = "votes:write"
+	ScopeCommentsWrite = "comments:write"
+)
+
+// AccessTokenScopes lists every scope a personal access token can be granted
+var AccessTokenScopes = []string{
+	ScopePollsRead,
+	ScopePollsWrite,
+	ScopeVotesRead,
+	ScopeVotesWrite,
+	ScopeCommentsWrite,
+}
+
+// IsValidScope checks if scope is a known access token scope
+func IsValidScope(scope string) bool {
+	for _, s := range AccessTokenScopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
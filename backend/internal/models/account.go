@@ -0,0 +1,15 @@
+package models
+
+// What happens to the polls of a user deleting their account
+const (
+	PollPolicyTransfer = "transfer" // Hand the polls over to another user
+	PollPolicyArchive  = "archive"  // Keep the polls read-only, without a creator
+	PollPolicyDelete   = "delete"   // Delete the polls with their votes and comments
+)
+
+// DeleteAccountRequest is the request payload for deleting the current account
+type DeleteAccountRequest struct {
+	Password   string `json:"password"` // Required for email accounts
+	PollPolicy string `json:"poll_policy" binding:"required,oneof=transfer archive delete"`
+	TransferTo string `json:"transfer_to" binding:"omitempty,email"` // Email of the new owner, for the transfer policy
+}
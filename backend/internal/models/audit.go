@@ -0,0 +1,29 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// AuditEntry is a line of the append-only audit log
+type AuditEntry struct {
+	ID         int64           `json:"id" db:"id"`
+	ActorID    *uuid.UUID      `json:"actor_id,omitempty" db:"actor_id"` // nil for anonymous voters
+	ActorName  string          `json:"actor_name,omitempty" db:"-"`
+	ActorEmail string          `json:"actor_email,omitempty" db:"-"` // Admin view only
+	Action     string          `json:"action" db:"action"`           // poll.update, vote.delete, auth.login...
+	TargetType string          `json:"target_type" db:"target_type"`
+	TargetID   string          `json:"target_id" db:"target_id"`
+	PollID     *uuid.UUID      `json:"poll_id,omitempty" db:"poll_id"`
+	Changes    json.RawMessage `json:"changes,omitempty" db:"changes"` // {"field": {"old": ..., "new": ...}}
+	IPAddress  string          `json:"ip_address,omitempty" db:"ip_address"`
+	RequestID  string          `json:"request_id,omitempty" db:"request_id"`
+	CreatedAt  time.Time       `json:"created_at" db:"created_at"`
+}
+
+// TableName returns the table name for AuditEntry
+func (AuditEntry) TableName() string {
+	return "audit_log"
+}
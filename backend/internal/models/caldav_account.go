@@ -0,0 +1,40 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// CalDAVAccount is the calendar of a user, read to suggest or fill in their votes.
+// Its app password is stored encrypted and never returned.
+type CalDAVAccount struct {
+	UserID     uuid.UUID  `json:"user_id" db:"user_id"`
+	URL        string     `json:"url" db:"url"`
+	Username   string     `json:"username" db:"username"`
+	AutoFill   bool       `json:"auto_fill" db:"auto_fill"` // Fill in and keep up to date the votes of open polls
+	LastSyncAt *time.Time `json:"last_sync_at,omitempty" db:"last_sync_at"`
+	LastError  *string    `json:"last_error,omitempty" db:"last_error"`
+	CreatedAt  time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at" db:"updated_at"`
+}
+
+// TableName returns the table name for CalDAVAccount
+func (CalDAVAccount) TableName() string {
+	return "caldav_accounts"
+}
+
+// ConnectCalDAVRequest is the request payload for connecting a CalDAV calendar. The
+// password may be left out to keep the current one.
+type ConnectCalDAVRequest struct {
+	URL      string `json:"url" binding:"required"`
+	Username string `json:"username" binding:"required"`
+	Password string `json:"password"`
+	AutoFill bool   `json:"auto_fill"`
+}
+
+// CalDAVSyncResult reports the votes filled in from a calendar
+type CalDAVSyncResult struct {
+	Polls   int `json:"polls"`
+	Updated int `json:"updated"`
+}
@@ -0,0 +1,28 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// CalendarFeed is the secret subscription of a user to their finalized events
+type CalendarFeed struct {
+	UserID      uuid.UUID  `json:"user_id" db:"user_id"`
+	TokenPrefix string     `json:"token_prefix" db:"token_prefix"` // First characters, to recognize the token
+	LastUsedAt  *time.Time `json:"last_used_at" db:"last_used_at"`
+	CreatedAt   time.Time  `json:"created_at" db:"created_at"`
+}
+
+// TableName returns the table name for CalendarFeed
+func (CalendarFeed) TableName() string {
+	return "calendar_feeds"
+}
+
+// CreateCalendarFeedResponse contains the plaintext token and the feed URLs, shown only once
+type CreateCalendarFeedResponse struct {
+	CalendarFeed
+	Token     string `json:"token"`
+	URL       string `json:"url"`
+	WebcalURL string `json:"webcal_url"` // Opens the subscription in calendar applications
+}
@@ -35,6 +35,16 @@ type AddDateOptionRequest struct {
 	EndTime   *time.Time `json:"end_time"`
 }
 
+// DateOptionAvailability tells whether a date option conflicts with a participant's calendar
+type DateOptionAvailability struct {
+	DateOptionID uuid.UUID  `json:"date_option_id"`
+	StartTime    time.Time  `json:"start_time"`
+	EndTime      *time.Time `json:"end_time,omitempty"`
+	Busy         bool       `json:"busy"`
+	Response     string     `json:"response,omitempty"` // Suggested response: "no" when busy
+	Conflict     string     `json:"conflict,omitempty"` // Summary of the conflicting event
+}
+
 // IsFinalDate checks if this date option is the final selected date
 func (d *DateOption) IsFinalDate(poll *Poll) bool {
 	if poll.FinalDate == nil {
@@ -11,9 +11,12 @@ type Notification struct {
 	ID           uuid.UUID  `json:"id" db:"id"`
 	PollID       uuid.UUID  `json:"poll_id" db:"poll_id"`
 	UserID       *uuid.UUID `json:"user_id,omitempty" db:"user_id"`
-	Type         string     `json:"type" db:"type"` // event_reminder, new_vote, new_comment, etc.
-	Status       string     `json:"status" db:"status"` // pending, sent, failed
+	Type         string     `json:"type" db:"type"`       // event_reminder, new_vote, new_comment, etc.
+	Channel      string     `json:"channel" db:"channel"` // email, chat
+	Status       string     `json:"status" db:"status"`   // pending, sent, failed
 	ScheduledAt  time.Time  `json:"scheduled_at" db:"scheduled_at"`
+	Attempts     int        `json:"attempts" db:"attempts"`
+	NextAttempt  *time.Time `json:"next_attempt_at,omitempty" db:"next_attempt_at"` // Retry of a pending notification
 	SentAt       *time.Time `json:"sent_at,omitempty" db:"sent_at"`
 	ErrorMessage *string    `json:"error_message,omitempty" db:"error_message"`
 	CreatedAt    time.Time  `json:"created_at" db:"created_at"`
@@ -27,19 +30,85 @@ type NotificationSetting struct {
 	UpdatedAt   time.Time `json:"updated_at" db:"updated_at"`
 }
 
+// InboxNotification is a notification shown in the user's notification center.
+// Events of the same type on a poll are merged until it is read.
+type InboxNotification struct {
+	ID         uuid.UUID  `json:"id" db:"id"`
+	Type       string     `json:"type" db:"type"` // new_vote, new_comment, final_date, poll_changed
+	PollID     uuid.UUID  `json:"poll_id" db:"poll_id"`
+	PollTitle  string     `json:"poll_title"`
+	AccessCode string     `json:"access_code"`
+	Actors     []string   `json:"actors" db:"actors"` // Latest authors, empty on anonymous polls
+	Count      int        `json:"count" db:"count"`   // Distinct authors merged
+	ReadAt     *time.Time `json:"read_at,omitempty" db:"read_at"`
+	CreatedAt  time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at" db:"updated_at"`
+}
+
+// NotificationPreference tells how a user receives a type of notification
+type NotificationPreference struct {
+	Type  string `json:"type" binding:"required"`
+	InApp bool   `json:"in_app"`
+	Email bool   `json:"email"`
+}
+
+// UpdateNotificationPreferencesRequest is the request payload for updating notification preferences
+type UpdateNotificationPreferencesRequest struct {
+	Preferences []NotificationPreference `json:"preferences" binding:"required,dive"`
+}
+
+// UserNotificationTypes lists the notification types users can turn off, in the
+// notification center or by email
+var UserNotificationTypes = []string{
+	NotificationTypeNewVote,
+	NotificationTypeNewComment,
+	NotificationTypeFinalDate,
+	NotificationTypePollChanged,
+	NotificationTypeEventReminder,
+}
+
+// IsUserNotificationType checks if t is a notification type users can turn off
+func IsUserNotificationType(t string) bool {
+	for _, ut := range UserNotificationTypes {
+		if ut == t {
+			return true
+		}
+	}
+	return false
+}
+
+// TestEmailRequest selects the notification sent to an admin to try a template
+type TestEmailRequest struct {
+	Type   string     `json:"type" binding:"required"`
+	PollID *uuid.UUID `json:"poll_id"` // Required, except for account_locked
+	Locale string     `json:"locale"`  // The admin's language by default
+}
+
 // Notification types
 const (
 	NotificationTypeEventReminder = "event_reminder"
 	NotificationTypeNewVote       = "new_vote"
 	NotificationTypeNewComment    = "new_comment"
 	NotificationTypeFinalDate     = "final_date"
+	NotificationTypePollChanged   = "poll_changed"
+	NotificationTypePollCreated   = "poll_created"
+	NotificationTypePollClosing   = "poll_closing"
+	NotificationTypeAccountLocked = "account_locked" // Sent right away, not queued
+	// Sent with the iTIP cancellation of a final date, from calendar_invitations
+	NotificationTypeEventCancelled = "event_cancelled"
+)
+
+// Notification channels
+const (
+	NotificationChannelEmail = "email"
+	NotificationChannelChat  = "chat" // The configured incoming webhook, without user_id
 )
 
 // Notification statuses
 const (
 	NotificationStatusPending = "pending"
 	NotificationStatusSent    = "sent"
-	NotificationStatusFailed  = "failed"
+	NotificationStatusFailed  = "failed" // Gave up after the maximum attempts
 )
 
 // Default notification settings keys
@@ -49,4 +118,6 @@ const (
 	SettingNewVoteEnabled     = "new_vote_enabled"
 	SettingNewCommentEnabled  = "new_comment_enabled"
 	SettingFinalDateEnabled   = "final_date_enabled"
+	SettingPollChangedEnabled = "poll_changed_enabled"
+	SettingChatEnabled        = "chat_enabled"
 )
@@ -22,6 +22,7 @@ type Poll struct {
 	LimitVotes      bool       `json:"limit_votes" db:"limit_votes"`         // Limit number of votes per user
 	MaxVotesPerUser int        `json:"max_votes_per_user" db:"max_votes_per_user"`
 	FinalDate       *uuid.UUID `json:"final_date,omitempty" db:"final_date"` // ID of the chosen DateOption
+	HasPassword     bool       `json:"has_password" db:"-"`                  // Password required to read or vote
 	CreatedAt       time.Time  `json:"created_at" db:"created_at"`
 	UpdatedAt       time.Time  `json:"updated_at" db:"updated_at"`
 }
@@ -42,6 +43,7 @@ type CreatePollRequest struct {
 	Anonymous       bool       `json:"anonymous"`
 	LimitVotes      bool       `json:"limit_votes"`
 	MaxVotesPerUser int        `json:"max_votes_per_user"`
+	Password        string     `json:"password" binding:"omitempty,min=8,max=72"` // Optional poll password
 	Dates           []DateRequest `json:"dates" binding:"required,min=1"`
 }
 
@@ -57,6 +59,12 @@ type UpdatePollRequest struct {
 	Description *string    `json:"description"`
 	Location    *string    `json:"location"`
 	ExpiresAt   *time.Time `json:"expires_at"`
+	Password    *string    `json:"password" binding:"omitempty,max=72"` // Empty string removes the password
+}
+
+// UnlockPollRequest is the request payload for unlocking a password-protected poll
+type UnlockPollRequest struct {
+	Password string `json:"password" binding:"required"`
 }
 
 // SetFinalDateRequest is the request payload for setting the final date
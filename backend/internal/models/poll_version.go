@@ -0,0 +1,48 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// PollVersion is a snapshot of the configuration of a poll, taken after each change
+type PollVersion struct {
+	ID            uuid.UUID               `json:"id" db:"id"`
+	PollID        uuid.UUID               `json:"poll_id" db:"poll_id"`
+	Version       int                     `json:"version" db:"version"`
+	Title         string                  `json:"title" db:"title"`
+	Description   string                  `json:"description" db:"description"`
+	Location      string                  `json:"location" db:"location"`
+	ExpiresAt     *time.Time              `json:"expires_at" db:"expires_at"`
+	DateOptions   []PollVersionDateOption `json:"date_options" db:"date_options"`
+	Reason        string                  `json:"reason" db:"reason"` // create, update, date_add, revert
+	RevertedFrom  *int                    `json:"reverted_from,omitempty" db:"reverted_from"`
+	CreatedBy     *uuid.UUID              `json:"created_by,omitempty" db:"created_by"`
+	CreatedByName string                  `json:"created_by_name,omitempty" db:"-"` // Populated by join
+	CreatedAt     time.Time               `json:"created_at" db:"created_at"`
+}
+
+// PollVersionDateOption is a date option as recorded in a poll version
+type PollVersionDateOption struct {
+	ID        uuid.UUID  `json:"id"`
+	StartTime time.Time  `json:"start_time"`
+	EndTime   *time.Time `json:"end_time,omitempty"`
+}
+
+// Poll version reasons
+const (
+	PollVersionCreate  = "create"
+	PollVersionUpdate  = "update"
+	PollVersionDateAdd = "date_add"
+	PollVersionRevert  = "revert"
+)
+
+// PollVersionDiff compares two versions of a poll
+type PollVersionDiff struct {
+	From         int                     `json:"from"`
+	To           int                     `json:"to"`
+	Changes      map[string]interface{}  `json:"changes"` // {"field": {"old": ..., "new": ...}}
+	DatesAdded   []PollVersionDateOption `json:"date_options_added"`
+	DatesRemoved []PollVersionDateOption `json:"date_options_removed"`
+}
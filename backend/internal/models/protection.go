@@ -0,0 +1,50 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// PollProtection holds the anti-spam rules applied to anonymous ballots of a poll
+type PollProtection struct {
+	PollID              uuid.UUID `json:"poll_id" db:"poll_id"`
+	RequirePow          bool      `json:"require_pow" db:"require_pow"`                     // Solve a proof-of-work challenge before voting
+	PowDifficulty       int       `json:"pow_difficulty" db:"pow_difficulty"`               // Leading zero bits
+	OneBallotPerDevice  bool      `json:"one_ballot_per_device" db:"one_ballot_per_device"` // Device cookie or fingerprint
+	BlockDuplicateNames bool      `json:"block_duplicate_names" db:"block_duplicate_names"`
+	NameBlocklist       []string  `json:"name_blocklist" db:"name_blocklist"`
+	UpdatedAt           time.Time `json:"updated_at" db:"updated_at"`
+}
+
+// TableName returns the table name for PollProtection
+func (PollProtection) TableName() string {
+	return "poll_protections"
+}
+
+// UpdatePollProtectionRequest is the request payload for updating the protections of a poll
+type UpdatePollProtectionRequest struct {
+	RequirePow          *bool    `json:"require_pow"`
+	PowDifficulty       *int     `json:"pow_difficulty"`
+	OneBallotPerDevice  *bool    `json:"one_ballot_per_device"`
+	BlockDuplicateNames *bool    `json:"block_duplicate_names"`
+	NameBlocklist       []string `json:"name_blocklist" binding:"omitempty,max=200,dive,max=100"`
+}
+
+// Ballot groups the votes submitted at once by an anonymous voter, for moderation
+type Ballot struct {
+	ID                uuid.UUID `json:"id"`
+	UserName          string    `json:"user_name"`
+	Votes             []Vote    `json:"votes"`
+	Flagged           bool      `json:"flagged"`
+	FlagReason        string    `json:"flag_reason,omitempty"`
+	SameDeviceBallots int       `json:"same_device_ballots"` // Other ballots from the same device
+	DuplicateName     bool      `json:"duplicate_name"`      // Another voter uses the same name
+	CreatedAt         time.Time `json:"created_at"`
+}
+
+// FlagBallotRequest is the request payload for flagging a ballot
+type FlagBallotRequest struct {
+	Flagged *bool  `json:"flagged" binding:"required"`
+	Reason  string `json:"reason" binding:"max=200"`
+}
@@ -0,0 +1,18 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Session represents a logged-in client, backed by a refresh token family
+type Session struct {
+	ID         uuid.UUID `json:"id" db:"family_id"`
+	UserAgent  string    `json:"user_agent" db:"user_agent"`
+	IPAddress  string    `json:"ip_address" db:"ip_address"`
+	CreatedAt  time.Time `json:"created_at" db:"session_started_at"`
+	LastUsedAt time.Time `json:"last_used_at" db:"created_at"` // Issue time of the current refresh token
+	ExpiresAt  time.Time `json:"expires_at" db:"expires_at"`
+	Current    bool      `json:"current" db:"-"`
+}
@@ -14,6 +14,7 @@ type User struct {
 	Name         string    `json:"name" db:"name"`
 	Avatar       string    `json:"avatar" db:"avatar"`
 	Provider     string    `json:"provider" db:"provider"` // "google" or "email"
+	Locale       string    `json:"locale" db:"locale"`     // Language of emails, empty for the default
 	CreatedAt    time.Time `json:"created_at" db:"created_at"`
 	UpdatedAt    time.Time `json:"updated_at" db:"updated_at"`
 }
@@ -45,8 +46,9 @@ type AuthResponse struct {
 
 // UpdateProfileRequest is the request payload for updating profile
 type UpdateProfileRequest struct {
-	Name  string `json:"name" binding:"required"`
-	Email string `json:"email" binding:"required,email"`
+	Name   string `json:"name" binding:"required"`
+	Email  string `json:"email" binding:"required,email"`
+	Locale string `json:"locale" binding:"omitempty,oneof=fr en"` // Unchanged when empty
 }
 
 // ChangePasswordRequest is the request payload for changing password
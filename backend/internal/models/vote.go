@@ -14,9 +14,14 @@ type Vote struct {
 	UserID      *uuid.UUID `json:"user_id,omitempty" db:"user_id"`
 	UserName    string     `json:"user_name" db:"user_name"` // Display name (user's name or custom for anonymous)
 	Response    string     `json:"response" db:"response"`   // "yes", "no", "maybe"
+	Source      string     `json:"source,omitempty" db:"source"` // VoteSourceCalDAV for votes filled in from a calendar
 	CreatedAt   time.Time  `json:"created_at" db:"created_at"`
 }
 
+// VoteSourceCalDAV marks the votes filled in from the CalDAV calendar of their voter.
+// They are kept up to date with the calendar until the voter changes them.
+const VoteSourceCalDAV = "caldav"
+
 // TableName returns the table name for Vote
 func (Vote) TableName() string {
 	return "votes"
@@ -27,6 +32,11 @@ type CreateVoteRequest struct {
 	Response string     `json:"response" binding:"omitempty,oneof=yes no maybe"` // For single vote with date_option_id query param
 	Votes    []VoteItem `json:"votes"` // For multiple votes at once
 	UserName string     `json:"user_name"` // Name for anonymous voting
+
+	// Anti-spam fields for anonymous ballots, see PollProtection
+	PowChallenge string `json:"pow_challenge,omitempty"`
+	PowSolution  string `json:"pow_solution,omitempty"`
+	Fingerprint  string `json:"fingerprint,omitempty" binding:"max=256"`
 }
 
 // VoteItem represents a single vote item
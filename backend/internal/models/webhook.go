@@ -0,0 +1,73 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Webhook delivers the events of a poll, or of every poll of its owner, to a URL
+type Webhook struct {
+	ID          uuid.UUID  `json:"id" db:"id"`
+	UserID      uuid.UUID  `json:"user_id" db:"user_id"`
+	PollID      *uuid.UUID `json:"poll_id,omitempty" db:"poll_id"` // Every poll of the user when empty
+	URL         string     `json:"url" db:"url"`
+	Events      []string   `json:"events" db:"events"` // Every event when empty
+	Description string     `json:"description" db:"description"`
+	Active      bool       `json:"active" db:"active"`
+	CreatedAt   time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at" db:"updated_at"`
+}
+
+// TableName returns the table name for Webhook
+func (Webhook) TableName() string {
+	return "webhooks"
+}
+
+// CreateWebhookRequest is the request payload for creating a webhook
+type CreateWebhookRequest struct {
+	URL         string     `json:"url" binding:"required,max=2000"`
+	PollID      *uuid.UUID `json:"poll_id"`
+	Events      []string   `json:"events"`
+	Description string     `json:"description" binding:"max=200"`
+}
+
+// UpdateWebhookRequest is the request payload for updating a webhook
+type UpdateWebhookRequest struct {
+	URL          *string   `json:"url" binding:"omitempty,max=2000"`
+	Events       *[]string `json:"events"`
+	Description  *string   `json:"description" binding:"omitempty,max=200"`
+	Active       *bool     `json:"active"`
+	RotateSecret bool      `json:"rotate_secret"`
+}
+
+// WebhookSecretResponse contains the signing secret, shown only when created or rotated
+type WebhookSecretResponse struct {
+	Webhook
+	Secret string `json:"secret,omitempty"`
+}
+
+// WebhookDelivery is one event sent, or to be sent, to a webhook
+type WebhookDelivery struct {
+	ID             uuid.UUID       `json:"id" db:"id"`
+	WebhookID      uuid.UUID       `json:"webhook_id" db:"webhook_id"`
+	EventType      string          `json:"event_type" db:"event_type"`
+	Payload        json.RawMessage `json:"payload" db:"payload"`
+	Status         string          `json:"status" db:"status"` // pending, delivered, failed
+	Attempts       int             `json:"attempts" db:"attempts"`
+	NextAttemptAt  *time.Time      `json:"next_attempt_at,omitempty" db:"next_attempt_at"` // Only while pending
+	LastStatusCode *int            `json:"last_status_code,omitempty" db:"last_status_code"`
+	LastError      *string         `json:"last_error,omitempty" db:"last_error"`
+	LastResponse   *string         `json:"last_response,omitempty" db:"last_response"`
+	RedeliveryOf   *uuid.UUID      `json:"redelivery_of,omitempty" db:"redelivery_of"`
+	DeliveredAt    *time.Time      `json:"delivered_at,omitempty" db:"delivered_at"`
+	CreatedAt      time.Time       `json:"created_at" db:"created_at"`
+}
+
+// Webhook delivery statuses
+const (
+	WebhookDeliveryPending   = "pending"
+	WebhookDeliveryDelivered = "delivered"
+	WebhookDeliveryFailed    = "failed"
+)
@@ -0,0 +1,135 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"doodle-clone/internal/email"
+	"doodle-clone/internal/webhooks"
+)
+
+// SMTP sends messages as HTML emails, with their plain-text part
+type SMTP struct {
+	sender *email.Sender
+}
+
+// NewSMTP creates an SMTP notifier
+func NewSMTP(sender *email.Sender) *SMTP {
+	return &SMTP{sender: sender}
+}
+
+// Notify implements Notifier
+func (s *SMTP) Notify(_ context.Context, m Message) error {
+	return s.sender.Send(m.To, m.Subject, m.HTML, m.Text, m.Calendar)
+}
+
+// Log writes messages to a writer instead of sending them, for development
+type Log struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewLog creates a notifier writing to w
+func NewLog(w io.Writer) *Log {
+	return &Log{w: w}
+}
+
+// Notify implements Notifier
+func (l *Log) Notify(_ context.Context, m Message) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	// The plain-text part reads better in a terminal
+	body := m.Text
+	if body == "" {
+		body = m.HTML
+	}
+	if m.Calendar != nil {
+		body += "\n\n" + m.Calendar.Content
+	}
+	_, err := fmt.Fprintf(l.w, "--- %s notification %s\nTo: %s\nSubject: %s\n\n%s\n\n",
+		time.Now().Format(time.RFC3339), m.Type, strings.Join(m.To, ", "), m.Subject, strings.TrimSpace(body))
+	return err
+}
+
+// Memory keeps messages in memory, for tests
+type Memory struct {
+	mu       sync.Mutex
+	messages []Message
+	// Err, when set, is returned instead of keeping the message
+	Err error
+}
+
+// NewMemory creates an in-memory notifier
+func NewMemory() *Memory {
+	return &Memory{}
+}
+
+// Notify implements Notifier
+func (m *Memory) Notify(_ context.Context, msg Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.Err != nil {
+		return m.Err
+	}
+	m.messages = append(m.messages, msg)
+	return nil
+}
+
+// Messages returns the messages received so far
+func (m *Memory) Messages() []Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]Message(nil), m.messages...)
+}
+
+// Reset forgets the messages received
+func (m *Memory) Reset() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.messages = nil
+}
+
+// Webhook posts messages as JSON, signed like poll webhooks (see package webhooks)
+type Webhook struct {
+	url    string
+	secret string
+	client *http.Client
+}
+
+// NewWebhook creates a webhook notifier. The URL comes from the configuration, so
+// private addresses are allowed.
+func NewWebhook(url, secret string, timeout time.Duration) (*Webhook, error) {
+	if url == "" {
+		return nil, errors.New("the webhook notifier needs NOTIFY_WEBHOOK_URL")
+	}
+	if err := webhooks.ValidateURL(url); err != nil {
+		return nil, err
+	}
+	return &Webhook{url: url, secret: secret, client: webhooks.NewClient(timeout, true)}, nil
+}
+
+// Notify implements Notifier
+func (w *Webhook) Notify(ctx context.Context, m Message) error {
+	body, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	_, err = webhooks.Deliver(ctx, w.client, webhooks.Delivery{
+		ID:     uuid.NewString(),
+		Event:  "notification." + m.Type,
+		URL:    w.url,
+		Secret: w.secret,
+		Body:   body,
+	})
+	return err
+}
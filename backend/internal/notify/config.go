@@ -0,0 +1,91 @@
+package notify
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"doodle-clone/internal/config"
+	"doodle-clone/internal/email"
+)
+
+// BackendAuto picks SMTP when it is configured, the log otherwise
+const BackendAuto = "auto"
+
+// FromConfig builds the notifier described by NOTIFY_BACKEND and NOTIFY_ROUTES.
+// Only the backends in use are created, so SMTP is never dialed unless chosen.
+func FromConfig() (Notifier, error) {
+	routes, err := ParseRoutes(config.AppConfig.NotifyRoutes)
+	if err != nil {
+		return nil, err
+	}
+
+	built := map[string]Notifier{}
+	backend := func(name string) (Notifier, error) {
+		if n, ok := built[name]; ok {
+			return n, nil
+		}
+		n, err := newBackend(name)
+		if err != nil {
+			return nil, err
+		}
+		built[name] = n
+		return n, nil
+	}
+
+	router := &Router{Routes: map[string]Notifier{}}
+	if router.Fallback, err = backend(defaultBackend()); err != nil {
+		return nil, err
+	}
+	for notificationType, name := range routes {
+		if router.Routes[notificationType], err = backend(name); err != nil {
+			return nil, err
+		}
+	}
+	return router, nil
+}
+
+// Describe summarizes the configured routing for the startup logs
+func Describe() string {
+	if config.AppConfig.NotifyRoutes == "" {
+		return defaultBackend()
+	}
+	return fmt.Sprintf("%s (routes: %s)", defaultBackend(), config.AppConfig.NotifyRoutes)
+}
+
+// defaultBackend resolves NOTIFY_BACKEND
+func defaultBackend() string {
+	backend := config.AppConfig.NotifyBackend
+	if backend == "" || backend == BackendAuto {
+		backend = BackendLog
+		if email.IsConfigured() {
+			backend = BackendSMTP
+		}
+	}
+	return backend
+}
+
+func newBackend(name string) (Notifier, error) {
+	switch name {
+	case BackendSMTP:
+		return NewSMTP(email.NewSender()), nil
+	case BackendLog:
+		var w io.Writer = os.Stderr
+		if path := config.AppConfig.NotifyLogFile; path != "" {
+			f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+			if err != nil {
+				return nil, fmt.Errorf("failed to open notification log: %w", err)
+			}
+			w = f
+		}
+		return NewLog(w), nil
+	case BackendMemory:
+		return NewMemory(), nil
+	case BackendWebhook:
+		return NewWebhook(config.AppConfig.NotifyWebhookURL, config.AppConfig.NotifyWebhookSecret, config.AppConfig.WebhookTimeout)
+	case BackendNone:
+		return Discard{}, nil
+	default:
+		return nil, fmt.Errorf("unknown notification backend %q", name)
+	}
+}
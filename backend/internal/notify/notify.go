@@ -0,0 +1,78 @@
+// Package notify delivers notifications through pluggable backends (SMTP, log, memory,
+// webhook), routed per notification type
+package notify
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"doodle-clone/internal/email"
+)
+
+// Backend names, as used in NOTIFY_BACKEND and NOTIFY_ROUTES
+const (
+	BackendSMTP    = "smtp"
+	BackendLog     = "log"
+	BackendMemory  = "memory"
+	BackendWebhook = "webhook"
+	BackendNone    = "none"
+)
+
+// Message is a notification to deliver to its recipients
+type Message struct {
+	Type    string   `json:"type"` // Notification type, to route the message
+	To      []string `json:"to"`
+	Subject string   `json:"subject"`
+	HTML    string   `json:"html"`
+	Text    string   `json:"text,omitempty"` // Plain-text alternative of the HTML
+	// Calendar is a meeting invitation or cancellation sent with the email
+	Calendar *email.Calendar `json:"calendar,omitempty"`
+}
+
+// Notifier delivers messages
+type Notifier interface {
+	Notify(ctx context.Context, m Message) error
+}
+
+// Discard drops every message, to turn a notification type off
+type Discard struct{}
+
+// Notify implements Notifier
+func (Discard) Notify(context.Context, Message) error { return nil }
+
+// Router sends each message to the notifier of its type, or to the fallback
+type Router struct {
+	Fallback Notifier
+	Routes   map[string]Notifier
+}
+
+// Notify implements Notifier
+func (r *Router) Notify(ctx context.Context, m Message) error {
+	if n, ok := r.Routes[m.Type]; ok {
+		return n.Notify(ctx, m)
+	}
+	if r.Fallback == nil {
+		return fmt.Errorf("no notifier for %s", m.Type)
+	}
+	return r.Fallback.Notify(ctx, m)
+}
+
+// ParseRoutes parses "type=backend" pairs separated by commas, such as
+// "new_vote=log,account_locked=smtp"
+func ParseRoutes(s string) (map[string]string, error) {
+	routes := map[string]string{}
+	for _, pair := range strings.Split(s, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		notificationType, backend, ok := strings.Cut(pair, "=")
+		notificationType, backend = strings.TrimSpace(notificationType), strings.TrimSpace(backend)
+		if !ok || notificationType == "" || backend == "" {
+			return nil, fmt.Errorf("invalid notification route %q, expected type=backend", pair)
+		}
+		routes[notificationType] = backend
+	}
+	return routes, nil
+}
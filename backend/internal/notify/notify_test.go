@@ -0,0 +1,121 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"doodle-clone/internal/config"
+	"doodle-clone/internal/email"
+	"doodle-clone/internal/webhooks"
+)
+
+func TestParseRoutes(t *testing.T) {
+	routes, err := ParseRoutes(" new_vote=none, account_locked = smtp ,")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"new_vote": "none", "account_locked": "smtp"}, routes)
+
+	routes, err = ParseRoutes("")
+	require.NoError(t, err)
+	assert.Empty(t, routes)
+
+	_, err = ParseRoutes("new_vote")
+	assert.Error(t, err)
+	_, err = ParseRoutes("=log")
+	assert.Error(t, err)
+}
+
+func TestRouter(t *testing.T) {
+	fallback, votes := NewMemory(), NewMemory()
+	router := &Router{Fallback: fallback, Routes: map[string]Notifier{"new_vote": votes, "new_comment": Discard{}}}
+	ctx := context.Background()
+
+	require.NoError(t, router.Notify(ctx, Message{Type: "new_vote", Subject: "vote"}))
+	require.NoError(t, router.Notify(ctx, Message{Type: "new_comment", Subject: "comment"}))
+	require.NoError(t, router.Notify(ctx, Message{Type: "final_date", Subject: "final"}))
+
+	require.Len(t, votes.Messages(), 1)
+	assert.Equal(t, "vote", votes.Messages()[0].Subject)
+	require.Len(t, fallback.Messages(), 1)
+	assert.Equal(t, "final", fallback.Messages()[0].Subject)
+
+	fallback.Reset()
+	assert.Empty(t, fallback.Messages())
+
+	fallback.Err = errors.New("down")
+	assert.Error(t, router.Notify(ctx, Message{Type: "final_date"}))
+	assert.Error(t, (&Router{}).Notify(ctx, Message{Type: "final_date"}), "no fallback")
+}
+
+func TestLog(t *testing.T) {
+	var buf bytes.Buffer
+	err := NewLog(&buf).Notify(context.Background(), Message{
+		Type:    "event_reminder",
+		To:      []string{"alice@example.com", "bob@example.com"},
+		Subject: "Rappel",
+		HTML:    "  <p>Bonjour</p>\n",
+	})
+	require.NoError(t, err)
+	assert.Contains(t, buf.String(), "notification event_reminder\n")
+	assert.Contains(t, buf.String(), "To: alice@example.com, bob@example.com\nSubject: Rappel\n\n<p>Bonjour</p>\n")
+}
+
+func TestWebhook(t *testing.T) {
+	var received Message
+	var verified bool
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		timestamp, _ := strconv.ParseInt(r.Header.Get(webhooks.HeaderTimestamp), 10, 64)
+		verified = webhooks.Verify("secret", timestamp, body, r.Header.Get(webhooks.HeaderSignature), time.Minute)
+		assert.Equal(t, "notification.final_date", r.Header.Get(webhooks.HeaderEvent))
+		json.Unmarshal(body, &received)
+	}))
+	defer receiver.Close()
+
+	n, err := NewWebhook(receiver.URL, "secret", 5*time.Second)
+	require.NoError(t, err)
+	msg := Message{
+		Type: "final_date", To: []string{"alice@example.com"}, Subject: "Date fixée", HTML: "<p>ok</p>",
+		Calendar: &email.Calendar{Method: "REQUEST", Content: "BEGIN:VCALENDAR\r\nMETHOD:REQUEST\r\nEND:VCALENDAR\r\n"},
+	}
+	require.NoError(t, n.Notify(context.Background(), msg))
+	assert.True(t, verified)
+	assert.Equal(t, msg, received)
+
+	_, err = NewWebhook("", "secret", time.Second)
+	assert.Error(t, err)
+}
+
+func TestFromConfig(t *testing.T) {
+	config.AppConfig = &config.Config{NotifyBackend: BackendAuto, NotifyRoutes: "new_vote=none,final_date=memory"}
+
+	n, err := FromConfig()
+	require.NoError(t, err)
+	router := n.(*Router)
+	assert.IsType(t, &Log{}, router.Fallback, "SMTP is not configured")
+	assert.IsType(t, Discard{}, router.Routes["new_vote"])
+	assert.IsType(t, &Memory{}, router.Routes["final_date"])
+	assert.Equal(t, "log (routes: new_vote=none,final_date=memory)", Describe())
+
+	config.AppConfig = &config.Config{NotifyBackend: BackendAuto, SMTPHost: "smtp.example.com", SMTPPort: "587", SMTPUser: "u", SMTPPassword: "p"}
+	n, err = FromConfig()
+	require.NoError(t, err)
+	assert.IsType(t, &SMTP{}, n.(*Router).Fallback)
+
+	config.AppConfig = &config.Config{NotifyBackend: "carrier-pigeon"}
+	_, err = FromConfig()
+	assert.Error(t, err)
+
+	config.AppConfig = &config.Config{NotifyBackend: BackendLog, NotifyRoutes: "final_date=webhook"}
+	_, err = FromConfig()
+	assert.Error(t, err, "webhook without URL")
+}
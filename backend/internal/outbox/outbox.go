@@ -0,0 +1,302 @@
+// Package outbox records poll events in the transaction of the change they describe,
+// and relays them to live streams, webhooks and notifications once committed
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"doodle-clone/internal/events"
+)
+
+// Channel wakes the relay up when events are committed
+const Channel = "outbox"
+
+// lockKey is the advisory lock held by the replica relaying events, so that
+// a single relay delivers them, in order
+const lockKey = 0x6f7574626f78
+
+const (
+	batchSize    = 100
+	purgeEvery   = time.Hour
+	retryDelay   = 5 * time.Second
+	drainTimeout = time.Minute
+)
+
+// Execer is implemented by both *pgxpool.Pool and pgx.Tx
+type Execer interface {
+	Exec(ctx context.Context, sql string, arguments ...any) (pgconn.CommandTag, error)
+}
+
+// Record adds an event to the outbox. Called with the transaction of the change,
+// the event exists if and only if the change is committed.
+func Record(ctx context.Context, db Execer, e events.Event) error {
+	payload, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(ctx, `
+		WITH recorded AS (
+			INSERT INTO outbox (poll_id, event_type, payload) VALUES ($1, $2, $3) RETURNING id
+		)
+		SELECT pg_notify($4, '') FROM recorded
+	`, e.PollID, e.Type, payload, Channel)
+	return err
+}
+
+// Handler applies an event within the transaction that marks it relayed, so
+// its effects are committed exactly once
+type Handler func(ctx context.Context, tx pgx.Tx, e events.Event) error
+
+// LiveStreams is the handler publishing events to the event streams of every replica
+func LiveStreams(ctx context.Context, tx pgx.Tx, e events.Event) error {
+	err := events.Publish(ctx, tx, e)
+	if errors.Is(err, events.ErrTooLarge) {
+		// Retrying would not help; clients see the change when they reload the poll
+		log.Printf("Not streaming %s event of poll %s: %v", e.Type, e.PollID, err)
+		return nil
+	}
+	return err
+}
+
+// Relay delivers the recorded events to the handlers
+type Relay struct {
+	pool        *pgxpool.Pool
+	handlers    []Handler
+	interval    time.Duration
+	maxAttempts int
+	retention   time.Duration
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// NewRelay creates a relay. Events are checked every interval, and right away when
+// a replica commits one; an event failing maxAttempts times is given up.
+func NewRelay(pool *pgxpool.Pool, interval time.Duration, maxAttempts int, retention time.Duration, handlers ...Handler) *Relay {
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+	return &Relay{
+		pool:        pool,
+		handlers:    handlers,
+		interval:    interval,
+		maxAttempts: maxAttempts,
+		retention:   retention,
+	}
+}
+
+// Start relays events in the background until Stop is called
+func (r *Relay) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	r.cancel = cancel
+	r.done = make(chan struct{})
+
+	go func() {
+		defer close(r.done)
+		for {
+			if err := r.listen(ctx); err != nil && ctx.Err() == nil {
+				log.Printf("Outbox listener stopped: %v", err)
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(retryDelay):
+			}
+		}
+	}()
+	log.Println("Outbox relay started")
+}
+
+// Stop stops the relay, after the batch being relayed
+func (r *Relay) Stop() {
+	if r.cancel == nil {
+		return
+	}
+	r.cancel()
+	<-r.done
+	log.Println("Outbox relay stopped")
+}
+
+// listen relays events whenever the channel is notified, or every interval,
+// until the connection fails or ctx ends
+func (r *Relay) listen(ctx context.Context) error {
+	conn, err := r.pool.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		// Do not hand a listening connection back to the pool
+		unlistenCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if _, err := conn.Exec(unlistenCtx, "UNLISTEN *"); err != nil {
+			conn.Conn().Close(unlistenCtx)
+		}
+		conn.Release()
+	}()
+
+	if _, err := conn.Exec(ctx, "LISTEN "+Channel); err != nil {
+		return err
+	}
+
+	var lastPurge time.Time
+	for {
+		// Also catches the events committed while nobody was listening
+		r.drain()
+		if time.Since(lastPurge) > purgeEvery {
+			r.purge()
+			lastPurge = time.Now()
+		}
+
+		waitCtx, cancel := context.WithTimeout(ctx, r.interval)
+		_, err := conn.Conn().WaitForNotification(waitCtx)
+		cancel()
+		if err != nil && ctx.Err() != nil {
+			return nil
+		}
+		if err != nil && !errors.Is(err, context.DeadlineExceeded) {
+			return err
+		}
+	}
+}
+
+// drain relays batches until the outbox is empty or a batch fails
+func (r *Relay) drain() {
+	for {
+		n, err := r.relayBatch()
+		if err != nil {
+			log.Printf("Error relaying outbox events: %v", err)
+			return
+		}
+		if n < batchSize {
+			return
+		}
+	}
+}
+
+// pendingEvent is an event read from the outbox
+type pendingEvent struct {
+	ID        int64
+	Event     events.Event
+	Attempts  int
+	decodeErr error
+}
+
+// relayBatch applies a batch of events in order, in one transaction, and returns how
+// many were read. An event that fails is retried on the next run, and the events
+// after it wait, unless it has failed too many times.
+func (r *Relay) relayBatch() (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), drainTimeout)
+	defer cancel()
+
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	var locked bool
+	if err := tx.QueryRow(ctx, "SELECT pg_try_advisory_xact_lock($1)", lockKey).Scan(&locked); err != nil {
+		return 0, err
+	}
+	if !locked {
+		return 0, nil // Another replica is relaying
+	}
+
+	rows, err := tx.Query(ctx, `
+		SELECT id, payload, attempts FROM outbox
+		WHERE processed_at IS NULL
+		ORDER BY id
+		LIMIT $1
+	`, batchSize)
+	if err != nil {
+		return 0, err
+	}
+	var pending []pendingEvent
+	for rows.Next() {
+		var p pendingEvent
+		var payload []byte
+		if err := rows.Scan(&p.ID, &payload, &p.Attempts); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		p.decodeErr = json.Unmarshal(payload, &p.Event)
+		pending = append(pending, p)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for _, p := range pending {
+		err := p.decodeErr
+		if err == nil {
+			err = r.apply(ctx, tx, p.Event)
+		}
+		if err != nil {
+			attempts := p.Attempts + 1
+			log.Printf("Failed to relay %s event %d (attempt %d): %v", p.Event.Type, p.ID, attempts, err)
+
+			giveUp := attempts >= r.maxAttempts || p.decodeErr != nil
+			_, updateErr := tx.Exec(ctx, `
+				UPDATE outbox SET attempts = $1, last_error = $2,
+				       processed_at = CASE WHEN $3 THEN CURRENT_TIMESTAMP END
+				WHERE id = $4
+			`, attempts, err.Error(), giveUp, p.ID)
+			if updateErr != nil {
+				return 0, updateErr
+			}
+			if !giveUp {
+				// Keep the order: the next events wait for the next run
+				return 0, tx.Commit(ctx)
+			}
+			continue
+		}
+
+		if _, err := tx.Exec(ctx, "UPDATE outbox SET processed_at = CURRENT_TIMESTAMP WHERE id = $1", p.ID); err != nil {
+			return 0, err
+		}
+	}
+
+	return len(pending), tx.Commit(ctx)
+}
+
+// apply runs every handler on an event, in a savepoint so a failure undoes them all
+func (r *Relay) apply(ctx context.Context, tx pgx.Tx, e events.Event) error {
+	savepoint, err := tx.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer savepoint.Rollback(ctx)
+
+	for _, h := range r.handlers {
+		if err := h(ctx, savepoint, e); err != nil {
+			return err
+		}
+	}
+	return savepoint.Commit(ctx)
+}
+
+// purge deletes the events relayed longer than the retention period ago
+func (r *Relay) purge() {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	tag, err := r.pool.Exec(ctx, `
+		DELETE FROM outbox WHERE processed_at < $1
+	`, time.Now().Add(-r.retention))
+	if err != nil {
+		log.Printf("Failed to purge outbox: %v", err)
+		return
+	}
+	if n := tag.RowsAffected(); n > 0 {
+		log.Printf("Purged %d outbox events", n)
+	}
+}
@@ -0,0 +1,77 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// sweepInterval is how often full buckets are evicted from memory
+const sweepInterval = time.Minute
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+	window  time.Duration
+}
+
+// MemoryLimiter keeps buckets in process memory. It is only accurate with a single replica.
+type MemoryLimiter struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+// NewMemoryLimiter creates an in-memory limiter
+func NewMemoryLimiter() *MemoryLimiter {
+	return &MemoryLimiter{
+		buckets:   make(map[string]*bucket),
+		lastSweep: time.Now(),
+		now:       time.Now,
+	}
+}
+
+// Allow takes a token from the bucket of key
+func (l *MemoryLimiter) Allow(_ context.Context, key string, policy Policy) (Result, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	if now.Sub(l.lastSweep) >= sweepInterval {
+		l.sweep(now)
+	}
+
+	key = policy.Name + ":" + key
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(policy.Limit), updated: now, window: policy.Window}
+		l.buckets[key] = b
+	}
+
+	available := refill(policy, b.tokens, b.updated, now)
+	res := result(policy, available)
+	if res.Allowed {
+		available--
+	}
+	b.tokens = available
+	b.updated = now
+	return res, nil
+}
+
+// sweep evicts buckets idle long enough to be full again, which are equivalent to no bucket
+func (l *MemoryLimiter) sweep(now time.Time) {
+	for key, b := range l.buckets {
+		if now.Sub(b.updated) >= b.window {
+			delete(l.buckets, key)
+		}
+	}
+	l.lastSweep = now
+}
+
+// Len returns the number of buckets held in memory
+func (l *MemoryLimiter) Len() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.buckets)
+}
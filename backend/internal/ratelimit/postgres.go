@@ -0,0 +1,74 @@
+package ratelimit
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// PostgresLimiter keeps buckets in the rate_limit_buckets table so that every replica
+// shares the same counters
+type PostgresLimiter struct {
+	db *pgxpool.Pool
+
+	mu        sync.Mutex
+	lastSweep time.Time
+}
+
+// NewPostgresLimiter creates a limiter backed by PostgreSQL
+func NewPostgresLimiter(db *pgxpool.Pool) *PostgresLimiter {
+	return &PostgresLimiter{db: db, lastSweep: time.Now()}
+}
+
+// Allow takes a token from the bucket of key in a single statement.
+// The existing row is locked while it is refilled, so concurrent requests on one key
+// are serialized; two requests creating the same key at once may both see a full bucket.
+func (l *PostgresLimiter) Allow(ctx context.Context, key string, policy Policy) (Result, error) {
+	now := time.Now()
+	l.maybeSweep(now)
+
+	var available float64
+	err := l.db.QueryRow(ctx, `
+		WITH prev AS (
+			SELECT tokens, updated_at FROM rate_limit_buckets WHERE key = $1 FOR UPDATE
+		), avail AS (
+			SELECT COALESCE(
+				(SELECT LEAST($2::float8, tokens + GREATEST(0, EXTRACT(EPOCH FROM ($4::timestamptz - updated_at)))::float8 * $3::float8) FROM prev),
+				$2::float8
+			) AS tokens
+		), upsert AS (
+			INSERT INTO rate_limit_buckets (key, tokens, updated_at, expires_at)
+			SELECT $1, CASE WHEN tokens >= 1 THEN tokens - 1 ELSE tokens END, $4, $5 FROM avail
+			ON CONFLICT (key) DO UPDATE
+			SET tokens = EXCLUDED.tokens, updated_at = EXCLUDED.updated_at, expires_at = EXCLUDED.expires_at
+		)
+		SELECT tokens FROM avail
+	`, policy.Name+":"+key, float64(policy.Limit), policy.rate(), now, now.Add(policy.Window)).Scan(&available)
+	if err != nil {
+		return Result{}, err
+	}
+
+	return result(policy, available), nil
+}
+
+// maybeSweep deletes buckets that are full again, at most once per sweepInterval
+func (l *PostgresLimiter) maybeSweep(now time.Time) {
+	l.mu.Lock()
+	if now.Sub(l.lastSweep) < sweepInterval {
+		l.mu.Unlock()
+		return
+	}
+	l.lastSweep = now
+	l.mu.Unlock()
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		if _, err := l.db.Exec(ctx, `DELETE FROM rate_limit_buckets WHERE expires_at < $1`, now); err != nil {
+			log.Printf("Error purging rate limit buckets: %v", err)
+		}
+	}()
+}
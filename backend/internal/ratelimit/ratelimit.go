@@ -0,0 +1,86 @@
+// Package ratelimit implements token-bucket rate limiting with pluggable storage
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Policy allows Limit requests per Window, with bursts of up to Limit requests
+type Policy struct {
+	Name   string
+	Limit  int
+	Window time.Duration
+}
+
+// rate returns the number of tokens refilled per second
+func (p Policy) rate() float64 {
+	return float64(p.Limit) / p.Window.Seconds()
+}
+
+// String formats the policy as in the RateLimit-Policy header: "100;w=60"
+func (p Policy) String() string {
+	return fmt.Sprintf("%d;w=%d", p.Limit, int(math.Ceil(p.Window.Seconds())))
+}
+
+// ParsePolicy parses a policy written as "<limit>/<window>", e.g. "100/1m"
+func ParsePolicy(name, spec string) (Policy, error) {
+	limitStr, windowStr, ok := strings.Cut(strings.TrimSpace(spec), "/")
+	if !ok {
+		return Policy{}, fmt.Errorf("rate limit %s: expected <limit>/<window>, got %q", name, spec)
+	}
+	limit, err := strconv.Atoi(limitStr)
+	if err != nil || limit <= 0 {
+		return Policy{}, fmt.Errorf("rate limit %s: invalid limit %q", name, limitStr)
+	}
+	window, err := time.ParseDuration(windowStr)
+	if err != nil || window <= 0 {
+		return Policy{}, fmt.Errorf("rate limit %s: invalid window %q", name, windowStr)
+	}
+	return Policy{Name: name, Limit: limit, Window: window}, nil
+}
+
+// Result describes the state of a bucket after a request
+type Result struct {
+	Allowed    bool
+	Limit      int
+	Remaining  int
+	Reset      time.Duration // Until the bucket is full again
+	RetryAfter time.Duration // Until the next request is allowed, when denied
+}
+
+// Limiter takes a token from the bucket identified by key
+type Limiter interface {
+	Allow(ctx context.Context, key string, policy Policy) (Result, error)
+}
+
+// result builds the Result of a request that found available tokens in the bucket
+func result(policy Policy, available float64) Result {
+	res := Result{Limit: policy.Limit, Allowed: available >= 1}
+	tokens := available
+	if res.Allowed {
+		tokens--
+	} else {
+		res.RetryAfter = seconds((1 - tokens) / policy.rate())
+	}
+	res.Remaining = int(math.Floor(tokens))
+	res.Reset = seconds((float64(policy.Limit) - tokens) / policy.rate())
+	return res
+}
+
+// refill returns the tokens of a bucket holding tokens at last, at time now
+func refill(policy Policy, tokens float64, last, now time.Time) float64 {
+	elapsed := now.Sub(last).Seconds()
+	if elapsed > 0 {
+		tokens += elapsed * policy.rate()
+	}
+	return math.Min(tokens, float64(policy.Limit))
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
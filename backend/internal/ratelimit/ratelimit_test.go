@@ -0,0 +1,106 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParsePolicy(t *testing.T) {
+	p, err := ParsePolicy("auth", "10/1m")
+	require.NoError(t, err)
+	assert.Equal(t, Policy{Name: "auth", Limit: 10, Window: time.Minute}, p)
+	assert.Equal(t, "10;w=60", p.String())
+
+	for _, spec := range []string{"", "10", "0/1m", "-1/1m", "x/1m", "10/", "10/0s", "10/soon"} {
+		_, err := ParsePolicy("bad", spec)
+		assert.Error(t, err, spec)
+	}
+}
+
+// fakeClock returns a limiter whose clock is advanced by the returned function
+func fakeClock() (*MemoryLimiter, func(time.Duration)) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	l := NewMemoryLimiter()
+	l.now = func() time.Time { return now }
+	l.lastSweep = now
+	return l, func(d time.Duration) { now = now.Add(d) }
+}
+
+func TestMemoryLimiter_Burst(t *testing.T) {
+	l, _ := fakeClock()
+	policy := Policy{Name: "test", Limit: 3, Window: 3 * time.Second}
+	ctx := context.Background()
+
+	for i := 2; i >= 0; i-- {
+		res, err := l.Allow(ctx, "alice", policy)
+		require.NoError(t, err)
+		assert.True(t, res.Allowed)
+		assert.Equal(t, 3, res.Limit)
+		assert.Equal(t, i, res.Remaining)
+	}
+
+	res, err := l.Allow(ctx, "alice", policy)
+	require.NoError(t, err)
+	assert.False(t, res.Allowed)
+	assert.Equal(t, 0, res.Remaining)
+	assert.Equal(t, time.Second, res.RetryAfter)
+	assert.Equal(t, 3*time.Second, res.Reset)
+
+	t.Run("Keys are independent", func(t *testing.T) {
+		res, err := l.Allow(ctx, "bob", policy)
+		require.NoError(t, err)
+		assert.True(t, res.Allowed)
+	})
+
+	t.Run("Policies are independent", func(t *testing.T) {
+		res, err := l.Allow(ctx, "alice", Policy{Name: "other", Limit: 1, Window: time.Minute})
+		require.NoError(t, err)
+		assert.True(t, res.Allowed)
+	})
+}
+
+func TestMemoryLimiter_Refill(t *testing.T) {
+	l, advance := fakeClock()
+	policy := Policy{Name: "test", Limit: 2, Window: 2 * time.Second}
+	ctx := context.Background()
+
+	l.Allow(ctx, "alice", policy)
+	l.Allow(ctx, "alice", policy)
+	res, _ := l.Allow(ctx, "alice", policy)
+	require.False(t, res.Allowed)
+
+	// One token per second
+	advance(500 * time.Millisecond)
+	res, _ = l.Allow(ctx, "alice", policy)
+	assert.False(t, res.Allowed)
+	assert.Equal(t, 500*time.Millisecond, res.RetryAfter)
+
+	advance(500 * time.Millisecond)
+	res, _ = l.Allow(ctx, "alice", policy)
+	assert.True(t, res.Allowed)
+
+	// Never more than the limit
+	advance(time.Hour)
+	res, _ = l.Allow(ctx, "alice", policy)
+	assert.True(t, res.Allowed)
+	assert.Equal(t, 1, res.Remaining)
+}
+
+func TestMemoryLimiter_Eviction(t *testing.T) {
+	l, advance := fakeClock()
+	policy := Policy{Name: "test", Limit: 5, Window: 10 * time.Second}
+	ctx := context.Background()
+
+	for _, key := range []string{"a", "b", "c"} {
+		l.Allow(ctx, key, policy)
+	}
+	assert.Equal(t, 3, l.Len())
+
+	advance(sweepInterval)
+	l.Allow(ctx, "d", policy)
+	assert.Equal(t, 1, l.Len(), "idle buckets are full again and should be evicted")
+}
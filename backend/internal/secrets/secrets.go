@@ -0,0 +1,66 @@
+// Package secrets encrypts the credentials the server must be able to read back, such as
+// the passwords of the calendar accounts of users
+package secrets
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+)
+
+// ErrNoKey is returned when no encryption key is configured
+var ErrNoKey = errors.New("no encryption key configured")
+
+// ErrInvalid is returned when a sealed value was altered, or sealed with another key or context
+var ErrInvalid = errors.New("invalid sealed value")
+
+// version prefixes sealed values, to allow changing the scheme later
+const version = 1
+
+// Box seals values with AES-256-GCM. The key is derived from a configured passphrase.
+type Box struct {
+	aead cipher.AEAD
+}
+
+// NewBox creates a box keyed with passphrase, ErrNoKey when it is empty
+func NewBox(passphrase string) (*Box, error) {
+	if passphrase == "" {
+		return nil, ErrNoKey
+	}
+	key := sha256.Sum256([]byte(passphrase))
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &Box{aead: aead}, nil
+}
+
+// Seal encrypts plaintext. The context (the ID of the owner, for instance) must be given
+// again to open it, so that a sealed value copied to another row cannot be read.
+func (b *Box) Seal(plaintext, context []byte) ([]byte, error) {
+	nonce := make([]byte, b.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	out := append([]byte{version}, nonce...)
+	return b.aead.Seal(out, nonce, plaintext, context), nil
+}
+
+// Open decrypts a value sealed with the same key and context
+func (b *Box) Open(sealed, context []byte) ([]byte, error) {
+	n := b.aead.NonceSize()
+	if len(sealed) < 1+n || sealed[0] != version {
+		return nil, ErrInvalid
+	}
+	plaintext, err := b.aead.Open(nil, sealed[1:1+n], sealed[1+n:], context)
+	if err != nil {
+		return nil, ErrInvalid
+	}
+	return plaintext, nil
+}
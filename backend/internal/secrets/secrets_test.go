@@ -0,0 +1,53 @@
+package secrets
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSealAndOpen(t *testing.T) {
+	box, err := NewBox("a passphrase")
+	require.NoError(t, err)
+
+	sealed, err := box.Seal([]byte("app-password"), []byte("user-1"))
+	require.NoError(t, err)
+	assert.NotContains(t, string(sealed), "app-password")
+
+	plaintext, err := box.Open(sealed, []byte("user-1"))
+	require.NoError(t, err)
+	assert.Equal(t, "app-password", string(plaintext))
+
+	// Each seal uses a new nonce
+	again, err := box.Seal([]byte("app-password"), []byte("user-1"))
+	require.NoError(t, err)
+	assert.NotEqual(t, sealed, again)
+
+	t.Run("Other context", func(t *testing.T) {
+		_, err := box.Open(sealed, []byte("user-2"))
+		assert.ErrorIs(t, err, ErrInvalid)
+	})
+
+	t.Run("Other key", func(t *testing.T) {
+		other, err := NewBox("another passphrase")
+		require.NoError(t, err)
+		_, err = other.Open(sealed, []byte("user-1"))
+		assert.ErrorIs(t, err, ErrInvalid)
+	})
+
+	t.Run("Altered", func(t *testing.T) {
+		altered := append([]byte{}, sealed...)
+		altered[len(altered)-1] ^= 1
+		_, err := box.Open(altered, []byte("user-1"))
+		assert.ErrorIs(t, err, ErrInvalid)
+
+		_, err = box.Open(sealed[:5], []byte("user-1"))
+		assert.ErrorIs(t, err, ErrInvalid)
+	})
+}
+
+func TestNewBoxWithoutKey(t *testing.T) {
+	_, err := NewBox("")
+	assert.ErrorIs(t, err, ErrNoKey)
+}
@@ -0,0 +1,175 @@
+// Package webhooks signs and delivers poll events to the HTTP endpoints of users
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Headers sent with each delivery
+const (
+	HeaderEvent     = "X-Doodle-Event"
+	HeaderDelivery  = "X-Doodle-Delivery"
+	HeaderTimestamp = "X-Doodle-Timestamp"
+	HeaderSignature = "X-Doodle-Signature"
+)
+
+// SecretPrefix starts every webhook secret, to recognize them
+const SecretPrefix = "whsec_"
+
+const (
+	baseBackoff = 30 * time.Second
+	maxBackoff  = 6 * time.Hour
+
+	// Only the start of the response is kept in the delivery log
+	maxResponseBody = 1024
+)
+
+// ErrPrivateAddress is returned when a webhook resolves to an address of the local network
+var ErrPrivateAddress = errors.New("webhook URL resolves to a private address")
+
+// Sign computes the signature of a delivery: the hex HMAC-SHA256 of
+// "<timestamp>.<body>" keyed with the webhook secret, prefixed with "sha256="
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks a signature as receivers should, rejecting timestamps older than tolerance
+func Verify(secret string, timestamp int64, body []byte, signature string, tolerance time.Duration) bool {
+	if tolerance > 0 && time.Since(time.Unix(timestamp, 0)).Abs() > tolerance {
+		return false
+	}
+	return hmac.Equal([]byte(Sign(secret, timestamp, body)), []byte(signature))
+}
+
+// Backoff returns the delay before the next attempt after attempt failed ones:
+// 30s, 1m, 2m, 4m... up to 6h
+func Backoff(attempt int) time.Duration {
+	if attempt < 1 {
+		attempt = 1
+	}
+	delay := float64(baseBackoff) * math.Pow(2, float64(attempt-1))
+	if delay > float64(maxBackoff) {
+		return maxBackoff
+	}
+	return time.Duration(delay)
+}
+
+// ValidateURL checks that a webhook URL is an absolute http(s) URL
+func ValidateURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return err
+	}
+	if u.Scheme != "https" && u.Scheme != "http" {
+		return errors.New("webhook URL must use http or https")
+	}
+	if u.Hostname() == "" {
+		return errors.New("webhook URL must have a host")
+	}
+	if u.User != nil {
+		return errors.New("webhook URL must not contain credentials")
+	}
+	return nil
+}
+
+// NewClient returns the HTTP client used for deliveries. Unless allowPrivate, it refuses
+// to connect to loopback, private and link-local addresses, so webhooks cannot reach
+// internal services; the check runs on the resolved address to defeat DNS tricks.
+func NewClient(timeout time.Duration, allowPrivate bool) *http.Client {
+	dialer := &net.Dialer{Timeout: timeout}
+	if !allowPrivate {
+		dialer.Control = func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			ip := net.ParseIP(host)
+			if ip == nil || isPrivate(ip) {
+				return ErrPrivateAddress
+			}
+			return nil
+		}
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = dialer.DialContext
+	transport.Proxy = nil
+
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: transport,
+		// A redirect could lead anywhere; receivers must answer at the registered URL
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+func isPrivate(ip net.IP) bool {
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsUnspecified() || ip.IsMulticast()
+}
+
+// Delivery is a signed request to a webhook endpoint
+type Delivery struct {
+	ID     string
+	Event  string
+	URL    string
+	Secret string
+	Body   []byte
+}
+
+// Result describes the answer of the receiver
+type Result struct {
+	StatusCode int
+	Body       string
+}
+
+// Deliver posts a delivery. Any answer other than 2xx is an error; the result is
+// returned along with it when the receiver answered.
+func Deliver(ctx context.Context, client *http.Client, d Delivery) (Result, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.URL, bytes.NewReader(d.Body))
+	if err != nil {
+		return Result{}, err
+	}
+
+	timestamp := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Doodle-Clone-Webhooks/1.0")
+	req.Header.Set(HeaderEvent, d.Event)
+	req.Header.Set(HeaderDelivery, d.ID)
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(HeaderSignature, Sign(d.Secret, timestamp, d.Body))
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return Result{}, err
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxResponseBody))
+	result := Result{StatusCode: resp.StatusCode, Body: strings.ToValidUTF8(string(body), "")}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return result, fmt.Errorf("receiver answered %d", resp.StatusCode)
+	}
+	return result, nil
+}
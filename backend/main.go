@@ -15,9 +15,14 @@ import (
 	"doodle-clone/internal/config"
 	"doodle-clone/internal/database"
 	"doodle-clone/internal/email"
+	"doodle-clone/internal/events"
 	"doodle-clone/internal/handlers"
+	"doodle-clone/internal/jwtkeys"
 	"doodle-clone/internal/middleware"
 	"doodle-clone/internal/models"
+	"doodle-clone/internal/notify"
+	"doodle-clone/internal/outbox"
+	"doodle-clone/internal/ratelimit"
 
 	_ "doodle-clone/docs"
 )
@@ -47,6 +52,14 @@ func main() {
 	if err := config.Load(); err != nil {
 		log.Fatalf("Failed to load config: %v", err)
 	}
+	if err := config.Validate(); err != nil {
+		log.Fatalf("Refusing to start: %v", err)
+	}
+
+	// Load JWT signing keys
+	if err := jwtkeys.Init(); err != nil {
+		log.Fatalf("Failed to load JWT signing keys: %v", err)
+	}
 
 	// Set Gin mode
 	if config.IsProduction() {
@@ -69,14 +82,23 @@ func main() {
 	initNotificationSettings()
 
 	// Create router
-	r := gin.Default()
+	// gin's logger would write the credentials of query strings, such as calendar feed tokens
+	r := gin.New()
+	r.Use(middleware.Logger(), gin.Recovery())
+	// Client IPs (rate limits, login throttling, audit) only come from X-Forwarded-For
+	// when the request went through a trusted proxy
+	if err := r.SetTrustedProxies(config.AppConfig.TrustedProxies); err != nil {
+		log.Fatalf("Invalid TRUSTED_PROXIES: %v", err)
+	}
 
 	// Global middleware
+	r.Use(middleware.RequestID())
 	r.Use(middleware.CORS())
 	r.Use(middleware.ErrorHandler())
 
-	// Rate limiting for public endpoints
-	r.Use(middleware.RateLimit(100, 60)) // 100 requests per minute
+	// Rate limiting: a default policy for every route, stricter ones on sensitive groups
+	limiter, policies := setupRateLimiting()
+	r.Use(middleware.RateLimit(limiter, policies.Default))
 
 	// Health check
 	r.GET("/health", func(c *gin.Context) {
@@ -95,20 +117,62 @@ func main() {
 	voteHandler := handlers.NewVoteHandler(database.Pool)
 	commentHandler := handlers.NewCommentHandler(database.Pool)
 	exportHandler := handlers.NewExportHandler(database.Pool)
+	calendarHandler := handlers.NewCalendarHandler(database.Pool)
+	auditHandler := handlers.NewAuditHandler(database.Pool)
 
-	// Create email sender
-	emailSender := email.NewSender()
+	// Notification backends, routed per notification type
+	notifier, err := notify.FromConfig()
+	if err != nil {
+		log.Fatalf("Invalid notification configuration: %v", err)
+	}
+	log.Printf("Notifications sent through %s", notify.Describe())
+
+	// Email templates, checked at startup so a broken override fails fast
+	templates, err := email.LoadTemplates(config.AppConfig.EmailTemplatesDir, config.AppConfig.EmailLocale)
+	if err != nil {
+		log.Fatalf("Invalid email templates: %v", err)
+	}
 
 	// Create notification handler and start background worker
-	notificationHandler := handlers.NewNotificationHandler(database.Pool, emailSender)
+	notificationHandler := handlers.NewNotificationHandler(database.Pool, notifier, templates)
 	notificationHandler.StartBackgroundWorker()
 	defer notificationHandler.StopBackgroundWorker()
 
-	// Link notification handler to poll handler
-	pollHandler.SetNotificationHandler(notificationHandler)
+	// Purge expired refresh tokens alongside the notification worker
+	authHandler.StartTokenCleanup()
+	defer authHandler.StopTokenCleanup()
+
+	// Lockout notifications
+	authHandler.SetNotifier(notifier, templates)
+
+	// Live poll events, shared between replicas through LISTEN/NOTIFY
+	eventBroker := events.NewBroker()
+	eventBroker.Start(database.Pool)
+	defer eventBroker.Stop()
+	eventHandler := handlers.NewEventHandler(database.Pool, eventBroker)
+
+	// Webhook deliveries, claimed with SKIP LOCKED so replicas share the queue
+	webhookHandler := handlers.NewWebhookHandler(database.Pool)
+	webhookHandler.StartDispatcher()
+	defer webhookHandler.StopDispatcher()
+
+	// CalDAV calendars, synced periodically to auto-fill votes (needs CALDAV_ENCRYPTION_KEY)
+	caldavHandler := handlers.NewCalDAVHandler(database.Pool)
+	caldavHandler.StartSync()
+	defer caldavHandler.StopSync()
+
+	// Poll events are recorded with their change, then relayed by a single replica
+	relay := outbox.NewRelay(database.Pool, config.AppConfig.OutboxInterval, config.AppConfig.OutboxMaxAttempts, config.AppConfig.OutboxRetention,
+		handlers.RelayHandlers(notificationHandler)...)
+	relay.Start()
+	defer relay.Stop()
+
+	// Public keys for verifying access tokens in other services
+	r.GET("/.well-known/jwks.json", authHandler.JWKS)
 
 	// Google OAuth routes (without /api prefix for compatibility)
 	google := r.Group("/auth")
+	google.Use(middleware.RateLimit(limiter, policies.Auth))
 	{
 		google.GET("/google/login", authHandler.GoogleLogin)
 		google.GET("/google/callback", authHandler.GoogleCallback)
@@ -119,59 +183,140 @@ func main() {
 	{
 		// Auth routes (public)
 		auth := api.Group("/auth")
+		auth.Use(middleware.RateLimit(limiter, policies.Auth))
 		{
 			auth.POST("/register", authHandler.Register)
 			auth.POST("/login", authHandler.Login)
 			auth.POST("/refresh", authHandler.Refresh)
 			auth.POST("/logout", authHandler.Logout)
 			auth.GET("/me", middleware.Auth(), authHandler.GetMe)
-			auth.PUT("/profile", middleware.Auth(), authHandler.UpdateProfile)
-			auth.PUT("/password", middleware.Auth(), authHandler.ChangePassword)
+			auth.PUT("/profile", middleware.Auth(), middleware.RequireSession(), authHandler.UpdateProfile)
+			auth.PUT("/password", middleware.Auth(), middleware.RequireSession(), authHandler.ChangePassword)
+			auth.GET("/sessions", middleware.Auth(), middleware.RequireSession(), authHandler.ListSessions)
+			auth.DELETE("/sessions", middleware.Auth(), middleware.RequireSession(), authHandler.RevokeOtherSessions)
+			auth.DELETE("/sessions/:sessionId", middleware.Auth(), middleware.RequireSession(), authHandler.RevokeSession)
 
 			// Google OAuth (also under /api)
 			auth.GET("/google/login", authHandler.GoogleLogin)
 			auth.GET("/google/callback", authHandler.GoogleCallback)
 		}
 
-		// Public poll access
+		// Public poll access (password-protected polls need a poll access token)
+		pollAccess := middleware.RequirePollAccess()
 		api.GET("/polls", pollHandler.ListPolls)
-		api.GET("/polls/:id", pollHandler.GetPoll)
-		api.GET("/polls/:id/votes", voteHandler.GetVotes)
-		api.GET("/polls/:id/comments", commentHandler.GetComments)
+		api.POST("/polls/:id/unlock", middleware.RateLimit(limiter, policies.Auth), pollHandler.UnlockPoll)
 
-		// Exports (public)
-		api.GET("/polls/:id/export/pdf", exportHandler.ExportPDF)
-		api.GET("/polls/:id/export/ics", exportHandler.ExportICS)
-		api.GET("/polls/:id/export/csv", exportHandler.ExportCSV)
+		// Calendar subscription, authenticated by its own token in the URL
+		api.GET("/user/calendar.ics", calendarHandler.CalendarFeed)
+
+		publicPoll := api.Group("")
+		publicPoll.Use(middleware.OptionalAuth(), pollAccess)
+		{
+			publicPoll.GET("/polls/:id", pollHandler.GetPoll)
+			publicPoll.GET("/polls/:id/votes", voteHandler.GetVotes)
+			publicPoll.GET("/polls/:id/comments", commentHandler.GetComments)
+			publicPoll.GET("/polls/:id/events", eventHandler.StreamPollEvents)
+			publicPoll.GET("/polls/:id/vote/challenge", middleware.RateLimit(limiter, policies.Vote), voteHandler.GetVoteChallenge)
+			publicPoll.POST("/polls/:id/dates/busy", middleware.RateLimit(limiter, policies.Vote), pollHandler.CheckBusyDates)
+
+			// Exports (public)
+			publicPoll.GET("/polls/:id/export/pdf", exportHandler.ExportPDF)
+			publicPoll.GET("/polls/:id/export/ics", exportHandler.ExportICS)
+			publicPoll.GET("/polls/:id/export/csv", exportHandler.ExportCSV)
+		}
 
 		// Protected routes (require authentication)
 		protected := api.Group("")
 		protected.Use(middleware.Auth())
 		{
 			// Polls
-			protected.POST("/polls", pollHandler.CreatePoll)
-			protected.PUT("/polls/:id", pollHandler.UpdatePoll)
-			protected.DELETE("/polls/:id", pollHandler.DeletePoll)
-			protected.POST("/polls/:id/final", pollHandler.SetFinalDate)
-			protected.POST("/polls/:id/dates", pollHandler.AddDateOption)
+			pollsWrite := middleware.RequireScope(models.ScopePollsWrite)
+			protected.POST("/polls", pollsWrite, pollHandler.CreatePoll)
+			protected.PUT("/polls/:id", pollsWrite, pollHandler.UpdatePoll)
+			protected.DELETE("/polls/:id", pollsWrite, pollHandler.DeletePoll)
+			protected.POST("/polls/:id/final", pollsWrite, pollHandler.SetFinalDate)
+			protected.POST("/polls/:id/dates", pollsWrite, pollHandler.AddDateOption)
+			protected.POST("/polls/:id/dates/import", pollsWrite, pollHandler.ImportDateOptions)
 
 			// Votes
-			protected.POST("/polls/:id/votes", voteHandler.CreateVote)
-			protected.PUT("/polls/:id/votes/:voteId", voteHandler.UpdateVote)
-			protected.DELETE("/polls/:id/votes/:voteId", voteHandler.DeleteVote)
+			votesWrite := middleware.RequireScope(models.ScopeVotesWrite)
+			protected.POST("/polls/:id/votes", votesWrite, pollAccess, voteHandler.CreateVote)
+			protected.PUT("/polls/:id/votes/:voteId", votesWrite, pollAccess, voteHandler.UpdateVote)
+			protected.DELETE("/polls/:id/votes/:voteId", votesWrite, pollAccess, voteHandler.DeleteVote)
+
+			// Anti-spam protections and moderation of anonymous ballots (poll creator only)
+			protected.GET("/polls/:id/protection", pollsWrite, voteHandler.GetPollProtection)
+			protected.PUT("/polls/:id/protection", pollsWrite, voteHandler.UpdatePollProtection)
+			protected.GET("/polls/:id/moderation", pollsWrite, voteHandler.ListBallots)
+			protected.PUT("/polls/:id/moderation/:ballotId", pollsWrite, voteHandler.FlagBallot)
+			protected.DELETE("/polls/:id/moderation/:ballotId", pollsWrite, voteHandler.DeleteBallot)
+
+			// Poll activity feed and version history (poll creator only)
+			protected.GET("/polls/:id/activity", pollsWrite, auditHandler.GetPollActivity)
+			protected.GET("/polls/:id/versions", pollsWrite, pollHandler.ListPollVersions)
+			protected.GET("/polls/:id/versions/:version", pollsWrite, pollHandler.GetPollVersion)
+			protected.GET("/polls/:id/versions/:version/diff", pollsWrite, pollHandler.DiffPollVersion)
+			protected.POST("/polls/:id/versions/:version/revert", pollsWrite, pollHandler.RevertPollVersion)
 
 			// Comments
-			protected.POST("/polls/:id/comments", commentHandler.CreateComment)
-			protected.PUT("/polls/:id/comments/:commentId", commentHandler.UpdateComment)
-			protected.DELETE("/polls/:id/comments/:commentId", commentHandler.DeleteComment)
+			commentsWrite := middleware.RequireScope(models.ScopeCommentsWrite)
+			protected.POST("/polls/:id/comments", commentsWrite, pollAccess, commentHandler.CreateComment)
+			protected.PUT("/polls/:id/comments/:commentId", commentsWrite, pollAccess, commentHandler.UpdateComment)
+			protected.DELETE("/polls/:id/comments/:commentId", commentsWrite, pollAccess, commentHandler.DeleteComment)
 
 			// User dashboard
-			protected.GET("/user/polls", pollHandler.GetUserPolls)
-			protected.GET("/user/votes", voteHandler.GetUserVotes)
+			protected.GET("/user/polls", middleware.RequireScope(models.ScopePollsRead), pollHandler.GetUserPolls)
+			protected.GET("/user/votes", middleware.RequireScope(models.ScopeVotesRead), voteHandler.GetUserVotes)
+
+			// Account data export and deletion (interactive sessions only)
+			protected.GET("/user/export", middleware.RequireSession(), authHandler.ExportAccount)
+			protected.DELETE("/user", middleware.RequireSession(), authHandler.DeleteAccount)
+
+			// Personal access tokens (interactive sessions only)
+			protected.GET("/user/tokens", middleware.RequireSession(), authHandler.ListAccessTokens)
+			protected.POST("/user/tokens", middleware.RequireSession(), authHandler.CreateAccessToken)
+			protected.DELETE("/user/tokens/:tokenId", middleware.RequireSession(), authHandler.RevokeAccessToken)
+
+			// Calendar subscription (interactive sessions only)
+			protected.GET("/user/calendar/feed", middleware.RequireSession(), calendarHandler.GetCalendarFeed)
+			protected.POST("/user/calendar/feed", middleware.RequireSession(), calendarHandler.CreateCalendarFeed)
+			protected.DELETE("/user/calendar/feed", middleware.RequireSession(), calendarHandler.RevokeCalendarFeed)
+
+			// CalDAV calendar (interactive sessions only)
+			protected.GET("/user/caldav", middleware.RequireSession(), caldavHandler.GetCalDAVAccount)
+			protected.PUT("/user/caldav", middleware.RequireSession(), caldavHandler.ConnectCalDAV)
+			protected.DELETE("/user/caldav", middleware.RequireSession(), caldavHandler.DisconnectCalDAV)
+			protected.POST("/user/caldav/sync", middleware.RequireSession(), caldavHandler.SyncCalDAV)
+			protected.GET("/polls/:id/availability", middleware.RequireSession(), pollAccess, caldavHandler.GetPollAvailability)
+
+			// Notification center (interactive sessions only)
+			protected.GET("/user/notifications", middleware.RequireSession(), notificationHandler.ListInbox)
+			protected.GET("/user/notifications/unread-count", middleware.RequireSession(), notificationHandler.CountUnreadInbox)
+			protected.POST("/user/notifications/read-all", middleware.RequireSession(), notificationHandler.MarkAllInboxRead)
+			protected.POST("/user/notifications/:notificationId/read", middleware.RequireSession(), notificationHandler.MarkInboxRead)
+			protected.GET("/user/notifications/preferences", middleware.RequireSession(), notificationHandler.GetNotificationPreferences)
+			protected.PUT("/user/notifications/preferences", middleware.RequireSession(), notificationHandler.UpdateNotificationPreferences)
+
+			// Webhooks (interactive sessions only)
+			protected.GET("/user/webhooks", middleware.RequireSession(), webhookHandler.ListWebhooks)
+			protected.POST("/user/webhooks", middleware.RequireSession(), webhookHandler.CreateWebhook)
+			protected.PUT("/user/webhooks/:webhookId", middleware.RequireSession(), webhookHandler.UpdateWebhook)
+			protected.DELETE("/user/webhooks/:webhookId", middleware.RequireSession(), webhookHandler.DeleteWebhook)
+			protected.GET("/user/webhooks/:webhookId/deliveries", middleware.RequireSession(), webhookHandler.ListWebhookDeliveries)
+			protected.POST("/user/webhooks/:webhookId/deliveries/:deliveryId/redeliver", middleware.RequireSession(), webhookHandler.RedeliverWebhook)
 
 			// Notification settings (admin only)
-			protected.GET("/notifications/settings", notificationHandler.GetNotificationSettings)
-			protected.PUT("/notifications/settings", notificationHandler.UpdateNotificationSetting)
+			protected.GET("/notifications/settings", middleware.RequireSession(), notificationHandler.GetNotificationSettings)
+			protected.PUT("/notifications/settings", middleware.RequireSession(), notificationHandler.UpdateNotificationSetting)
+			protected.GET("/admin/notifications", middleware.RequireSession(), notificationHandler.ListNotifications)
+			protected.POST("/admin/notifications/requeue", middleware.RequireSession(), notificationHandler.RequeueFailedNotifications)
+			protected.POST("/admin/notifications/:notificationId/requeue", middleware.RequireSession(), notificationHandler.RequeueNotification)
+			protected.GET("/admin/emails/preview", middleware.RequireSession(), notificationHandler.PreviewEmail)
+			protected.POST("/admin/emails/test", middleware.RequireSession(), notificationHandler.SendTestEmail)
+			protected.GET("/admin/emails/diagnostics", middleware.RequireSession(), notificationHandler.EmailDiagnostics)
+
+			// Audit log (admin only)
+			protected.GET("/admin/audit", middleware.RequireSession(), auditHandler.ListAuditLog)
 		}
 
 		// Routes that support optional auth (can work with or without login)
@@ -179,7 +324,8 @@ func main() {
 		optionalAuth.Use(middleware.OptionalAuth())
 		{
 			// Votes with optional auth (for anonymous voting)
-			optionalAuth.POST("/polls/:id/vote", voteHandler.CreateVote)
+			optionalAuth.POST("/polls/:id/vote", middleware.RateLimit(limiter, policies.Vote),
+				middleware.RequireScope(models.ScopeVotesWrite), pollAccess, voteHandler.CreateVote)
 		}
 	}
 
@@ -218,9 +364,10 @@ func init() {
 	// Set up custom log format
 	log.SetFlags(log.LstdFlags | log.Lshortfile)
 
-	// Check for required env vars in production
+	// Check for required env vars in production. JWT_SECRET is only needed while legacy
+	// HS256 tokens are accepted, which config.Validate checks.
 	if os.Getenv("ENVIRONMENT") == "production" {
-		required := []string{"DB_HOST", "DB_NAME", "DB_USER", "DB_PASSWORD", "JWT_SECRET"}
+		required := []string{"DB_HOST", "DB_NAME", "DB_USER", "DB_PASSWORD"}
 		for _, env := range required {
 			if os.Getenv(env) == "" {
 				log.Printf("Warning: Required environment variable %s is not set", env)
@@ -244,11 +391,13 @@ func initNotificationSettings() {
 	defer cancel()
 
 	defaultSettings := map[string]string{
-		models.SettingReminderEnabled:   "true",
-		models.SettingReminderHours:     "1",
-		models.SettingNewVoteEnabled:    "false",
-		models.SettingNewCommentEnabled: "false",
-		models.SettingFinalDateEnabled:  "true",
+		models.SettingReminderEnabled:    "true",
+		models.SettingReminderHours:      "1",
+		models.SettingNewVoteEnabled:     "false",
+		models.SettingNewCommentEnabled:  "false",
+		models.SettingFinalDateEnabled:   "true",
+		models.SettingPollChangedEnabled: "true",
+		models.SettingChatEnabled:        "true",
 	}
 
 	for key, value := range defaultSettings {
@@ -270,14 +419,49 @@ func initNotificationSettings() {
 
 func getDescriptionForKey(key string) string {
 	descriptions := map[string]string{
-		models.SettingReminderEnabled:   "Enable reminder notifications before events",
-		models.SettingReminderHours:     "Hours before event to send reminder",
-		models.SettingNewVoteEnabled:    "Enable notifications when someone votes",
-		models.SettingNewCommentEnabled: "Enable notifications when someone comments",
-		models.SettingFinalDateEnabled:  "Enable notifications when final date is set",
+		models.SettingReminderEnabled:    "Enable reminder notifications before events",
+		models.SettingReminderHours:      "Hours before event to send reminder",
+		models.SettingNewVoteEnabled:     "Enable notifications when someone votes",
+		models.SettingNewCommentEnabled:  "Enable notifications when someone comments",
+		models.SettingFinalDateEnabled:   "Enable notifications when final date is set",
+		models.SettingPollChangedEnabled: "Enable notifications when a reverted poll changes its date options",
+		models.SettingChatEnabled:        "Post poll summaries to the chat webhook (CHAT_WEBHOOK_URL)",
 	}
 	if desc, ok := descriptions[key]; ok {
 		return desc
 	}
 	return ""
 }
+
+// rateLimitPolicies are the rate limits applied per route group
+type rateLimitPolicies struct {
+	Default ratelimit.Policy
+	Auth    ratelimit.Policy
+	Vote    ratelimit.Policy
+}
+
+// setupRateLimiting creates the configured rate limiter backend and parses the policies
+func setupRateLimiting() (ratelimit.Limiter, rateLimitPolicies) {
+	var policies rateLimitPolicies
+	var err error
+	if policies.Default, err = ratelimit.ParsePolicy("default", config.AppConfig.RateLimitDefault); err != nil {
+		log.Fatalf("Invalid RATE_LIMIT_DEFAULT: %v", err)
+	}
+	if policies.Auth, err = ratelimit.ParsePolicy("auth", config.AppConfig.RateLimitAuth); err != nil {
+		log.Fatalf("Invalid RATE_LIMIT_AUTH: %v", err)
+	}
+	if policies.Vote, err = ratelimit.ParsePolicy("vote", config.AppConfig.RateLimitVote); err != nil {
+		log.Fatalf("Invalid RATE_LIMIT_VOTE: %v", err)
+	}
+
+	switch config.AppConfig.RateLimitBackend {
+	case "postgres":
+		log.Println("Rate limiting with the PostgreSQL backend")
+		return ratelimit.NewPostgresLimiter(database.Pool), policies
+	case "memory", "":
+		return ratelimit.NewMemoryLimiter(), policies
+	default:
+		log.Fatalf("Unknown RATE_LIMIT_BACKEND %q (expected memory or postgres)", config.AppConfig.RateLimitBackend)
+		return nil, policies
+	}
+}